@@ -0,0 +1,83 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/context/ctxhttp"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// AlertWebhook is a URL alert notifications are POSTed to, as JSON.
+type AlertWebhook struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+func (w AlertWebhook) check() error {
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid URL %q: needs to be http or https", w.URL)
+	}
+	return nil
+}
+
+// WebhookNotifier notifies webhooks of alerts.
+type WebhookNotifier struct {
+	webhooks []AlertWebhook
+	client   *http.Client
+}
+
+// NewWebhookNotifier makes a new WebhookNotifier.
+func NewWebhookNotifier(webhooks []AlertWebhook) *WebhookNotifier {
+	return &WebhookNotifier{
+		webhooks: webhooks,
+		client:   &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// Notify implements AlertNotifier, POSTing the notification to every
+// webhook. It returns the first error, if any, having tried them all.
+func (n *WebhookNotifier) Notify(ctx context.Context, notification AlertNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, w := range n.webhooks {
+		if err := postJSON(ctx, n.client, w.URL, w.Headers, body); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// postJSON POSTs a JSON body to a webhook.
+func postJSON(ctx context.Context, client *http.Client, webhookURL string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequest("POST", webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := ctxhttp.Do(ctx, client, req)
+	if err != nil {
+		return fmt.Errorf("error posting to %s: %v", webhookURL, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("error posting to %s: %s", webhookURL, resp.Status)
+	}
+	return nil
+}
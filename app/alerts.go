@@ -0,0 +1,580 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+// States of alerts.
+const (
+	AlertPending  = "pending"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// Alerts are evaluated on every new report, but no more often than this.
+const alertMinInterval = time.Second
+
+// Notifications waiting to be sent; more are dropped, rather than holding
+// up evaluating alerts.
+const alertQueueSize = 64
+
+// AlertConfig is the set of alerting rules, and the webhooks notified when
+// their alerts fire and resolve.
+type AlertConfig struct {
+	Rules    []AlertRule    `json:"rules"`
+	Webhooks []AlertWebhook `json:"webhooks,omitempty"`
+}
+
+// AlertRule raises an alert for every node of a topology matching its
+// condition, once it has done so for the rule's duration. Exactly one of
+// Metric, Transition and Egress is set.
+type AlertRule struct {
+	Name     string `json:"name"`
+	Severity string `json:"severity,omitempty"`
+	// Topology is the ID of the rendered topology the rule applies to,
+	// e.g. containers or hosts.
+	Topology string `json:"topology"`
+	// For is how long the condition must hold before the alert fires, as
+	// a Go duration, e.g. 5m. It fires straight away if empty.
+	For string `json:"for,omitempty"`
+
+	Metric     *MetricCondition     `json:"metric,omitempty"`
+	Transition *TransitionCondition `json:"transition,omitempty"`
+	Egress     *EgressCondition     `json:"egress,omitempty"`
+
+	forDuration time.Duration
+}
+
+// MetricCondition holds when the last sample of a metric is above or below
+// a threshold.
+type MetricCondition struct {
+	Name  string   `json:"name"`
+	Above *float64 `json:"above,omitempty"`
+	Below *float64 `json:"below,omitempty"`
+}
+
+// TransitionCondition holds when a node's value for Key changes from From
+// (or anything, if empty) to To, until it changes again, e.g. a container
+// going from running to exited.
+type TransitionCondition struct {
+	Key  string `json:"key"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+}
+
+// EgressCondition holds when a node connects to external nodes which aren't
+// allowed. Allow lists the names of external services, e.g. those of the
+// external service catalogue, or DNS suffixes of them; the Internet at
+// large is only allowed by AllowInternet.
+type EgressCondition struct {
+	Allow         []string `json:"allow,omitempty"`
+	AllowInternet bool     `json:"allowInternet,omitempty"`
+}
+
+// Alert is raised by a rule for a node.
+type Alert struct {
+	Rule       string    `json:"rule"`
+	Severity   string    `json:"severity,omitempty"`
+	State      string    `json:"state"`
+	Topology   string    `json:"topology"`
+	NodeID     string    `json:"nodeId"`
+	Label      string    `json:"label"`
+	Summary    string    `json:"summary"`
+	ActiveAt   time.Time `json:"activeAt"`
+	FiredAt    time.Time `json:"firedAt"`
+	ResolvedAt time.Time `json:"resolvedAt"`
+}
+
+// LoadAlertConfig loads the alert config in path.
+func LoadAlertConfig(path string) (AlertConfig, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return AlertConfig{}, err
+	}
+	return ParseAlertConfig(buf)
+}
+
+// ParseAlertConfig parses a YAML or JSON alert config, checking its rules
+// and webhooks.
+func ParseAlertConfig(buf []byte) (AlertConfig, error) {
+	var c AlertConfig
+	if err := yaml.Unmarshal(buf, &c); err != nil {
+		return AlertConfig{}, err
+	}
+	names := map[string]struct{}{}
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if r.Name == "" {
+			return AlertConfig{}, fmt.Errorf("alert rule %d has no name", i)
+		}
+		if _, ok := names[r.Name]; ok {
+			return AlertConfig{}, fmt.Errorf("alert rule %q defined more than once", r.Name)
+		}
+		names[r.Name] = struct{}{}
+		if err := r.check(); err != nil {
+			return AlertConfig{}, fmt.Errorf("alert rule %q: %v", r.Name, err)
+		}
+	}
+	for i, w := range c.Webhooks {
+		if err := w.check(); err != nil {
+			return AlertConfig{}, fmt.Errorf("webhook %d: %v", i, err)
+		}
+	}
+	return c, nil
+}
+
+func (r *AlertRule) check() error {
+	if _, ok := topologyRegistry.get(r.Topology); !ok {
+		return fmt.Errorf("unknown topology %q", r.Topology)
+	}
+	if r.For != "" {
+		d, err := time.ParseDuration(r.For)
+		if err != nil {
+			return err
+		}
+		r.forDuration = d
+	}
+	conditions := 0
+	if r.Metric != nil {
+		conditions++
+		if r.Metric.Name == "" {
+			return fmt.Errorf("metric condition has no name")
+		}
+		if r.Metric.Above == nil && r.Metric.Below == nil {
+			return fmt.Errorf("metric condition needs a threshold to be above or below")
+		}
+	}
+	if r.Transition != nil {
+		conditions++
+		if r.Transition.Key == "" || r.Transition.To == "" {
+			return fmt.Errorf("transition condition needs a key and the value it changes to")
+		}
+	}
+	if r.Egress != nil {
+		conditions++
+	}
+	if conditions != 1 {
+		return fmt.Errorf("needs exactly one of metric, transition and egress conditions, has %d", conditions)
+	}
+	return nil
+}
+
+type alertKey struct {
+	rule, node string
+}
+
+// alertState is what the Alerter knows of a rule's condition for a node.
+type alertState struct {
+	// active is whether the condition holds; the alert fires once it has
+	// for the rule's duration.
+	active bool
+	alert  Alert
+
+	// the last value of the key of a transition condition
+	last string
+	seen bool
+}
+
+// evaluate returns whether the rule's condition holds for n, and, if it
+// does, a summary of why. The summary is empty if it is unchanged.
+func (r *AlertRule) evaluate(n report.Node, state *alertState) (bool, string) {
+	switch {
+	case r.Metric != nil:
+		metric, ok := n.Metrics[r.Metric.Name]
+		if !ok {
+			return false, ""
+		}
+		sample, ok := metric.LastSample()
+		if !ok {
+			return false, ""
+		}
+		value := strconv.FormatFloat(sample.Value, 'f', -1, 64)
+		if r.Metric.Above != nil && sample.Value > *r.Metric.Above {
+			return true, fmt.Sprintf("%s is %s, above %v", r.Metric.Name, value, *r.Metric.Above)
+		}
+		if r.Metric.Below != nil && sample.Value < *r.Metric.Below {
+			return true, fmt.Sprintf("%s is %s, below %v", r.Metric.Name, value, *r.Metric.Below)
+		}
+		return false, ""
+
+	case r.Transition != nil:
+		value, _ := n.Latest.Lookup(r.Transition.Key)
+		last, seen := state.last, state.seen
+		state.last, state.seen = value, true
+		if state.active {
+			return value == r.Transition.To, ""
+		}
+		if !seen || value == last || value != r.Transition.To {
+			return false, ""
+		}
+		if r.Transition.From != "" && last != r.Transition.From {
+			return false, ""
+		}
+		return true, fmt.Sprintf("%s changed from %q to %q", r.Transition.Key, last, value)
+
+	case r.Egress != nil:
+		denied := []string{}
+		for _, id := range n.Adjacency {
+			if name, ok := r.Egress.deniedExternalNode(id); ok {
+				denied = append(denied, name)
+			}
+		}
+		if len(denied) == 0 {
+			return false, ""
+		}
+		sort.Strings(denied)
+		return true, "connects to " + strings.Join(denied, ", ")
+	}
+	return false, ""
+}
+
+// deniedExternalNode returns the name of the external node with the given
+// rendered ID, if it is one and isn't allowed.
+func (e *EgressCondition) deniedExternalNode(id string) (string, bool) {
+	if id == render.OutgoingInternetID {
+		return "the Internet", !e.AllowInternet
+	}
+	if !strings.HasPrefix(id, render.ServiceNodeIDPrefix) {
+		return "", false
+	}
+	name := strings.TrimPrefix(id, render.ServiceNodeIDPrefix)
+	for _, allowed := range e.Allow {
+		if name == allowed || strings.HasSuffix(name, "."+allowed) {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// AlertNotifier is told about alerts firing and resolving.
+type AlertNotifier interface {
+	Notify(ctx context.Context, n AlertNotification) error
+}
+
+// AlertNotification tells notifiers about alerts which have all just fired,
+// or all just resolved.
+type AlertNotification struct {
+	Status string  `json:"status"`
+	Alerts []Alert `json:"alerts"`
+}
+
+// Alerter evaluates alerting rules against the reports of a Reporter, and
+// notifies its notifiers of alerts firing and resolving, in the background.
+// Each alert is notified once when it fires, and once when it resolves.
+//
+// The reports are those of a single user, so multitenant Reporters aren't
+// supported.
+type Alerter struct {
+	reporter      Reporter
+	rules         []AlertRule
+	notifiers     []AlertNotifier
+	interval      time.Duration
+	services      *ExternalServices
+	notifications chan AlertNotification
+	quit          chan struct{}
+	done          chan struct{}
+	notified      chan struct{}
+
+	mtx    sync.Mutex
+	states map[alertKey]*alertState
+}
+
+// NewAlerter makes a new Alerter, which evaluates the rules on every new
+// report, and at least every interval so that rule durations elapse
+// without new reports.
+func NewAlerter(reporter Reporter, rules []AlertRule, notifiers []AlertNotifier, interval time.Duration) *Alerter {
+	return &Alerter{
+		reporter:      reporter,
+		rules:         rules,
+		notifiers:     notifiers,
+		interval:      interval,
+		notifications: make(chan AlertNotification, alertQueueSize),
+		quit:          make(chan struct{}),
+		done:          make(chan struct{}),
+		notified:      make(chan struct{}),
+		states:        map[alertKey]*alertState{},
+	}
+}
+
+// RenderWith makes the alerter render topologies with the external service
+// catalogue held by e. It has to be called before Start.
+func (a *Alerter) RenderWith(e *ExternalServices) {
+	a.services = e
+}
+
+// Start evaluating the rules in the background.
+func (a *Alerter) Start() {
+	go a.loop()
+	go a.notifyLoop()
+}
+
+// Stop evaluating the rules, once the notifications queued have been sent.
+func (a *Alerter) Stop() {
+	close(a.quit)
+	<-a.done
+	close(a.notifications)
+	<-a.notified
+}
+
+func (a *Alerter) loop() {
+	defer close(a.done)
+	var (
+		// There is no user to get the reports of, as the Reporter isn't
+		// multitenant.
+		ctx    = context.Background()
+		wait   = make(chan struct{}, 1)
+		ticker = time.NewTicker(a.interval)
+	)
+	defer ticker.Stop()
+	a.reporter.WaitOn(ctx, wait)
+	defer a.reporter.UnWait(ctx, wait)
+
+	for {
+		now := time.Now()
+		rpt, err := a.reporter.Report(ctx, now)
+		if err != nil {
+			log.Errorf("Error getting report to evaluate alerts: %v", err)
+		} else {
+			for _, n := range a.Evaluate(a.services.Context(ctx), rpt, now) {
+				a.queue(n)
+			}
+		}
+
+		select {
+		case <-time.After(alertMinInterval):
+		case <-a.quit:
+			return
+		}
+		select {
+		case <-wait:
+		case <-ticker.C:
+		case <-a.quit:
+			return
+		}
+	}
+}
+
+// renderedAlertNodes are the nodes of a rendered topology alerts are
+// raised for, and their labels.
+type renderedAlertNodes struct {
+	nodes  report.Nodes
+	labels map[string]string
+}
+
+// renderAlertNodes renders the topologies of the rules.
+func (a *Alerter) renderAlertNodes(ctx context.Context, rpt report.Report) map[string]renderedAlertNodes {
+	rendered := map[string]renderedAlertNodes{}
+	for _, rule := range a.rules {
+		if _, ok := rendered[rule.Topology]; ok {
+			continue
+		}
+		desc, ok := topologyRegistry.get(rule.Topology)
+		if !ok {
+			continue
+		}
+		r := renderedAlertNodes{
+			nodes:  render.Render(ctx, rpt, desc.renderer, render.Transformers(nil)).Nodes,
+			labels: map[string]string{},
+		}
+		for id, n := range r.nodes {
+			if n.Topology != render.Pseudo {
+				r.labels[id] = nodeLabel(rpt, n)
+			}
+		}
+		rendered[rule.Topology] = r
+	}
+	return rendered
+}
+
+// Evaluate evaluates the rules against a report at the given time,
+// returning the notifications of the alerts which fired or resolved.
+func (a *Alerter) Evaluate(ctx context.Context, rpt report.Report, now time.Time) []AlertNotification {
+	rendered := a.renderAlertNodes(ctx, rpt)
+
+	a.mtx.Lock()
+	var (
+		fired, resolved []Alert
+		seen            = map[alertKey]struct{}{}
+	)
+	for i := range a.rules {
+		rule := &a.rules[i]
+		r, ok := rendered[rule.Topology]
+		if !ok {
+			continue
+		}
+
+		for id, n := range r.nodes {
+			if n.Topology == render.Pseudo {
+				continue
+			}
+			key := alertKey{rule.Name, id}
+			seen[key] = struct{}{}
+			state, ok := a.states[key]
+			if !ok {
+				state = &alertState{}
+				a.states[key] = state
+			}
+
+			holds, summary := rule.evaluate(n, state)
+			if !holds {
+				if state.active && state.alert.State == AlertFiring {
+					resolved = append(resolved, state.resolve(now))
+				}
+				state.active = false
+				if !state.seen {
+					delete(a.states, key)
+				}
+				continue
+			}
+			if !state.active {
+				state.active = true
+				state.alert = Alert{
+					Rule:     rule.Name,
+					Severity: rule.Severity,
+					State:    AlertPending,
+					Topology: rule.Topology,
+					NodeID:   id,
+					ActiveAt: now,
+				}
+			}
+			if summary != "" {
+				state.alert.Summary = summary
+			}
+			state.alert.Label = r.labels[id]
+			if state.alert.State == AlertPending && now.Sub(state.alert.ActiveAt) >= rule.forDuration {
+				state.alert.State = AlertFiring
+				state.alert.FiredAt = now
+				fired = append(fired, state.alert)
+			}
+		}
+	}
+	// Alerts of nodes which have gone resolve.
+	for key, state := range a.states {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		if state.active && state.alert.State == AlertFiring {
+			resolved = append(resolved, state.resolve(now))
+		}
+		delete(a.states, key)
+	}
+	a.mtx.Unlock()
+
+	notifications := []AlertNotification{}
+	if len(fired) > 0 {
+		sortAlerts(fired)
+		notifications = append(notifications, AlertNotification{Status: AlertFiring, Alerts: fired})
+	}
+	if len(resolved) > 0 {
+		sortAlerts(resolved)
+		notifications = append(notifications, AlertNotification{Status: AlertResolved, Alerts: resolved})
+	}
+	return notifications
+}
+
+func (s *alertState) resolve(now time.Time) Alert {
+	alert := s.alert
+	alert.State = AlertResolved
+	alert.ResolvedAt = now
+	return alert
+}
+
+func nodeLabel(rpt report.Report, n report.Node) string {
+	if summary, ok := detailed.MakeBasicNodeSummary(rpt, n); ok {
+		return summary.Label
+	}
+	return n.ID
+}
+
+// queue a notification to be sent in the background.
+func (a *Alerter) queue(n AlertNotification) {
+	select {
+	case a.notifications <- n:
+	default:
+		log.Errorf("Alert notification queue full; dropping %d %s alerts", len(n.Alerts), n.Status)
+	}
+}
+
+func (a *Alerter) notifyLoop() {
+	defer close(a.notified)
+	ctx := context.Background()
+	for n := range a.notifications {
+		for _, notifier := range a.notifiers {
+			if err := notifier.Notify(ctx, n); err != nil {
+				log.Errorf("Error notifying %d %s alerts: %v", len(n.Alerts), n.Status, err)
+			}
+		}
+	}
+}
+
+// Alerts returns the pending and firing alerts.
+func (a *Alerter) Alerts() []Alert {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	alerts := []Alert{}
+	for _, state := range a.states {
+		if state.active {
+			alerts = append(alerts, state.alert)
+		}
+	}
+	sortAlerts(alerts)
+	return alerts
+}
+
+func sortAlerts(alerts []Alert) {
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Rule != alerts[j].Rule {
+			return alerts[i].Rule < alerts[j].Rule
+		}
+		return alerts[i].NodeID < alerts[j].NodeID
+	})
+}
+
+// APIAlerts is returned by the /api/alerts handler.
+type APIAlerts struct {
+	Rules  []AlertRule `json:"rules"`
+	Alerts []Alert     `json:"alerts"`
+}
+
+// RegisterAlertRoutes registers the route listing the rules and alerts of
+// a, if alerting is configured.
+func RegisterAlertRoutes(router *mux.Router, a *Alerter) {
+	router.Methods("GET").Path("/api/alerts").
+		HandlerFunc(requestContextDecorator(handleAlerts(a)))
+}
+
+func handleAlerts(a *Alerter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		result := APIAlerts{Rules: []AlertRule{}, Alerts: []Alert{}}
+		if a != nil {
+			result.Rules = a.rules
+			result.Alerts = a.Alerts()
+		}
+		if state := r.FormValue("state"); state != "" {
+			alerts := []Alert{}
+			for _, alert := range result.Alerts {
+				if alert.State == state {
+					alerts = append(alerts, alert)
+				}
+			}
+			result.Alerts = alerts
+		}
+		respondWith(w, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,189 @@
+package app_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func mustParseAlertConfig(t *testing.T, config string) app.AlertConfig {
+	c, err := app.ParseAlertConfig([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func evaluate(ctx context.Context, a *app.Alerter, rpt report.Report, now time.Time) []app.AlertNotification {
+	rpt, _ = app.StaticCollector(rpt).Report(ctx, now)
+	return a.Evaluate(ctx, rpt, now)
+}
+
+func TestParseAlertConfig(t *testing.T) {
+	c := mustParseAlertConfig(t, `
+rules:
+- name: container-cpu
+  topology: containers
+  metric: {name: docker_cpu_total_usage, above: 80}
+  for: 5m
+webhooks:
+- url: https://hooks.example.com/scope
+`)
+	equals(t, 1, len(c.Rules))
+	equals(t, 1, len(c.Webhooks))
+
+	for _, bad := range []string{
+		`rules: [{topology: containers, metric: {name: cpu, above: 1}}]`,
+		`rules: [{name: a, topology: nope, metric: {name: cpu, above: 1}}]`,
+		`rules: [{name: a, topology: containers}]`,
+		`rules: [{name: a, topology: containers, metric: {name: cpu}}]`,
+		`rules: [{name: a, topology: containers, metric: {name: cpu, above: 1}, egress: {}}]`,
+		`rules: [{name: a, topology: containers, transition: {key: docker_container_state}}]`,
+		`rules: [{name: a, topology: containers, metric: {name: cpu, above: 1}, for: soon}]`,
+		`rules: [{name: a, topology: hosts, egress: {}}, {name: a, topology: hosts, egress: {}}]`,
+		`webhooks: [{url: "ftp://example.com"}]`,
+	} {
+		if _, err := app.ParseAlertConfig([]byte(bad)); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestMetricAlert(t *testing.T) {
+	ctx := context.Background()
+	c := mustParseAlertConfig(t, `rules: [{name: busy, topology: containers, metric: {name: docker_cpu_total_usage, above: 0.04}, for: 1m}]`)
+	a := app.NewAlerter(app.StaticCollector(fixture.Report), c.Rules, nil, time.Minute)
+
+	// Pending until the condition has held for a minute
+	start := fixture.Now
+	equals(t, 0, len(evaluate(ctx, a, fixture.Report, start)))
+	alerts := a.Alerts()
+	equals(t, 1, len(alerts))
+	equals(t, app.AlertPending, alerts[0].State)
+	equals(t, fixture.ServerContainerNodeID, alerts[0].NodeID)
+
+	notifications := evaluate(ctx, a, fixture.Report, start.Add(time.Minute))
+	equals(t, 1, len(notifications))
+	equals(t, app.AlertFiring, notifications[0].Status)
+	equals(t, 1, len(notifications[0].Alerts))
+	equals(t, fixture.ServerContainerNodeID, notifications[0].Alerts[0].NodeID)
+	equals(t, "docker_cpu_total_usage is 0.05, above 0.04", notifications[0].Alerts[0].Summary)
+
+	// Firing alerts are only notified once
+	equals(t, 0, len(evaluate(ctx, a, fixture.Report, start.Add(2*time.Minute))))
+
+	// and resolve once the metric drops
+	rpt := fixture.Report.Copy()
+	node := rpt.Container.Nodes[fixture.ServerContainerNodeID]
+	node.Metrics = node.Metrics.Copy()
+	node.Metrics[docker.CPUTotalUsage] = report.MakeSingletonMetric(start.Add(3*time.Minute), 0.01)
+	rpt.Container.Nodes[fixture.ServerContainerNodeID] = node
+	notifications = evaluate(ctx, a, rpt, start.Add(3*time.Minute))
+	equals(t, 1, len(notifications))
+	equals(t, app.AlertResolved, notifications[0].Status)
+	equals(t, fixture.ServerContainerNodeID, notifications[0].Alerts[0].NodeID)
+	equals(t, 0, len(a.Alerts()))
+}
+
+func TestTransitionAlert(t *testing.T) {
+	ctx := context.Background()
+	c := mustParseAlertConfig(t, `rules: [{name: exited, topology: containers, transition: {key: docker_container_state, from: running, to: exited}}]`)
+	a := app.NewAlerter(app.StaticCollector(fixture.Report), c.Rules, nil, time.Minute)
+
+	exited := fixture.Report.Copy()
+	node := exited.Container.Nodes[fixture.ClientContainerNodeID]
+	exited.Container.Nodes[fixture.ClientContainerNodeID] = node.WithLatest(docker.ContainerState, fixture.Now, docker.StateExited)
+
+	// Containers which were never seen running don't fire
+	equals(t, 0, len(evaluate(ctx, a, exited, fixture.Now)))
+
+	evaluate(ctx, a, fixture.Report, fixture.Now)
+	notifications := evaluate(ctx, a, exited, fixture.Now)
+	equals(t, 1, len(notifications))
+	equals(t, app.AlertFiring, notifications[0].Status)
+	equals(t, fixture.ClientContainerNodeID, notifications[0].Alerts[0].NodeID)
+	equals(t, fixture.ClientContainerName, notifications[0].Alerts[0].Label)
+
+	equals(t, 0, len(evaluate(ctx, a, exited, fixture.Now)))
+
+	notifications = evaluate(ctx, a, fixture.Report, fixture.Now)
+	equals(t, 1, len(notifications))
+	equals(t, app.AlertResolved, notifications[0].Status)
+}
+
+func TestEgressAlert(t *testing.T) {
+	ctx := context.Background()
+	c := mustParseAlertConfig(t, `
+rules:
+- {name: internet, topology: processes, egress: {}}
+- {name: allowed, topology: processes, egress: {allowInternet: true}}
+`)
+	a := app.NewAlerter(app.StaticCollector(fixture.Report), c.Rules, nil, time.Minute)
+
+	notifications := evaluate(ctx, a, fixture.Report, fixture.Now)
+	equals(t, 1, len(notifications))
+	equals(t, 1, len(notifications[0].Alerts))
+	alert := notifications[0].Alerts[0]
+	equals(t, "internet", alert.Rule)
+	equals(t, fixture.NonContainerProcessNodeID, alert.NodeID)
+	equals(t, "connects to the Internet", alert.Summary)
+	if alert.NodeID == render.OutgoingInternetID {
+		t.Errorf("pseudo nodes shouldn't raise alerts")
+	}
+}
+
+func TestAlertWebhooks(t *testing.T) {
+	received := make(chan app.AlertNotification, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n app.AlertNotification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Error(err)
+		}
+		equals(t, "secret", r.Header.Get("X-Token"))
+		received <- n
+	}))
+	defer hook.Close()
+
+	c := mustParseAlertConfig(t, `
+rules: [{name: internet, topology: processes, egress: {}}]
+webhooks: [{url: "`+hook.URL+`", headers: {X-Token: secret}}]
+`)
+	notifier := app.NewWebhookNotifier(c.Webhooks)
+	a := app.NewAlerter(app.StaticCollector(fixture.Report), c.Rules, []app.AlertNotifier{notifier}, time.Minute)
+	a.Start()
+	defer a.Stop()
+
+	select {
+	case n := <-received:
+		equals(t, app.AlertFiring, n.Status)
+		equals(t, fixture.NonContainerProcessNodeID, n.Alerts[0].NodeID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not notified")
+	}
+
+	router := mux.NewRouter()
+	app.RegisterAlertRoutes(router, a)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var result app.APIAlerts
+	body := getRawJSON(t, ts, "/api/alerts?state=firing")
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&result); err != nil {
+		t.Fatalf("JSON parse error: %s", err)
+	}
+	equals(t, 1, len(result.Rules))
+	equals(t, 1, len(result.Alerts))
+	equals(t, fixture.NonContainerProcessNodeID, result.Alerts[0].NodeID)
+}
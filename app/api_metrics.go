@@ -0,0 +1,134 @@
+package app
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/report"
+)
+
+const metricNamespace = "scope"
+
+// Labels attached to every node metric sample.
+var metricLabels = []string{"topology", "node_id", "container_name", "pod", "namespace", "host"}
+
+var invalidMetricNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// Prometheus exposition of the latest sample of every node metric in the
+// current report.
+func makeMetricsHandler(rep Reporter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		rpt, err := rep.Report(ctx, time.Now())
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+		registry := prometheus.NewRegistry()
+		if err := registry.Register(reportMetricsCollector{rpt}); err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
+
+// reportMetricsCollector is a prometheus.Collector exposing the metrics of
+// the nodes in a report as gauges.
+type reportMetricsCollector struct {
+	rpt report.Report
+}
+
+// Describe implements prometheus.Collector. It sends no descriptors, as
+// the metrics depend on the report, which makes the collector unchecked.
+func (c reportMetricsCollector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector.
+func (c reportMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	descs := map[string]*prometheus.Desc{}
+	c.rpt.WalkNamedTopologies(func(topologyID string, t *report.Topology) {
+		for nodeID, n := range t.Nodes {
+			var labels []string
+			for metricID, metric := range n.Metrics {
+				sample, ok := metric.LastSample()
+				if !ok {
+					continue
+				}
+				desc, ok := descs[metricID]
+				if !ok {
+					desc = prometheus.NewDesc(
+						prometheus.BuildFQName(metricNamespace, "", invalidMetricNameChars.ReplaceAllString(metricID, "_")),
+						"Latest value of the Scope metric "+metricID+".",
+						metricLabels, nil,
+					)
+					descs[metricID] = desc
+				}
+				if labels == nil {
+					labels = c.nodeLabels(topologyID, nodeID, n)
+				}
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, sample.Value, labels...)
+			}
+		}
+	})
+}
+
+// nodeLabels returns the values of metricLabels for a node, looking them up
+// in its parents when the node itself doesn't have them.
+func (c reportMetricsCollector) nodeLabels(topologyID, nodeID string, n report.Node) []string {
+	var (
+		containerName = c.lookup(n, report.Container, docker.ContainerName)
+		pod           string
+		namespace     = c.lookup(n, report.Pod, kubernetes.Namespace)
+		hostName      = c.lookup(n, report.Host, host.HostName)
+	)
+	if topologyID == report.Pod {
+		pod, _ = n.Latest.Lookup(kubernetes.Name)
+	} else {
+		pod = c.lookupParent(n, report.Pod, kubernetes.Name)
+	}
+	if hostName == "" {
+		if hostNodeID, ok := n.Latest.Lookup(report.HostNodeID); ok {
+			if node, ok := c.rpt.Host.Nodes[hostNodeID]; ok {
+				hostName, _ = node.Latest.Lookup(host.HostName)
+			}
+			if hostName == "" {
+				hostName, _ = report.ParseHostNodeID(hostNodeID)
+			}
+		}
+	}
+	return []string{topologyID, nodeID, containerName, pod, namespace, hostName}
+}
+
+// lookup returns the value of key in the node's Latest, or else in the
+// Latest of its first parent in the given topology.
+func (c reportMetricsCollector) lookup(n report.Node, parentTopology, key string) string {
+	if value, ok := n.Latest.Lookup(key); ok {
+		return value
+	}
+	return c.lookupParent(n, parentTopology, key)
+}
+
+func (c reportMetricsCollector) lookupParent(n report.Node, parentTopology, key string) string {
+	parentIDs, ok := n.Parents.Lookup(parentTopology)
+	if !ok || len(parentIDs) == 0 {
+		return ""
+	}
+	t, ok := c.rpt.Topology(parentTopology)
+	if !ok {
+		return ""
+	}
+	parent, ok := t.Nodes[parentIDs[0]]
+	if !ok {
+		return ""
+	}
+	value, _ := parent.Latest.Lookup(key)
+	return value
+}
@@ -0,0 +1,68 @@
+package app_test
+
+import (
+	"bytes"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestAPIMetrics(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	body := is200(t, ts, "/api/metrics")
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Prometheus text format parse error: %s", err)
+	}
+
+	findSample := func(name, nodeID string) *dto.Metric {
+		family, ok := families[name]
+		if !ok {
+			t.Fatalf("Expected metric family %s", name)
+		}
+		for _, m := range family.Metric {
+			for _, l := range m.Label {
+				if l.GetName() == "node_id" && l.GetValue() == nodeID {
+					return m
+				}
+			}
+		}
+		t.Fatalf("Expected %s sample for node %s", name, nodeID)
+		return nil
+	}
+	labels := func(m *dto.Metric) map[string]string {
+		result := map[string]string{}
+		for _, l := range m.Label {
+			result[l.GetName()] = l.GetValue()
+		}
+		return result
+	}
+
+	{
+		m := findSample("scope_"+docker.CPUTotalUsage, fixture.ClientContainerNodeID)
+		equals(t, 0.03, m.GetGauge().GetValue())
+		equals(t, map[string]string{
+			"topology":       "container",
+			"node_id":        fixture.ClientContainerNodeID,
+			"container_name": fixture.ClientContainerName,
+			"pod":            "pong-a",
+			"namespace":      fixture.KubernetesNamespace,
+			"host":           fixture.ClientHostName,
+		}, labels(m))
+	}
+	{
+		m := findSample("scope_"+host.CPUUsage, fixture.ServerHostNodeID)
+		equals(t, 0.12, m.GetGauge().GetValue())
+		equals(t, "host", labels(m)["topology"])
+		equals(t, fixture.ServerHostName, labels(m)["host"])
+		equals(t, "", labels(m)["pod"])
+	}
+}
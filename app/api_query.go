@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+// APIQueryResult is returned by the /api/query handler.
+type APIQueryResult struct {
+	Query      string             `json:"query"`
+	Topologies []APIQueryTopology `json:"topologies"`
+}
+
+// APIQueryTopology holds the nodes of a topology matching a query.
+type APIQueryTopology struct {
+	ID    string                 `json:"id"`
+	Name  string                 `json:"name"`
+	Nodes detailed.NodeSummaries `json:"nodes"`
+}
+
+// queryFilter returns the filter for the node query in the q parameter, if
+// any.
+func queryFilter(values url.Values) (render.FilterFunc, error) {
+	q := values.Get("q")
+	if q == "" {
+		return nil, nil
+	}
+	filter, err := render.ParseQuery(q)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %v", err)
+	}
+	return filter, nil
+}
+
+// hasOptions returns whether topology options were given, other than a
+// query.
+func hasOptions(values url.Values) bool {
+	for key := range values {
+		if key != "q" {
+			return true
+		}
+	}
+	return false
+}
+
+// makeQueryHandler returns a handler rendering every topology, with its
+// default options, returning the nodes matching the query in the q
+// parameter.
+func (r *Registry) makeQueryHandler(rep Reporter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		query := req.Form.Get("q")
+		if query == "" {
+			respondWith(w, http.StatusBadRequest, "missing query")
+			return
+		}
+		filter, err := queryFilter(req.Form)
+		if err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		rpt, err := rep.Report(ctx, deserializeTimestamp(req.Form.Get("timestamp")))
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		// Rendering takes a while, so isn't done while walking the registry
+		descs := []APITopologyDesc{}
+		r.walk(func(desc APITopologyDesc) {
+			descs = append(descs, desc)
+			descs = append(descs, desc.SubTopologies...)
+		})
+
+		var (
+			rc        = RenderContextForReporter(rep, rpt)
+			censorCfg = report.GetCensorConfigFromRequest(req)
+			result    = APIQueryResult{Query: query, Topologies: []APIQueryTopology{}}
+		)
+		for _, desc := range updateFilters(rpt, descs) {
+			nodes := render.Render(ctx, rpt, desc.renderer, desc.transformer(nil, true, filter)).Nodes
+			if len(nodes) == 0 {
+				continue
+			}
+			result.Topologies = append(result.Topologies, APIQueryTopology{
+				ID:    desc.id,
+				Name:  desc.Name,
+				Nodes: detailed.CensorNodeSummaries(detailed.Summaries(ctx, rc, nodes), censorCfg),
+			})
+		}
+		respondWith(w, http.StatusOK, result)
+	}
+}
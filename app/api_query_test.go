@@ -0,0 +1,56 @@
+package app_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestAPIQuery(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	is400(t, ts, "/api/query")
+	is400(t, ts, "/api/query?q="+url.QueryEscape("docker_cpu_total_usage > high"))
+
+	body := getRawJSON(t, ts, "/api/query?q="+url.QueryEscape("topology=container AND docker_label_myrole=customapplication1"))
+	var result app.APIQueryResult
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&result); err != nil {
+		t.Fatalf("JSON parse error: %s", err)
+	}
+	var containers *app.APIQueryTopology
+	for i, topology := range result.Topologies {
+		if topology.ID == "containers" {
+			containers = &result.Topologies[i]
+		}
+	}
+	if containers == nil {
+		t.Fatalf("no containers in %v", result)
+	}
+	equals(t, 1, len(containers.Nodes))
+	if _, ok := containers.Nodes[fixture.ClientContainerNodeID]; !ok {
+		t.Errorf("expected %s in %v", fixture.ClientContainerNodeID, containers.Nodes)
+	}
+}
+
+func TestAPITopologyQuery(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	is400(t, ts, "/api/topology/containers?q="+url.QueryEscape("(topology=container"))
+	is400(t, ts, "/api/topology/containers/ws?q="+url.QueryEscape("(topology=container"))
+
+	body := getRawJSON(t, ts, "/api/topology/containers?q="+url.QueryEscape("docker_cpu_total_usage > 0.04"))
+	var topo app.APITopology
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&topo); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 1, len(topo.Nodes))
+	if _, ok := topo.Nodes[fixture.ServerContainerNodeID]; !ok {
+		t.Errorf("expected %s in %v", fixture.ServerContainerNodeID, topo.Nodes)
+	}
+}
@@ -31,6 +31,9 @@ const (
 	podsID                 = "pods"
 	kubeControllersID      = "kube-controllers"
 	servicesID             = "services"
+	ingressesID            = "ingresses"
+	networkPoliciesID      = "network-policies"
+	autoscalersID          = "autoscalers"
 	hostsID                = "hosts"
 	weaveID                = "weave"
 	ecsTasksID             = "ecs-tasks"
@@ -265,6 +268,29 @@ func MakeRegistry() *Registry {
 			Options:     []APITopologyOptionGroup{unmanagedFilter},
 			HideIfEmpty: true,
 		},
+		APITopologyDesc{
+			id:          ingressesID,
+			parent:      podsID,
+			renderer:    render.IngressRenderer,
+			Name:        "Ingresses",
+			Options:     []APITopologyOptionGroup{unmanagedFilter},
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          networkPoliciesID,
+			parent:      podsID,
+			renderer:    render.NetworkPolicyRenderer,
+			Name:        "Network policies",
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          autoscalersID,
+			parent:      podsID,
+			renderer:    render.HorizontalPodAutoscalerRenderer,
+			Name:        "Autoscalers",
+			Options:     []APITopologyOptionGroup{unmanagedFilter},
+			HideIfEmpty: true,
+		},
 		APITopologyDesc{
 			id:          ecsTasksID,
 			renderer:    render.ECSTaskRenderer,
@@ -294,6 +320,16 @@ func MakeRegistry() *Registry {
 			renderer: render.HostRenderer,
 			Name:     "Hosts",
 			Rank:     4,
+			Options: []APITopologyOptionGroup{
+				{
+					ID:      "unprobed",
+					Default: "show",
+					Options: []APITopologyOption{
+						{Value: "show", Label: "Show unprobed", filter: nil, filterPseudo: false},
+						{Value: "hide", Label: "Hide unprobed", filter: render.Complement(render.IsUnprobedHost), filterPseudo: false},
+					},
+				},
+			},
 		},
 		APITopologyDesc{
 			id:       weaveID,
@@ -532,25 +568,37 @@ func (r *Registry) RendererForTopology(topologyID string, values url.Values, rpt
 	}
 	topology = updateFilters(rpt, []APITopologyDesc{topology})[0]
 
-	if len(values) == 0 {
-		// if no options where provided, only apply base filter
-		return topology.renderer, render.FilterUnconnectedPseudo, nil
+	query, err := queryFilter(values)
+	if err != nil {
+		return nil, nil, err
 	}
+	// if no options were provided, only apply the query and base filter
+	return topology.renderer, topology.transformer(values, hasOptions(values), query), nil
+}
 
+// transformer returns the filters to render the topology with: query, if
+// not nil, the topology's options, as set in values or else defaulted, if
+// withOptions, and always FilterUnconnectedPseudo.
+func (t APITopologyDesc) transformer(values url.Values, withOptions bool, query render.FilterFunc) render.Transformer {
 	var filters []render.FilterFunc
-	for _, group := range topology.Options {
-		value := group.Default
-		if vs := values[group.ID]; len(vs) > 0 {
-			value = vs[0]
-		}
-		if filter := group.filter(value); filter != nil {
-			filters = append(filters, filter)
+	if query != nil {
+		filters = append(filters, query)
+	}
+	if withOptions {
+		for _, group := range t.Options {
+			value := group.Default
+			if vs := values[group.ID]; len(vs) > 0 {
+				value = vs[0]
+			}
+			if filter := group.filter(value); filter != nil {
+				filters = append(filters, filter)
+			}
 		}
 	}
 	if len(filters) > 0 {
-		return topology.renderer, render.Transformers([]render.Transformer{render.ComposeFilterFuncs(filters...), render.FilterUnconnectedPseudo}), nil
+		return render.Transformers([]render.Transformer{render.ComposeFilterFuncs(filters...), render.FilterUnconnectedPseudo})
 	}
-	return topology.renderer, render.FilterUnconnectedPseudo, nil
+	return render.FilterUnconnectedPseudo
 }
 
 type reporterHandler func(context.Context, Reporter, http.ResponseWriter, *http.Request)
@@ -577,6 +625,10 @@ func (r *Registry) captureRenderer(rep Reporter, f rendererHandler) CtxHandlerFu
 			return
 		}
 		req.ParseForm()
+		if _, err := queryFilter(req.Form); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
 		renderer, filter, err := r.RendererForTopology(topologyID, req.Form, rpt)
 		if err != nil {
 			respondWith(w, http.StatusInternalServerError, err)
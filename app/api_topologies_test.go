@@ -191,7 +191,7 @@ func getTestContainerLabelFilterTopologySummary(t *testing.T, exclude bool) (det
 func TestAPITopologyAddsKubernetes(t *testing.T) {
 	router := mux.NewRouter()
 	c := app.NewCollector(1 * time.Minute)
-	app.RegisterReportPostHandler(c, router)
+	app.RegisterReportPostHandler(c, router, nil)
 	app.RegisterTopologyRoutes(router, c, map[string]bool{"foo_capability": true})
 	ts := httptest.NewServer(router)
 	defer ts.Close()
@@ -1,7 +1,10 @@
 package app
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
 	"time"
 
 	"context"
@@ -34,10 +37,23 @@ func RenderContextForReporter(rep Reporter, r report.Report) detailed.RenderCont
 	rc := detailed.RenderContext{Report: r}
 	if wrep, ok := rep.(WebReporter); ok {
 		rc.MetricsGraphURL = wrep.MetricsGraphURL
+		if wrep.Events != nil {
+			rc.NodeEvents = func(topologyID, nodeID string) []report.Row {
+				return nodeEventRows(context.Background(), wrep.Events, topologyID, nodeID)
+			}
+		}
 	}
 	return rc
 }
 
+// APITopologyDiff is returned by the /api/topology/{name}/diff handler.
+type APITopologyDiff struct {
+	From  time.Time         `json:"from"`
+	To    time.Time         `json:"to"`
+	Nodes detailed.Diff     `json:"nodes"`
+	Edges detailed.EdgeDiff `json:"edges"`
+}
+
 type rendererHandler func(context.Context, render.Renderer, render.Transformer, detailed.RenderContext, http.ResponseWriter, *http.Request)
 
 // Full topology.
@@ -49,34 +65,116 @@ func handleTopology(ctx context.Context, renderer render.Renderer, transformer r
 	})
 }
 
-// Individual nodes.
-func handleNode(ctx context.Context, renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, w http.ResponseWriter, r *http.Request) {
+// Individual nodes, with the controls a allows.
+func handleNode(a *ControlAuthorizer) rendererHandler {
+	return func(ctx context.Context, renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, w http.ResponseWriter, r *http.Request) {
+		var (
+			censorCfg  = report.GetCensorConfigFromRequest(r)
+			vars       = mux.Vars(r)
+			topologyID = vars["topology"]
+			nodeID     = vars["id"]
+		)
+		// We must not lose the node during filtering. We achieve that by
+		// (1) rendering the report with the base renderer, without
+		// filtering, which gives us the node (if it exists at all), and
+		// then (2) applying the filter separately to that result.  If the
+		// node is lost in the second step, we simply put it back.
+		nodes := renderer.Render(ctx, rc.Report)
+		node, ok := nodes.Nodes[nodeID]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		nodes = transformer.Transform(nodes)
+		if filteredNode, ok := nodes.Nodes[nodeID]; ok {
+			node = filteredNode
+		} else { // we've lost the node during filtering; put it back
+			nodes.Nodes[nodeID] = node
+			nodes.Filtered--
+		}
+		rawNode := detailed.MakeNode(topologyID, rc, nodes.Nodes, node)
+		rawNode.Controls = a.authorizedControls(r, node, rawNode.Controls)
+		respondWith(w, http.StatusOK, APINode{Node: detailed.CensorNode(rawNode, censorCfg)})
+	}
+}
+
+// Diff of the full topology between two points in time.
+func handleTopologyDiff(ctx context.Context, rep Reporter, w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
 	var (
+		topologyID = mux.Vars(r)["topology"]
 		censorCfg  = report.GetCensorConfigFromRequest(r)
-		vars       = mux.Vars(r)
-		topologyID = vars["topology"]
-		nodeID     = vars["id"]
 	)
-	// We must not lose the node during filtering. We achieve that by
-	// (1) rendering the report with the base renderer, without
-	// filtering, which gives us the node (if it exists at all), and
-	// then (2) applying the filter separately to that result.  If the
-	// node is lost in the second step, we simply put it back.
-	nodes := renderer.Render(ctx, rc.Report)
-	node, ok := nodes.Nodes[nodeID]
-	if !ok {
+	if _, ok := topologyRegistry.get(topologyID); !ok {
 		http.NotFound(w, r)
 		return
 	}
-	nodes = transformer.Transform(nodes)
-	if filteredNode, ok := nodes.Nodes[nodeID]; ok {
-		node = filteredNode
-	} else { // we've lost the node during filtering; put it back
-		nodes.Nodes[nodeID] = node
-		nodes.Filtered--
+	if _, err := queryFilter(r.Form); err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
+	if r.Form.Get("from") == "" {
+		respondWith(w, http.StatusBadRequest, "missing 'from' timestamp")
+		return
+	}
+	from, err := time.Parse(time.RFC3339, r.Form.Get("from"))
+	if err != nil {
+		respondWith(w, http.StatusBadRequest, fmt.Sprintf("invalid 'from' timestamp: %v", err))
+		return
+	}
+	to := time.Now()
+	if t := r.Form.Get("to"); t != "" {
+		if to, err = time.Parse(time.RFC3339, t); err != nil {
+			respondWith(w, http.StatusBadRequest, fmt.Sprintf("invalid 'to' timestamp: %v", err))
+			return
+		}
+	}
+
+	fromTopo, err := renderSummaries(ctx, rep, topologyID, r.Form, from, censorCfg)
+	if err != nil {
+		respondWith(w, http.StatusInternalServerError, err)
+		return
+	}
+	toTopo, err := renderSummaries(ctx, rep, topologyID, r.Form, to, censorCfg)
+	if err != nil {
+		respondWith(w, http.StatusInternalServerError, err)
+		return
 	}
-	rawNode := detailed.MakeNode(topologyID, rc, nodes.Nodes, node)
-	respondWith(w, http.StatusOK, APINode{Node: detailed.CensorNode(rawNode, censorCfg)})
+
+	diff := detailed.TopoDiff(fromTopo, toTopo)
+	sort.Slice(diff.Add, func(i, j int) bool { return diff.Add[i].ID < diff.Add[j].ID })
+	sort.Slice(diff.Update, func(i, j int) bool { return diff.Update[i].ID < diff.Update[j].ID })
+	sort.Strings(diff.Remove)
+	respondWith(w, http.StatusOK, APITopologyDiff{
+		From:  from,
+		To:    to,
+		Nodes: diff,
+		Edges: detailed.TopoEdgeDiff(fromTopo, toTopo),
+	})
+}
+
+// renderSummaries renders the censored node summaries of a topology at
+// the given timestamp.
+func renderSummaries(ctx context.Context, rep Reporter, topologyID string, values url.Values, timestamp time.Time, censorCfg report.CensorConfig) (detailed.NodeSummaries, error) {
+	rpt, err := rep.Report(ctx, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	renderer, filter, err := topologyRegistry.RendererForTopology(topologyID, values, rpt)
+	if err != nil {
+		return nil, err
+	}
+	return detailed.CensorNodeSummaries(
+		detailed.Summaries(
+			ctx,
+			RenderContextForReporter(rep, rpt),
+			render.Render(ctx, rpt, renderer, filter).Nodes,
+		),
+		censorCfg,
+	), nil
 }
 
 // Websocket for the full topology.
@@ -90,6 +188,10 @@ func handleWebsocket(
 		respondWith(w, http.StatusInternalServerError, err)
 		return
 	}
+	if _, err := queryFilter(r.Form); err != nil {
+		respondWith(w, http.StatusBadRequest, err)
+		return
+	}
 	loop := websocketLoop
 	if t := r.Form.Get("t"); t != "" {
 		var err error
@@ -141,25 +243,11 @@ func handleWebsocket(
 		// might be interested in implementing in the future.
 		timestampDelta := time.Since(channelOpenedAt)
 		reportTimestamp := startReportingAt.Add(timestampDelta)
-		re, err := rep.Report(ctx, reportTimestamp)
-		if err != nil {
-			log.Errorf("Error generating report: %v", err)
-			return
-		}
-		renderer, filter, err := topologyRegistry.RendererForTopology(topologyID, r.Form, re)
+		newTopo, err := renderSummaries(ctx, rep, topologyID, r.Form, reportTimestamp, censorCfg)
 		if err != nil {
 			log.Errorf("Error generating report: %v", err)
 			return
 		}
-
-		newTopo := detailed.CensorNodeSummaries(
-			detailed.Summaries(
-				ctx,
-				RenderContextForReporter(rep, re),
-				render.Render(ctx, re, renderer, filter).Nodes,
-			),
-			censorCfg,
-		)
 		diff := detailed.TopoDiff(previousTopo, newTopo)
 		previousTopo = newTopo
 
@@ -178,3 +266,29 @@ func handleWebsocket(
 		}
 	}
 }
+
+// Export of the full topology as a graph.
+func handleExport(ctx context.Context, renderer render.Renderer, transformer render.Transformer, rc detailed.RenderContext, w http.ResponseWriter, r *http.Request) {
+	var (
+		censorCfg  = report.GetCensorConfigFromRequest(r)
+		topologyID = mux.Vars(r)["topology"]
+		format     = r.Form.Get("format")
+	)
+	if format == "" {
+		format = detailed.ExportDOT
+	}
+	contentType, ok := detailed.ExportContentTypes[format]
+	if !ok {
+		respondWith(w, http.StatusBadRequest, fmt.Sprintf("unknown export format %q", format))
+		return
+	}
+	nodeSummaries := detailed.CensorNodeSummaries(
+		detailed.Summaries(ctx, rc, render.Render(ctx, rc.Report, renderer, transformer).Nodes),
+		censorCfg,
+	)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Cache-Control", "no-cache")
+	if err := detailed.Export(w, format, topologyID, nodeSummaries); err != nil {
+		log.Errorf("Error exporting topology %s: %v", topologyID, err)
+	}
+}
@@ -1,8 +1,10 @@
 package app_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/websocket"
@@ -153,3 +155,71 @@ func TestAPITopologyWebsocket(t *testing.T) {
 }
 
 func newu64(value uint64) *uint64 { return &value }
+
+func TestAPITopologyDiff(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	is404(t, ts, "/api/topology/foobar/diff?from=2018-01-01T00:00:00Z")
+	for _, path := range []string{
+		"/api/topology/processes/diff",
+		"/api/topology/processes/diff?from=yesterday",
+		"/api/topology/processes/diff?from=2018-01-01T00:00:00Z&to=now",
+	} {
+		if res, _ := checkGet(t, ts, path); res.StatusCode != 400 {
+			t.Errorf("Expected status %d, got %d. Path: %s", 400, res.StatusCode, path)
+		}
+	}
+
+	// The static collector returns the same report at any point in time.
+	body := getRawJSON(t, ts, "/api/topology/processes/diff?from=2018-01-01T00:00:00Z&to=2018-01-02T00:00:00Z")
+	var diff app.APITopologyDiff
+	decoder := codec.NewDecoderBytes(body, &codec.JsonHandle{})
+	if err := decoder.Decode(&diff); err != nil {
+		t.Fatalf("JSON parse error: %s", err)
+	}
+	equals(t, false, diff.Nodes.Reset)
+	equals(t, 0, len(diff.Nodes.Add))
+	equals(t, 0, len(diff.Nodes.Update))
+	equals(t, 0, len(diff.Nodes.Remove))
+	equals(t, 0, len(diff.Edges.Add))
+	equals(t, 0, len(diff.Edges.Remove))
+}
+
+func TestAPITopologyExport(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	is404(t, ts, "/api/topology/foobar/export")
+	is400(t, ts, "/api/topology/containers/export?format=svg")
+
+	res, body := checkGet(t, ts, "/api/topology/containers/export")
+	equals(t, 200, res.StatusCode)
+	equals(t, "text/vnd.graphviz", res.Header.Get("Content-Type"))
+	if !strings.HasPrefix(string(body), `digraph "containers" {`) || !strings.Contains(string(body), fmt.Sprintf("%q -> ", fixture.ClientContainerNodeID)) {
+		t.Errorf("unexpected DOT export:\n%s", body)
+	}
+
+	res, body = checkGet(t, ts, "/api/topology/containers/export?format=graphml")
+	equals(t, 200, res.StatusCode)
+	equals(t, "application/graphml+xml", res.Header.Get("Content-Type"))
+	if !strings.Contains(string(body), `<node id="`+fixture.ServerContainerID+`;`) {
+		t.Errorf("unexpected GraphML export:\n%s", body)
+	}
+
+	res, body = checkGet(t, ts, "/api/topology/containers/export?format=cytoscape")
+	equals(t, 200, res.StatusCode)
+	equals(t, "application/json", res.Header.Get("Content-Type"))
+	var graph struct {
+		Elements struct {
+			Nodes []interface{} `json:"nodes"`
+			Edges []interface{} `json:"edges"`
+		} `json:"elements"`
+	}
+	if err := json.Unmarshal(body, &graph); err != nil {
+		t.Fatalf("JSON parse error: %s", err)
+	}
+	if len(graph.Elements.Nodes) == 0 || len(graph.Elements.Edges) == 0 {
+		t.Errorf("unexpected Cytoscape export:\n%s", body)
+	}
+}
@@ -0,0 +1,598 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// Types of audit records.
+const (
+	AuditControl      = "control"
+	AuditSessionStart = "session_start"
+	AuditSessionStop  = "session_stop"
+)
+
+const (
+	// Records waiting to be written to the sinks; recording more blocks
+	// until they are written, rather than dropping them.
+	auditQueueSize = 1024
+	// Transcripts are cut short beyond this many bytes.
+	maxTranscriptBytes = 1 << 20
+	// Webhooks are retried this many times, doubling the delay from
+	// webhookRetryDelay, before giving up on a record.
+	webhookRetries    = 5
+	webhookRetryDelay = time.Second
+)
+
+// AuditReadControl is the control users need to be allowed, by a rule
+// without node conditions, to query the audit trail. Without a control
+// policy, nobody may.
+const AuditReadControl = "read_audit"
+
+// AuditRecord records a control request and its response, or the start or
+// stop of a terminal session on the pipe a control opened.
+type AuditRecord struct {
+	Time    time.Time         `json:"time"`
+	Type    string            `json:"type"`
+	User    string            `json:"user"`
+	ProbeID string            `json:"probeId"`
+	NodeID  string            `json:"nodeId"`
+	Control string            `json:"control"`
+	Args    map[string]string `json:"args,omitempty"`
+	PipeID  string            `json:"pipeId,omitempty"`
+
+	// Response is the probe's response to a control, unless the
+	// request failed with Error, or was Denied by the control policy.
+	Response *xfer.Response `json:"response,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Denied   bool           `json:"denied,omitempty"`
+
+	// Transcript is what went through a session's pipe, if transcripts
+	// are enabled. It is only written to the sinks, not kept in memory.
+	Transcript []AuditTranscriptEntry `json:"transcript,omitempty"`
+}
+
+// Directions of transcript entries.
+const (
+	TranscriptInput  = "in"
+	TranscriptOutput = "out"
+)
+
+// AuditTranscriptEntry is data going in or out of a session's pipe.
+type AuditTranscriptEntry struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Data      string    `json:"data"`
+}
+
+// AuditSink is somewhere audit records are written to.
+type AuditSink interface {
+	Write(AuditRecord) error
+}
+
+// Auditor keeps an audit trail of control requests and the terminal
+// sessions they open. The latest records, without transcripts, are kept in
+// memory to be queried; all of them are written to the sinks in the
+// background.
+type Auditor struct {
+	sinks       []AuditSink
+	maxRecords  int
+	transcripts bool
+	authorizer  *ControlAuthorizer
+	queue       chan AuditRecord
+	done        chan struct{}
+
+	// stopMtx is held to queue records, and to stop queueing them.
+	stopMtx sync.RWMutex
+	stopped bool
+
+	mtx      sync.Mutex
+	records  []AuditRecord
+	sessions map[string]*auditSession
+}
+
+// auditSession is a pipe opened by a control.
+type auditSession struct {
+	control     AuditRecord
+	transcript  []AuditTranscriptEntry
+	size        int
+	connections int
+}
+
+// NewAuditor makes a new Auditor, keeping the latest maxRecords records in
+// memory, and recording the transcripts of sessions if transcripts is set.
+// Records are attributed to the users authorizer identifies.
+func NewAuditor(sinks []AuditSink, maxRecords int, transcripts bool, authorizer *ControlAuthorizer) *Auditor {
+	a := &Auditor{
+		sinks:       sinks,
+		maxRecords:  maxRecords,
+		transcripts: transcripts,
+		authorizer:  authorizer,
+		queue:       make(chan AuditRecord, auditQueueSize),
+		done:        make(chan struct{}),
+		sessions:    map[string]*auditSession{},
+	}
+	go a.loop()
+	return a
+}
+
+func (a *Auditor) loop() {
+	defer close(a.done)
+	for record := range a.queue {
+		for _, sink := range a.sinks {
+			if err := sink.Write(record); err != nil {
+				log.Errorf("Error writing audit record: %v", err)
+			}
+		}
+	}
+}
+
+// Stop the Auditor, once its records have been written to the sinks,
+// stopping the sinks which write in the background. Records made after
+// that are dropped.
+func (a *Auditor) Stop() {
+	a.stopMtx.Lock()
+	if a.stopped {
+		a.stopMtx.Unlock()
+		return
+	}
+	a.stopped = true
+	close(a.queue)
+	a.stopMtx.Unlock()
+	<-a.done
+	for _, sink := range a.sinks {
+		if s, ok := sink.(interface {
+			Stop()
+		}); ok {
+			s.Stop()
+		}
+	}
+}
+
+// Record adds a record to the audit trail. It blocks while the queue of
+// records to write to the sinks is full, so none are lost.
+func (a *Auditor) Record(record AuditRecord) {
+	a.stopMtx.RLock()
+	defer a.stopMtx.RUnlock()
+	if a.stopped {
+		log.Warnf("Auditor stopped; dropping %s record of %s by %q", record.Type, record.Control, record.User)
+		return
+	}
+
+	kept := record
+	kept.Transcript = nil
+	a.mtx.Lock()
+	a.records = append(a.records, kept)
+	if len(a.records) > a.maxRecords {
+		a.records = a.records[len(a.records)-a.maxRecords:]
+	}
+	a.mtx.Unlock()
+
+	select {
+	case a.queue <- record:
+	default:
+		log.Warnf("Audit queue full; waiting to queue %s record of %s by %q", record.Type, record.Control, record.User)
+		a.queue <- record
+	}
+}
+
+// AuditQuery selects audit records. Empty fields match any record.
+type AuditQuery struct {
+	Type    string
+	User    string
+	ProbeID string
+	NodeID  string
+	Control string
+	Since   time.Time
+	Limit   int
+}
+
+func (q AuditQuery) matches(r AuditRecord) bool {
+	return (q.Type == "" || q.Type == r.Type) &&
+		(q.User == "" || q.User == r.User) &&
+		(q.ProbeID == "" || q.ProbeID == r.ProbeID) &&
+		(q.NodeID == "" || q.NodeID == r.NodeID) &&
+		(q.Control == "" || q.Control == r.Control) &&
+		!r.Time.Before(q.Since)
+}
+
+// Query returns the records in memory matching q, oldest first, limited to
+// the latest q.Limit of them if set.
+func (a *Auditor) Query(q AuditQuery) []AuditRecord {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	result := []AuditRecord{}
+	for _, r := range a.records {
+		if q.matches(r) {
+			result = append(result, r)
+		}
+	}
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[len(result)-q.Limit:]
+	}
+	return result
+}
+
+// auditControl records a control request and its response, remembering
+// the pipe it opened, if any, to attribute the session to the request.
+func (a *Auditor) auditControl(ctx context.Context, probeID string, req xfer.Request, res xfer.Response, err error) {
+	record := AuditRecord{
+		Time:    mtime.Now(),
+		Type:    AuditControl,
+		User:    a.authorizer.contextUser(ctx),
+		ProbeID: probeID,
+		NodeID:  req.NodeID,
+		Control: req.Control,
+		Args:    req.ControlArgs,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	} else {
+		record.Response = &res
+		if res.Pipe != "" {
+			record.PipeID = res.Pipe
+			a.mtx.Lock()
+			a.sessions[res.Pipe] = &auditSession{control: record}
+			a.mtx.Unlock()
+		}
+	}
+	a.Record(record)
+}
+
+// auditDenied records a control request denied by the control policy.
+func (a *Auditor) auditDenied(ctx context.Context, probeID string, req xfer.Request, err error) {
+	a.Record(AuditRecord{
+		Time:    mtime.Now(),
+		Type:    AuditControl,
+		User:    a.authorizer.contextUser(ctx),
+		ProbeID: probeID,
+		NodeID:  req.NodeID,
+		Control: req.Control,
+		Args:    req.ControlArgs,
+		Error:   err.Error(),
+		Denied:  true,
+	})
+}
+
+// record makes a record of a session by user, attributed to the control
+// which opened it, if known.
+func (s *auditSession) record(user, recordType, pipeID string) AuditRecord {
+	return AuditRecord{
+		Time:    mtime.Now(),
+		Type:    recordType,
+		User:    user,
+		ProbeID: s.control.ProbeID,
+		NodeID:  s.control.NodeID,
+		Control: s.control.Control,
+		PipeID:  pipeID,
+	}
+}
+
+func (a *Auditor) startSession(ctx context.Context, pipeID string) {
+	a.mtx.Lock()
+	session, ok := a.sessions[pipeID]
+	if !ok {
+		session = &auditSession{}
+		a.sessions[pipeID] = session
+	}
+	session.connections++
+	record := session.record(a.authorizer.contextUser(ctx), AuditSessionStart, pipeID)
+	a.mtx.Unlock()
+	a.Record(record)
+}
+
+func (a *Auditor) stopSession(ctx context.Context, pipeID string) {
+	a.mtx.Lock()
+	session, ok := a.sessions[pipeID]
+	if !ok {
+		a.mtx.Unlock()
+		return
+	}
+	record := session.record(a.authorizer.contextUser(ctx), AuditSessionStop, pipeID)
+	record.Transcript = session.transcript
+	session.transcript, session.size = nil, 0
+	session.connections--
+	if session.connections <= 0 {
+		delete(a.sessions, pipeID)
+	}
+	a.mtx.Unlock()
+	a.Record(record)
+}
+
+// forgetSession forgets the session on a pipe which has been deleted.
+func (a *Auditor) forgetSession(pipeID string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	delete(a.sessions, pipeID)
+}
+
+func (a *Auditor) transcribe(pipeID, direction string, data []byte) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	session, ok := a.sessions[pipeID]
+	if !ok || session.size >= maxTranscriptBytes {
+		return
+	}
+	if len(data) > maxTranscriptBytes-session.size {
+		data = data[:maxTranscriptBytes-session.size]
+	}
+	session.size += len(data)
+	session.transcript = append(session.transcript, AuditTranscriptEntry{
+		Time:      mtime.Now(),
+		Direction: direction,
+		Data:      string(data),
+	})
+}
+
+// auditingControlRouter is a ControlRouter auditing the control requests
+// it handles.
+type auditingControlRouter struct {
+	ControlRouter
+	auditor *Auditor
+}
+
+// NewAuditingControlRouter returns a ControlRouter auditing the requests
+// handled by cr.
+func NewAuditingControlRouter(cr ControlRouter, a *Auditor) ControlRouter {
+	return auditingControlRouter{cr, a}
+}
+
+func (cr auditingControlRouter) Handle(ctx context.Context, probeID string, req xfer.Request) (xfer.Response, error) {
+	res, err := cr.ControlRouter.Handle(ctx, probeID, req)
+	cr.auditor.auditControl(ctx, probeID, req, res, err)
+	return res, err
+}
+
+// Denied implements controlDenier.
+func (cr auditingControlRouter) Denied(ctx context.Context, probeID string, req xfer.Request, err error) {
+	cr.auditor.auditDenied(ctx, probeID, req, err)
+}
+
+// auditingPipeRouter is a PipeRouter auditing the sessions of the UI end of
+// its pipes.
+type auditingPipeRouter struct {
+	PipeRouter
+	auditor *Auditor
+}
+
+// NewAuditingPipeRouter returns a PipeRouter auditing sessions on the pipes
+// of pr, with their transcripts if the Auditor records them.
+func NewAuditingPipeRouter(pr PipeRouter, a *Auditor) PipeRouter {
+	return auditingPipeRouter{pr, a}
+}
+
+func (pr auditingPipeRouter) Get(ctx context.Context, id string, e End) (xfer.Pipe, io.ReadWriter, error) {
+	pipe, endIO, err := pr.PipeRouter.Get(ctx, id, e)
+	if err != nil || e != UIEnd {
+		return pipe, endIO, err
+	}
+	pr.auditor.startSession(ctx, id)
+	if pr.auditor.transcripts {
+		endIO = transcribingReadWriter{endIO, pr.auditor, id}
+	}
+	return pipe, endIO, nil
+}
+
+func (pr auditingPipeRouter) Release(ctx context.Context, id string, e End) error {
+	if e == UIEnd {
+		pr.auditor.stopSession(ctx, id)
+	}
+	return pr.PipeRouter.Release(ctx, id, e)
+}
+
+func (pr auditingPipeRouter) Delete(ctx context.Context, id string) error {
+	pr.auditor.forgetSession(id)
+	return pr.PipeRouter.Delete(ctx, id)
+}
+
+// transcribingReadWriter transcribes the UI end of a pipe: what is read
+// from it is the session's output, and what is written its input.
+type transcribingReadWriter struct {
+	io.ReadWriter
+	auditor *Auditor
+	pipeID  string
+}
+
+func (t transcribingReadWriter) Read(p []byte) (int, error) {
+	n, err := t.ReadWriter.Read(p)
+	if n > 0 {
+		t.auditor.transcribe(t.pipeID, TranscriptOutput, p[:n])
+	}
+	return n, err
+}
+
+func (t transcribingReadWriter) Write(p []byte) (int, error) {
+	n, err := t.ReadWriter.Write(p)
+	if n > 0 {
+		t.auditor.transcribe(t.pipeID, TranscriptInput, p[:n])
+	}
+	return n, err
+}
+
+// FileAuditSink appends audit records to a file, as JSON lines.
+type FileAuditSink struct {
+	mtx  sync.Mutex
+	file *os.File
+}
+
+// NewFileAuditSink opens path to append audit records to it.
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditSink{file: file}, nil
+}
+
+// Write implements AuditSink.
+func (s *FileAuditSink) Write(record AuditRecord) error {
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	_, err = s.file.Write(append(buf, '\n'))
+	return err
+}
+
+// Close the file.
+func (s *FileAuditSink) Close() error {
+	return s.file.Close()
+}
+
+// SyslogAuditSink writes audit records to syslog, as JSON.
+type SyslogAuditSink struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogAuditSink connects to syslog at address, which is "local" for
+// the local syslog daemon, or a URL such as udp://host:514.
+func NewSyslogAuditSink(address string) (*SyslogAuditSink, error) {
+	var (
+		writer   *syslog.Writer
+		err      error
+		priority = syslog.LOG_INFO | syslog.LOG_AUTH
+	)
+	if address == "local" {
+		writer, err = syslog.New(priority, "scope-audit")
+	} else {
+		u, parseErr := url.Parse(address)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		writer, err = syslog.Dial(u.Scheme, u.Host, priority, "scope-audit")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogAuditSink{writer: writer}, nil
+}
+
+// Write implements AuditSink.
+func (s *SyslogAuditSink) Write(record AuditRecord) error {
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.writer.Info(string(buf))
+}
+
+// WebhookAuditSink POSTs audit records to a URL, as JSON, in the
+// background, retrying failed POSTs.
+type WebhookAuditSink struct {
+	url    string
+	client *http.Client
+	queue  chan []byte
+	done   chan struct{}
+}
+
+// NewWebhookAuditSink makes a new WebhookAuditSink.
+func NewWebhookAuditSink(webhookURL string) *WebhookAuditSink {
+	s := &WebhookAuditSink{
+		url:    webhookURL,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan []byte, auditQueueSize),
+		done:   make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+func (s *WebhookAuditSink) loop() {
+	defer close(s.done)
+	for body := range s.queue {
+		delay := webhookRetryDelay
+		for i := 0; ; i++ {
+			err := postJSON(context.Background(), s.client, s.url, nil, body)
+			if err == nil {
+				break
+			}
+			if i == webhookRetries {
+				log.Errorf("Error writing audit record, giving up: %v", err)
+				break
+			}
+			log.Warnf("Error writing audit record, retrying in %v: %v", delay, err)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+}
+
+// Write implements AuditSink, queueing the record to be POSTed. It blocks
+// while the queue is full.
+func (s *WebhookAuditSink) Write(record AuditRecord) error {
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.queue <- buf
+	return nil
+}
+
+// Stop the sink, once the queued records have been POSTed.
+func (s *WebhookAuditSink) Stop() {
+	close(s.queue)
+	<-s.done
+}
+
+// RegisterAuditRoutes registers the route to query the audit trail. Only
+// users authorizer allows AuditReadControl may query it, so nobody may
+// without a control policy.
+func RegisterAuditRoutes(router *mux.Router, a *Auditor, authorizer *ControlAuthorizer) {
+	router.Methods("GET").Path("/api/audit").
+		HandlerFunc(requestContextDecorator(handleAudit(a, authorizer)))
+}
+
+func handleAudit(a *Auditor, authorizer *ControlAuthorizer) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if allowed := authorizer.authorizer(r); allowed == nil || !allowed(AuditReadControl, "", report.MakeNode("")) {
+			respondWith(w, http.StatusForbidden, "not allowed to read the audit trail")
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		q := AuditQuery{
+			Type:    r.Form.Get("type"),
+			User:    r.Form.Get("user"),
+			ProbeID: r.Form.Get("probeId"),
+			NodeID:  r.Form.Get("nodeId"),
+			Control: r.Form.Get("control"),
+		}
+		if since := r.Form.Get("since"); since != "" {
+			t, err := time.Parse(time.RFC3339, since)
+			if err != nil {
+				respondWith(w, http.StatusBadRequest, fmt.Sprintf("invalid since: %v", err))
+				return
+			}
+			q.Since = t
+		}
+		if limit := r.Form.Get("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil || n < 0 {
+				respondWith(w, http.StatusBadRequest, fmt.Sprintf("invalid limit %q", limit))
+				return
+			}
+			q.Limit = n
+		}
+		respondWith(w, http.StatusOK, a.Query(q))
+	}
+}
@@ -0,0 +1,259 @@
+package app_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+func getAudit(t *testing.T, ts *httptest.Server, path string) []app.AuditRecord {
+	var records []app.AuditRecord
+	body := getRawJSON(t, ts, path)
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&records); err != nil {
+		t.Fatalf("JSON parse error: %s", err)
+	}
+	return records
+}
+
+// memoryAuditSink keeps the records written to it.
+type memoryAuditSink struct {
+	mtx     sync.Mutex
+	records []app.AuditRecord
+}
+
+func (s *memoryAuditSink) Write(record app.AuditRecord) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestAuditControls(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-audit")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	fileSink, err := app.NewFileAuditSink(path)
+	ok(t, err)
+	defer fileSink.Close()
+
+	hooked := make(chan app.AuditRecord, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record app.AuditRecord
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			t.Error(err)
+		}
+		hooked <- record
+	}))
+	defer hook.Close()
+
+	policy, err := app.ParseControlPolicy([]byte(`rules: [{users: ["*"], controls: ["*"]}]`))
+	ok(t, err)
+	authorizer := &app.ControlAuthorizer{BasicAuth: true}
+	auditor := app.NewAuditor([]app.AuditSink{fileSink, app.NewWebhookAuditSink(hook.URL)}, 10, false, authorizer)
+	ctx := context.Background()
+	controlRouter := app.NewAuditingControlRouter(app.NewLocalControlRouter(), auditor)
+	_, err = controlRouter.Register(ctx, "probe1", func(req xfer.Request) xfer.Response {
+		if req.Control == "docker_exec_container" {
+			return xfer.Response{Pipe: "pipe1", RawTTY: true}
+		}
+		return xfer.ResponseErrorf("no such control")
+	})
+	ok(t, err)
+
+	router := mux.NewRouter()
+	app.RegisterControlRoutes(router, controlRouter, app.StaticCollector{}, authorizer)
+	app.RegisterAuditRoutes(router, auditor, authorizer)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	for _, control := range []string{"docker_exec_container", "kubernetes_delete_pod"} {
+		req, err := http.NewRequest("POST", ts.URL+"/api/control/probe1/node1/"+control, strings.NewReader(`{"command": "sh"}`))
+		ok(t, err)
+		req.SetBasicAuth("alice", "secret")
+		res, err := http.DefaultClient.Do(req)
+		ok(t, err)
+		res.Body.Close()
+	}
+	auditor.Stop()
+	// Records made once stopped are dropped
+	auditor.Record(app.AuditRecord{Type: app.AuditControl, User: "bob"})
+
+	// Nobody may read the audit trail without a control policy
+	res, err := http.Get(ts.URL + "/api/audit")
+	ok(t, err)
+	res.Body.Close()
+	equals(t, http.StatusForbidden, res.StatusCode)
+	authorizer.Policy = policy
+
+	records := getAudit(t, ts, "/api/audit")
+	equals(t, 2, len(records))
+	exec := records[0]
+	equals(t, app.AuditControl, exec.Type)
+	equals(t, "alice", exec.User)
+	equals(t, "probe1", exec.ProbeID)
+	equals(t, "node1", exec.NodeID)
+	equals(t, "docker_exec_container", exec.Control)
+	equals(t, map[string]string{"command": "sh"}, exec.Args)
+	equals(t, "pipe1", exec.PipeID)
+	equals(t, "no such control", records[1].Response.Error)
+
+	records = getAudit(t, ts, "/api/audit?control=kubernetes_delete_pod")
+	equals(t, 1, len(records))
+	records = getAudit(t, ts, "/api/audit?limit=1")
+	equals(t, "kubernetes_delete_pod", records[0].Control)
+	equals(t, 0, len(getAudit(t, ts, "/api/audit?user=bob")))
+	is400(t, ts, "/api/audit?since=yesterday")
+	is400(t, ts, "/api/audit?limit=-1")
+
+	// Every record reached the sinks
+	f, err := os.Open(path)
+	ok(t, err)
+	defer f.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); lines++ {
+		var record app.AuditRecord
+		ok(t, json.Unmarshal(scanner.Bytes(), &record))
+		equals(t, "alice", record.User)
+	}
+	equals(t, 2, lines)
+	equals(t, 2, len(hooked))
+}
+
+func TestAuditDeniedControls(t *testing.T) {
+	policy, err := app.ParseControlPolicy([]byte(testControlPolicy + `- users: [carol]
+  controls: [read_audit]
+`))
+	ok(t, err)
+	authorizer := testControlAuthorizer(policy)
+
+	auditor := app.NewAuditor(nil, 10, false, authorizer)
+	defer auditor.Stop()
+	router := mux.NewRouter()
+	app.RegisterControlRoutes(router, app.NewAuditingControlRouter(app.NewLocalControlRouter(), auditor), app.StaticCollector(controlledReport()), authorizer)
+	app.RegisterAuditRoutes(router, auditor, authorizer)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	request := func(method, path, user string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(`{"command": "sh"}`))
+		ok(t, err)
+		req.Header.Set("X-Scope-User", user)
+		res, err := http.DefaultClient.Do(req)
+		ok(t, err)
+		return res
+	}
+	res := request("POST", "/api/control/probe1/node1/docker_exec_container", "bob")
+	res.Body.Close()
+	equals(t, http.StatusForbidden, res.StatusCode)
+
+	// Only users allowed to read the audit trail may query it
+	res = request("GET", "/api/audit", "bob")
+	res.Body.Close()
+	equals(t, http.StatusForbidden, res.StatusCode)
+	res = request("GET", "/api/audit", "carol")
+	defer res.Body.Close()
+	equals(t, http.StatusOK, res.StatusCode)
+	var records []app.AuditRecord
+	ok(t, json.NewDecoder(res.Body).Decode(&records))
+	equals(t, 1, len(records))
+	equals(t, "bob", records[0].User)
+	equals(t, "docker_exec_container", records[0].Control)
+	equals(t, map[string]string{"command": "sh"}, records[0].Args)
+	equals(t, true, records[0].Denied)
+}
+
+func TestAuditWebhookRetries(t *testing.T) {
+	var (
+		posts  = 0
+		hooked = make(chan app.AuditRecord, 1)
+	)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if posts++; posts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var record app.AuditRecord
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			t.Error(err)
+		}
+		hooked <- record
+	}))
+	defer hook.Close()
+
+	sink := app.NewWebhookAuditSink(hook.URL)
+	ok(t, sink.Write(app.AuditRecord{Type: app.AuditControl, User: "alice"}))
+	sink.Stop()
+	equals(t, 2, posts)
+	equals(t, "alice", (<-hooked).User)
+}
+
+func TestAuditSessions(t *testing.T) {
+	sink := &memoryAuditSink{}
+	auditor := app.NewAuditor([]app.AuditSink{sink}, 10, true, testControlAuthorizer(nil))
+	defer auditor.Stop()
+	var (
+		localPipeRouter = app.NewLocalPipeRouter()
+		pipeRouter      = app.NewAuditingPipeRouter(localPipeRouter, auditor)
+		controlRouter   = app.NewAuditingControlRouter(app.NewLocalControlRouter(), auditor)
+	)
+	defer pipeRouter.Stop()
+
+	req, err := http.NewRequest("GET", "/api/pipe/pipe1", nil)
+	ok(t, err)
+	req.Header.Set("X-Scope-User", "alice")
+	req.RemoteAddr = "127.0.0.1:1234"
+	ctx := context.WithValue(context.Background(), app.RequestCtxKey, req)
+
+	_, err = controlRouter.Register(ctx, "probe1", func(req xfer.Request) xfer.Response {
+		return xfer.Response{Pipe: "pipe1"}
+	})
+	ok(t, err)
+	_, err = controlRouter.Handle(ctx, "probe1", xfer.Request{NodeID: "node1", Control: "docker_exec_container"})
+	ok(t, err)
+
+	_, probeIO, err := localPipeRouter.Get(ctx, "pipe1", app.ProbeEnd)
+	ok(t, err)
+	_, uiIO, err := pipeRouter.Get(ctx, "pipe1", app.UIEnd)
+	ok(t, err)
+	go probeIO.Write([]byte("$ "))
+	buf := make([]byte, 2)
+	_, err = uiIO.Read(buf)
+	ok(t, err)
+	go probeIO.Read(make([]byte, 3))
+	_, err = uiIO.Write([]byte("ls\n"))
+	ok(t, err)
+	ok(t, pipeRouter.Release(ctx, "pipe1", app.UIEnd))
+
+	// Transcripts are only written to the sinks
+	records := auditor.Query(app.AuditQuery{NodeID: "node1"})
+	equals(t, 3, len(records))
+	equals(t, app.AuditSessionStart, records[1].Type)
+	equals(t, 0, len(records[2].Transcript))
+	auditor.Stop()
+	equals(t, 3, len(sink.records))
+	stop := sink.records[2]
+	equals(t, app.AuditSessionStop, stop.Type)
+	equals(t, "alice", stop.User)
+	equals(t, "docker_exec_container", stop.Control)
+	equals(t, "pipe1", stop.PipeID)
+	equals(t, 2, len(stop.Transcript))
+	equals(t, app.TranscriptOutput, stop.Transcript[0].Direction)
+	equals(t, "$ ", stop.Transcript[0].Data)
+	equals(t, app.TranscriptInput, stop.Transcript[1].Direction)
+	equals(t, "ls\n", stop.Transcript[1].Data)
+}
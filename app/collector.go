@@ -41,6 +41,8 @@ type Reporter interface {
 type WebReporter struct {
 	Reporter
 	MetricsGraphURL string
+	Events          EventStore
+	Authorizer      *ControlAuthorizer
 }
 
 // Adder is something that can accept reports. It's a convenient interface for
@@ -53,10 +55,12 @@ type Adder interface {
 	Add(context.Context, report.Report, []byte) error
 }
 
-// A Collector is a Reporter and an Adder
+// A Collector is a Reporter and an Adder, and stores the lifecycle events
+// detected in its reports.
 type Collector interface {
 	Reporter
 	Adder
+	EventStore
 }
 
 // Collector receives published reports from multiple producers. It yields a
@@ -69,6 +73,7 @@ type collector struct {
 	cached     *report.Report
 	merger     Merger
 	waitableCondition
+	*MemoryEventStore
 }
 
 type waitableCondition struct {
@@ -107,7 +112,8 @@ func NewCollector(window time.Duration) Collector {
 		waitableCondition: waitableCondition{
 			waiters: map[chan struct{}]struct{}{},
 		},
-		merger: NewFastMerger(),
+		merger:           NewFastMerger(),
+		MemoryEventStore: NewMemoryEventStore(maxMemoryEvents),
 	}
 }
 
@@ -251,6 +257,15 @@ func (c StaticCollector) WaitOn(context.Context, chan struct{}) {}
 // implements Reporter.
 func (c StaticCollector) UnWait(context.Context, chan struct{}) {}
 
+// AddEvents implements EventStore; StaticCollector has no events, its
+// report never changing.
+func (c StaticCollector) AddEvents(context.Context, []Event) error { return ErrEventsNotSupported }
+
+// Events implements EventStore.
+func (c StaticCollector) Events(context.Context, EventQuery) ([]Event, error) {
+	return nil, ErrEventsNotSupported
+}
+
 // NewFileCollector reads and parses the files at path (a file or
 // directory) as reports.  If there are multiple files, and they all
 // have names representing "nanoseconds since epoch" timestamps,
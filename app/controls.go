@@ -1,19 +1,270 @@
 package app
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/rpc"
+	"time"
 
 	"context"
+	"github.com/ghodss/yaml"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 	"github.com/ugorji/go/codec"
 
 	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/cri"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
 )
 
-// RegisterControlRoutes registers the various control routes with a http mux.
-func RegisterControlRoutes(router *mux.Router, cr ControlRouter) {
+// ControlPolicy decides which users may run which controls on which nodes.
+// A control is allowed if any of the rules allows it.
+type ControlPolicy struct {
+	Rules []ControlRule `json:"rules"`
+}
+
+// ControlRule allows users to run controls on the nodes it matches. Users
+// and Controls may contain "*" to match any user (including anonymous
+// ones) or control; the node conditions which are set must all match.
+type ControlRule struct {
+	Users    []string `json:"users"`
+	Controls []string `json:"controls"`
+
+	// Topologies are the report topologies of the nodes, e.g. container
+	// or pod.
+	Topologies []string `json:"topologies,omitempty"`
+	// Namespaces are the Kubernetes namespaces of the nodes.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Labels are Docker or Kubernetes labels the nodes must have.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// LoadControlPolicy loads the control policy in path.
+func LoadControlPolicy(path string) (*ControlPolicy, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseControlPolicy(buf)
+}
+
+// ParseControlPolicy parses a YAML or JSON control policy, checking its
+// rules.
+func ParseControlPolicy(buf []byte) (*ControlPolicy, error) {
+	var p ControlPolicy
+	if err := yaml.Unmarshal(buf, &p); err != nil {
+		return nil, err
+	}
+	for i, rule := range p.Rules {
+		if len(rule.Users) == 0 || len(rule.Controls) == 0 {
+			return nil, fmt.Errorf("control rule %d needs users and controls", i)
+		}
+	}
+	return &p, nil
+}
+
+// Allowed returns whether user may run the control on n, a node of the
+// given topology.
+func (p *ControlPolicy) Allowed(user, control, topology string, n report.Node) bool {
+	for _, rule := range p.Rules {
+		if rule.allows(user, control, topology, n) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r ControlRule) allows(user, control, topology string, n report.Node) bool {
+	if !matchesAny(r.Users, user) || !matchesAny(r.Controls, control) {
+		return false
+	}
+	if len(r.Topologies) > 0 && !matchesAny(r.Topologies, topology) {
+		return false
+	}
+	if len(r.Namespaces) > 0 && !matchesAny(r.Namespaces, nodeNamespace(n)) {
+		return false
+	}
+	for key, value := range r.Labels {
+		if v, ok := labelValue(n, key); !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == s {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeNamespace returns the Kubernetes namespace of a Kubernetes object, or
+// of a container in a pod.
+func nodeNamespace(n report.Node) string {
+	if namespace, ok := n.Latest.Lookup(kubernetes.Namespace); ok {
+		return namespace
+	}
+	namespace, _ := n.Latest.Lookup(docker.LabelPrefix + "io.kubernetes.pod.namespace")
+	return namespace
+}
+
+func labelValue(n report.Node, key string) (string, bool) {
+	if value, ok := n.Latest.Lookup(docker.LabelPrefix + key); ok {
+		return value, true
+	}
+	return n.Latest.Lookup(kubernetes.LabelPrefix + key)
+}
+
+// ControlAuthorizer identifies the users of the API, and authorizes the
+// controls they run with its policy. A nil ControlAuthorizer identifies
+// nobody and allows all controls.
+type ControlAuthorizer struct {
+	// Policy authorizes controls; all are allowed if it is nil.
+	Policy *ControlPolicy
+	// UserIDHeader identifies users in requests from TrustedProxies, which
+	// are expected to have authenticated them. Requests from anywhere
+	// else are anonymous.
+	UserIDHeader   string
+	TrustedProxies []*net.IPNet
+	// BasicAuth says whether the app requires basic authentication, so
+	// the username identifies users when there is no UserIDHeader.
+	BasicAuth bool
+}
+
+// user returns the identity of the user making r, if known.
+func (a *ControlAuthorizer) user(r *http.Request) string {
+	if a == nil {
+		return ""
+	}
+	if a.UserIDHeader != "" {
+		if !a.trusted(r) {
+			return ""
+		}
+		return r.Header.Get(a.UserIDHeader)
+	}
+	if a.BasicAuth {
+		if username, _, ok := r.BasicAuth(); ok {
+			return username
+		}
+	}
+	return ""
+}
+
+// trusted says whether r comes from a trusted proxy.
+func (a *ControlAuthorizer) trusted(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, proxy := range a.TrustedProxies {
+		if ip != nil && proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// contextUser returns the user making the request in ctx, if known.
+func (a *ControlAuthorizer) contextUser(ctx context.Context) string {
+	if r, ok := ctx.Value(RequestCtxKey).(*http.Request); ok && r != nil {
+		return a.user(r)
+	}
+	return ""
+}
+
+// authorizer returns a function saying whether the user making r may run
+// a control on a node, or nil if all controls are allowed.
+func (a *ControlAuthorizer) authorizer(r *http.Request) func(control, topology string, n report.Node) bool {
+	if a == nil || a.Policy == nil {
+		return nil
+	}
+	user := a.user(r)
+	return func(control, topology string, n report.Node) bool {
+		return a.Policy.Allowed(user, control, topology, n)
+	}
+}
+
+// authorizedControls returns the controls of n the user making r may run.
+func (a *ControlAuthorizer) authorizedControls(r *http.Request, n report.Node, controls []detailed.ControlInstance) []detailed.ControlInstance {
+	allowed := a.authorizer(r)
+	if allowed == nil {
+		return controls
+	}
+	result := []detailed.ControlInstance{}
+	for _, c := range controls {
+		if allowed(c.Control.ID, n.Topology, n) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// findControlNode finds the report node a control is run on.
+func findControlNode(rpt report.Report, nodeID, control string) (string, report.Node, bool) {
+	var (
+		topology string
+		node     report.Node
+		found    bool
+	)
+	rpt.WalkNamedTopologies(func(name string, t *report.Topology) {
+		if found {
+			return
+		}
+		if _, ok := t.Controls[control]; !ok {
+			return
+		}
+		if n, ok := t.Nodes[nodeID]; ok {
+			topology, node, found = name, n, true
+		}
+	})
+	return topology, node, found
+}
+
+// ttyControls are the controls opening the terminals which resize controls
+// apply to, on the same nodes.
+var ttyControls = map[string][]string{
+	docker.ResizeExecTTY: {docker.ExecContainer, docker.AttachContainer},
+	cri.ResizeExecTTY:    {cri.ExecContainer, cri.AttachContainer},
+	host.ResizeExecTTY:   {host.ExecHost},
+}
+
+// controlAllowed says whether allowed allows a control on the node nodeID
+// of rpt. Resize controls aren't listed in topologies, so they are also
+// allowed to whoever may open the terminals they resize on the node.
+func controlAllowed(allowed func(control, topology string, n report.Node) bool, rpt report.Report, nodeID, control string) bool {
+	// Nodes which have gone can only be matched by rules without node
+	// conditions.
+	topology, node, _ := findControlNode(rpt, nodeID, control)
+	if allowed(control, topology, node) {
+		return true
+	}
+	for _, ttyControl := range ttyControls[control] {
+		if controlAllowed(allowed, rpt, nodeID, ttyControl) {
+			return true
+		}
+	}
+	return false
+}
+
+// controlDenier is a ControlRouter to be told of the control requests denied
+// by the control policy, which never reach it.
+type controlDenier interface {
+	Denied(ctx context.Context, probeID string, req xfer.Request, err error)
+}
+
+// RegisterControlRoutes registers the various control routes with a http
+// mux. Controls are authorized by a, against the nodes in rep's reports.
+func RegisterControlRoutes(router *mux.Router, cr ControlRouter, rep Reporter, a *ControlAuthorizer) {
 	router.
 		Methods("GET").
 		Path("/api/control/ws").
@@ -22,12 +273,12 @@ func RegisterControlRoutes(router *mux.Router, cr ControlRouter) {
 		Methods("POST").
 		Name("api_control_probeid_nodeid_control").
 		MatcherFunc(URLMatcher("/api/control/{probeID}/{nodeID}/{control}")).
-		HandlerFunc(requestContextDecorator(handleControl(cr)))
+		HandlerFunc(requestContextDecorator(handleControl(cr, rep, a)))
 }
 
 // handleControl routes control requests from the client to the appropriate
-// probe.  Its is blocking.
-func handleControl(cr ControlRouter) CtxHandlerFunc {
+// probe, if the control policy allows them.  Its is blocking.
+func handleControl(cr ControlRouter, rep Reporter, a *ControlAuthorizer) CtxHandlerFunc {
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		var (
 			vars        = mux.Vars(r)
@@ -45,12 +296,29 @@ func handleControl(cr ControlRouter) CtxHandlerFunc {
 				return
 			}
 		}
-
-		result, err := cr.Handle(ctx, probeID, xfer.Request{
+		req := xfer.Request{
 			NodeID:      nodeID,
 			Control:     control,
 			ControlArgs: controlArgs,
-		})
+		}
+
+		if allowed := a.authorizer(r); allowed != nil {
+			rpt, err := rep.Report(ctx, time.Now())
+			if err != nil {
+				respondWith(w, http.StatusInternalServerError, err)
+				return
+			}
+			if !controlAllowed(allowed, rpt, nodeID, control) {
+				err := fmt.Errorf("not allowed to run %s on %s", control, nodeID)
+				if d, ok := cr.(controlDenier); ok {
+					d.Denied(ctx, probeID, req, err)
+				}
+				respondWith(w, http.StatusForbidden, err.Error())
+				return
+			}
+		}
+
+		result, err := cr.Handle(ctx, probeID, req)
 		if err != nil {
 			respondWith(w, http.StatusBadRequest, err.Error())
 			return
@@ -15,11 +15,14 @@ import (
 	"github.com/weaveworks/scope/app"
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
 )
 
 func TestControl(t *testing.T) {
 	router := mux.NewRouter()
-	app.RegisterControlRoutes(router, app.NewLocalControlRouter())
+	app.RegisterControlRoutes(router, app.NewLocalControlRouter(), app.StaticCollector{}, nil)
 	server := httptest.NewServer(router)
 	defer server.Close()
 
@@ -77,3 +80,139 @@ func TestControl(t *testing.T) {
 		t.Fatalf("'%s' != 'foo'", response.Value)
 	}
 }
+
+const testControlPolicy = `
+rules:
+- users: [alice]
+  controls: [docker_exec_container, docker_stop_container]
+  topologies: [container]
+  labels: {team: payments}
+- users: ["*"]
+  controls: [host_exec]
+`
+
+// testControlAuthorizer authorizes controls with policy, identifying users
+// by the X-Scope-User header of requests from the local test servers.
+func testControlAuthorizer(policy *app.ControlPolicy) *app.ControlAuthorizer {
+	_, local, _ := net.ParseCIDR("127.0.0.0/8")
+	return &app.ControlAuthorizer{
+		Policy:         policy,
+		UserIDHeader:   "X-Scope-User",
+		TrustedProxies: []*net.IPNet{local},
+	}
+}
+
+func controlledReport() report.Report {
+	rpt := fixture.Report.Copy()
+	rpt.Container.Controls = report.Controls{}
+	rpt.Container.Controls.AddControl(report.Control{ID: docker.ExecContainer, Human: "Exec shell"})
+	rpt.Container.Controls.AddControl(report.Control{ID: docker.StopContainer, Human: "Stop"})
+	for id, node := range rpt.Container.Nodes {
+		node = node.WithLatests(map[string]string{report.ControlProbeID: "probe1"})
+		node = node.WithLatestControls(map[string]report.NodeControlData{
+			docker.ExecContainer: {},
+			docker.StopContainer: {},
+		})
+		if id == fixture.ClientContainerNodeID {
+			node = node.WithLatests(map[string]string{docker.LabelPrefix + "team": "payments"})
+		}
+		rpt.Container.Nodes[id] = node
+	}
+	return rpt
+}
+
+func TestControlPolicy(t *testing.T) {
+	policy, err := app.ParseControlPolicy([]byte(testControlPolicy))
+	ok(t, err)
+	rpt := controlledReport()
+	payments := rpt.Container.Nodes[fixture.ClientContainerNodeID]
+	other := rpt.Container.Nodes[fixture.ServerContainerNodeID]
+
+	for _, tc := range []struct {
+		user, control, topology string
+		node                    report.Node
+		want                    bool
+	}{
+		{"alice", docker.ExecContainer, report.Container, payments, true},
+		{"alice", docker.ExecContainer, report.Container, other, false},
+		{"alice", docker.ExecContainer, report.Pod, payments, false},
+		{"alice", "kubernetes_delete_pod", report.Container, payments, false},
+		{"bob", docker.ExecContainer, report.Container, payments, false},
+		{"bob", "host_exec", report.Host, report.MakeNode("host"), true},
+		{"", "host_exec", report.Host, report.MakeNode("host"), true},
+	} {
+		if have := policy.Allowed(tc.user, tc.control, tc.topology, tc.node); have != tc.want {
+			t.Errorf("%q %s on %s: want %v, have %v", tc.user, tc.control, tc.node.ID, tc.want, have)
+		}
+	}
+
+	if _, err := app.ParseControlPolicy([]byte(`rules: [{users: [alice]}]`)); err == nil {
+		t.Error("expected error for a rule without controls")
+	}
+}
+
+func TestControlPolicyRequests(t *testing.T) {
+	policy, err := app.ParseControlPolicy([]byte(testControlPolicy))
+	ok(t, err)
+	authorizer := testControlAuthorizer(policy)
+
+	rep := app.StaticCollector(controlledReport())
+	router := mux.NewRouter()
+	app.RegisterControlRoutes(router, app.NewLocalControlRouter(), rep, authorizer)
+	app.RegisterTopologyRoutes(router, app.WebReporter{Reporter: rep, Authorizer: authorizer}, map[string]bool{})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	request := func(method, path, user string) (*http.Response, []byte) {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader("{}"))
+		ok(t, err)
+		req.Header.Set("X-Scope-User", user)
+		res, err := http.DefaultClient.Do(req)
+		ok(t, err)
+		defer res.Body.Close()
+		var body []byte
+		if res.StatusCode == http.StatusOK {
+			var node app.APINode
+			ok(t, codec.NewDecoder(res.Body, &codec.JsonHandle{}).Decode(&node))
+			for _, c := range node.Node.Controls {
+				body = append(body, c.Control.ID+" "...)
+			}
+		}
+		return res, body
+	}
+
+	// Denied controls are hidden
+	nodePath := "/api/topology/containers/" + url.QueryEscape(fixture.ClientContainerNodeID)
+	_, controls := request("GET", nodePath, "alice")
+	equals(t, "docker_exec_container docker_stop_container ", string(controls))
+	_, controls = request("GET", nodePath, "bob")
+	equals(t, "", string(controls))
+
+	// and forbidden when requested directly; allowed ones reach the
+	// control router, which has no probe to run them.
+	controlPath := "/api/control/probe1/" + url.QueryEscape(fixture.ClientContainerNodeID) + "/" + docker.ExecContainer
+	res, _ := request("POST", controlPath, "bob")
+	equals(t, http.StatusForbidden, res.StatusCode)
+	res, _ = request("POST", controlPath, "alice")
+	equals(t, http.StatusBadRequest, res.StatusCode)
+
+	controlPath = "/api/control/probe1/" + url.QueryEscape(fixture.ServerContainerNodeID) + "/" + docker.ExecContainer
+	res, _ = request("POST", controlPath, "alice")
+	equals(t, http.StatusForbidden, res.StatusCode)
+
+	// Resize controls aren't listed on nodes, but are allowed to users
+	// who may open the terminals they resize.
+	resizePath := "/api/control/probe1/" + url.QueryEscape(fixture.ClientContainerNodeID) + "/" + docker.ResizeExecTTY
+	res, _ = request("POST", resizePath, "alice")
+	equals(t, http.StatusBadRequest, res.StatusCode)
+	res, _ = request("POST", resizePath, "bob")
+	equals(t, http.StatusForbidden, res.StatusCode)
+
+	// The header is only trusted from trusted proxies
+	authorizer.TrustedProxies = nil
+	res, _ = request("POST", controlPath, "alice")
+	equals(t, http.StatusForbidden, res.StatusCode)
+	hostPath := "/api/control/probe1/host1/host_exec"
+	res, _ = request("POST", hostPath, "alice")
+	equals(t, http.StatusBadRequest, res.StatusCode)
+}
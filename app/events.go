@@ -0,0 +1,391 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+// Types of lifecycle events.
+const (
+	EventAppeared        = "appeared"
+	EventDisappeared     = "disappeared"
+	EventStateChanged    = "state_changed"
+	EventPhaseChanged    = "phase_changed"
+	EventReplicasChanged = "replicas_changed"
+)
+
+// Events are detected on every new report, but no more often than this.
+const eventMinInterval = time.Second
+
+// Memory event stores keep this many of the latest events.
+const maxMemoryEvents = 10000
+
+// ErrEventsNotSupported is returned by collectors which can't store events.
+var ErrEventsNotSupported = errors.New("lifecycle events are not supported by this collector")
+
+// eventTopology is an API topology whose nodes are watched for lifecycle
+// events. Its nodes are taken from the report topologies it is rendered
+// from, whose node IDs it keeps, without rendering it.
+type eventTopology struct {
+	topologies []string
+	// keys are the metadata keys whose changes are events, with the
+	// types of those events.
+	keys map[string]string
+}
+
+var eventTopologies = map[string]eventTopology{
+	containersID: {
+		topologies: []string{report.Container},
+		keys:       map[string]string{docker.ContainerState: EventStateChanged},
+	},
+	podsID: {
+		topologies: []string{report.Pod},
+		keys:       map[string]string{kubernetes.State: EventPhaseChanged},
+	},
+	kubeControllersID: {
+		topologies: []string{report.Deployment, report.DaemonSet, report.StatefulSet, report.CronJob, report.Job},
+		keys: map[string]string{
+			kubernetes.DesiredReplicas: EventReplicasChanged,
+			kubernetes.Replicas:        EventReplicasChanged,
+		},
+	},
+	hostsID: {
+		topologies: []string{report.Host},
+	},
+}
+
+// nodes returns the nodes of the topology in rpt.
+func (t eventTopology) nodes(rpt report.Report) report.Nodes {
+	nodes := report.Nodes{}
+	for _, name := range t.topologies {
+		topology, ok := rpt.Topology(name)
+		if !ok {
+			continue
+		}
+		for id, n := range topology.Nodes {
+			nodes[id] = n.WithTopology(name)
+		}
+	}
+	return nodes
+}
+
+// Event is a lifecycle transition of a node, detected between successive
+// reports.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Topology string    `json:"topology"`
+	NodeID   string    `json:"nodeId"`
+	Label    string    `json:"label,omitempty"`
+	// Key is the metadata key which changed From one value To another.
+	Key  string `json:"key,omitempty"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+func (e Event) detail() string {
+	switch e.Type {
+	case EventAppeared, EventDisappeared:
+		return ""
+	}
+	return fmt.Sprintf("%s changed from %q to %q", e.Key, e.From, e.To)
+}
+
+// EventQuery selects events. Empty fields match any event.
+type EventQuery struct {
+	Topology string
+	NodeID   string
+	From     time.Time
+	To       time.Time
+}
+
+func (q EventQuery) matches(e Event) bool {
+	return (q.Topology == "" || q.Topology == e.Topology) &&
+		(q.NodeID == "" || q.NodeID == e.NodeID) &&
+		!e.Time.Before(q.From) &&
+		(q.To.IsZero() || !e.Time.After(q.To))
+}
+
+// EventStore stores lifecycle events. Collectors implement it: those which
+// persist reports persist events too, others keep them in a
+// MemoryEventStore, and those which can't store them return
+// ErrEventsNotSupported.
+type EventStore interface {
+	AddEvents(ctx context.Context, events []Event) error
+	// Events returns the events matching q, oldest first.
+	Events(ctx context.Context, q EventQuery) ([]Event, error)
+}
+
+// MemoryEventStore keeps the latest events in memory.
+type MemoryEventStore struct {
+	max    int
+	mtx    sync.Mutex
+	events []Event
+}
+
+// NewMemoryEventStore makes a new MemoryEventStore keeping the latest max
+// events.
+func NewMemoryEventStore(max int) *MemoryEventStore {
+	return &MemoryEventStore{max: max}
+}
+
+// AddEvents implements EventStore.
+func (s *MemoryEventStore) AddEvents(_ context.Context, events []Event) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.events = append(s.events, events...)
+	if len(s.events) > s.max {
+		s.events = append([]Event(nil), s.events[len(s.events)-s.max:]...)
+	}
+	return nil
+}
+
+// Events implements EventStore.
+func (s *MemoryEventStore) Events(_ context.Context, q EventQuery) ([]Event, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	result := []Event{}
+	for _, e := range s.events {
+		if q.matches(e) {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// EventDetector detects lifecycle events by comparing the nodes of
+// successive reports of a Reporter, and adds them to an EventStore.
+type EventDetector struct {
+	reporter Reporter
+	store    EventStore
+	quit     chan struct{}
+	done     chan struct{}
+
+	mtx sync.Mutex
+	// the report and rendered nodes of each topology events were last
+	// detected from
+	last      report.Report
+	lastNodes map[string]report.Nodes
+}
+
+// NewEventDetector makes a new EventDetector.
+func NewEventDetector(reporter Reporter, store EventStore) *EventDetector {
+	return &EventDetector{
+		reporter: reporter,
+		store:    store,
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start detecting events in the background.
+func (d *EventDetector) Start() {
+	go d.loop()
+}
+
+// Stop detecting events.
+func (d *EventDetector) Stop() {
+	close(d.quit)
+	<-d.done
+}
+
+func (d *EventDetector) loop() {
+	defer close(d.done)
+	var (
+		ctx  = context.Background()
+		wait = make(chan struct{}, 1)
+	)
+	if _, err := d.store.Events(ctx, EventQuery{To: time.Unix(0, 0)}); err == ErrEventsNotSupported {
+		log.Warnf("Not detecting events: %v", err)
+		return
+	}
+	d.reporter.WaitOn(ctx, wait)
+	defer d.reporter.UnWait(ctx, wait)
+
+	for {
+		now := time.Now()
+		rpt, err := d.reporter.Report(ctx, now)
+		if err != nil {
+			log.Errorf("Error getting report to detect events: %v", err)
+		} else if err := d.Detect(ctx, rpt, now); err != nil {
+			log.Errorf("Error storing events: %v", err)
+		}
+
+		select {
+		case <-time.After(eventMinInterval):
+		case <-d.quit:
+			return
+		}
+		select {
+		case <-wait:
+		case <-d.quit:
+			return
+		}
+	}
+}
+
+// Detect compares a report with the one events were last detected from,
+// and stores the events between them as happening at the given time. The
+// first report is only remembered.
+func (d *EventDetector) Detect(ctx context.Context, rpt report.Report, now time.Time) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	var (
+		events []Event
+		nodes  = map[string]report.Nodes{}
+	)
+	for topologyID, t := range eventTopologies {
+		nodes[topologyID] = t.nodes(rpt)
+		if d.lastNodes != nil {
+			events = append(events, detectEvents(topologyID, t.keys, d.last, d.lastNodes[topologyID], rpt, nodes[topologyID], now)...)
+		}
+	}
+	d.last, d.lastNodes = rpt, nodes
+	if len(events) == 0 {
+		return nil
+	}
+	sortEvents(events)
+	return d.store.AddEvents(ctx, events)
+}
+
+func detectEvents(topologyID string, keys map[string]string, lastRpt report.Report, last report.Nodes, rpt report.Report, nodes report.Nodes, now time.Time) []Event {
+	var events []Event
+	event := func(r report.Report, n report.Node, eventType string) Event {
+		return Event{
+			Time:     now,
+			Type:     eventType,
+			Topology: topologyID,
+			NodeID:   n.ID,
+			Label:    nodeLabel(r, n),
+		}
+	}
+	for id, n := range nodes {
+		prev, existed := last[id]
+		if !existed {
+			events = append(events, event(rpt, n, EventAppeared))
+		}
+		for key, eventType := range keys {
+			value, _ := n.Latest.Lookup(key)
+			prevValue, _ := prev.Latest.Lookup(key)
+			if existed && value != prevValue {
+				e := event(rpt, n, eventType)
+				e.Key, e.From, e.To = key, prevValue, value
+				events = append(events, e)
+			}
+		}
+	}
+	for id, n := range last {
+		if _, ok := nodes[id]; !ok {
+			events = append(events, event(lastRpt, n, EventDisappeared))
+		}
+	}
+	return events
+}
+
+func sortEvents(events []Event) {
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].Time.Equal(events[j].Time) {
+			return events[i].Time.Before(events[j].Time)
+		}
+		if events[i].Topology != events[j].Topology {
+			return events[i].Topology < events[j].Topology
+		}
+		if events[i].NodeID != events[j].NodeID {
+			return events[i].NodeID < events[j].NodeID
+		}
+		if events[i].Type != events[j].Type {
+			return events[i].Type < events[j].Type
+		}
+		return events[i].To < events[j].To
+	})
+}
+
+// nodeEventRows returns the rows of the lifecycle events table of a node.
+func nodeEventRows(ctx context.Context, store EventStore, topologyID, nodeID string) []report.Row {
+	events, err := store.Events(ctx, EventQuery{Topology: topologyID, NodeID: nodeID})
+	if err == ErrEventsNotSupported {
+		return nil
+	} else if err != nil {
+		log.Errorf("Error getting events of %s: %v", nodeID, err)
+		return nil
+	}
+	rows := make([]report.Row, 0, len(events))
+	for i, e := range events {
+		rows = append(rows, report.Row{
+			// Rows are sorted by ID; pad it to keep them in order.
+			ID: fmt.Sprintf("%08d", i),
+			Entries: map[string]string{
+				detailed.EventTimeColumn:   e.Time.UTC().Format(time.RFC3339),
+				detailed.EventTypeColumn:   e.Type,
+				detailed.EventDetailColumn: e.detail(),
+			},
+		})
+	}
+	return rows
+}
+
+// RegisterEventRoutes registers the route to query the events of s.
+func RegisterEventRoutes(router *mux.Router, s EventStore) {
+	router.Methods("GET").Path("/api/events").
+		HandlerFunc(requestContextDecorator(handleEvents(s)))
+}
+
+func handleEvents(s EventStore) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		q := EventQuery{
+			Topology: r.Form.Get("topology"),
+			NodeID:   r.Form.Get("node"),
+		}
+		for param, t := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+			value := r.Form.Get(param)
+			if value == "" {
+				continue
+			}
+			parsed, err := parseEventTime(value)
+			if err != nil {
+				respondWith(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %v", param, err))
+				return
+			}
+			*t = parsed
+		}
+		if s == nil {
+			respondWith(w, http.StatusOK, []Event{})
+			return
+		}
+		events, err := s.Events(ctx, q)
+		if err == ErrEventsNotSupported {
+			respondWith(w, http.StatusNotImplemented, err)
+			return
+		} else if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondWith(w, http.StatusOK, events)
+	}
+}
+
+// parseEventTime parses an RFC3339 time, or seconds since the epoch.
+func parseEventTime(s string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,154 @@
+package app_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestEventDetector(t *testing.T) {
+	ctx := context.Background()
+	store := app.NewMemoryEventStore(100)
+	d := app.NewEventDetector(app.StaticCollector(fixture.Report), store)
+
+	exited := fixture.Report.Copy()
+	node := exited.Container.Nodes[fixture.ClientContainerNodeID]
+	exited.Container.Nodes[fixture.ClientContainerNodeID] = node.WithLatest(docker.ContainerState, fixture.Now, docker.StateExited)
+	// Containers go with their processes
+	gone := fixture.Report.Copy()
+	delete(gone.Container.Nodes, fixture.ServerContainerNodeID)
+	for id, n := range gone.Process.Nodes {
+		if containers, _ := n.Parents.Lookup(report.Container); containers.Contains(fixture.ServerContainerNodeID) {
+			delete(gone.Process.Nodes, id)
+		}
+	}
+
+	// The first report is what changes are detected against
+	start := fixture.Now
+	if err := d.Detect(ctx, fixture.Report, start); err != nil {
+		t.Fatal(err)
+	}
+	events, _ := store.Events(ctx, app.EventQuery{})
+	equals(t, 0, len(events))
+
+	if err := d.Detect(ctx, exited, start.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Detect(ctx, gone, start.Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	events, _ = store.Events(ctx, app.EventQuery{Topology: "containers", NodeID: fixture.ClientContainerNodeID})
+	equals(t, []app.Event{
+		{
+			Time:     start.Add(time.Second),
+			Type:     app.EventStateChanged,
+			Topology: "containers",
+			NodeID:   fixture.ClientContainerNodeID,
+			Label:    fixture.ClientContainerName,
+			Key:      docker.ContainerState,
+			From:     docker.StateRunning,
+			To:       docker.StateExited,
+		},
+		{
+			Time:     start.Add(2 * time.Second),
+			Type:     app.EventStateChanged,
+			Topology: "containers",
+			NodeID:   fixture.ClientContainerNodeID,
+			Label:    fixture.ClientContainerName,
+			Key:      docker.ContainerState,
+			From:     docker.StateExited,
+			To:       docker.StateRunning,
+		},
+	}, events)
+
+	events, _ = store.Events(ctx, app.EventQuery{Topology: "containers", NodeID: fixture.ServerContainerNodeID})
+	equals(t, 1, len(events))
+	equals(t, app.EventDisappeared, events[0].Type)
+	equals(t, "server", events[0].Label) // from its ECS container name label
+
+	events, _ = store.Events(ctx, app.EventQuery{From: start.Add(2 * time.Second), To: start.Add(2 * time.Second)})
+	for _, e := range events {
+		equals(t, start.Add(2*time.Second), e.Time)
+	}
+}
+
+func TestMemoryEventStoreLimit(t *testing.T) {
+	ctx := context.Background()
+	store := app.NewMemoryEventStore(2)
+	for i := 0; i < 3; i++ {
+		store.AddEvents(ctx, []app.Event{{Time: fixture.Now.Add(time.Duration(i) * time.Second), Type: app.EventAppeared}})
+	}
+	events, _ := store.Events(ctx, app.EventQuery{})
+	equals(t, 2, len(events))
+	equals(t, fixture.Now.Add(time.Second), events[0].Time)
+}
+
+func TestEventRoutes(t *testing.T) {
+	ctx := context.Background()
+	store := app.NewMemoryEventStore(100)
+	store.AddEvents(ctx, []app.Event{
+		{Time: fixture.Now, Type: app.EventAppeared, Topology: "containers", NodeID: fixture.ClientContainerNodeID},
+		{Time: fixture.Now.Add(time.Minute), Type: app.EventAppeared, Topology: "containers", NodeID: fixture.ServerContainerNodeID},
+	})
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterEventRoutes(router, store)
+	app.RegisterTopologyRoutes(router, app.WebReporter{Reporter: app.StaticCollector(fixture.Report), Events: store}, nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var events []app.Event
+	if err := json.Unmarshal(getRawJSON(t, ts, "/api/events?topology=containers&node="+url.QueryEscape(fixture.ClientContainerNodeID)), &events); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 1, len(events))
+	equals(t, fixture.ClientContainerNodeID, events[0].NodeID)
+
+	if err := json.Unmarshal(getRawJSON(t, ts, "/api/events?from="+url.QueryEscape(fixture.Now.Add(time.Second).Format(time.RFC3339))), &events); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 1, len(events))
+	equals(t, fixture.ServerContainerNodeID, events[0].NodeID)
+
+	res, _ := checkGet(t, ts, "/api/events?to=yesterday")
+	equals(t, 400, res.StatusCode)
+
+	var node app.APINode
+	body := getRawJSON(t, ts, "/api/topology/containers/"+url.QueryEscape(fixture.ClientContainerNodeID))
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&node); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, table := range node.Node.Tables {
+		if table.ID == detailed.EventsTableID {
+			found = true
+			equals(t, 1, len(table.Rows))
+			equals(t, app.EventAppeared, table.Rows[0].Entries[detailed.EventTypeColumn])
+		}
+	}
+	if !found {
+		t.Errorf("Expected a lifecycle events table, got %v", node.Node.Tables)
+	}
+}
+
+func TestEventRoutesNotSupported(t *testing.T) {
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterEventRoutes(router, app.StaticCollector(fixture.Report))
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	res, _ := checkGet(t, ts, "/api/events")
+	equals(t, 501, res.StatusCode)
+}
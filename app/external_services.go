@@ -0,0 +1,142 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+// ExternalServicesWriteControl is the control users need to be allowed, by
+// a rule without node conditions, to replace the external service catalogue
+// when there is a control policy.
+const ExternalServicesWriteControl = "write_external_services"
+
+// ExternalServices holds the catalogue of external services rendered as
+// pseudo nodes of their own. It can be loaded from a file, and reloaded on
+// demand.
+type ExternalServices struct {
+	mtx       sync.Mutex
+	path      string
+	catalogue *render.ExternalServiceCatalogue
+}
+
+// NewExternalServices loads the external service catalogue in path. If path
+// is empty, the catalogue starts off empty.
+func NewExternalServices(path string) (*ExternalServices, error) {
+	e := &ExternalServices{path: path, catalogue: &render.ExternalServiceCatalogue{}}
+	if path == "" {
+		return e, nil
+	}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Catalogue returns the external service catalogue in use.
+func (e *ExternalServices) Catalogue() *render.ExternalServiceCatalogue {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.catalogue
+}
+
+func (e *ExternalServices) set(catalogue *render.ExternalServiceCatalogue) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.catalogue = catalogue
+}
+
+// Reload reloads the external service catalogue from its file. If the file
+// can't be loaded, the catalogue in use is kept.
+func (e *ExternalServices) Reload() error {
+	if e.path == "" {
+		return fmt.Errorf("no external services file configured")
+	}
+	catalogue, err := render.LoadExternalServices(e.path)
+	if err != nil {
+		return fmt.Errorf("error loading external services from %s: %v", e.path, err)
+	}
+	e.set(catalogue)
+	log.Infof("Loaded %d external services from %s", len(catalogue.Services), e.path)
+	return nil
+}
+
+// Context returns a context rendering with the catalogue in use. e may be
+// nil, in which case no external services are rendered.
+func (e *ExternalServices) Context(ctx context.Context) context.Context {
+	if e == nil {
+		return ctx
+	}
+	return render.WithExternalServices(ctx, e.Catalogue())
+}
+
+// Wrap implements middleware.Interface, rendering everything next renders
+// with the catalogue in use.
+func (e *ExternalServices) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(e.Context(r.Context())))
+	})
+}
+
+// RegisterExternalServicesRoutes registers the routes to get, replace and
+// reload the external service catalogue. When authorizer has a control
+// policy, only users it allows ExternalServicesWriteControl may replace it.
+func RegisterExternalServicesRoutes(router *mux.Router, e *ExternalServices, authorizer *ControlAuthorizer) {
+	router.Methods("GET").Path("/api/external-services").
+		HandlerFunc(requestContextDecorator(handleGetExternalServices(e)))
+	router.Methods("PUT").Path("/api/external-services").
+		HandlerFunc(requestContextDecorator(handlePutExternalServices(e, authorizer)))
+	router.Methods("POST").Path("/api/external-services/reload").
+		HandlerFunc(requestContextDecorator(handleReloadExternalServices(e)))
+}
+
+func handleGetExternalServices(e *ExternalServices) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		respondWith(w, http.StatusOK, e.Catalogue())
+	}
+}
+
+// handlePutExternalServices replaces the catalogue with the one in the
+// request body, as YAML or JSON. It lasts until the next reload.
+func handlePutExternalServices(e *ExternalServices, authorizer *ControlAuthorizer) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if allowed := authorizer.authorizer(r); allowed != nil && !allowed(ExternalServicesWriteControl, "", report.MakeNode("")) {
+			respondWith(w, http.StatusForbidden, "not allowed to replace the external services")
+			return
+		}
+		buf, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		catalogue, err := render.ParseExternalServices(buf)
+		if err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		e.set(catalogue)
+		respondWith(w, http.StatusOK, catalogue)
+	}
+}
+
+func handleReloadExternalServices(e *ExternalServices) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if e.path == "" {
+			respondWith(w, http.StatusNotFound, fmt.Errorf("no external services file configured"))
+			return
+		}
+		if err := e.Reload(); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		respondWith(w, http.StatusOK, e.Catalogue())
+	}
+}
@@ -0,0 +1,106 @@
+package app_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/render"
+)
+
+func getExternalServices(t *testing.T, ts *httptest.Server) render.ExternalServiceCatalogue {
+	var catalogue render.ExternalServiceCatalogue
+	body := getRawJSON(t, ts, "/api/external-services")
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&catalogue); err != nil {
+		t.Fatalf("JSON parse error: %s", err)
+	}
+	return catalogue
+}
+
+func TestExternalServices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-external-services")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "services.yaml")
+	ok(t, ioutil.WriteFile(path, []byte("services: [{name: Stripe API, include: [{dnsSuffix: stripe.com}]}]\n"), 0644))
+
+	externalServices, err := app.NewExternalServices(path)
+	ok(t, err)
+	router := mux.NewRouter()
+	app.RegisterExternalServicesRoutes(router, externalServices, nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	catalogue := getExternalServices(t, ts)
+	equals(t, 1, len(catalogue.Services))
+	equals(t, "Stripe API", catalogue.Services[0].Name)
+
+	// Reloading picks up changes to the file, but not broken ones
+	ok(t, ioutil.WriteFile(path, []byte("services: [{name: Corporate VPN, include: [{cidr: 10.20.0.0/16}]}]\n"), 0644))
+	res, _ := checkRequest(t, ts, "POST", "/api/external-services/reload", nil)
+	equals(t, http.StatusOK, res.StatusCode)
+	equals(t, "Corporate VPN", getExternalServices(t, ts).Services[0].Name)
+
+	ok(t, ioutil.WriteFile(path, []byte("services: [{name: Corporate VPN, include: [{cidr: 10.20.0.0/99}]}]\n"), 0644))
+	res, _ = checkRequest(t, ts, "POST", "/api/external-services/reload", nil)
+	equals(t, http.StatusBadRequest, res.StatusCode)
+	equals(t, "Corporate VPN", getExternalServices(t, ts).Services[0].Name)
+
+	// Replacing the catalogue through the API
+	res, _ = checkRequest(t, ts, "PUT", "/api/external-services", []byte(`{"services": [{"name": "Partner", "include": [{"port": 8443}]}]}`))
+	equals(t, http.StatusOK, res.StatusCode)
+	equals(t, "Partner", getExternalServices(t, ts).Services[0].Name)
+
+	res, _ = checkRequest(t, ts, "PUT", "/api/external-services", []byte(`{"services": [{"name": "Partner"}]}`))
+	equals(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestExternalServicesPolicy(t *testing.T) {
+	externalServices, err := app.NewExternalServices("")
+	ok(t, err)
+	policy, err := app.ParseControlPolicy([]byte(`rules: [{users: [alice], controls: [write_external_services]}]`))
+	ok(t, err)
+	router := mux.NewRouter()
+	app.RegisterExternalServicesRoutes(router, externalServices, testControlAuthorizer(policy))
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Only users allowed to may replace the catalogue
+	put := func(user string) int {
+		req, err := http.NewRequest("PUT", ts.URL+"/api/external-services", strings.NewReader(`{"services": [{"name": "Partner", "include": [{"port": 8443}]}]}`))
+		ok(t, err)
+		req.Header.Set("X-Scope-User", user)
+		res, err := http.DefaultClient.Do(req)
+		ok(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	equals(t, http.StatusForbidden, put("bob"))
+	equals(t, 0, len(getExternalServices(t, ts).Services))
+	equals(t, http.StatusOK, put("alice"))
+	equals(t, "Partner", getExternalServices(t, ts).Services[0].Name)
+}
+
+func TestExternalServicesWithoutFile(t *testing.T) {
+	externalServices, err := app.NewExternalServices("")
+	ok(t, err)
+	router := mux.NewRouter()
+	app.RegisterExternalServicesRoutes(router, externalServices, nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	equals(t, 0, len(getExternalServices(t, ts).Services))
+	res, _ := checkRequest(t, ts, "POST", "/api/external-services/reload", nil)
+	equals(t, http.StatusNotFound, res.StatusCode)
+	res, _ = checkRequest(t, ts, "PUT", "/api/external-services", []byte(`{"services": [{"name": "Partner", "include": [{"port": 8443}]}]}`))
+	equals(t, http.StatusOK, res.StatusCode)
+	equals(t, "Partner", getExternalServices(t, ts).Services[0].Name)
+}
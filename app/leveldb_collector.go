@@ -0,0 +1,409 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// How often the persistent collector enforces its retention limits.
+const retentionInterval = time.Minute
+
+// Lifecycle events are stored under this prefix, which sorts after the
+// timestamp keys of reports.
+var eventKeyPrefix = []byte{0xff}
+
+// eventKeys is the range of all event keys. Unlike util.BytesPrefix, it has
+// a limit, which DB.SizeOf needs to measure it.
+var eventKeys = util.Range{
+	Start: eventKeyPrefix,
+	Limit: bytes.Repeat([]byte{0xff}, len(eventKey(time.Time{}, 0))+1),
+}
+
+// Reports received in the current reportQuantisationInterval are stored
+// under this prefix until they are merged, so they survive a crash.
+var pendingKeyPrefix = []byte{0xfe}
+
+// LevelDBCollectorConfig is the configuration for a persistent collector.
+type LevelDBCollectorConfig struct {
+	// Path of the database directory.
+	Path string
+	// Window is the amount of time merged into each served report.
+	Window time.Duration
+	// Reports older than Retention are deleted. Zero means no limit.
+	Retention time.Duration
+	// When the database grows over MaxSize bytes, the oldest reports and
+	// events are deleted. Zero means no limit.
+	MaxSize int64
+}
+
+// levelDBCollector keeps the reports of the last window in memory, like the
+// local collector, and additionally persists one merged report per
+// reportQuantisationInterval in an embedded LevelDB database, so that past
+// reports can be served without any external storage. It persists
+// lifecycle events too, implementing EventStore.
+type levelDBCollector struct {
+	Collector // serves the live window and handles waiters
+	cfg       LevelDBCollectorConfig
+	db        *leveldb.DB
+	merger    Merger
+
+	mtx          sync.Mutex
+	pending      []report.Report
+	pendingStart time.Time
+	pendingSeq   uint32
+	eventSeq     uint32
+
+	quit chan struct{}
+}
+
+// NewLevelDBCollector returns a collector persisting reports in a LevelDB
+// database at cfg.Path, which is created if it doesn't exist.
+func NewLevelDBCollector(cfg LevelDBCollectorConfig) (Collector, error) {
+	db, err := leveldb.OpenFile(cfg.Path, nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &levelDBCollector{
+		Collector: NewCollector(cfg.Window),
+		cfg:       cfg,
+		db:        db,
+		merger:    NewFastMerger(),
+		quit:      make(chan struct{}),
+	}
+	if err := c.loadPending(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	go c.loop()
+	return c, nil
+}
+
+// loadPending reads back the pending reports a previous run didn't get to
+// merge, e.g. because it crashed.
+func (c *levelDBCollector) loadPending() error {
+	iter := c.db.NewIterator(util.BytesPrefix(pendingKeyPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		rpt, err := report.MakeFromBytes(iter.Value())
+		if err != nil {
+			return err
+		}
+		if len(c.pending) == 0 {
+			key := iter.Key()[len(pendingKeyPrefix):]
+			c.pendingStart = time.Unix(0, int64(binary.BigEndian.Uint64(key)))
+		}
+		c.pending = append(c.pending, rpt.Upgrade())
+	}
+	return iter.Error()
+}
+
+// Add adds a report to the live collector, and persists the merger of
+// the reports received in each reportQuantisationInterval. Each report is
+// written to the database before Add returns, so acknowledged reports
+// aren't lost if the app crashes before merging them. It implements Adder.
+func (c *levelDBCollector) Add(ctx context.Context, rpt report.Report, buf []byte) error {
+	// buf is the report as gzip'd msgpack already, as it is stored, unless
+	// the caller didn't have it.
+	if buf == nil {
+		encoded, err := rpt.WriteBinary()
+		if err != nil {
+			return err
+		}
+		buf = encoded.Bytes()
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	now := mtime.Now()
+	if len(c.pending) > 0 && now.Sub(c.pendingStart) >= reportQuantisationInterval {
+		if err := c.flush(); err != nil {
+			return err
+		}
+	}
+	if len(c.pending) == 0 {
+		c.pendingStart = now
+	}
+	c.pendingSeq++
+	if err := c.db.Put(sequencedKey(pendingKeyPrefix, now, c.pendingSeq), buf, nil); err != nil {
+		return err
+	}
+	c.pending = append(c.pending, rpt)
+	return c.Collector.Add(ctx, rpt, buf)
+}
+
+// flush replaces the pending reports in the database with their merger.
+// The caller must hold c.mtx.
+func (c *levelDBCollector) flush() error {
+	rpt := c.merger.Merge(c.pending)
+	buf, err := rpt.WriteBinary()
+	if err != nil {
+		return err
+	}
+	batch := new(leveldb.Batch)
+	batch.Put(timestampKey(c.pendingStart), buf.Bytes())
+	iter := c.db.NewIterator(util.BytesPrefix(pendingKeyPrefix), nil)
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if err := c.db.Write(batch, nil); err != nil {
+		return err
+	}
+	c.pending = nil
+	return nil
+}
+
+// Report returns the merged report for the window ending at timestamp. Recent
+// timestamps are served by the live collector, older ones from the
+// database. It implements Reporter.
+func (c *levelDBCollector) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	if c.isLive(timestamp) {
+		return c.Collector.Report(ctx, timestamp)
+	}
+
+	snapshot, pending, err := c.snapshot(timestamp)
+	if err != nil {
+		return report.MakeReport(), err
+	}
+	defer snapshot.Release()
+	var reports []report.Report
+	for _, rpt := range pending {
+		reports = append(reports, rpt.Upgrade())
+	}
+	iter := snapshot.NewIterator(c.windowRange(timestamp), nil)
+	defer iter.Release()
+	for iter.Next() {
+		rpt, err := report.MakeFromBytes(iter.Value())
+		if err != nil {
+			return report.MakeReport(), err
+		}
+		reports = append(reports, rpt.Upgrade())
+	}
+	if err := iter.Error(); err != nil {
+		return report.MakeReport(), err
+	}
+	return c.merger.Merge(reports), nil
+}
+
+// HasReports indicates whether the collector contains reports between
+// timestamp-app.window and timestamp.
+func (c *levelDBCollector) HasReports(ctx context.Context, timestamp time.Time) (bool, error) {
+	if c.isLive(timestamp) {
+		return c.Collector.HasReports(ctx, timestamp)
+	}
+	snapshot, pending, err := c.snapshot(timestamp)
+	if err != nil {
+		return false, err
+	}
+	defer snapshot.Release()
+	if len(pending) > 0 {
+		return true, nil
+	}
+	iter := snapshot.NewIterator(c.windowRange(timestamp), nil)
+	defer iter.Release()
+	return iter.First(), iter.Error()
+}
+
+// HasHistoricReports indicates whether the collector contains reports
+// older than now-app.window.
+func (c *levelDBCollector) HasHistoricReports() bool {
+	return true
+}
+
+// Close stops the retention loop, persists the pending reports and closes
+// the database.
+func (c *levelDBCollector) Close() error {
+	close(c.quit)
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if len(c.pending) > 0 {
+		if err := c.flush(); err != nil {
+			log.Errorf("Error persisting pending reports: %v", err)
+		}
+	}
+	return c.db.Close()
+}
+
+func (c *levelDBCollector) isLive(timestamp time.Time) bool {
+	return mtime.Now().Sub(timestamp) < reportQuantisationInterval
+}
+
+// snapshot returns a snapshot of the database, and the pending reports if
+// they are in the window ending at timestamp. Those are only persisted
+// under the start of their interval once merged, which doesn't happen
+// until the next report arrives, however long the live collector has
+// stopped serving them.
+func (c *levelDBCollector) snapshot(timestamp time.Time) (*leveldb.Snapshot, []report.Report, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	snapshot, err := c.db.GetSnapshot()
+	if err != nil {
+		return nil, nil, err
+	}
+	var pending []report.Report
+	if len(c.pending) > 0 && !c.pendingStart.Before(timestamp.Add(-c.cfg.Window)) && !c.pendingStart.After(timestamp) {
+		pending = append(pending, c.pending...)
+	}
+	return snapshot, pending, nil
+}
+
+func (c *levelDBCollector) windowRange(timestamp time.Time) *util.Range {
+	return &util.Range{
+		Start: timestampKey(timestamp.Add(-c.cfg.Window)),
+		Limit: timestampKey(timestamp.Add(1)),
+	}
+}
+
+func (c *levelDBCollector) loop() {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.enforceRetention(); err != nil {
+				log.Errorf("Error enforcing report retention: %v", err)
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// enforceRetention deletes the reports and events which are older than the
+// retention period, and then the oldest reports and events until the
+// database fits in MaxSize. The same fraction of reports and events is
+// deleted, as the excess is of the size of both on disk.
+func (c *levelDBCollector) enforceRetention() error {
+	if c.cfg.Retention > 0 {
+		cutoff := mtime.Now().Add(-c.cfg.Retention)
+		expired := &util.Range{Limit: timestampKey(cutoff)}
+		if err := c.deleteRange(expired, 1); err != nil {
+			return err
+		}
+		expiredEvents := &util.Range{Start: eventKeyPrefix, Limit: eventKey(cutoff, 0)}
+		if err := c.deleteRange(expiredEvents, 1); err != nil {
+			return err
+		}
+	}
+	if c.cfg.MaxSize > 0 {
+		ranges := []util.Range{{Limit: pendingKeyPrefix}, eventKeys}
+		sizes, err := c.db.SizeOf(ranges)
+		if err != nil {
+			return err
+		}
+		total := sizes.Sum()
+		if excess := total - c.cfg.MaxSize; excess > 0 && total > 0 {
+			fraction := float64(excess) / float64(total)
+			for i := range ranges {
+				if err := c.deleteRange(&ranges[i], fraction); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// AddEvents persists lifecycle events. It implements EventStore.
+func (c *levelDBCollector) AddEvents(_ context.Context, events []Event) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	batch := new(leveldb.Batch)
+	for _, e := range events {
+		buf, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		c.eventSeq++
+		batch.Put(eventKey(e.Time, c.eventSeq), buf)
+	}
+	return c.db.Write(batch, nil)
+}
+
+// Events returns the persisted lifecycle events matching q, oldest first.
+// It implements EventStore.
+func (c *levelDBCollector) Events(_ context.Context, q EventQuery) ([]Event, error) {
+	r := util.BytesPrefix(eventKeyPrefix)
+	if !q.From.IsZero() {
+		r.Start = eventKey(q.From, 0)
+	}
+	if !q.To.IsZero() {
+		r.Limit = eventKey(q.To.Add(1), 0)
+	}
+	result := []Event{}
+	iter := c.db.NewIterator(r, nil)
+	defer iter.Release()
+	for iter.Next() {
+		var e Event
+		if err := json.Unmarshal(iter.Value(), &e); err != nil {
+			return nil, err
+		}
+		if q.matches(e) {
+			result = append(result, e)
+		}
+	}
+	return result, iter.Error()
+}
+
+// deleteRange deletes the records in r, oldest first, until at least the
+// given fraction of their size has been deleted; 1 deletes them all. Sizes
+// are those of the keys and values, as the database only measures the
+// compressed size of ranges on disk.
+func (c *levelDBCollector) deleteRange(r *util.Range, fraction float64) error {
+	var (
+		batch          = new(leveldb.Batch)
+		total, deleted int64
+		iter           = c.db.NewIterator(r, nil)
+	)
+	for iter.Next() {
+		total += int64(len(iter.Key()) + len(iter.Value()))
+	}
+	maxBytes := int64(fraction * float64(total))
+	for ok := iter.First(); ok && deleted < maxBytes; ok = iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+		deleted += int64(len(iter.Key()) + len(iter.Value()))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+	log.Debugf("Deleting %d persisted records", batch.Len())
+	if err := c.db.Write(batch, nil); err != nil {
+		return err
+	}
+	return c.db.CompactRange(*r)
+}
+
+// eventKey is the key of an event at t, made unique by seq.
+func eventKey(t time.Time, seq uint32) []byte {
+	return sequencedKey(eventKeyPrefix, t, seq)
+}
+
+// sequencedKey is a key under prefix which sorts by t, made unique by seq.
+func sequencedKey(prefix []byte, t time.Time, seq uint32) []byte {
+	key := append(append([]byte{}, prefix...), timestampKey(t)...)
+	return append(key, byte(seq>>24), byte(seq>>16), byte(seq>>8), byte(seq))
+}
+
+// timestampKey encodes a timestamp so that keys sort chronologically.
+func timestampKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
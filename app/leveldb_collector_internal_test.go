@@ -0,0 +1,326 @@
+package app
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestLevelDBCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	cfg := LevelDBCollectorConfig{Path: dir, Window: 10 * time.Second, Retention: time.Hour}
+	coll, err := NewLevelDBCollector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := coll.(*levelDBCollector)
+
+	r1 := report.MakeReport()
+	r1.Endpoint.AddNode(report.MakeNode("foo"))
+	r2 := report.MakeReport()
+	r2.Endpoint.AddNode(report.MakeNode("bar"))
+	r3 := report.MakeReport()
+	r3.Endpoint.AddNode(report.MakeNode("baz"))
+
+	c.Add(ctx, r1, nil)
+	mtime.NowForce(now.Add(time.Second))
+	c.Add(ctx, r2, nil)
+	// r3 arrives in the next quantisation interval, which persists r1 and r2.
+	mtime.NowForce(now.Add(time.Minute))
+	c.Add(ctx, r3, nil)
+
+	want := report.MakeReport()
+	want.Endpoint.AddNode(report.MakeNode("foo"))
+	want.Endpoint.AddNode(report.MakeNode("bar"))
+	have, err := c.Report(ctx, now.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want.Endpoint.Nodes, have.Endpoint.Nodes) {
+		t.Error(test.Diff(want.Endpoint.Nodes, have.Endpoint.Nodes))
+	}
+	if ok, err := c.HasReports(ctx, now.Add(time.Second)); !ok || err != nil {
+		t.Errorf("expected persisted reports: %v, %v", ok, err)
+	}
+	if ok, err := c.HasReports(ctx, now.Add(-time.Minute)); ok || err != nil {
+		t.Errorf("expected no reports before the first one: %v, %v", ok, err)
+	}
+	if !c.HasHistoricReports() {
+		t.Error("expected historic reports")
+	}
+
+	// Recent timestamps are served by the live collector.
+	have, err = c.Report(ctx, mtime.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := have.Endpoint.Nodes["baz"]; !ok {
+		t.Errorf("expected live report, got %v", have.Endpoint.Nodes)
+	}
+
+	// Persisted reports disappear once they exceed the retention period.
+	mtime.NowForce(now.Add(2 * time.Hour))
+	if err := c.enforceRetention(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.HasReports(ctx, now.Add(time.Second)); ok || err != nil {
+		t.Errorf("expected expired reports to be deleted: %v, %v", ok, err)
+	}
+
+	// Pending reports are persisted on close, and survive a restart.
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	coll, err = NewLevelDBCollector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = coll.(*levelDBCollector)
+	defer c.Close()
+	have, err = c.Report(ctx, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := have.Endpoint.Nodes["baz"]; !ok {
+		t.Errorf("expected report persisted on close, got %v", have.Endpoint.Nodes)
+	}
+}
+
+func TestLevelDBCollectorBoundary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	coll, err := NewLevelDBCollector(LevelDBCollectorConfig{Path: dir, Window: 10 * time.Second, Retention: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := coll.(*levelDBCollector)
+	defer c.Close()
+
+	r1 := report.MakeReport()
+	r1.Endpoint.AddNode(report.MakeNode("foo"))
+	buf, err := r1.WriteBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add(ctx, r1, buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	// No report has arrived since, so r1 is still pending when the live
+	// collector stops serving its timestamp.
+	mtime.NowForce(now.Add(2 * reportQuantisationInterval))
+	ts := now.Add(time.Second)
+	if c.isLive(ts) {
+		t.Fatal("expected a historic timestamp")
+	}
+	have, err := c.Report(ctx, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := have.Endpoint.Nodes["foo"]; !ok {
+		t.Errorf("expected pending report, got %v", have.Endpoint.Nodes)
+	}
+	if ok, err := c.HasReports(ctx, ts); !ok || err != nil {
+		t.Errorf("expected pending reports: %v, %v", ok, err)
+	}
+	if ok, err := c.HasReports(ctx, now.Add(-time.Second)); ok || err != nil {
+		t.Errorf("expected no reports before the pending one: %v, %v", ok, err)
+	}
+}
+
+func TestLevelDBCollectorCrash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	cfg := LevelDBCollectorConfig{Path: dir, Window: 10 * time.Second}
+	coll, err := NewLevelDBCollector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := coll.(*levelDBCollector)
+	r1 := report.MakeReport()
+	r1.Endpoint.AddNode(report.MakeNode("foo"))
+	if err := c.Add(ctx, r1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stop without persisting the pending reports, as a crash would.
+	close(c.quit)
+	if err := c.db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	coll, err = NewLevelDBCollector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = coll.(*levelDBCollector)
+	defer c.Close()
+	mtime.NowForce(now.Add(time.Minute))
+	r2 := report.MakeReport()
+	r2.Endpoint.AddNode(report.MakeNode("bar"))
+	if err := c.Add(ctx, r2, nil); err != nil {
+		t.Fatal(err)
+	}
+	have, err := c.Report(ctx, now.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := have.Endpoint.Nodes["foo"]; !ok {
+		t.Errorf("expected the acknowledged report to survive a crash, got %v", have.Endpoint.Nodes)
+	}
+}
+
+func TestLevelDBCollectorEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	cfg := LevelDBCollectorConfig{Path: dir, Window: 10 * time.Second, Retention: time.Hour}
+	coll, err := NewLevelDBCollector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := coll.(*levelDBCollector)
+
+	// Events don't get in the way of reports
+	c.Add(ctx, report.MakeReport(), nil)
+	mtime.NowForce(now.Add(time.Minute))
+	c.Add(ctx, report.MakeReport(), nil)
+
+	events := []Event{
+		{Time: now.UTC(), Type: EventAppeared, Topology: "hosts", NodeID: "a"},
+		{Time: now.UTC(), Type: EventAppeared, Topology: "hosts", NodeID: "b"},
+		{Time: now.Add(time.Minute).UTC(), Type: EventDisappeared, Topology: "hosts", NodeID: "a"},
+	}
+	if err := c.AddEvents(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		q    EventQuery
+		want []Event
+	}{
+		{EventQuery{}, events},
+		{EventQuery{NodeID: "a"}, []Event{events[0], events[2]}},
+		{EventQuery{From: now.Add(time.Second)}, events[2:]},
+		{EventQuery{To: now}, events[:2]},
+	} {
+		have, err := c.Events(ctx, tc.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tc.want, have) {
+			t.Errorf("%+v: %s", tc.q, test.Diff(tc.want, have))
+		}
+	}
+	if ok, err := c.HasReports(ctx, now); !ok || err != nil {
+		t.Errorf("expected persisted reports: %v, %v", ok, err)
+	}
+
+	// Events expire along with reports, and otherwise survive a restart.
+	mtime.NowForce(now.Add(time.Hour + time.Second))
+	if err := c.enforceRetention(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	coll, err = NewLevelDBCollector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = coll.(*levelDBCollector)
+	defer c.Close()
+	have, err := c.Events(ctx, EventQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(events[2:], have) {
+		t.Error(test.Diff(events[2:], have))
+	}
+}
+
+func TestLevelDBCollectorEventsMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	coll, err := NewLevelDBCollector(LevelDBCollectorConfig{Path: dir, Window: 10 * time.Second, MaxSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := coll.(*levelDBCollector)
+	defer c.Close()
+
+	now := time.Now().UTC()
+	events := []Event{}
+	for i := 0; i < 1000; i++ {
+		events = append(events, Event{Time: now.Add(time.Duration(i) * time.Second), Type: EventAppeared, Topology: "hosts", NodeID: strconv.Itoa(i)})
+	}
+	if err := c.AddEvents(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+	// Sizes are only known once written to disk
+	if err := c.db.CompactRange(util.Range{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.enforceRetention(); err != nil {
+		t.Fatal(err)
+	}
+	have, err := c.Events(ctx, EventQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(have) == 0 || len(have) == len(events) {
+		t.Fatalf("expected the oldest events to be deleted, have %d of %d", len(have), len(events))
+	}
+	if !reflect.DeepEqual(events[len(events)-len(have):], have) {
+		t.Error("expected the latest events to be kept")
+	}
+}
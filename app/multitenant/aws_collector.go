@@ -555,6 +555,17 @@ func (c *awsCollector) UnWait(ctx context.Context, waiter chan struct{}) {
 	}
 }
 
+// AddEvents implements app.EventStore; events are not stored by the
+// multitenant collector.
+func (c *awsCollector) AddEvents(context.Context, []app.Event) error {
+	return app.ErrEventsNotSupported
+}
+
+// Events implements app.EventStore.
+func (c *awsCollector) Events(context.Context, app.EventQuery) ([]app.Event, error) {
+	return nil, app.ErrEventsNotSupported
+}
+
 type inProcessStore struct {
 	cache gcache.Cache
 }
@@ -0,0 +1,492 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"context"
+
+	"github.com/ghodss/yaml"
+	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	// Reports are sampled at least networkPolicyStep apart (the default
+	// app window) over the requested time window, and at most
+	// maxNetworkPolicySamples of them are used.
+	networkPolicyStep       = 15 * time.Second
+	maxNetworkPolicySamples = 240
+
+	// Namespace label set by Kubernetes, used to select namespaces for
+	// which the probes didn't report any labels.
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+
+	// Annotations listing why a direction was left out of a policy.
+	incompleteIngressAnnotation = "scope.weave.works/incomplete-ingress"
+	incompleteEgressAnnotation  = "scope.weave.works/incomplete-egress"
+
+	// Peers which are addresses outside the pods, rather than podSelector
+	// keys, start with this.
+	ipBlockPeerPrefix = "ipblock:"
+)
+
+// Policies allowing egress always allow DNS lookups, which the probes
+// don't necessarily see, e.g. when not tracking UDP.
+var (
+	dnsPeer = networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{namespaceNameLabel: "kube-system"}},
+		PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"k8s-app": "kube-dns"}},
+	}
+	dnsPorts = map[policyPort]struct{}{
+		{protocol: apiv1.ProtocolUDP, port: 53}: {},
+		{protocol: apiv1.ProtocolTCP, port: 53}: {},
+	}
+)
+
+// Pod labels which differ between pods of the same controller, and so
+// mustn't be used in selectors.
+var podInstanceLabels = map[string]struct{}{
+	"pod-template-hash":                  {},
+	"pod-template-generation":            {},
+	"controller-revision-hash":           {},
+	"controller-uid":                     {},
+	"statefulset.kubernetes.io/pod-name": {},
+}
+
+var invalidPolicyNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// Generate Kubernetes NetworkPolicies allowing the pod connections
+// observed in a namespace over a time window.
+func makeNetworkPolicyHandler(rep Reporter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondWith(w, http.StatusBadRequest, err)
+			return
+		}
+		namespace := r.Form.Get("namespace")
+		if namespace == "" {
+			respondWith(w, http.StatusBadRequest, "missing 'namespace'")
+			return
+		}
+		to := time.Now()
+		if t := r.Form.Get("to"); t != "" {
+			var err error
+			if to, err = time.Parse(time.RFC3339, t); err != nil {
+				respondWith(w, http.StatusBadRequest, fmt.Sprintf("invalid 'to' timestamp: %v", err))
+				return
+			}
+		}
+		from := to
+		if t := r.Form.Get("from"); t != "" {
+			var err error
+			if from, err = time.Parse(time.RFC3339, t); err != nil {
+				respondWith(w, http.StatusBadRequest, fmt.Sprintf("invalid 'from' timestamp: %v", err))
+				return
+			}
+		}
+		if from.After(to) {
+			respondWith(w, http.StatusBadRequest, "'from' is after 'to'")
+			return
+		}
+		// Without historic reports, every timestamp gets the same recent
+		// report, so a single sample will do.
+		if !rep.HasHistoricReports() {
+			from = to
+		}
+
+		step := to.Sub(from) / maxNetworkPolicySamples
+		if step < networkPolicyStep {
+			step = networkPolicyStep
+		}
+		conns := newPodConnections()
+		for ts := to; !ts.Before(from); ts = ts.Add(-step) {
+			rpt, err := rep.Report(ctx, ts)
+			if err != nil {
+				respondWith(w, http.StatusInternalServerError, err)
+				return
+			}
+			conns.addReport(ctx, rpt)
+		}
+
+		var buf []byte
+		for _, policy := range conns.networkPolicies(namespace) {
+			out, err := yaml.Marshal(policy)
+			if err != nil {
+				respondWith(w, http.StatusInternalServerError, err)
+				return
+			}
+			buf = append(buf, "---\n"...)
+			buf = append(buf, out...)
+		}
+		w.Header().Set("Content-Type", "application/x-yaml")
+		w.Header().Add("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf)
+	}
+}
+
+// podSelector identifies a set of pods by namespace and labels.
+type podSelector struct {
+	namespace string
+	labels    map[string]string
+}
+
+func (s podSelector) key() string {
+	keys := make([]string, 0, len(s.labels))
+	for k := range s.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(s.namespace)
+	for _, k := range keys {
+		fmt.Fprintf(&b, ";%s=%s", k, s.labels[k])
+	}
+	return b.String()
+}
+
+// name returns a readable policy name for the pods selected.
+func (s podSelector) name() string {
+	base := ""
+	for _, k := range []string{"app.kubernetes.io/name", "app", "name", "k8s-app"} {
+		if v, ok := s.labels[k]; ok {
+			base = v
+			break
+		}
+	}
+	if base == "" {
+		keys := make([]string, 0, len(s.labels))
+		for k := range s.labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		values := make([]string, 0, len(keys))
+		for _, k := range keys {
+			values = append(values, s.labels[k])
+		}
+		base = strings.Join(values, "-")
+	}
+	base = strings.Trim(invalidPolicyNameChars.ReplaceAllString(strings.ToLower(base), "-"), "-.")
+	if len(base) > 200 {
+		base = base[:200]
+	}
+	return base + "-observed"
+}
+
+type policyPort struct {
+	protocol apiv1.Protocol
+	port     int32
+}
+
+type podFlow struct {
+	from, to string // podSelector keys, or ipBlockPeerPrefix and a CIDR
+	port     policyPort
+}
+
+// podConnections accumulates the connections of pods observed in reports.
+type podConnections struct {
+	selectors       map[string]podSelector
+	namespaceLabels map[string]map[string]string
+	flows           map[podFlow]struct{}
+	// Why the ingress or egress of the pods of a podSelector key couldn't
+	// be fully resolved into rules.
+	unresolvedIngress map[string]map[string]struct{}
+	unresolvedEgress  map[string]map[string]struct{}
+}
+
+func newPodConnections() podConnections {
+	return podConnections{
+		selectors:         map[string]podSelector{},
+		namespaceLabels:   map[string]map[string]string{},
+		flows:             map[podFlow]struct{}{},
+		unresolvedIngress: map[string]map[string]struct{}{},
+		unresolvedEgress:  map[string]map[string]struct{}{},
+	}
+}
+
+func addReason(reasons map[string]map[string]struct{}, key, reason string) {
+	if reasons[key] == nil {
+		reasons[key] = map[string]struct{}{}
+	}
+	reasons[key][reason] = struct{}{}
+}
+
+func (c podConnections) addReport(ctx context.Context, rpt report.Report) {
+	for _, n := range rpt.Namespace.Nodes {
+		if name, ok := n.Latest.Lookup(kubernetes.Name); ok {
+			if labels := kubernetesLabels(n); len(labels) > 0 {
+				c.namespaceLabels[name] = labels
+			}
+		}
+	}
+
+	// Connections to service IPs which weren't resolved to the pods
+	// behind them can't be expressed as rules.
+	serviceIPs := map[string]struct{}{}
+	for _, n := range rpt.Service.Nodes {
+		if ip, ok := n.Latest.Lookup(kubernetes.IP); ok && ip != "" && ip != "None" {
+			serviceIPs[ip] = struct{}{}
+		}
+	}
+
+	// The endpoints of each pod are among its children. The endpoints of
+	// pods which can't be selected by a policy map to "".
+	endpointPods := map[string]string{}
+	for _, pod := range render.PodRenderer.Render(ctx, rpt).Nodes {
+		if pod.Topology != report.Pod {
+			continue
+		}
+		namespace, _ := pod.Latest.Lookup(kubernetes.Namespace)
+		labels := kubernetesLabels(pod)
+		for k := range podInstanceLabels {
+			delete(labels, k)
+		}
+		key := ""
+		if len(labels) > 0 {
+			selector := podSelector{namespace: namespace, labels: labels}
+			key = selector.key()
+			c.selectors[key] = selector
+		}
+		pod.Children.ForEach(func(child report.Node) {
+			if child.Topology == report.Endpoint {
+				endpointPods[child.ID] = key
+			}
+		})
+	}
+
+	// peer returns the key of the peer at the other end of a connection
+	// from or to a pod, or why it can't be expressed in a policy.
+	peer := func(id string) (key string, unresolved string) {
+		if key, ok := endpointPods[id]; ok {
+			if key == "" {
+				return "", "pods without labels to select them by"
+			}
+			return key, ""
+		}
+		_, addr, _, ok := report.ParseEndpointNodeID(id)
+		ip := net.ParseIP(addr)
+		if !ok || ip == nil || report.IsLoopback(addr) {
+			return "", ""
+		}
+		if _, ok := serviceIPs[addr]; ok {
+			return "", "service IP " + addr
+		}
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		return fmt.Sprintf("%s%s/%d", ipBlockPeerPrefix, addr, bits), ""
+	}
+
+	for id, n := range rpt.Endpoint.Nodes {
+		from, fromPod := endpointPods[id]
+		for _, adjacent := range n.Adjacency {
+			to, toPod := endpointPods[adjacent]
+			if (!fromPod || from == "") && (!toPod || to == "") {
+				continue // not a connection of pods we make policies for
+			}
+			_, _, port, ok := report.ParseEndpointNodeID(adjacent)
+			if !ok {
+				continue
+			}
+			p, err := strconv.ParseInt(port, 10, 32)
+			if err != nil {
+				continue
+			}
+			flow := podFlow{from: from, to: to, port: policyPort{protocol: apiv1.ProtocolTCP, port: int32(p)}}
+			if report.IsUDPEndpointNodeID(adjacent) {
+				flow.port.protocol = apiv1.ProtocolUDP
+			}
+			if !fromPod || from == "" {
+				var unresolved string
+				if flow.from, unresolved = peer(id); unresolved != "" {
+					addReason(c.unresolvedIngress, to, "connections from "+unresolved)
+				}
+			}
+			if !toPod || to == "" {
+				var unresolved string
+				if flow.to, unresolved = peer(adjacent); unresolved != "" {
+					addReason(c.unresolvedEgress, from, "connections to "+unresolved)
+				}
+			}
+			if flow.from != "" && flow.to != "" {
+				c.flows[flow] = struct{}{}
+			}
+		}
+	}
+}
+
+// networkPolicies returns a NetworkPolicy for each set of pods in the
+// namespace which had connections, allowing exactly those connections, and
+// DNS lookups. A direction with connections which couldn't be expressed as
+// rules is left out of the policy, and annotated with why, rather than
+// cutting those connections off.
+func (c podConnections) networkPolicies(namespace string) []networkingv1.NetworkPolicy {
+	type peerPorts map[string]map[policyPort]struct{}
+	var (
+		ingress = map[string]peerPorts{}
+		egress  = map[string]peerPorts{}
+	)
+	add := func(rules map[string]peerPorts, key, peer string, port policyPort) {
+		if rules[key] == nil {
+			rules[key] = peerPorts{}
+		}
+		if rules[key][peer] == nil {
+			rules[key][peer] = map[policyPort]struct{}{}
+		}
+		rules[key][peer][port] = struct{}{}
+	}
+	for f := range c.flows {
+		if selector, ok := c.selectors[f.to]; ok && selector.namespace == namespace {
+			add(ingress, f.to, f.from, f.port)
+		}
+		if selector, ok := c.selectors[f.from]; ok && selector.namespace == namespace {
+			add(egress, f.from, f.to, f.port)
+		}
+	}
+
+	var keys []string
+	for key, selector := range c.selectors {
+		if selector.namespace != namespace {
+			continue
+		}
+		_, hasIngress := ingress[key]
+		_, hasEgress := egress[key]
+		_, ingressUnresolved := c.unresolvedIngress[key]
+		_, egressUnresolved := c.unresolvedEgress[key]
+		if (hasIngress || hasEgress) && !(ingressUnresolved && egressUnresolved) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var (
+		result = []networkingv1.NetworkPolicy{}
+		names  = map[string]int{}
+	)
+	for _, key := range keys {
+		selector := c.selectors[key]
+		name := selector.name()
+		if names[name]++; names[name] > 1 {
+			name = fmt.Sprintf("%s-%d", name, names[name])
+		}
+		policy := networkingv1.NetworkPolicy{
+			TypeMeta: metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: selector.labels},
+			},
+		}
+		if reasons, ok := c.unresolvedIngress[key]; ok {
+			metav1.SetMetaDataAnnotation(&policy.ObjectMeta, incompleteIngressAnnotation, joinReasons(reasons))
+		} else {
+			policy.Spec.PolicyTypes = append(policy.Spec.PolicyTypes, networkingv1.PolicyTypeIngress)
+			for _, peer := range sortedKeys(ingress[key]) {
+				policy.Spec.Ingress = append(policy.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+					From:  []networkingv1.NetworkPolicyPeer{c.peer(namespace, peer)},
+					Ports: policyPorts(ingress[key][peer]),
+				})
+			}
+		}
+		if reasons, ok := c.unresolvedEgress[key]; ok {
+			metav1.SetMetaDataAnnotation(&policy.ObjectMeta, incompleteEgressAnnotation, joinReasons(reasons))
+		} else {
+			policy.Spec.PolicyTypes = append(policy.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+			for _, peer := range sortedKeys(egress[key]) {
+				policy.Spec.Egress = append(policy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+					To:    []networkingv1.NetworkPolicyPeer{c.peer(namespace, peer)},
+					Ports: policyPorts(egress[key][peer]),
+				})
+			}
+			policy.Spec.Egress = append(policy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+				To:    []networkingv1.NetworkPolicyPeer{dnsPeer},
+				Ports: policyPorts(dnsPorts),
+			})
+		}
+		result = append(result, policy)
+	}
+	return result
+}
+
+func (c podConnections) peer(namespace, key string) networkingv1.NetworkPolicyPeer {
+	if cidr, ok := report.WithoutPrefix(key, ipBlockPeerPrefix); ok {
+		return networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}}
+	}
+	selector := c.selectors[key]
+	peer := networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: selector.labels},
+	}
+	if selector.namespace != namespace {
+		labels, ok := c.namespaceLabels[selector.namespace]
+		if !ok {
+			labels = map[string]string{namespaceNameLabel: selector.namespace}
+		}
+		peer.NamespaceSelector = &metav1.LabelSelector{MatchLabels: labels}
+	}
+	return peer
+}
+
+func policyPorts(ports map[policyPort]struct{}) []networkingv1.NetworkPolicyPort {
+	sorted := make([]policyPort, 0, len(ports))
+	for port := range ports {
+		sorted = append(sorted, port)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].port != sorted[j].port {
+			return sorted[i].port < sorted[j].port
+		}
+		return sorted[i].protocol < sorted[j].protocol
+	})
+	result := make([]networkingv1.NetworkPolicyPort, 0, len(sorted))
+	for _, port := range sorted {
+		protocol := port.protocol
+		p := intstr.FromInt(int(port.port))
+		result = append(result, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &p})
+	}
+	return result
+}
+
+func joinReasons(reasons map[string]struct{}) string {
+	sorted := make([]string, 0, len(reasons))
+	for reason := range reasons {
+		sorted = append(sorted, reason)
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, "; ")
+}
+
+func sortedKeys(m map[string]map[policyPort]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// kubernetesLabels returns the Kubernetes labels of a node.
+func kubernetesLabels(n report.Node) map[string]string {
+	labels := map[string]string{}
+	n.Latest.ForEach(func(key string, _ time.Time, value string) {
+		if label, ok := report.WithoutPrefix(key, kubernetes.LabelPrefix); ok {
+			labels[label] = value
+		}
+	})
+	return labels
+}
@@ -0,0 +1,183 @@
+package app_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/gorilla/mux"
+	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestAPINetworkPolicies(t *testing.T) {
+	rpt := fixture.Report.Copy()
+	rpt.Pod.Nodes[fixture.ClientPodNodeID] = rpt.Pod.Nodes[fixture.ClientPodNodeID].WithLatests(map[string]string{
+		kubernetes.LabelPrefix + "app":               "client",
+		kubernetes.LabelPrefix + "pod-template-hash": "5d4c3b2a1",
+	})
+	rpt.Pod.Nodes[fixture.ServerPodNodeID] = rpt.Pod.Nodes[fixture.ServerPodNodeID].WithLatests(map[string]string{
+		kubernetes.LabelPrefix + "app": "server",
+	})
+	// The client also sends UDP to the server
+	serverUDP := report.MakeUDPEndpointNodeID(fixture.ServerHostID, "", fixture.ServerIP, "514")
+	rpt.Endpoint.AddNode(report.MakeNode(serverUDP).WithTopology(report.Endpoint).WithLatests(map[string]string{
+		process.PID:       fixture.ServerPID,
+		report.HostNodeID: fixture.ServerHostNodeID,
+	}))
+	clientUDP := report.MakeUDPEndpointNodeID(fixture.ClientHostID, "", fixture.ClientIP, "40000")
+	rpt.Endpoint.AddNode(report.MakeNode(clientUDP).WithTopology(report.Endpoint).WithLatests(map[string]string{
+		process.PID:       fixture.Client1PID,
+		report.HostNodeID: fixture.ClientHostNodeID,
+	}).WithAdjacent(serverUDP))
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, app.StaticCollector(rpt), map[string]bool{})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	if res, _ := checkGet(t, ts, "/api/networkpolicies"); res.StatusCode != 400 {
+		t.Errorf("Expected status %d, got %d", 400, res.StatusCode)
+	}
+	if body := is200(t, ts, "/api/networkpolicies?namespace=foo"); len(body) != 0 {
+		t.Errorf("Expected no policies, got %s", body)
+	}
+
+	body := is200(t, ts, "/api/networkpolicies?namespace="+fixture.KubernetesNamespace+"&from=2018-01-01T00:00:00Z&to=2018-01-01T00:01:00Z")
+	var have []networkingv1.NetworkPolicy
+	for _, doc := range strings.Split(string(body), "---\n")[1:] {
+		var policy networkingv1.NetworkPolicy
+		if err := yaml.Unmarshal([]byte(doc), &policy); err != nil {
+			t.Fatalf("YAML parse error: %s", err)
+		}
+		have = append(have, policy)
+	}
+
+	var (
+		tcp       = apiv1.ProtocolTCP
+		udp       = apiv1.ProtocolUDP
+		port53    = intstr.FromInt(53)
+		port80    = intstr.FromInt(80)
+		port514   = intstr.FromInt(514)
+		clientSel = metav1.LabelSelector{MatchLabels: map[string]string{"app": "client"}}
+		serverSel = metav1.LabelSelector{MatchLabels: map[string]string{"app": "server"}}
+		dnsSel    = metav1.LabelSelector{MatchLabels: map[string]string{"k8s-app": "kube-dns"}}
+		systemSel = metav1.LabelSelector{MatchLabels: map[string]string{"kubernetes.io/metadata.name": "kube-system"}}
+		ports     = []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port80}, {Protocol: &udp, Port: &port514}}
+		dnsRule   = networkingv1.NetworkPolicyEgressRule{
+			To:    []networkingv1.NetworkPolicyPeer{{PodSelector: &dnsSel, NamespaceSelector: &systemSel}},
+			Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port53}, {Protocol: &udp, Port: &port53}},
+		}
+		external = func(cidr string) networkingv1.NetworkPolicyIngressRule {
+			return networkingv1.NetworkPolicyIngressRule{
+				From:  []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: cidr}}},
+				Ports: ports[:1],
+			}
+		}
+		types    = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}
+		typeMeta = metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"}
+	)
+	want := []networkingv1.NetworkPolicy{
+		{
+			TypeMeta:   typeMeta,
+			ObjectMeta: metav1.ObjectMeta{Name: "client-observed", Namespace: fixture.KubernetesNamespace},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: clientSel,
+				Egress: []networkingv1.NetworkPolicyEgressRule{{
+					To:    []networkingv1.NetworkPolicyPeer{{PodSelector: &serverSel}},
+					Ports: ports,
+				}, dnsRule},
+				PolicyTypes: types,
+			},
+		},
+		{
+			TypeMeta:   typeMeta,
+			ObjectMeta: metav1.ObjectMeta{Name: "server-observed", Namespace: fixture.KubernetesNamespace},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: serverSel,
+				Ingress: []networkingv1.NetworkPolicyIngressRule{
+					// The clients from outside the pods
+					external(fixture.UnknownClient1IP + "/32"),
+					external(fixture.UnknownClient3IP + "/32"),
+					external(fixture.RandomClientIP + "/32"),
+					{
+						From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &clientSel}},
+						Ports: ports,
+					},
+				},
+				Egress:      []networkingv1.NetworkPolicyEgressRule{dnsRule},
+				PolicyTypes: types,
+			},
+		},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	// Connections from pods which can't be selected leave the server's
+	// ingress out, rather than cutting them off.
+	router = mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, app.StaticCollector(withoutLabel(rpt, fixture.ClientPodNodeID, "app")), map[string]bool{})
+	ts2 := httptest.NewServer(router)
+	defer ts2.Close()
+	body = is200(t, ts2, "/api/networkpolicies?namespace="+fixture.KubernetesNamespace)
+	var policy networkingv1.NetworkPolicy
+	if err := yaml.Unmarshal([]byte(strings.Split(string(body), "---\n")[1]), &policy); err != nil {
+		t.Fatalf("YAML parse error: %s", err)
+	}
+	if policy.Name != "server-observed" {
+		t.Fatalf("Expected only the server's policy, got %s", body)
+	}
+	equals(t, []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}, policy.Spec.PolicyTypes)
+	equals(t, 0, len(policy.Spec.Ingress))
+	equals(t, "connections from pods without labels to select them by", policy.Annotations["scope.weave.works/incomplete-ingress"])
+
+	// Without historic reports, the window is sampled once.
+	counter := &countingReporter{StaticCollector: app.StaticCollector(rpt)}
+	router = mux.NewRouter().SkipClean(true)
+	app.RegisterTopologyRoutes(router, counter, map[string]bool{})
+	ts3 := httptest.NewServer(router)
+	defer ts3.Close()
+	is200(t, ts3, "/api/networkpolicies?namespace="+fixture.KubernetesNamespace+"&from=2018-01-01T00:00:00Z&to=2018-01-01T01:00:00Z")
+	equals(t, int32(1), atomic.LoadInt32(&counter.reports))
+}
+
+// countingReporter counts the reports asked of it.
+type countingReporter struct {
+	app.StaticCollector
+	reports int32
+}
+
+func (c *countingReporter) Report(ctx context.Context, timestamp time.Time) (report.Report, error) {
+	atomic.AddInt32(&c.reports, 1)
+	return c.StaticCollector.Report(ctx, timestamp)
+}
+
+// withoutLabel returns a copy of a report without a Kubernetes label of a
+// pod.
+func withoutLabel(rpt report.Report, podID, label string) report.Report {
+	rpt = rpt.Copy()
+	pod := rpt.Pod.Nodes[podID]
+	latest := report.MakeStringLatestMap()
+	pod.Latest.ForEach(func(k string, ts time.Time, v string) {
+		if k != kubernetes.LabelPrefix+label {
+			latest = latest.Set(k, ts, v)
+		}
+	})
+	pod.Latest = latest
+	rpt.Pod.Nodes[podID] = pod
+	return rpt
+}
@@ -0,0 +1,504 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+const (
+	recordingExt         = ".cast"
+	recordingContentType = "application/x-asciicast"
+
+	// Terminal size until the first resize.
+	defaultTTYWidth  = 80
+	defaultTTYHeight = 24
+)
+
+// Recording IDs are those of the pipes recorded, which needn't be escaped
+// in file names.
+var recordingIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// RecordingInfo describes a recorded terminal session.
+type RecordingInfo struct {
+	ID      string    `json:"id"`
+	User    string    `json:"user"`
+	ProbeID string    `json:"probeId"`
+	NodeID  string    `json:"nodeId"`
+	Control string    `json:"control"`
+	Started time.Time `json:"started"`
+	Size    int64     `json:"size,omitempty"`
+}
+
+// asciicastHeader is the first line of an asciicast v2 recording. Players
+// ignore the scope key, which says what was recorded.
+type asciicastHeader struct {
+	Version   int           `json:"version"`
+	Width     uint64        `json:"width"`
+	Height    uint64        `json:"height"`
+	Timestamp int64         `json:"timestamp"`
+	Title     string        `json:"title,omitempty"`
+	Scope     RecordingInfo `json:"scope"`
+}
+
+// Recorder records the traffic of the pipes opened by some controls, e.g.
+// container exec and attach, in asciicast v2 files: output, input, and the
+// terminal being resized by resize controls.
+type Recorder struct {
+	dir        string
+	controls   map[string]struct{}
+	authorizer *ControlAuthorizer
+
+	mtx        sync.Mutex
+	recordings map[string]*recording
+}
+
+// recording is a pipe being recorded. Its file is only open while the UI
+// is connected to the pipe.
+type recording struct {
+	sync.Mutex
+	info    RecordingInfo
+	file    *os.File
+	pending map[string][]byte
+
+	// The header, with the terminal size, is written with the first
+	// event; until then, resizes only change the size in the header.
+	header        bool
+	width, height uint64
+}
+
+// NewRecorder makes a new Recorder, recording the pipes opened by the
+// given controls into files in dir, by the users authorizer identifies.
+func NewRecorder(dir string, controls []string, authorizer *ControlAuthorizer) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	r := &Recorder{
+		dir:        dir,
+		controls:   map[string]struct{}{},
+		authorizer: authorizer,
+		recordings: map[string]*recording{},
+	}
+	for _, control := range controls {
+		r.controls[control] = struct{}{}
+	}
+	return r, nil
+}
+
+func (r *Recorder) path(id string) string {
+	return filepath.Join(r.dir, id+recordingExt)
+}
+
+func (r *Recorder) get(id string) (*recording, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	rec, ok := r.recordings[id]
+	return rec, ok
+}
+
+// start recording the pipe opened by a control.
+func (r *Recorder) start(ctx context.Context, probeID string, req xfer.Request, pipeID string) {
+	if _, ok := r.controls[req.Control]; !ok || !recordingIDRegexp.MatchString(pipeID) {
+		return
+	}
+	rec := &recording{
+		info: RecordingInfo{
+			ID:      pipeID,
+			User:    r.authorizer.contextUser(ctx),
+			ProbeID: probeID,
+			NodeID:  req.NodeID,
+			Control: req.Control,
+			Started: mtime.Now(),
+		},
+		pending: map[string][]byte{},
+		width:   defaultTTYWidth,
+		height:  defaultTTYHeight,
+	}
+	r.mtx.Lock()
+	r.recordings[pipeID] = rec
+	r.mtx.Unlock()
+}
+
+// resize records a terminal being resized by a resize control.
+func (r *Recorder) resize(req xfer.Request) {
+	rec, ok := r.get(req.ControlArgs["pipeID"])
+	if !ok {
+		return
+	}
+	width, err := strconv.ParseUint(req.ControlArgs["width"], 10, 32)
+	if err != nil {
+		return
+	}
+	height, err := strconv.ParseUint(req.ControlArgs["height"], 10, 32)
+	if err != nil {
+		return
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	if !rec.header {
+		rec.width, rec.height = width, height
+		return
+	}
+	rec.writeEvent("r", []byte(fmt.Sprintf("%dx%d", width, height)))
+}
+
+func (r *Recorder) open(id string) error {
+	rec, ok := r.get(id)
+	if !ok {
+		return nil
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.file != nil {
+		return nil
+	}
+	file, err := os.OpenFile(r.path(id), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening recording %s: %v", id, err)
+	}
+	rec.file = file
+	return nil
+}
+
+func (r *Recorder) close(id string) {
+	rec, ok := r.get(id)
+	if !ok {
+		return
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.file == nil {
+		return
+	}
+	if err := rec.file.Close(); err != nil {
+		log.Errorf("Error closing recording %s: %v", id, err)
+	}
+	rec.file = nil
+}
+
+func (r *Recorder) forget(id string) {
+	r.close(id)
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.recordings, id)
+}
+
+func (r *Recorder) record(id, eventType string, data []byte) {
+	rec, ok := r.get(id)
+	if !ok {
+		return
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.file == nil {
+		return
+	}
+	if !rec.header {
+		rec.writeHeader()
+	}
+	// Don't split UTF-8 sequences across events, as they would not be
+	// valid JSON strings.
+	data = append(rec.pending[eventType], data...)
+	complete := utf8Prefix(data)
+	rec.pending[eventType] = append([]byte{}, data[complete:]...)
+	if complete > 0 {
+		rec.writeEvent(eventType, data[:complete])
+	}
+}
+
+// utf8Prefix returns the length of the longest prefix of data not ending in
+// an incomplete UTF-8 sequence.
+func utf8Prefix(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(data)
+}
+
+func (rec *recording) writeHeader() {
+	rec.header = true
+	rec.writeLine(asciicastHeader{
+		Version:   2,
+		Width:     rec.width,
+		Height:    rec.height,
+		Timestamp: rec.info.Started.Unix(),
+		Title:     fmt.Sprintf("%s on %s", rec.info.Control, rec.info.NodeID),
+		Scope:     rec.info,
+	})
+}
+
+func (rec *recording) writeEvent(eventType string, data []byte) {
+	elapsed := mtime.Now().Sub(rec.info.Started).Seconds()
+	rec.writeLine([]interface{}{elapsed, eventType, string(data)})
+}
+
+func (rec *recording) writeLine(v interface{}) {
+	if rec.file == nil {
+		return
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		log.Errorf("Error encoding recording %s: %v", rec.info.ID, err)
+		return
+	}
+	if _, err := rec.file.Write(append(buf, '\n')); err != nil {
+		log.Errorf("Error writing recording %s: %v", rec.info.ID, err)
+	}
+}
+
+// List the recordings, newest first.
+func (r *Recorder) List() ([]RecordingInfo, error) {
+	files, err := ioutil.ReadDir(r.dir)
+	if err != nil {
+		return nil, err
+	}
+	result := []RecordingInfo{}
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), recordingExt) {
+			continue
+		}
+		info, err := r.readInfo(strings.TrimSuffix(fi.Name(), recordingExt))
+		if err != nil {
+			log.Warnf("Skipping recording %s: %v", fi.Name(), err)
+			continue
+		}
+		info.Size = fi.Size()
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Started.After(result[j].Started)
+	})
+	return result, nil
+}
+
+func (r *Recorder) readInfo(id string) (RecordingInfo, error) {
+	f, err := os.Open(r.path(id))
+	if err != nil {
+		return RecordingInfo{}, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil {
+		return RecordingInfo{}, err
+	}
+	var header asciicastHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		return RecordingInfo{}, err
+	}
+	header.Scope.ID = id
+	return header.Scope, nil
+}
+
+// recordingControlRouter is a ControlRouter telling a Recorder about the
+// pipes opened by controls, and terminal resizes.
+type recordingControlRouter struct {
+	ControlRouter
+	recorder *Recorder
+}
+
+// NewRecordingControlRouter returns a ControlRouter telling r about the
+// pipes opened, and terminals resized, by the controls cr handles.
+func NewRecordingControlRouter(cr ControlRouter, r *Recorder) ControlRouter {
+	return recordingControlRouter{cr, r}
+}
+
+func (cr recordingControlRouter) Handle(ctx context.Context, probeID string, req xfer.Request) (xfer.Response, error) {
+	res, err := cr.ControlRouter.Handle(ctx, probeID, req)
+	if err != nil || res.Error != "" {
+		return res, err
+	}
+	if res.Pipe != "" {
+		cr.recorder.start(ctx, probeID, req, res.Pipe)
+	} else if _, ok := req.ControlArgs["pipeID"]; ok {
+		cr.recorder.resize(req)
+	}
+	return res, err
+}
+
+// recordingPipeRouter is a PipeRouter recording the UI end of the pipes
+// its Recorder records.
+type recordingPipeRouter struct {
+	PipeRouter
+	recorder *Recorder
+}
+
+// NewRecordingPipeRouter returns a PipeRouter recording the pipes of pr
+// which r records.
+func NewRecordingPipeRouter(pr PipeRouter, r *Recorder) PipeRouter {
+	return recordingPipeRouter{pr, r}
+}
+
+func (pr recordingPipeRouter) Get(ctx context.Context, id string, e End) (xfer.Pipe, io.ReadWriter, error) {
+	pipe, endIO, err := pr.PipeRouter.Get(ctx, id, e)
+	if err != nil || e != UIEnd {
+		return pipe, endIO, err
+	}
+	if _, ok := pr.recorder.get(id); !ok {
+		return pipe, endIO, nil
+	}
+	// Sessions which should be recorded aren't allowed unrecorded
+	if err := pr.recorder.open(id); err != nil {
+		pr.PipeRouter.Release(ctx, id, e)
+		return nil, nil, err
+	}
+	return pipe, recordingReadWriter{endIO, pr.recorder, id}, nil
+}
+
+func (pr recordingPipeRouter) Release(ctx context.Context, id string, e End) error {
+	if e == UIEnd {
+		pr.recorder.close(id)
+	}
+	return pr.PipeRouter.Release(ctx, id, e)
+}
+
+func (pr recordingPipeRouter) Delete(ctx context.Context, id string) error {
+	pr.recorder.forget(id)
+	return pr.PipeRouter.Delete(ctx, id)
+}
+
+// recordingReadWriter records the UI end of a pipe: what is read from it is
+// the terminal's output, and what is written its input.
+type recordingReadWriter struct {
+	io.ReadWriter
+	recorder *Recorder
+	pipeID   string
+}
+
+func (r recordingReadWriter) Read(p []byte) (int, error) {
+	n, err := r.ReadWriter.Read(p)
+	if n > 0 {
+		r.recorder.record(r.pipeID, "o", p[:n])
+	}
+	return n, err
+}
+
+func (r recordingReadWriter) Write(p []byte) (int, error) {
+	n, err := r.ReadWriter.Write(p)
+	if n > 0 {
+		r.recorder.record(r.pipeID, "i", p[:n])
+	}
+	return n, err
+}
+
+// RegisterRecordingRoutes registers the routes to list and fetch the
+// recordings of r, if recording is enabled. Users only see the recordings
+// of the controls a allows them to run, on the nodes in rep's reports.
+func RegisterRecordingRoutes(router *mux.Router, r *Recorder, rep Reporter, a *ControlAuthorizer) {
+	router.Methods("GET").Path("/api/recordings").
+		HandlerFunc(requestContextDecorator(handleListRecordings(r, rep, a)))
+	router.Methods("GET").Path("/api/recordings/{id}").
+		HandlerFunc(requestContextDecorator(handleGetRecording(r, rep, a)))
+}
+
+// recordingAuthorizer returns a function saying whether the user making
+// req may run the control recorded, as they may see the recording, or nil
+// if all controls are allowed.
+func recordingAuthorizer(ctx context.Context, req *http.Request, rep Reporter, a *ControlAuthorizer) (func(RecordingInfo) bool, error) {
+	allowed := a.authorizer(req)
+	if allowed == nil {
+		return nil, nil
+	}
+	rpt, err := rep.Report(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return func(info RecordingInfo) bool {
+		topology, node, _ := findControlNode(rpt, info.NodeID, info.Control)
+		return allowed(info.Control, topology, node)
+	}, nil
+}
+
+func handleListRecordings(r *Recorder, rep Reporter, a *ControlAuthorizer) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+		if r == nil {
+			respondWith(w, http.StatusOK, []RecordingInfo{})
+			return
+		}
+		allowed, err := recordingAuthorizer(ctx, req, rep, a)
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+		recordings, err := r.List()
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+		if allowed != nil {
+			result := []RecordingInfo{}
+			for _, info := range recordings {
+				if allowed(info) {
+					result = append(result, info)
+				}
+			}
+			recordings = result
+		}
+		respondWith(w, http.StatusOK, recordings)
+	}
+}
+
+func handleGetRecording(r *Recorder, rep Reporter, a *ControlAuthorizer) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+		id := mux.Vars(req)["id"]
+		if r == nil || !recordingIDRegexp.MatchString(id) {
+			http.NotFound(w, req)
+			return
+		}
+		allowed, err := recordingAuthorizer(ctx, req, rep, a)
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+		if allowed != nil {
+			info, err := r.readInfo(id)
+			if os.IsNotExist(err) {
+				http.NotFound(w, req)
+				return
+			} else if err != nil {
+				respondWith(w, http.StatusInternalServerError, err)
+				return
+			}
+			if !allowed(info) {
+				respondWith(w, http.StatusForbidden, fmt.Sprintf("not allowed to see recording %s", id))
+				return
+			}
+		}
+		f, err := os.Open(r.path(id))
+		if os.IsNotExist(err) {
+			http.NotFound(w, req)
+			return
+		} else if err != nil {
+			respondWith(w, http.StatusInternalServerError, err)
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Type", recordingContentType)
+		if _, err := io.Copy(w, f); err != nil {
+			log.Errorf("Error sending recording %s: %v", id, err)
+		}
+	}
+}
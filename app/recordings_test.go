@@ -0,0 +1,187 @@
+package app_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+func TestRecordings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-recordings")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	start := time.Now().Truncate(time.Second)
+	mtime.NowForce(start)
+	defer mtime.NowReset()
+
+	authorizer := testControlAuthorizer(nil)
+	recorder, err := app.NewRecorder(dir, []string{"docker_exec_container"}, authorizer)
+	ok(t, err)
+	var (
+		ctx             = context.Background()
+		localPipeRouter = app.NewLocalPipeRouter()
+		pipeRouter      = app.NewRecordingPipeRouter(localPipeRouter, recorder)
+		controlRouter   = app.NewRecordingControlRouter(app.NewLocalControlRouter(), recorder)
+	)
+	defer pipeRouter.Stop()
+	_, err = controlRouter.Register(ctx, "probe1", func(req xfer.Request) xfer.Response {
+		switch req.Control {
+		case "docker_exec_container":
+			return xfer.Response{Pipe: "pipe1", RawTTY: true}
+		case "docker_get_logs":
+			return xfer.Response{Pipe: "pipe2"}
+		}
+		return xfer.Response{}
+	})
+	ok(t, err)
+	resize := func(width, height string) {
+		_, err := controlRouter.Handle(ctx, "probe1", xfer.Request{
+			NodeID:      "node1",
+			Control:     "docker_resize_exec_tty",
+			ControlArgs: map[string]string{"pipeID": "pipe1", "width": width, "height": height},
+		})
+		ok(t, err)
+	}
+
+	_, err = controlRouter.Handle(ctx, "probe1", xfer.Request{NodeID: "node1", Control: "docker_exec_container"})
+	ok(t, err)
+	_, err = controlRouter.Handle(ctx, "probe1", xfer.Request{NodeID: "node1", Control: "docker_get_logs"})
+	ok(t, err)
+	resize("120", "40")
+
+	_, probeIO, err := localPipeRouter.Get(ctx, "pipe1", app.ProbeEnd)
+	ok(t, err)
+	_, uiIO, err := pipeRouter.Get(ctx, "pipe1", app.UIEnd)
+	ok(t, err)
+
+	// A UTF-8 sequence split across reads is recorded in one event
+	for _, output := range [][]byte{[]byte("h\xc3"), []byte("\xa9llo")} {
+		mtime.NowForce(mtime.Now().Add(500 * time.Millisecond))
+		go probeIO.Write(output)
+		_, err := io.ReadFull(uiIO, make([]byte, len(output)))
+		ok(t, err)
+	}
+	mtime.NowForce(start.Add(2 * time.Second))
+	go probeIO.Read(make([]byte, 3))
+	_, err = uiIO.Write([]byte("ls\n"))
+	ok(t, err)
+	resize("100", "30")
+	ok(t, pipeRouter.Release(ctx, "pipe1", app.UIEnd))
+
+	router := mux.NewRouter()
+	app.RegisterRecordingRoutes(router, recorder, app.StaticCollector{}, authorizer)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var recordings []app.RecordingInfo
+	body := getRawJSON(t, ts, "/api/recordings")
+	ok(t, codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&recordings))
+	equals(t, 1, len(recordings))
+	equals(t, "pipe1", recordings[0].ID)
+	equals(t, "node1", recordings[0].NodeID)
+	equals(t, "docker_exec_container", recordings[0].Control)
+
+	res, body := checkGet(t, ts, "/api/recordings/pipe1")
+	equals(t, 200, res.StatusCode)
+	equals(t, "application/x-asciicast", res.Header.Get("Content-Type"))
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	ok(t, func() error { scanner.Scan(); return scanner.Err() }())
+	var header struct {
+		Version, Width, Height int
+		Timestamp              int64
+	}
+	ok(t, json.Unmarshal(scanner.Bytes(), &header))
+	equals(t, 2, header.Version)
+	equals(t, 120, header.Width)
+	equals(t, 40, header.Height)
+	equals(t, start.Unix(), header.Timestamp)
+
+	events := [][]interface{}{}
+	for scanner.Scan() {
+		var event []interface{}
+		ok(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	equals(t, [][]interface{}{
+		{0.5, "o", "h"},
+		{1.0, "o", "éllo"},
+		{2.0, "i", "ls\n"},
+		{2.0, "r", "100x30"},
+	}, events)
+
+	is404(t, ts, "/api/recordings/pipe2")
+	is404(t, ts, "/api/recordings/..%2Fpipe1")
+
+	// Under a control policy, only users who may run the control see its
+	// recordings.
+	policy, err := app.ParseControlPolicy([]byte(testControlPolicy + `- users: [carol]
+  controls: [docker_exec_container]
+`))
+	ok(t, err)
+	authorizer.Policy = policy
+	request := func(path, user string) (*http.Response, []byte) {
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		ok(t, err)
+		req.Header.Set("X-Scope-User", user)
+		res, err := http.DefaultClient.Do(req)
+		ok(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		ok(t, err)
+		return res, body
+	}
+	for user, want := range map[string]int{"alice": 0, "carol": 1} {
+		_, body := request("/api/recordings", user)
+		ok(t, codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&recordings))
+		equals(t, want, len(recordings))
+	}
+	res, _ = request("/api/recordings/pipe1", "alice")
+	equals(t, http.StatusForbidden, res.StatusCode)
+	res, _ = request("/api/recordings/pipe1", "carol")
+	equals(t, http.StatusOK, res.StatusCode)
+}
+
+func TestRecordingOpenError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-recordings")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	recorder, err := app.NewRecorder(dir, []string{"docker_exec_container"}, nil)
+	ok(t, err)
+	var (
+		ctx             = context.Background()
+		localPipeRouter = app.NewLocalPipeRouter()
+		pipeRouter      = app.NewRecordingPipeRouter(localPipeRouter, recorder)
+		controlRouter   = app.NewRecordingControlRouter(app.NewLocalControlRouter(), recorder)
+	)
+	defer pipeRouter.Stop()
+	_, err = controlRouter.Register(ctx, "probe1", func(req xfer.Request) xfer.Response {
+		return xfer.Response{Pipe: "pipe1", RawTTY: true}
+	})
+	ok(t, err)
+	_, err = controlRouter.Handle(ctx, "probe1", xfer.Request{NodeID: "node1", Control: "docker_exec_container"})
+	ok(t, err)
+
+	// The session isn't allowed if it can't be recorded
+	ok(t, os.Mkdir(filepath.Join(dir, "pipe1.cast"), 0700))
+	if _, _, err := pipeRouter.Get(ctx, "pipe1", app.UIEnd); err == nil {
+		t.Fatal("expected error opening the recording")
+	}
+}
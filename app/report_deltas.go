@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Probes are expected to publish a full report well within this interval,
+// so bases older than this are no longer of any use.
+const reportBaseExpiry = 5 * time.Minute
+
+// Limits on the bases kept, as each holds a whole report. When over either,
+// the oldest bases are forgotten, and their probes asked for full reports.
+const (
+	maxReportBases     = 1000
+	maxReportBaseBytes = 64 << 20 // as encoded
+)
+
+// UserIDer returns the user, or organisation, a request is made for. In
+// multitenant apps, reports are kept apart by it.
+type UserIDer func(context.Context) (string, error)
+
+// reportBases keeps the last report received from each probe publishing
+// deltas, so the next delta can be applied to it.
+type reportBases struct {
+	sync.Mutex
+	userIDer  UserIDer
+	bases     map[reportBaseKey]reportBase
+	bytes     int
+	lastPrune time.Time
+}
+
+// Probe IDs are only unique per user, and anyone can claim any of them.
+type reportBaseKey struct {
+	userID, probeID string
+}
+
+type reportBase struct {
+	report   report.Report
+	bytes    int
+	received time.Time
+}
+
+// newReportBases returns bases kept per user, as identified by userIDer, or
+// for a single user if it is nil.
+func newReportBases(userIDer UserIDer) *reportBases {
+	return &reportBases{
+		userIDer:  userIDer,
+		bases:     map[reportBaseKey]reportBase{},
+		lastPrune: mtime.Now(),
+	}
+}
+
+func (b *reportBases) key(ctx context.Context, probeID string) (reportBaseKey, error) {
+	if b.userIDer == nil {
+		return reportBaseKey{probeID: probeID}, nil
+	}
+	userID, err := b.userIDer(ctx)
+	return reportBaseKey{userID: userID, probeID: probeID}, err
+}
+
+func (b *reportBases) get(key reportBaseKey) (report.Report, bool) {
+	b.Lock()
+	defer b.Unlock()
+	base, ok := b.bases[key]
+	return base.report, ok
+}
+
+// set the base of a probe to rpt, which took size bytes encoded.
+func (b *reportBases) set(key reportBaseKey, rpt report.Report, size int) {
+	b.Lock()
+	defer b.Unlock()
+	now := mtime.Now()
+	b.bytes -= b.bases[key].bytes
+	b.bases[key] = reportBase{report: rpt, bytes: size, received: now}
+	b.bytes += size
+
+	if len(b.bases) > maxReportBases || b.bytes > maxReportBaseBytes {
+		b.evictOldest(key)
+	}
+	if now.Sub(b.lastPrune) < reportBaseExpiry {
+		return
+	}
+	for k, base := range b.bases {
+		if now.Sub(base.received) > reportBaseExpiry {
+			b.delete(k)
+		}
+	}
+	b.lastPrune = now
+}
+
+// evictOldest forgets the oldest bases, other than keep, until under the
+// limits.
+func (b *reportBases) evictOldest(keep reportBaseKey) {
+	for len(b.bases) > maxReportBases || b.bytes > maxReportBaseBytes {
+		var (
+			oldest reportBaseKey
+			found  bool
+		)
+		for k, base := range b.bases {
+			if k != keep && (!found || base.received.Before(b.bases[oldest].received)) {
+				oldest, found = k, true
+			}
+		}
+		if !found {
+			return
+		}
+		b.delete(oldest)
+	}
+}
+
+func (b *reportBases) delete(key reportBaseKey) {
+	b.bytes -= b.bases[key].bytes
+	delete(b.bases, key)
+}
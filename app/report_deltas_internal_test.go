@@ -0,0 +1,39 @@
+package app
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/mtime"
+
+	"github.com/weaveworks/scope/report"
+)
+
+func TestReportBasesLimits(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	b := newReportBases(nil)
+	for i := 0; i <= maxReportBases; i++ {
+		mtime.NowForce(now.Add(time.Duration(i) * time.Millisecond))
+		b.set(reportBaseKey{probeID: strconv.Itoa(i)}, report.MakeReport(), 1)
+	}
+	if len(b.bases) != maxReportBases {
+		t.Errorf("Expected %d bases, got %d", maxReportBases, len(b.bases))
+	}
+	if _, ok := b.get(reportBaseKey{probeID: "0"}); ok {
+		t.Errorf("Expected the oldest base to be forgotten")
+	}
+
+	// A big base pushes out all the others, but is kept itself
+	b.set(reportBaseKey{probeID: "big"}, report.MakeReport(), maxReportBaseBytes)
+	if len(b.bases) != 1 || b.bytes != maxReportBaseBytes {
+		t.Errorf("Expected only the big base, got %d bases of %d bytes", len(b.bases), b.bytes)
+	}
+	b.set(reportBaseKey{probeID: "big"}, report.MakeReport(), 1)
+	if b.bytes != 1 {
+		t.Errorf("Expected replaced bases not to count, got %d bytes", b.bytes)
+	}
+}
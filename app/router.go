@@ -92,6 +92,10 @@ func gzipHandler(h http.HandlerFunc) http.Handler {
 
 // RegisterTopologyRoutes registers the various topology routes with a http mux.
 func RegisterTopologyRoutes(router *mux.Router, r Reporter, capabilities map[string]bool) {
+	var authorizer *ControlAuthorizer
+	if wrep, ok := r.(WebReporter); ok {
+		authorizer = wrep.Authorizer
+	}
 	get := router.Methods("GET").Subrouter()
 	get.Handle("/api",
 		gzipHandler(requestContextDecorator(apiHandler(r, capabilities))))
@@ -103,60 +107,121 @@ func RegisterTopologyRoutes(router *mux.Router, r Reporter, capabilities map[str
 	get.Handle("/api/topology/{topology}/ws",
 		requestContextDecorator(captureReporter(r, handleWebsocket))). // NB not gzip!
 		Name("api_topology_topology_ws")
+	get.Handle("/api/topology/{topology}/diff",
+		gzipHandler(requestContextDecorator(captureReporter(r, handleTopologyDiff)))).
+		Name("api_topology_topology_diff")
+	get.Handle("/api/topology/{topology}/export",
+		gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleExport)))).
+		Name("api_topology_topology_export")
 	get.MatcherFunc(URLMatcher("/api/topology/{topology}/{id}")).Handler(
-		gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleNode)))).
+		gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleNode(authorizer))))).
 		Name("api_topology_topology_id")
+	get.Handle("/api/query",
+		gzipHandler(requestContextDecorator(topologyRegistry.makeQueryHandler(r))))
 	get.Handle("/api/report",
 		gzipHandler(requestContextDecorator(makeRawReportHandler(r))))
 	get.Handle("/api/probes",
 		gzipHandler(requestContextDecorator(makeProbeHandler(r))))
+	get.Handle("/api/networkpolicies",
+		gzipHandler(requestContextDecorator(makeNetworkPolicyHandler(r))))
+	get.Handle("/api/metrics",
+		requestContextDecorator(makeMetricsHandler(r))) // NB promhttp does its own compression
 }
 
-// RegisterReportPostHandler registers the handler for report submission
-func RegisterReportPostHandler(a Adder, router *mux.Router) {
+// RegisterReportPostHandler registers the handler for report submission.
+// The reports of each user, as identified by userIDer, are kept apart.
+func RegisterReportPostHandler(a Adder, router *mux.Router, userIDer UserIDer) {
+	bases := newReportBases(userIDer)
 	post := router.Methods("POST").Subrouter()
 	post.HandleFunc("/api/report", requestContextDecorator(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-		var (
-			rpt    report.Report
-			buf    = &bytes.Buffer{}
-			reader = io.TeeReader(r.Body, buf)
-		)
-
-		gzipped := strings.Contains(r.Header.Get("Content-Encoding"), "gzip")
-		if !gzipped {
-			reader = io.TeeReader(r.Body, gzip.NewWriter(buf))
-		}
-
-		contentType := r.Header.Get("Content-Type")
-		isMsgpack := strings.HasPrefix(contentType, "application/msgpack")
-		var handle codec.Handle
-		switch {
-		case strings.HasPrefix(contentType, "application/json"):
-			handle = &codec.JsonHandle{}
-		case isMsgpack:
-			handle = &codec.MsgpackHandle{}
-		default:
-			respondWith(w, http.StatusBadRequest, fmt.Errorf("Unsupported Content-Type: %v", contentType))
+		ack, status, err := addReport(ctx, a, bases,
+			r.Header.Get(xfer.ScopeProbeIDHeader),
+			r.Header.Get(xfer.ScopeReportIDHeader),
+			r.Header.Get("Content-Type"),
+			strings.Contains(r.Header.Get("Content-Encoding"), "gzip"),
+			r.Body)
+		if err != nil {
+			respondWith(w, status, err)
 			return
 		}
-
-		if err := rpt.ReadBinary(ctx, reader, gzipped, handle); err != nil {
-			respondWith(w, http.StatusBadRequest, err)
-			return
+		if ack != "" {
+			w.Header().Set(xfer.ScopeReportAckHeader, ack)
 		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+// addReport decodes a report published by a probe, or a delta against the
+// last one it published, and adds it. It returns the ID to acknowledge the
+// report with, if any, and the HTTP status describing any error.
+func addReport(ctx context.Context, a Adder, bases *reportBases, probeID, reportID, contentType string, gzipped bool, body io.Reader) (string, int, error) {
+	var (
+		rpt    report.Report
+		buf    = &bytes.Buffer{}
+		reader = io.TeeReader(body, buf)
+	)
+
+	if !gzipped {
+		reader = io.TeeReader(body, gzip.NewWriter(buf))
+	}
 
-		// a.Add(..., buf) assumes buf is gzip'd msgpack
-		if !isMsgpack {
-			buf, _ = rpt.WriteBinary()
+	isDelta := strings.HasPrefix(contentType, xfer.ReportDeltaContentType)
+	isMsgpack := strings.HasPrefix(contentType, "application/msgpack")
+	var handle codec.Handle
+	switch {
+	case strings.HasPrefix(contentType, "application/json"):
+		handle = &codec.JsonHandle{}
+	case isMsgpack, isDelta:
+		handle = &codec.MsgpackHandle{}
+	default:
+		return "", http.StatusBadRequest, fmt.Errorf("Unsupported Content-Type: %v", contentType)
+	}
+
+	if isDelta {
+		var delta report.Delta
+		if err := delta.ReadBinary(reader, gzipped, handle); err != nil {
+			return "", http.StatusBadRequest, err
 		}
+		key, err := bases.key(ctx, probeID)
+		if err != nil {
+			return "", http.StatusUnauthorized, err
+		}
+		// The base can be missing if the app restarted, or if the
+		// probe is talking to several apps behind one address; the
+		// probe reacts to this by publishing a full report.
+		base, ok := bases.get(key)
+		if !ok {
+			return "", http.StatusConflict, fmt.Errorf("No base report for probe %q", probeID)
+		}
+		if rpt, err = delta.Apply(base); err != nil {
+			return "", http.StatusConflict, err
+		}
+	} else if err := rpt.ReadBinary(ctx, reader, gzipped, handle); err != nil {
+		return "", http.StatusBadRequest, err
+	}
 
-		if err := a.Add(ctx, rpt, buf.Bytes()); err != nil {
-			log.Errorf("Error Adding report: %v", err)
-			respondWith(w, http.StatusInternalServerError, err)
-			return
+	// a.Add(..., buf) assumes buf is gzip'd msgpack; the gzip writer
+	// above is never closed, so re-encode those too.
+	if !isMsgpack || !gzipped {
+		buf, _ = rpt.WriteBinary()
+	}
+
+	if err := a.Add(ctx, rpt, buf.Bytes()); err != nil {
+		log.Errorf("Error Adding report: %v", err)
+		return "", http.StatusInternalServerError, err
+	}
+
+	// Probes able to publish deltas say so by sending the report ID;
+	// shortcut reports are partial, so can't serve as a base.
+	if probeID != "" && reportID != "" && !rpt.Shortcut {
+		key, err := bases.key(ctx, probeID)
+		if err != nil {
+			return "", http.StatusOK, nil
 		}
-		w.WriteHeader(http.StatusOK)
-	}))
+		bases.set(key, rpt, buf.Len())
+		return rpt.ID, http.StatusOK, nil
+	}
+	return "", http.StatusOK, nil
 }
 
 var newVersion = struct {
@@ -15,6 +15,9 @@ import (
 
 	"github.com/weaveworks/common/test"
 	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test/fixture"
 )
 
@@ -43,7 +46,7 @@ func TestReportPostHandler(t *testing.T) {
 	test := func(contentType string, encoder func(interface{}) ([]byte, error)) {
 		router := mux.NewRouter()
 		c := app.NewCollector(1 * time.Minute)
-		app.RegisterReportPostHandler(c, router)
+		app.RegisterReportPostHandler(c, router, nil)
 		ts := httptest.NewServer(router)
 		defer ts.Close()
 
@@ -94,3 +97,87 @@ func TestReportPostHandler(t *testing.T) {
 		return buf.Bytes(), err
 	})
 }
+
+func TestReportPostHandlerDelta(t *testing.T) {
+	router := mux.NewRouter()
+	c := app.NewCollector(1 * time.Minute)
+	app.RegisterReportPostHandler(c, router, func(ctx context.Context) (string, error) {
+		return ctx.Value(app.RequestCtxKey).(*http.Request).Header.Get("X-Scope-OrgID"), nil
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	orgID := "org1"
+	post := func(probeID, contentType string, body *bytes.Buffer, reportID string) *http.Response {
+		req, err := http.NewRequest("POST", ts.URL+"/api/report", body)
+		if err != nil {
+			t.Fatalf("Error posting report: %v", err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set(xfer.ScopeProbeIDHeader, probeID)
+		req.Header.Set(xfer.ScopeReportIDHeader, reportID)
+		req.Header.Set("X-Scope-OrgID", orgID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error posting report %v", err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	base := fixture.Report.Copy()
+	buf, err := base.WriteBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := post("probe1", "application/msgpack", buf, base.ID)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Error posting report: %d", resp.StatusCode)
+	}
+	if have := resp.Header.Get(xfer.ScopeReportAckHeader); have != base.ID {
+		t.Fatalf("Expected report %q to be acknowledged, got %q", base.ID, have)
+	}
+
+	current := base.Copy()
+	node := current.Container.Nodes[fixture.ClientContainerNodeID]
+	current.Container.Nodes[fixture.ClientContainerNodeID] = node.WithLatest(docker.ContainerName, time.Now(), "renamed")
+	delta := report.MakeDelta(base, current)
+
+	buf, err = delta.WriteBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = post("probe1", xfer.ReportDeltaContentType, buf, current.ID)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Error posting delta: %d", resp.StatusCode)
+	}
+	if have := resp.Header.Get(xfer.ScopeReportAckHeader); have != current.ID {
+		t.Fatalf("Expected delta %q to be acknowledged, got %q", current.ID, have)
+	}
+
+	// A probe the app has no base report for has to send a full report
+	buf, _ = delta.WriteBinary()
+	if resp := post("probe2", xfer.ReportDeltaContentType, buf, current.ID); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("Expected conflict posting delta without base, got %d", resp.StatusCode)
+	}
+
+	// Nor can one apply deltas to another organisation's probe's report
+	orgID = "org2"
+	buf, _ = delta.WriteBinary()
+	if resp := post("probe1", xfer.ReportDeltaContentType, buf, current.ID); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("Expected conflict posting delta for another organisation's probe, got %d", resp.StatusCode)
+	}
+
+	rpt, err := c.Report(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := len(base.Endpoint.Nodes), len(rpt.Endpoint.Nodes); want != have {
+		t.Errorf("Expected %d endpoint nodes, got %d", want, have)
+	}
+	if have, _ := rpt.Container.Nodes[fixture.ClientContainerNodeID].Latest.Lookup(docker.ContainerName); have != "renamed" {
+		t.Errorf("Expected container to be renamed, got %q", have)
+	}
+}
@@ -0,0 +1,334 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+// How long a new connection has to show whether it is HTTP/2 or not.
+const prefaceTimeout = 10 * time.Second
+
+// http2Preface is what every HTTP/2 connection, and so every gRPC stream
+// from a probe, starts with.
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// NewStreamServer makes a gRPC server accepting probes connecting over a
+// single stream, as an alternative to POSTing reports and separate control
+// and pipe websockets. If authorize is not nil, streams whose metadata it
+// rejects are refused. Streams are then identified by userIDer as the
+// requests to the HTTP API are, and refused if that fails.
+func NewStreamServer(a Adder, cr ControlRouter, pr PipeRouter, authorize func(http.Header) bool, userIDer UserIDer) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.CustomCodec(xfer.StreamCodec{}),
+		grpc.InitialWindowSize(xfer.StreamWindowSize),
+		grpc.InitialConnWindowSize(xfer.StreamConnWindowSize),
+	)
+	server.RegisterService(&xfer.StreamServiceDesc, &streamServer{
+		adder:     a,
+		cr:        cr,
+		pr:        pr,
+		bases:     newReportBases(userIDer),
+		authorize: authorize,
+		userIDer:  userIDer,
+	})
+	return server
+}
+
+type streamServer struct {
+	adder     Adder
+	cr        ControlRouter
+	pr        PipeRouter
+	bases     *reportBases
+	authorize func(http.Header) bool
+	userIDer  UserIDer
+}
+
+// streamHeaders turns the stream's metadata back into the headers the probe
+// would have sent over HTTP.
+func streamHeaders(ctx context.Context) http.Header {
+	headers := http.Header{}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		for _, value := range values {
+			headers.Add(key, value)
+		}
+	}
+	return headers
+}
+
+// streamRequestContext adds the request the probe would have made over HTTP
+// to ctx, as requestContextDecorator does, so the collector and routers can
+// tell whose the stream is.
+func streamRequestContext(ctx context.Context, headers http.Header) context.Context {
+	r, _ := http.NewRequest("POST", "/api/report", nil)
+	r.Header = headers
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+	r = r.WithContext(ctx)
+	return context.WithValue(ctx, RequestCtxKey, r)
+}
+
+// Connect serves one probe's stream until it goes away.
+func (s *streamServer) Connect(stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	headers := streamHeaders(ctx)
+	if s.authorize != nil && !s.authorize(headers) {
+		return grpc.Errorf(codes.Unauthenticated, "unauthorized")
+	}
+	ctx = streamRequestContext(ctx, headers)
+	if s.userIDer != nil {
+		if _, err := s.userIDer(ctx); err != nil {
+			return grpc.Errorf(codes.Unauthenticated, "%v", err)
+		}
+	}
+	probeID := headers.Get(xfer.ScopeProbeIDHeader)
+	if probeID == "" {
+		return grpc.Errorf(codes.InvalidArgument, "missing %s", xfer.ScopeProbeIDHeader)
+	}
+
+	conn := &probeStream{
+		StreamConn: xfer.NewStreamConn(stream),
+		responses:  map[uint64]chan xfer.Response{},
+	}
+	defer conn.CloseAll()
+
+	var (
+		controlsID int64
+		controls   bool
+	)
+	defer func() {
+		if controls {
+			s.cr.Deregister(ctx, probeID, controlsID)
+		}
+	}()
+
+	for {
+		msg, err := conn.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch {
+		case msg.Hello != nil:
+			if msg.Hello.Controls && !controls {
+				if controlsID, err = s.cr.Register(ctx, probeID, conn.control); err != nil {
+					return err
+				}
+				controls = true
+			}
+			// Answering tells the probe the stream works end to end.
+			if err := conn.Send(xfer.StreamMessage{Hello: &xfer.StreamHello{}}); err != nil {
+				return err
+			}
+
+		case msg.Report != nil:
+			// Adding the report before reading anything else pushes back on
+			// the probe while we're busy.
+			ack, status, err := addReport(ctx, s.adder, s.bases, probeID, msg.ReportID, msg.ReportContentType, true, bytes.NewReader(msg.Report))
+			reply := xfer.StreamReportAck{ID: ack, Status: status}
+			if err != nil {
+				reply.Error = err.Error()
+			}
+			if err := conn.Send(xfer.StreamMessage{ReportAck: &reply}); err != nil {
+				return err
+			}
+
+		case msg.ControlResponse != nil:
+			conn.response(msg.ControlID, *msg.ControlResponse)
+
+		case msg.PipeOpen:
+			s.pipe(ctx, conn, msg.PipeID)
+
+		case msg.PipeData != nil:
+			conn.Deliver(msg.PipeID, msg.PipeData)
+
+		case msg.PipeClosed:
+			conn.ClosePipeID(msg.PipeID)
+			if err := s.pr.Delete(ctx, msg.PipeID); err != nil {
+				log.Debugf("Error deleting pipe %s: %v", msg.PipeID, err)
+			}
+		}
+	}
+}
+
+// pipe connects the probe end of a pipe to the stream, as the websocket at
+// /api/pipe/{pipeID}/probe would.
+func (s *streamServer) pipe(ctx context.Context, conn *probeStream, id string) {
+	pipe, endIO, err := s.pr.Get(ctx, id, ProbeEnd)
+	if err != nil {
+		// this usually means the pipe has been closed
+		log.Debugf("Error getting pipe %s: %v", id, err)
+		conn.Send(xfer.StreamMessage{PipeID: id, PipeClosed: true})
+		return
+	}
+	streamPipe := conn.OpenPipe(id)
+	go func() {
+		defer s.pr.Release(ctx, id, ProbeEnd)
+		if err := pipe.CopyToWebsocket(endIO, streamPipe); err != nil && !xfer.IsExpectedWSCloseError(err) {
+			log.Errorf("Error copying to pipe %s stream: %v", id, err)
+		}
+		if !streamPipe.Closed() {
+			conn.ClosePipe(streamPipe)
+			conn.Send(xfer.StreamMessage{PipeID: id, PipeClosed: true})
+		}
+	}()
+}
+
+// probeStream is the app's end of a probe's stream.
+type probeStream struct {
+	lastID uint64 // first, for 64-bit alignment of atomic accesses
+
+	*xfer.StreamConn
+	mtx       sync.Mutex
+	responses map[uint64]chan xfer.Response
+}
+
+// control sends a control request to the probe and waits for the response.
+func (p *probeStream) control(req xfer.Request) xfer.Response {
+	id := atomic.AddUint64(&p.lastID, 1)
+	response := make(chan xfer.Response, 1)
+	p.mtx.Lock()
+	p.responses[id] = response
+	p.mtx.Unlock()
+	defer func() {
+		p.mtx.Lock()
+		delete(p.responses, id)
+		p.mtx.Unlock()
+	}()
+
+	if err := p.Send(xfer.StreamMessage{ControlID: id, ControlRequest: &req}); err != nil {
+		return xfer.ResponseError(err)
+	}
+	select {
+	case res := <-response:
+		return res
+	case <-p.Context().Done():
+		return xfer.ResponseErrorf("Probe disconnected")
+	}
+}
+
+func (p *probeStream) response(id uint64, res xfer.Response) {
+	p.mtx.Lock()
+	response, ok := p.responses[id]
+	p.mtx.Unlock()
+	if ok {
+		response <- res
+	}
+}
+
+// SplitListener splits the connections accepted by l between HTTP/2 ones,
+// i.e. probe streams, and the rest, so both can be served on the same port.
+// Closing either listener closes l.
+func SplitListener(l net.Listener) (httpListener, streamListener net.Listener) {
+	s := &splitListener{
+		Listener: l,
+		quit:     make(chan struct{}),
+	}
+	s.http = &subListener{splitListener: s, conns: make(chan net.Conn)}
+	s.stream = &subListener{splitListener: s, conns: make(chan net.Conn)}
+	go s.loop()
+	return s.http, s.stream
+}
+
+type splitListener struct {
+	net.Listener
+	http, stream *subListener
+
+	once sync.Once
+	quit chan struct{}
+	err  error
+}
+
+func (s *splitListener) loop() {
+	for {
+		conn, err := s.Listener.Accept()
+		if err != nil {
+			s.close(err)
+			return
+		}
+		go s.route(conn)
+	}
+}
+
+// route works out where a connection should go from its first bytes, as far
+// as they match the HTTP/2 preface.
+func (s *splitListener) route(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(prefaceTimeout))
+	target := s.stream
+	for i := 1; i <= len(http2Preface); i++ {
+		peeked, err := reader.Peek(i)
+		if err != nil {
+			// Let the HTTP server deal with whatever we got.
+			target = s.http
+			break
+		}
+		if peeked[i-1] != http2Preface[i-1] {
+			target = s.http
+			break
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	select {
+	case target.conns <- &peekedConn{Conn: conn, reader: reader}:
+	case <-s.quit:
+		conn.Close()
+	}
+}
+
+func (s *splitListener) close(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.quit)
+		s.Listener.Close()
+	})
+}
+
+type subListener struct {
+	*splitListener
+	conns chan net.Conn
+}
+
+func (l *subListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.quit:
+		return nil, l.err
+	}
+}
+
+func (l *subListener) Close() error {
+	l.close(fmt.Errorf("listener closed"))
+	return nil
+}
+
+// peekedConn is a connection whose first bytes have been read already.
+type peekedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
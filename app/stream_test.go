@@ -0,0 +1,316 @@
+package app_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+type pipeClient struct {
+	c appclient.AppClient
+}
+
+func (p pipeClient) PipeConnection(_, pipeID string, pipe xfer.Pipe) error {
+	p.c.PipeConnection(pipeID, pipe)
+	return nil
+}
+
+func (p pipeClient) PipeClose(_, pipeID string) error {
+	return p.c.PipeClose(pipeID)
+}
+
+// streamTestApp serves an app, accepting streams only if stream is true.
+func streamTestApp(t *testing.T, stream bool, userIDer app.UserIDer) (app.Collector, string, func()) {
+	var (
+		collector     = app.NewCollector(time.Minute)
+		controlRouter = app.NewLocalControlRouter()
+		pipeRouter    = app.NewLocalPipeRouter()
+		router        = mux.NewRouter()
+	)
+	router.Methods("GET").Path("/api").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		codec.NewEncoder(w, &codec.JsonHandle{}).Encode(xfer.Details{
+			ID:           "app",
+			Capabilities: map[string]bool{xfer.StreamCapability: true},
+		})
+	})
+	app.RegisterReportPostHandler(collector, router, userIDer)
+	app.RegisterControlRoutes(router, controlRouter, collector, nil)
+	app.RegisterPipeRoutes(router, pipeRouter)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpListener := listener
+	streamServer := app.NewStreamServer(collector, controlRouter, pipeRouter, nil, userIDer)
+	if stream {
+		var streamListener net.Listener
+		httpListener, streamListener = app.SplitListener(listener)
+		go streamServer.Serve(streamListener)
+	}
+	go http.Serve(httpListener, router)
+
+	return collector, listener.Addr().String(), func() {
+		streamServer.Stop()
+		listener.Close()
+		pipeRouter.Stop()
+	}
+}
+
+func hasNode(collector app.Collector, id string) func() interface{} {
+	return func() interface{} {
+		rpt, err := collector.Report(context.Background(), time.Now())
+		if err != nil {
+			return false
+		}
+		_, ok := rpt.Host.Nodes[id]
+		return ok
+	}
+}
+
+func TestStream(t *testing.T) {
+	collector, addr, stop := streamTestApp(t, true, nil)
+	defer stop()
+
+	controlHandler := xfer.ControlHandlerFunc(func(req xfer.Request) xfer.Response {
+		if req.NodeID != "nodeid" || req.Control != "control" || req.AppID != "app" {
+			return xfer.ResponseErrorf("unexpected request %v", req)
+		}
+		return xfer.Response{Value: "foo"}
+	})
+	probeConfig := appclient.ProbeConfig{
+		ProbeID:            "foo",
+		FullReportInterval: time.Minute,
+		Stream:             true,
+	}
+	client, err := appclient.NewAppClient(probeConfig, addr, url.URL{Scheme: "http", Host: addr}, controlHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+	if _, err := client.Details(); err != nil {
+		t.Fatal(err)
+	}
+	client.ControlConnection()
+
+	// Reports, the second of which goes out as a delta
+	for _, id := range []string{"host1", "host2"} {
+		rpt := report.MakeReport()
+		rpt.Host.AddNode(report.MakeNode(id))
+		if err := client.Publish(appclient.NewEncodedReport(rpt)); err != nil {
+			t.Fatal(err)
+		}
+		test.Poll(t, time.Second, true, hasNode(collector, id))
+	}
+
+	// Controls
+	var response xfer.Response
+	test.Poll(t, time.Second, "foo", func() interface{} {
+		resp, err := http.Post(
+			fmt.Sprintf("http://%s/api/control/foo/nodeid/control", addr),
+			"application/json",
+			strings.NewReader("{}"),
+		)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&response); err != nil {
+			return err
+		}
+		return response.Value
+	})
+
+	// Pipes
+	pipeID, pipe, err := controls.NewPipe(pipeClient{client}, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s/api/pipe/%s", addr, pipeID), http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	local, _ := pipe.Ends()
+	msg := []byte("hello world")
+	if _, err := local.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, buf, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf, msg) {
+		t.Fatalf("%v != %v", buf, msg)
+	}
+
+	msg = []byte("goodbye, cruel world")
+	if err := conn.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	if n, err := local.Read(buf); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(msg, buf[:n]) {
+		t.Fatalf("%v != %v", buf[:n], msg)
+	}
+
+	// Closing the pipe on the probe deletes it in the app
+	if err := pipe.Close(); err != nil {
+		t.Fatal(err)
+	}
+	test.Poll(t, time.Second, true, func() interface{} {
+		_, _, err := conn.ReadMessage()
+		return err != nil
+	})
+}
+
+func TestStreamSlowPipe(t *testing.T) {
+	collector, addr, stop := streamTestApp(t, true, nil)
+	defer stop()
+
+	controlHandler := xfer.ControlHandlerFunc(func(req xfer.Request) xfer.Response {
+		return xfer.Response{Value: "foo"}
+	})
+	probeConfig := appclient.ProbeConfig{
+		ProbeID: "foo",
+		Stream:  true,
+	}
+	client, err := appclient.NewAppClient(probeConfig, addr, url.URL{Scheme: "http", Host: addr}, controlHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+	if _, err := client.Details(); err != nil {
+		t.Fatal(err)
+	}
+	client.ControlConnection()
+
+	// A pipe which is never read on the probe
+	pipeID, _, err := controls.NewPipe(pipeClient{client}, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s/api/pipe/%s", addr, pipeID), http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 2*xfer.StreamPipeBuffer; i++ {
+		if err := conn.WriteMessage(websocket.BinaryMessage, []byte("hello")); err != nil {
+			break
+		}
+	}
+
+	// Reports and controls still go through
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode("host1"))
+	if err := client.Publish(appclient.NewEncodedReport(rpt)); err != nil {
+		t.Fatal(err)
+	}
+	test.Poll(t, 5*time.Second, true, hasNode(collector, "host1"))
+
+	test.Poll(t, 5*time.Second, "foo", func() interface{} {
+		resp, err := http.Post(
+			fmt.Sprintf("http://%s/api/control/foo/nodeid/control", addr),
+			"application/json",
+			strings.NewReader("{}"),
+		)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		var response xfer.Response
+		if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&response); err != nil {
+			return err
+		}
+		return response.Value
+	})
+
+	// and the pipe which didn't keep up is closed
+	test.Poll(t, 5*time.Second, true, func() interface{} {
+		_, _, err := conn.ReadMessage()
+		return err != nil
+	})
+}
+
+func TestStreamUserID(t *testing.T) {
+	// Probes are told apart by their token, as with multitenant.UserIDHeader
+	userIDs := make(chan string, 10)
+	userIDer := func(ctx context.Context) (string, error) {
+		r, ok := ctx.Value(app.RequestCtxKey).(*http.Request)
+		if !ok || r.Header.Get("Authorization") == "" {
+			return "", fmt.Errorf("no user ID")
+		}
+		userIDs <- r.Header.Get("Authorization")
+		return r.Header.Get("Authorization"), nil
+	}
+	collector, addr, stop := streamTestApp(t, true, userIDer)
+	defer stop()
+
+	probeConfig := appclient.ProbeConfig{
+		Token:              "user1",
+		ProbeID:            "foo",
+		FullReportInterval: time.Minute,
+		Stream:             true,
+	}
+	client, err := appclient.NewAppClient(probeConfig, addr, url.URL{Scheme: "http", Host: addr}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+	if _, err := client.Details(); err != nil {
+		t.Fatal(err)
+	}
+
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode("host1"))
+	if err := client.Publish(appclient.NewEncodedReport(rpt)); err != nil {
+		t.Fatal(err)
+	}
+	test.Poll(t, time.Second, true, hasNode(collector, "host1"))
+	if userID := <-userIDs; userID != "Scope-Probe token=user1" {
+		t.Errorf("Expected the stream to be user1's, got %q", userID)
+	}
+}
+
+func TestStreamFallback(t *testing.T) {
+	collector, addr, stop := streamTestApp(t, false, nil)
+	defer stop()
+
+	probeConfig := appclient.ProbeConfig{
+		ProbeID: "foo",
+		Stream:  true,
+	}
+	client, err := appclient.NewAppClient(probeConfig, addr, url.URL{Scheme: "http", Host: addr}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+	if _, err := client.Details(); err != nil {
+		t.Fatal(err)
+	}
+
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode("host1"))
+	if err := client.Publish(appclient.NewEncodedReport(rpt)); err != nil {
+		t.Fatal(err)
+	}
+	test.Poll(t, 5*time.Second, true, hasNode(collector, "host1"))
+}
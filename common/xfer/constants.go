@@ -12,12 +12,28 @@ const (
 
 	// ScopeProbeVersionHeader is the header we use to carry the probe's version.
 	ScopeProbeVersionHeader = "X-Scope-Probe-Version"
+
+	// ScopeReportIDHeader is the header probes use to carry the ID of the
+	// report they publish, when they are able to publish deltas against it.
+	ScopeReportIDHeader = "X-Scope-Report-ID"
+
+	// ScopeReportAckHeader is the header the app uses to acknowledge a
+	// report, meaning the probe can publish deltas against it from then on.
+	ScopeReportAckHeader = "X-Scope-Report-Ack"
+
+	// ReportDeltaContentType is the content type of reports published as
+	// deltas against an acknowledged report.
+	ReportDeltaContentType = "application/vnd.weaveworks.scope.delta+msgpack"
 )
 
 // HistoricReportsCapability indicates whether reports older than the
 // current time (-app.window) can be retrieved.
 const HistoricReportsCapability = "historic_reports"
 
+// StreamCapability indicates whether probes can connect to the app over a
+// single gRPC stream, on the same port as the HTTP API.
+const StreamCapability = "probe_stream"
+
 // Details are some generic details that can be fetched from /api
 type Details struct {
 	ID           string          `json:"id"`
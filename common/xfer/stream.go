@@ -0,0 +1,306 @@
+package xfer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+	"google.golang.org/grpc"
+)
+
+const (
+	// StreamMethod is the gRPC method probes call to open their stream to an
+	// app, over which reports, controls and pipes are all multiplexed.
+	StreamMethod = "/scope.App/Connect"
+
+	// StreamWindowSize and StreamConnWindowSize are the HTTP/2 flow control
+	// windows for streams. They are larger than gRPC's default 64KB, as a
+	// report is typically a few hundred KB and shouldn't take several round
+	// trips.
+	StreamWindowSize     = 1 << 20
+	StreamConnWindowSize = 4 << 20
+
+	// StreamPipeBuffer is how many messages received for a pipe are
+	// buffered until it reads them. Pipes falling further behind are
+	// closed.
+	StreamPipeBuffer = 64
+)
+
+// StreamMessage is what probes and apps exchange over the stream. Each
+// message carries one of the kinds of traffic below.
+type StreamMessage struct {
+	// Hello is the first message a probe sends, which the app answers.
+	Hello *StreamHello `json:"hello,omitempty"`
+
+	// Report is published by the probe, encoded as it would be for
+	// POST /api/report, and is acknowledged by the app with ReportAck.
+	Report            []byte           `json:"report,omitempty"`
+	ReportContentType string           `json:"reportContentType,omitempty"`
+	ReportID          string           `json:"reportID,omitempty"`
+	ReportAck         *StreamReportAck `json:"reportAck,omitempty"`
+
+	// Control requests go from app to probe, and their responses back,
+	// matched up by ControlID.
+	ControlID       uint64    `json:"controlID,omitempty"`
+	ControlRequest  *Request  `json:"controlRequest,omitempty"`
+	ControlResponse *Response `json:"controlResponse,omitempty"`
+
+	// Pipe traffic goes both ways. The probe opens its end of a pipe with
+	// PipeOpen, and deletes the pipe with PipeClosed; the app sends
+	// PipeClosed when the pipe is gone on its side.
+	PipeID     string `json:"pipeID,omitempty"`
+	PipeOpen   bool   `json:"pipeOpen,omitempty"`
+	PipeData   []byte `json:"pipeData,omitempty"`
+	PipeClosed bool   `json:"pipeClosed,omitempty"`
+}
+
+// StreamHello tells the app what the probe wants to use the stream for.
+type StreamHello struct {
+	Controls bool `json:"controls,omitempty"`
+}
+
+// StreamReportAck is the outcome of publishing a report; Status is the
+// HTTP status the app would have replied to POST /api/report with.
+type StreamReportAck struct {
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// StreamServer is implemented by apps accepting probe streams.
+type StreamServer interface {
+	Connect(grpc.ServerStream) error
+}
+
+// StreamServiceDesc describes the gRPC service probes connect to.
+var StreamServiceDesc = grpc.ServiceDesc{
+	ServiceName: "scope.App",
+	HandlerType: (*StreamServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName: "Connect",
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			return srv.(StreamServer).Connect(stream)
+		},
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+}
+
+// StreamCodec is the gRPC codec for StreamMessages, which are encoded as
+// msgpack like the rest of what probes send.
+type StreamCodec struct{}
+
+var streamHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{RawToString: true}
+	// Control response values end up JSON-encoded for the UI.
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return h
+}()
+
+// Marshal implements grpc.Codec
+func (StreamCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := codec.NewEncoder(buf, streamHandle).Encode(v)
+	return buf.Bytes(), err
+}
+
+// Unmarshal implements grpc.Codec
+func (StreamCodec) Unmarshal(data []byte, v interface{}) error {
+	return codec.NewDecoderBytes(data, streamHandle).Decode(v)
+}
+
+// String implements grpc.Codec
+func (StreamCodec) String() string {
+	return "msgpack"
+}
+
+// Stream is the part of gRPC client and server streams used by both ends.
+type Stream interface {
+	Context() context.Context
+	SendMsg(m interface{}) error
+	RecvMsg(m interface{}) error
+}
+
+// StreamConn wraps a stream, serialising sends (which gRPC doesn't allow
+// concurrently) and keeping track of the pipes multiplexed over it.
+type StreamConn struct {
+	stream  Stream
+	sendMtx sync.Mutex
+
+	mtx   sync.Mutex
+	pipes map[string]*StreamPipe
+}
+
+// NewStreamConn makes a new StreamConn.
+func NewStreamConn(stream Stream) *StreamConn {
+	return &StreamConn{
+		stream: stream,
+		pipes:  map[string]*StreamPipe{},
+	}
+}
+
+// Context is the context of the underlying stream.
+func (c *StreamConn) Context() context.Context {
+	return c.stream.Context()
+}
+
+// Send sends a message. It blocks while the peer isn't keeping up.
+func (c *StreamConn) Send(msg StreamMessage) error {
+	c.sendMtx.Lock()
+	defer c.sendMtx.Unlock()
+	return c.stream.SendMsg(&msg)
+}
+
+// Recv receives the next message.
+func (c *StreamConn) Recv() (StreamMessage, error) {
+	var msg StreamMessage
+	err := c.stream.RecvMsg(&msg)
+	return msg, err
+}
+
+// OpenPipe starts multiplexing the pipe with the given ID, replacing any
+// previous one.
+func (c *StreamConn) OpenPipe(id string) *StreamPipe {
+	p := &StreamPipe{
+		id:       id,
+		conn:     c,
+		incoming: make(chan []byte, StreamPipeBuffer),
+		quit:     make(chan struct{}),
+	}
+	c.mtx.Lock()
+	old := c.pipes[id]
+	c.pipes[id] = p
+	c.mtx.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return p
+}
+
+// ClosePipe stops multiplexing the pipe, if it still is.
+func (c *StreamConn) ClosePipe(p *StreamPipe) {
+	c.mtx.Lock()
+	if c.pipes[p.id] == p {
+		delete(c.pipes, p.id)
+	}
+	c.mtx.Unlock()
+	p.Close()
+}
+
+// ClosePipeID is ClosePipe by ID, for when the peer closes a pipe.
+func (c *StreamConn) ClosePipeID(id string) {
+	c.mtx.Lock()
+	p, ok := c.pipes[id]
+	c.mtx.Unlock()
+	if ok {
+		c.ClosePipe(p)
+	}
+}
+
+// Deliver passes pipe data received to the pipe. It never blocks, as that
+// would stop reading from the stream, holding up reports and controls too:
+// a pipe whose buffer is full is closed instead, and the peer told so.
+func (c *StreamConn) Deliver(id string, data []byte) {
+	c.mtx.Lock()
+	p, ok := c.pipes[id]
+	c.mtx.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case p.incoming <- data:
+	case <-p.quit:
+	default:
+		log.Warnf("Closing pipe %s, which isn't keeping up", id)
+		c.ClosePipe(p)
+		// Sending blocks while the peer isn't keeping up either
+		go c.Send(StreamMessage{PipeID: id, PipeClosed: true})
+	}
+}
+
+// CloseAll closes all the pipes, once the stream has ended.
+func (c *StreamConn) CloseAll() {
+	c.mtx.Lock()
+	pipes := c.pipes
+	c.pipes = map[string]*StreamPipe{}
+	c.mtx.Unlock()
+	for _, p := range pipes {
+		p.Close()
+	}
+}
+
+// StreamPipe is a pipe multiplexed over a stream. It implements Websocket,
+// so Pipe.CopyToWebsocket can be used with it.
+type StreamPipe struct {
+	id       string
+	conn     *StreamConn
+	incoming chan []byte
+	quit     chan struct{}
+	once     sync.Once
+}
+
+// ReadMessage implements Websocket
+func (p *StreamPipe) ReadMessage() (int, []byte, error) {
+	select {
+	case data := <-p.incoming:
+		return websocket.BinaryMessage, data, nil
+	case <-p.quit:
+		return 0, nil, io.EOF
+	}
+}
+
+// WriteMessage implements Websocket
+func (p *StreamPipe) WriteMessage(_ int, data []byte) error {
+	select {
+	case <-p.quit:
+		return io.ErrClosedPipe
+	default:
+	}
+	return p.conn.Send(StreamMessage{PipeID: p.id, PipeData: data})
+}
+
+// ReadJSON implements Websocket
+func (p *StreamPipe) ReadJSON(v interface{}) error {
+	_, data, err := p.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WriteJSON implements Websocket
+func (p *StreamPipe) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return p.WriteMessage(websocket.TextMessage, data)
+}
+
+// Close implements Websocket. It doesn't tell the peer; that's up to the
+// owner of the pipe.
+func (p *StreamPipe) Close() error {
+	p.once.Do(func() { close(p.quit) })
+	return nil
+}
+
+// Done returns a channel which is closed when the pipe is.
+func (p *StreamPipe) Done() <-chan struct{} {
+	return p.quit
+}
+
+// Closed returns whether the pipe has been closed.
+func (p *StreamPipe) Closed() bool {
+	select {
+	case <-p.quit:
+		return true
+	default:
+		return false
+	}
+}
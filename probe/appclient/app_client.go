@@ -1,8 +1,9 @@
 package appclient
 
 import (
+	"bytes"
+	"crypto/tls"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -17,6 +18,7 @@ import (
 	"github.com/ugorji/go/codec"
 
 	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
 )
 
 const (
@@ -31,23 +33,52 @@ type AppClient interface {
 	ControlConnection()
 	PipeConnection(string, xfer.Pipe)
 	PipeClose(string) error
-	Publish(io.Reader, bool) error
+	Publish(*EncodedReport) error
 	Target() url.URL
 	ReTarget(url.URL)
 	Stop()
 }
 
+// EncodedReport is a report being published, which is encoded in full at
+// most once, however many apps it is published to. Apps acknowledging
+// reports may be sent a delta against their last one instead.
+type EncodedReport struct {
+	report.Report
+	once sync.Once
+	buf  []byte
+	err  error
+}
+
+// NewEncodedReport returns rpt, ready to be published.
+func NewEncodedReport(rpt report.Report) *EncodedReport {
+	return &EncodedReport{Report: rpt}
+}
+
+// Full returns the report encoded in full. The buffers returned share the
+// encoding, so must not be written to.
+func (r *EncodedReport) Full() (*bytes.Buffer, error) {
+	r.once.Do(func() {
+		buf, err := r.Report.WriteBinary()
+		if err == nil {
+			r.buf = buf.Bytes()
+		}
+		r.err = err
+	})
+	return bytes.NewBuffer(r.buf), r.err
+}
+
 // appClient is a client to an app, dealing with report publishing, controls and pipes.
 type appClient struct {
 	ProbeConfig
 
-	quit     chan struct{}
-	mtx      sync.Mutex
-	client   *http.Client
-	wsDialer websocket.Dialer
-	appID    string
-	hostname string
-	target   url.URL
+	quit      chan struct{}
+	mtx       sync.Mutex
+	client    *http.Client
+	wsDialer  websocket.Dialer
+	tlsConfig *tls.Config
+	appID     string
+	hostname  string
+	target    url.URL
 
 	// Track all the background goroutines, ensure they all stop
 	backgroundWait sync.WaitGroup
@@ -57,10 +88,26 @@ type appClient struct {
 
 	// For publish
 	publishLoop sync.Once
-	readers     chan io.Reader
+	reports     chan *EncodedReport
+
+	// For delta-encoded publishing; only used by whichever of the publish
+	// loop or the stream is publishing.
+	deltaBase    *report.Report // last report acknowledged by the app
+	lastFull     time.Time
+	lastConflict time.Time // last time the app didn't have our base
 
 	// For controls
 	control xfer.ControlHandler
+
+	// For the gRPC stream, used instead of all of the above when the app
+	// supports it.
+	useStream      bool // guarded by mtx
+	streamControls bool // guarded by mtx
+	session        *streamSession
+	pendingReport  *EncodedReport
+	reportReady    chan struct{}
+	streamLoop     sync.Once
+	streamed       bool // whether the stream ever worked; only used by its loop
 }
 
 // NewAppClient makes a new appClient.
@@ -80,9 +127,11 @@ func NewAppClient(pc ProbeConfig, hostname string, target url.URL, control xfer.
 			TLSClientConfig:  httpTransport.TLSClientConfig,
 			HandshakeTimeout: httpClientTimeout,
 		},
-		conns:   map[string]xfer.Websocket{},
-		readers: make(chan io.Reader, 2),
-		control: control,
+		tlsConfig:   httpTransport.TLSClientConfig,
+		conns:       map[string]xfer.Websocket{},
+		reports:     make(chan *EncodedReport, 2),
+		control:     control,
+		reportReady: make(chan struct{}, 1),
 	}, nil
 }
 
@@ -167,7 +216,7 @@ func (c *appClient) ReTarget(target url.URL) {
 // Stop stops the appClient.
 func (c *appClient) Stop() {
 	c.mtx.Lock()
-	close(c.readers)
+	close(c.reports)
 	close(c.quit)
 	for _, conn := range c.conns {
 		conn.Close()
@@ -196,6 +245,9 @@ func (c *appClient) Details() (xfer.Details, error) {
 		return result, err
 	}
 	c.appID = result.ID
+	c.mtx.Lock()
+	c.useStream = c.Stream && result.Capabilities[xfer.StreamCapability]
+	c.mtx.Unlock()
 	return result, nil
 }
 
@@ -273,6 +325,15 @@ func (c *appClient) controlConnection() (bool, error) {
 }
 
 func (c *appClient) ControlConnection() {
+	c.mtx.Lock()
+	if c.useStream {
+		c.streamControls = true
+		c.streamLoop.Do(c.startStreaming)
+		c.mtx.Unlock()
+		return
+	}
+	c.mtx.Unlock()
+
 	go func() {
 		log.Infof("Control connection to %s starting", c.hostname)
 		defer log.Infof("Control connection to %s exiting", c.hostname)
@@ -280,15 +341,65 @@ func (c *appClient) ControlConnection() {
 	}()
 }
 
-func (c *appClient) publish(r io.Reader) error {
+// encodeReport encodes rpt for publishing, as a delta against the last
+// report the app acknowledged if possible. Every FullReportInterval, and
+// whenever the app has lost track of the base, a full report is sent instead.
+//
+// Several apps behind one address, e.g. a load balancer, each only know
+// about the reports they received, so would keep rejecting deltas against
+// the others' bases. Hence after a rejection only full reports are sent,
+// until FullReportInterval has passed.
+func (c *appClient) encodeReport(rpt *EncodedReport) (*bytes.Buffer, string, bool, error) {
+	now := time.Now()
+	if c.deltaBase != nil && !rpt.Shortcut && now.Sub(c.lastFull) < c.FullReportInterval && now.Sub(c.lastConflict) >= c.FullReportInterval {
+		buf, err := report.MakeDelta(*c.deltaBase, rpt.Report).WriteBinary()
+		return buf, xfer.ReportDeltaContentType, true, err
+	}
+	buf, err := rpt.Full()
+	return buf, "application/msgpack", false, err
+}
+
+// conflicted records that the app didn't have the base of a delta.
+func (c *appClient) conflicted() {
+	c.deltaBase = nil
+	c.lastConflict = time.Now()
+}
+
+// acknowledged records the app's acknowledgement of rpt, if any, so the
+// next reports are published as deltas against it.
+func (c *appClient) acknowledged(rpt *EncodedReport, delta bool, ack string) {
+	if rpt.Shortcut {
+		return
+	}
+	if ack != rpt.ID {
+		// Apps which don't know about deltas don't acknowledge reports
+		c.deltaBase = nil
+		return
+	}
+	c.deltaBase = &rpt.Report
+	if !delta {
+		c.lastFull = time.Now()
+	}
+}
+
+// publish sends rpt to the app over HTTP.
+func (c *appClient) publish(rpt *EncodedReport) error {
+	buf, contentType, delta, err := c.encodeReport(rpt)
+	if err != nil {
+		return err
+	}
+
 	url := c.url("/api/report")
-	req, err := c.ProbeConfig.authorizedRequest("POST", url, r)
+	req, err := c.ProbeConfig.authorizedRequest("POST", url, buf)
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Encoding", "gzip")
-	req.Header.Set("Content-Type", "application/msgpack")
+	req.Header.Set("Content-Type", contentType)
 	// req.Header.Set("Content-Type", "application/binary") // TODO: we should use http.DetectContentType(..) on the gob'ed
+	if c.FullReportInterval > 0 && !rpt.Shortcut {
+		req.Header.Set(xfer.ScopeReportIDHeader, rpt.ID)
+	}
 
 	// Make sure this request is cancelled when we stop the client
 	req.Cancel = c.quit
@@ -299,10 +410,16 @@ func (c *appClient) publish(r io.Reader) error {
 	}
 	defer resp.Body.Close()
 
+	if delta && resp.StatusCode == http.StatusConflict {
+		// The app doesn't have our base (anymore), so fall back to a full report
+		c.conflicted()
+		return c.publish(rpt)
+	}
 	if resp.StatusCode != http.StatusOK {
 		text, _ := ioutil.ReadAll(resp.Body)
-		return fmt.Errorf(resp.Status + ": " + string(text))
+		return fmt.Errorf("%s: %s", resp.Status, text)
 	}
+	c.acknowledged(rpt, delta, resp.Header.Get(xfer.ScopeReportAckHeader))
 	return nil
 }
 
@@ -311,35 +428,38 @@ func (c *appClient) startPublishing() {
 		log.Infof("Publish loop for %s starting", c.hostname)
 		defer log.Infof("Publish loop for %s exiting", c.hostname)
 		c.doWithBackoff("publish", func() (bool, error) {
-			r := <-c.readers
-			if r == nil {
+			rpt, ok := <-c.reports
+			if !ok {
 				return true, nil
 			}
-			return false, c.publish(r)
+			return false, c.publish(rpt)
 		})
 	}()
 }
 
 // Publish implements Publisher
-func (c *appClient) Publish(r io.Reader, shortcut bool) error {
+func (c *appClient) Publish(rpt *EncodedReport) error {
+	if c.queueStreamReport(rpt) {
+		return nil
+	}
 	// Lazily start the background publishing loop.
 	c.publishLoop.Do(c.startPublishing)
 	// enqueue report
 	select {
-	case c.readers <- r:
+	case c.reports <- rpt:
 	default:
 		log.Warnf("Dropping report to %s", c.hostname)
-		if shortcut {
+		if rpt.Shortcut {
 			return nil
 		}
 		// drop an old report to make way for new one
 		c.mtx.Lock()
 		defer c.mtx.Unlock()
 		select {
-		case <-c.readers:
+		case <-c.reports:
 		default:
 		}
-		c.readers <- r
+		c.reports <- rpt
 	}
 	return nil
 }
@@ -376,13 +496,17 @@ func (c *appClient) PipeConnection(id string, pipe xfer.Pipe) {
 		log.Infof("Pipe %s connection to %s starting", id, c.hostname)
 		defer log.Infof("Pipe %s connection to %s exiting", id, c.hostname)
 		c.doWithBackoff(id, func() (bool, error) {
-			return c.pipeConnection(id, pipe)
+			return c.streamPipeConnection(id, pipe)
 		})
 	}()
 }
 
 // PipeClose closes the given pipe id on the app.
 func (c *appClient) PipeClose(id string) error {
+	if s, _ := c.streaming(); s != nil {
+		s.ClosePipeID(id)
+		return s.Send(xfer.StreamMessage{PipeID: id, PipeClosed: true})
+	}
 	url := c.url(fmt.Sprintf("/api/pipe/%s", id))
 	req, err := c.ProbeConfig.authorizedRequest("DELETE", url, nil)
 	if err != nil {
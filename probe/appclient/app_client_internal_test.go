@@ -105,8 +105,7 @@ func TestAppClientPublish(t *testing.T) {
 
 	// First few reports might be dropped as the client is spinning up.
 	for i := 0; i < 10; i++ {
-		buf, _ := rpt.WriteBinary()
-		if err := p.Publish(buf, false); err != nil {
+		if err := p.Publish(NewEncodedReport(rpt)); err != nil {
 			t.Error(err)
 		}
 		time.Sleep(10 * time.Millisecond)
@@ -119,6 +118,151 @@ func TestAppClientPublish(t *testing.T) {
 	}
 }
 
+func TestEncodedReportFull(t *testing.T) {
+	rpt := NewEncodedReport(report.MakeReport())
+	first, err := rpt.Full()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := rpt.Full()
+	if first.Len() == 0 || &first.Bytes()[0] != &second.Bytes()[0] {
+		t.Errorf("Expected the report to be encoded once")
+	}
+}
+
+func TestAppClientPublishDeltas(t *testing.T) {
+	test := func(ack bool, want []string) {
+		var (
+			received      = make(chan string, 10)
+			rejectedDelta = false
+		)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentType := r.Header.Get("Content-Type")
+			received <- contentType
+			if contentType == xfer.ReportDeltaContentType && !rejectedDelta {
+				// As if the app had restarted, losing the base
+				rejectedDelta = true
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			if ack {
+				w.Header().Set(xfer.ScopeReportAckHeader, r.Header.Get(xfer.ScopeReportIDHeader))
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+		s := httptest.NewServer(handler)
+		defer s.Close()
+
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := NewAppClient(ProbeConfig{FullReportInterval: time.Minute}, u.Host, *u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Stop()
+
+		have := []string{}
+		for i := 0; i < 3; i++ {
+			if err := p.Publish(NewEncodedReport(report.MakeReport())); err != nil {
+				t.Fatal(err)
+			}
+			// Wait for the publish, and any retry, to be over
+			for done := false; !done; {
+				select {
+				case contentType := <-received:
+					have = append(have, contentType)
+				case <-time.After(100 * time.Millisecond):
+					done = true
+				}
+			}
+		}
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("ack=%v: %s", ack, test.Diff(want, have))
+		}
+	}
+
+	test(true, []string{
+		"application/msgpack",
+		xfer.ReportDeltaContentType, // rejected, so sent again in full
+		"application/msgpack",
+		"application/msgpack", // no more deltas until the next full report interval
+	})
+	// Apps which don't acknowledge reports only ever get full ones
+	test(false, []string{
+		"application/msgpack",
+		"application/msgpack",
+		"application/msgpack",
+	})
+}
+
+func TestAppClientPublishDeltasLoadBalanced(t *testing.T) {
+	// Two apps behind one address, each only knowing the reports it got
+	var (
+		bases    [2]string
+		next     int
+		requests = make(chan string, 20)
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app := next
+		next = 1 - next
+		contentType := r.Header.Get("Content-Type")
+		requests <- contentType
+		if contentType == xfer.ReportDeltaContentType {
+			var delta report.Delta
+			if err := delta.ReadBinary(r.Body, true, &codec.MsgpackHandle{}); err != nil {
+				t.Error(err)
+			}
+			if delta.Base != bases[app] {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		bases[app] = r.Header.Get(xfer.ScopeReportIDHeader)
+		w.Header().Set(xfer.ScopeReportAckHeader, bases[app])
+		w.WriteHeader(http.StatusOK)
+	})
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewAppClient(ProbeConfig{FullReportInterval: time.Minute}, u.Host, *u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	have := []string{}
+	for i := 0; i < 5; i++ {
+		if err := p.Publish(NewEncodedReport(report.MakeReport())); err != nil {
+			t.Fatal(err)
+		}
+		for done := false; !done; {
+			select {
+			case contentType := <-requests:
+				have = append(have, contentType)
+			case <-time.After(100 * time.Millisecond):
+				done = true
+			}
+		}
+	}
+	want := []string{
+		"application/msgpack",
+		xfer.ReportDeltaContentType,
+		"application/msgpack",
+		"application/msgpack",
+		"application/msgpack",
+		"application/msgpack",
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
 func TestAppClientDetails(t *testing.T) {
 	var (
 		id      = "foobarbaz"
@@ -210,8 +354,7 @@ func TestStop(t *testing.T) {
 		case <-receivedReport:
 			done = true
 		default:
-			buf, _ := rpt.WriteBinary()
-			if err := p.Publish(buf, false); err != nil {
+			if err := p.Publish(NewEncodedReport(rpt)); err != nil {
 				t.Error(err)
 			}
 			time.Sleep(10 * time.Millisecond)
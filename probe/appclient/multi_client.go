@@ -1,7 +1,6 @@
 package appclient
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"net/url"
@@ -152,22 +151,19 @@ func (c *multiClient) Stop() {
 	close(c.quit)
 }
 
-// Publish implements Publisher by publishing the reader to all of the
-// underlying publishers sequentially. To do that, it needs to drain the
-// reader, and recreate new readers for each publisher. Note that it will
-// publish to one endpoint for each unique ID. Failed publishes don't count.
+// Publish implements Publisher by publishing the report to all of the
+// underlying publishers sequentially. The report is encoded in full once
+// for all of them; those publishing deltas encode their own. Note that it
+// will publish to one endpoint for each unique ID. Failed publishes don't
+// count.
 func (c *multiClient) Publish(r report.Report) error {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	buf, err := r.WriteBinary()
-	if err != nil {
-		return err
-	}
-
+	encoded := NewEncodedReport(r)
 	errs := []string{}
 	for _, c := range c.clients {
-		if err := c.Publish(bytes.NewReader(buf.Bytes()), r.Shortcut); err != nil {
+		if err := c.Publish(encoded); err != nil {
 			errs = append(errs, err.Error())
 		}
 	}
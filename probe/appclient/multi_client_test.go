@@ -1,7 +1,6 @@
 package appclient_test
 
 import (
-	"io"
 	"net/url"
 	"runtime"
 	"testing"
@@ -16,6 +15,7 @@ type mockClient struct {
 	count   int
 	stopped int
 	publish int
+	last    *appclient.EncodedReport
 }
 
 func (c *mockClient) Details() (xfer.Details, error) {
@@ -37,8 +37,9 @@ func (c *mockClient) Stop() {
 	c.stopped++
 }
 
-func (c *mockClient) Publish(io.Reader, bool) error {
+func (c *mockClient) Publish(rpt *appclient.EncodedReport) error {
 	c.publish++
+	c.last = rpt
 	return nil
 }
 
@@ -114,4 +115,8 @@ func TestMultiClientPublish(t *testing.T) {
 			t.Errorf("want %d, have %d", want, have)
 		}
 	}
+	// The report is only encoded once for all of them
+	if a1.last == nil || a1.last != b3.last {
+		t.Errorf("Expected clients to share the encoded report")
+	}
 }
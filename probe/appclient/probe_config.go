@@ -7,6 +7,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/certifi/gocertifi"
@@ -36,6 +37,14 @@ type ProbeConfig struct {
 	ProbeVersion string
 	ProbeID      string
 	Insecure     bool
+
+	// FullReportInterval is how often to publish a full report to apps
+	// which accept deltas; zero disables deltas.
+	FullReportInterval time.Duration
+
+	// Stream is whether to connect to apps which support it over a single
+	// gRPC stream, rather than HTTP and websockets.
+	Stream bool
 }
 
 func (pc ProbeConfig) authorizeHeaders(headers http.Header) {
@@ -56,6 +65,16 @@ func (pc ProbeConfig) authorizedRequest(method string, urlStr string, body io.Re
 	return req, err
 }
 
+// AuthorizedClient returns a request carrying the probe's credentials, and
+// a client to make it with, for talking to the app outside of an AppClient.
+func (pc ProbeConfig) AuthorizedClient(method string, u *url.URL, body io.Reader) (*http.Client, *http.Request, error) {
+	req, err := pc.authorizedRequest(method, u.String(), body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &http.Client{Transport: pc.getHTTPTransport(u.Hostname())}, req, nil
+}
+
 func (pc ProbeConfig) getHTTPTransport(hostname string) *http.Transport {
 	transport := cleanhttp.DefaultTransport()
 	transport.DialContext = (&net.Dialer{
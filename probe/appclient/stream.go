@@ -0,0 +1,375 @@
+package appclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+var errNotStreaming = errors.New("not connected to app")
+
+// streamSession is one connection of the gRPC stream to the app.
+type streamSession struct {
+	*xfer.StreamConn
+	cancel func()
+	acks   chan xfer.StreamReportAck
+	done   chan struct{}
+}
+
+func (s *streamSession) ended() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// streaming returns the current stream session, if any, and whether the
+// stream is to be used rather than HTTP at all.
+func (c *appClient) streaming() (*streamSession, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.session, c.useStream
+}
+
+func (c *appClient) startStreaming() {
+	go func() {
+		log.Infof("Stream to %s starting", c.hostname)
+		defer log.Infof("Stream to %s exiting", c.hostname)
+		c.doWithBackoff("stream", c.streamConnection)
+	}()
+}
+
+// fallBack stops using the stream, moving whatever was meant to go over it
+// to the HTTP endpoints.
+func (c *appClient) fallBack(err error) {
+	log.Warnf("Cannot stream to %s, falling back to HTTP: %v", c.hostname, err)
+	c.mtx.Lock()
+	c.useStream = false
+	controls, rpt := c.streamControls, c.pendingReport
+	c.pendingReport = nil
+	c.mtx.Unlock()
+
+	if controls {
+		c.ControlConnection()
+	}
+	if rpt != nil {
+		c.Publish(rpt)
+	}
+}
+
+func (c *appClient) dialStream(ctx context.Context) (*grpc.ClientConn, grpc.ClientStream, error) {
+	target := c.Target()
+	host := target.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		if target.Scheme == "https" {
+			host = net.JoinHostPort(host, "443")
+		} else {
+			host = net.JoinHostPort(host, "80")
+		}
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithCodec(xfer.StreamCodec{}),
+		grpc.WithInitialWindowSize(xfer.StreamWindowSize),
+		grpc.WithInitialConnWindowSize(xfer.StreamConnWindowSize),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, dialTimeout)
+		}),
+	}
+	if target.Scheme == "https" {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(c.tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	conn, err := grpc.DialContext(ctx, host, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headers := http.Header{}
+	c.ProbeConfig.authorizeHeaders(headers)
+	md := metadata.MD{}
+	for key, values := range headers {
+		md[strings.ToLower(key)] = values
+	}
+	stream, err := grpc.NewClientStream(metadata.NewOutgoingContext(ctx, md), &xfer.StreamServiceDesc.Streams[0], conn, xfer.StreamMethod)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, stream, nil
+}
+
+// handshake says hello and waits for the app to answer, which shows the
+// stream gets through whatever is between the probe and the app.
+func handshake(s *streamSession, controls bool) error {
+	if err := s.Send(xfer.StreamMessage{Hello: &xfer.StreamHello{Controls: controls}}); err != nil {
+		return err
+	}
+	answered := make(chan error, 1)
+	go func() {
+		msg, err := s.Recv()
+		if err == nil && msg.Hello == nil {
+			err = xfer.ErrInvalidMessage
+		}
+		answered <- err
+	}()
+	select {
+	case err := <-answered:
+		return err
+	case <-time.After(httpClientTimeout):
+		s.cancel()
+		return fmt.Errorf("timed out waiting for app")
+	}
+}
+
+// streamConnection runs one session of the stream, until it fails. If the
+// very first one fails, the stream is given up on in favour of HTTP.
+func (c *appClient) streamConnection() (bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	conn, stream, err := c.dialStream(ctx)
+	if err == nil {
+		defer conn.Close()
+	}
+	s := &streamSession{
+		cancel: cancel,
+		acks:   make(chan xfer.StreamReportAck, 1),
+		done:   make(chan struct{}),
+	}
+	if err == nil {
+		s.StreamConn = xfer.NewStreamConn(stream)
+		c.mtx.Lock()
+		controls := c.streamControls
+		c.mtx.Unlock()
+		err = handshake(s, controls)
+	}
+	if c.hasQuit() {
+		return true, nil
+	}
+	if err != nil {
+		if !c.streamed {
+			c.fallBack(err)
+			return true, nil
+		}
+		return false, err
+	}
+	c.streamed = true
+
+	c.mtx.Lock()
+	c.session = s
+	c.mtx.Unlock()
+	reportsDone := make(chan struct{})
+	go func() {
+		defer close(reportsDone)
+		c.streamReports(s)
+	}()
+	defer func() {
+		c.mtx.Lock()
+		c.session = nil
+		c.mtx.Unlock()
+		close(s.done)
+		cancel()
+		s.CloseAll()
+		<-reportsDone
+	}()
+
+	for {
+		msg, err := s.Recv()
+		if c.hasQuit() {
+			return true, nil
+		} else if err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		switch {
+		case msg.ReportAck != nil:
+			select {
+			case s.acks <- *msg.ReportAck:
+			default:
+				log.Warnf("Unexpected report acknowledgement from %s", c.hostname)
+			}
+
+		case msg.ControlRequest != nil:
+			go c.streamControl(s, msg.ControlID, *msg.ControlRequest)
+
+		case msg.PipeData != nil:
+			s.Deliver(msg.PipeID, msg.PipeData)
+
+		case msg.PipeClosed:
+			s.ClosePipeID(msg.PipeID)
+		}
+	}
+}
+
+func (c *appClient) streamControl(s *streamSession, id uint64, req xfer.Request) {
+	req.AppID = c.appID
+	var res xfer.Response
+	if c.control == nil {
+		res = xfer.ResponseErrorf("Controls are disabled")
+	} else {
+		c.control.Handle(req, &res)
+	}
+	if err := s.Send(xfer.StreamMessage{ControlID: id, ControlResponse: &res}); err != nil {
+		log.Errorf("Error responding to control for %s: %v", c.hostname, err)
+	}
+}
+
+// queueStreamReport queues rpt to go out over the stream, returning false if
+// the stream isn't used. Only one report is published at a time, and the
+// next one only once the app has acknowledged the previous one; reports
+// published in the meantime are merged into the one waiting to go out
+// rather than dropped.
+func (c *appClient) queueStreamReport(rpt *EncodedReport) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if !c.useStream {
+		return false
+	}
+	if c.pendingReport != nil {
+		merged := c.pendingReport.Merge(rpt.Report)
+		merged.ID = rpt.ID
+		merged.Shortcut = c.pendingReport.Shortcut && rpt.Shortcut
+		rpt = NewEncodedReport(merged)
+	}
+	c.pendingReport = rpt
+	select {
+	case c.reportReady <- struct{}{}:
+	default:
+	}
+	c.streamLoop.Do(c.startStreaming)
+	return true
+}
+
+func (c *appClient) takeStreamReport() (*EncodedReport, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	rpt := c.pendingReport
+	c.pendingReport = nil
+	return rpt, rpt != nil
+}
+
+func (c *appClient) streamReports(s *streamSession) {
+	for {
+		select {
+		case <-c.reportReady:
+		case <-s.done:
+			return
+		}
+		rpt, ok := c.takeStreamReport()
+		if !ok {
+			continue
+		}
+		if err := c.streamReport(s, rpt); err != nil {
+			if s.ended() {
+				// Try again on the next session
+				c.queueStreamReport(rpt)
+				return
+			}
+			log.Errorf("Error publishing report to %s: %v", c.hostname, err)
+		}
+	}
+}
+
+func (c *appClient) streamReport(s *streamSession, rpt *EncodedReport) error {
+	buf, contentType, delta, err := c.encodeReport(rpt)
+	if err != nil {
+		return err
+	}
+	msg := xfer.StreamMessage{
+		Report:            buf.Bytes(),
+		ReportContentType: contentType,
+	}
+	if c.FullReportInterval > 0 && !rpt.Shortcut {
+		msg.ReportID = rpt.ID
+	}
+	if err := s.Send(msg); err != nil {
+		s.cancel()
+		return err
+	}
+
+	select {
+	case ack := <-s.acks:
+		if delta && ack.Status == http.StatusConflict {
+			// The app doesn't have our base (anymore), so fall back to a full report
+			c.conflicted()
+			return c.streamReport(s, rpt)
+		}
+		if ack.Status != http.StatusOK {
+			return fmt.Errorf("%d: %s", ack.Status, ack.Error)
+		}
+		c.acknowledged(rpt, delta, ack.ID)
+		return nil
+	case <-s.done:
+		return errNotStreaming
+	}
+}
+
+// streamPipeConnection connects a pipe over the stream, as pipeConnection
+// does over a websocket.
+func (c *appClient) streamPipeConnection(id string, pipe xfer.Pipe) (bool, error) {
+	if c.hasQuit() {
+		return true, nil
+	}
+	s, ok := c.streaming()
+	if !ok {
+		return c.pipeConnection(id, pipe)
+	}
+	if s == nil {
+		return false, errNotStreaming
+	}
+
+	streamPipe := s.OpenPipe(id)
+	defer s.ClosePipe(streamPipe)
+	if err := s.Send(xfer.StreamMessage{PipeID: id, PipeOpen: true}); err != nil {
+		return false, err
+	}
+	copied := make(chan struct{})
+	defer close(copied)
+	go func() {
+		select {
+		case <-streamPipe.Done():
+			// Copying can be stuck writing to a pipe which isn't being read,
+			// which is why it may have been closed; closing our end too
+			// unblocks it. Pipes are kept across sessions though.
+			if !s.ended() {
+				pipe.Close()
+			}
+		case <-copied:
+		}
+	}()
+	_, remote := pipe.Ends()
+	if err := pipe.CopyToWebsocket(remote, streamPipe); err != nil && !xfer.IsExpectedWSCloseError(err) {
+		return false, err
+	}
+	if s.ended() {
+		return false, errNotStreaming
+	}
+	// Either we or the app closed the pipe
+	pipe.Close()
+	return true, nil
+}
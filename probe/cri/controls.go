@@ -0,0 +1,181 @@
+package cri
+
+import (
+	"context"
+	"net/url"
+
+	log "github.com/sirupsen/logrus"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"github.com/weaveworks/scope/common/xfer"
+	client "github.com/weaveworks/scope/cri/runtime"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+// sizeQueue passes terminal resizes of an exec session on to the runtime.
+type sizeQueue chan remotecommand.TerminalSize
+
+// Next implements remotecommand.TerminalSizeQueue.
+func (q sizeQueue) Next() *remotecommand.TerminalSize {
+	size, ok := <-q
+	if !ok {
+		return nil
+	}
+	return &size
+}
+
+func (r *Reporter) stopContainer(containerID string, _ xfer.Request) xfer.Response {
+	log.Infof("Stopping container %s", containerID)
+	_, err := r.cri.StopContainer(context.Background(), &client.StopContainerRequest{
+		ContainerId: containerID,
+		Timeout:     docker.StopWaitTime,
+	})
+	return xfer.ResponseError(err)
+}
+
+func (r *Reporter) removeContainer(containerID string, req xfer.Request) xfer.Response {
+	log.Infof("Removing container %s", containerID)
+	if _, err := r.cri.RemoveContainer(context.Background(), &client.RemoveContainerRequest{
+		ContainerId: containerID,
+	}); err != nil {
+		return xfer.ResponseError(err)
+	}
+	return xfer.Response{
+		RemovedNode: req.NodeID,
+	}
+}
+
+func (r *Reporter) attachContainer(containerID string, req xfer.Request) xfer.Response {
+	resp, err := r.cri.Attach(context.Background(), &client.AttachRequest{
+		ContainerId: containerID,
+		Stdin:       true,
+		Stdout:      true,
+		Stderr:      true,
+	})
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	return r.stream(containerID, req, resp.Url, false, nil)
+}
+
+func (r *Reporter) execContainer(containerID string, req xfer.Request) xfer.Response {
+	resp, err := r.cri.Exec(context.Background(), &client.ExecRequest{
+		ContainerId: containerID,
+		Cmd:         docker.ExecShellCmd,
+		Tty:         true,
+		Stdin:       true,
+		Stdout:      true,
+	})
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	return r.stream(containerID, req, resp.Url, true, make(sizeQueue, 1))
+}
+
+// stream connects a new pipe to the runtime's streaming server at rawURL,
+// as returned by the Exec and Attach calls. If sizes is not nil, the
+// terminal of the session can be resized with the ResizeExecTTY control.
+func (r *Reporter) stream(containerID string, req xfer.Request, rawURL string, tty bool, sizes sizeQueue) xfer.Response {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	executor, err := remotecommand.NewSPDYExecutor(&restclient.Config{}, "POST", u)
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+
+	id, pipe, err := controls.NewPipe(r.pipes, req.AppID)
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	local, _ := pipe.Ends()
+	options := remotecommand.StreamOptions{
+		Stdin:  local,
+		Stdout: local,
+		Tty:    tty,
+	}
+	if !tty {
+		options.Stderr = local
+	}
+	response := xfer.Response{
+		Pipe:   id,
+		RawTTY: tty,
+	}
+	if sizes != nil {
+		options.TerminalSizeQueue = sizes
+		response.ResizeTTYControl = ResizeExecTTY
+
+		r.Lock()
+		r.sizeQueues[id] = sizes
+		r.Unlock()
+
+		pipe.OnClose(func() {
+			r.Lock()
+			delete(r.sizeQueues, id)
+			close(sizes)
+			r.Unlock()
+		})
+	}
+	go func() {
+		if err := executor.Stream(options); err != nil {
+			log.Errorf("Error streaming to container %s: %v", containerID, err)
+		}
+		pipe.Close()
+	}()
+	return response
+}
+
+func (r *Reporter) resizeExecTTY(pipeID string, height, width uint) xfer.Response {
+	r.Lock()
+	defer r.Unlock()
+
+	sizes, ok := r.sizeQueues[pipeID]
+	if !ok {
+		return xfer.ResponseErrorf("Unknown pipeID (%q)", pipeID)
+	}
+
+	// Only the latest size matters, so replace any the runtime hasn't
+	// picked up yet rather than blocking.
+	select {
+	case <-sizes:
+	default:
+	}
+	sizes <- remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
+	return xfer.Response{}
+}
+
+func captureContainerID(f func(string, xfer.Request) xfer.Response) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		containerID, ok := report.ParseContainerNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		return f(containerID, req)
+	}
+}
+
+func (r *Reporter) registerControls() {
+	controls := map[string]xfer.ControlHandlerFunc{
+		StopContainer:   captureContainerID(r.stopContainer),
+		RemoveContainer: captureContainerID(r.removeContainer),
+		AttachContainer: captureContainerID(r.attachContainer),
+		ExecContainer:   captureContainerID(r.execContainer),
+		ResizeExecTTY:   xfer.ResizeTTYControlWrapper(r.resizeExecTTY),
+	}
+	r.handlerRegistry.Batch(nil, controls)
+}
+
+func (r *Reporter) deregisterControls() {
+	controls := []string{
+		StopContainer,
+		RemoveContainer,
+		AttachContainer,
+		ExecContainer,
+		ResizeExecTTY,
+	}
+	r.handlerRegistry.Batch(controls, nil)
+}
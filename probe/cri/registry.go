@@ -70,14 +70,21 @@ func parseEndpoint(endpoint string) (string, string, error) {
 
 // NewCRIClient creates client to CRI.
 func NewCRIClient(endpoint string) (client.RuntimeServiceClient, error) {
+	runtime, _, err := NewCRIClients(endpoint)
+	return runtime, err
+}
+
+// NewCRIClients creates runtime and image service clients to CRI, sharing
+// a single connection.
+func NewCRIClients(endpoint string) (client.RuntimeServiceClient, client.ImageServiceClient, error) {
 	addr, dailer, err := getAddressAndDialer(endpoint)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	conn, err := grpc.Dial(addr, grpc.WithInsecure(), grpc.WithDialer(dailer))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return client.NewRuntimeServiceClient(conn), nil
+	return client.NewRuntimeServiceClient(conn), client.NewImageServiceClient(conn), nil
 }
@@ -2,46 +2,159 @@ package cri
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	units "github.com/docker/go-units"
+	humanize "github.com/dustin/go-humanize"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/weaveworks/common/mtime"
 	client "github.com/weaveworks/scope/cri/runtime"
+	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/report"
 )
 
+// Control IDs used by the CRI integration.
+const (
+	StopContainer   = report.CRIStopContainer
+	RemoveContainer = report.CRIRemoveContainer
+	AttachContainer = report.CRIAttachContainer
+	ExecContainer   = report.CRIExecContainer
+	ResizeExecTTY   = "cri_resize_exec_tty"
+)
+
+// Exposed for testing
+var (
+	ContainerControls = []report.Control{
+		{
+			ID:    AttachContainer,
+			Human: "Attach",
+			Icon:  "fa fa-desktop",
+			Rank:  1,
+		},
+		{
+			ID:    ExecContainer,
+			Human: "Exec shell",
+			Icon:  "fa fa-terminal",
+			Rank:  2,
+		},
+		{
+			ID:    StopContainer,
+			Human: "Stop",
+			Icon:  "fa fa-stop",
+			Rank:  7,
+		},
+		{
+			ID:    RemoveContainer,
+			Human: "Remove",
+			Icon:  "far fa-trash-alt",
+			Rank:  8,
+		},
+	}
+)
+
 // Reporter generate Reports containing Container and ContainerImage topologies
 type Reporter struct {
-	cri client.RuntimeServiceClient
+	cri             client.RuntimeServiceClient
+	images          client.ImageServiceClient
+	probeID         string
+	pipes           controls.PipeClient
+	handlerRegistry *controls.HandlerRegistry
+
+	sync.RWMutex
+	cpuUsage   map[string]*client.CpuUsage // container ID -> previous cumulative usage
+	pids       map[int]string              // pid -> container ID
+	statuses   map[string]containerStatus  // container ID -> last fetched status
+	sizeQueues map[string]sizeQueue        // pipe ID -> terminal resizes
+}
+
+// containerStatus is the status of a container, as last fetched from the
+// runtime, and the container state it was fetched in.
+type containerStatus struct {
+	state  client.ContainerState
+	status *client.ContainerStatus
+	pid    int
 }
 
 // NewReporter makes a new Reporter
-func NewReporter(cri client.RuntimeServiceClient) *Reporter {
+func NewReporter(cri client.RuntimeServiceClient, images client.ImageServiceClient, probeID string, pipes controls.PipeClient, handlerRegistry *controls.HandlerRegistry) *Reporter {
 	reporter := &Reporter{
-		cri: cri,
+		cri:             cri,
+		images:          images,
+		probeID:         probeID,
+		pipes:           pipes,
+		handlerRegistry: handlerRegistry,
+		cpuUsage:        map[string]*client.CpuUsage{},
+		pids:            map[int]string{},
+		statuses:        map[string]containerStatus{},
+		sizeQueues:      map[string]sizeQueue{},
 	}
+	reporter.registerControls()
 
 	return reporter
 }
 
 // Name of this reporter, for metrics gathering
-func (Reporter) Name() string { return "CRI" }
+func (*Reporter) Name() string { return "CRI" }
 
-// Report generates a Report containing Container topologies
+// Stop unregisters controls.
+func (r *Reporter) Stop() {
+	r.deregisterControls()
+}
+
+// LockedPIDLookup runs f under a read lock, and gives f a function for
+// use doing pid->container ID lookups.
+func (r *Reporter) LockedPIDLookup(f func(func(int) string)) {
+	r.RLock()
+	defer r.RUnlock()
+
+	f(func(pid int) string {
+		return r.pids[pid]
+	})
+}
+
+// Report generates a Report containing Container and ContainerImage topologies
 func (r *Reporter) Report() (report.Report, error) {
 	result := report.MakeReport()
-	containerTopol, err := r.containerTopology()
+	images, err := r.listImages()
+	if err != nil {
+		return report.MakeReport(), err
+	}
+
+	containerTopol, err := r.containerTopology(images)
 	if err != nil {
 		return report.MakeReport(), err
 	}
 
 	result.Container = result.Container.Merge(containerTopol)
+	result.ContainerImage = result.ContainerImage.Merge(containerImageTopology(images))
 	return result, nil
 }
 
-func (r *Reporter) containerTopology() (report.Topology, error) {
+func (r *Reporter) listImages() ([]*client.Image, error) {
+	if r.images == nil {
+		return nil, nil
+	}
+	resp, err := r.images.ListImages(context.Background(), &client.ListImagesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Images, nil
+}
+
+func (r *Reporter) containerTopology(images []*client.Image) (report.Topology, error) {
 	result := report.MakeTopology().
-		WithMetadataTemplates(docker.ContainerImageMetadataTemplates).
-		WithTableTemplates(docker.ContainerImageTableTemplates)
+		WithMetadataTemplates(docker.ContainerMetadataTemplates).
+		WithMetricTemplates(docker.ContainerMetricTemplates).
+		WithTableTemplates(docker.ContainerTableTemplates)
+	result.Controls.AddControls(ContainerControls)
 
 	ctx := context.Background()
 	resp, err := r.cri.ListContainers(ctx, &client.ListContainersRequest{})
@@ -49,25 +162,225 @@ func (r *Reporter) containerTopology() (report.Topology, error) {
 		return result, err
 	}
 
+	imagesByRef := map[string]*client.Image{}
+	for _, image := range images {
+		imagesByRef[image.Id] = image
+		for _, digest := range image.RepoDigests {
+			imagesByRef[digest] = image
+		}
+	}
+
+	metrics := r.containerMetrics(ctx)
+	pids := map[int]string{}
+	statuses := map[string]containerStatus{}
 	for _, c := range resp.Containers {
-		result.AddNode(getNode(c))
+		node := getNode(c, imagesByRef[c.ImageRef])
+		status, pid := r.cachedContainerStatus(ctx, c)
+		statuses[c.Id] = containerStatus{state: c.State, status: status, pid: pid}
+		if status != nil {
+			node = node.WithLatests(statusLatests(status))
+		}
+		if pid > 0 {
+			pids[pid] = c.Id
+		}
+		node = node.WithLatests(map[string]string{report.ControlProbeID: r.probeID})
+		if m, ok := metrics[c.Id]; ok {
+			node = node.WithMetrics(m)
+		}
+		result.AddNode(node)
 	}
 
+	r.Lock()
+	r.pids = pids
+	r.statuses = statuses
+	r.Unlock()
+
 	return result, nil
 }
 
-func getNode(c *client.Container) report.Node {
-	result := report.MakeNodeWith(report.MakeContainerNodeID(c.Id), map[string]string{
-		docker.ContainerName:         c.Metadata.Name,
-		docker.ContainerID:           c.Id,
-		docker.ContainerState:        fmt.Sprintf("%v", c.State),
-		docker.ContainerRestartCount: fmt.Sprintf("%v", c.Metadata.Attempt),
-		docker.ImageID:               c.ImageRef,
-		docker.ImageName:             c.Image.Image,
-	}).WithParents(report.MakeSets().
-		Add(report.ContainerImage, report.MakeStringSet(report.MakeContainerImageNodeID(c.ImageRef))),
-	)
+// cachedContainerStatus returns the status of a container, only fetching
+// it again from the runtime when the container has changed state. The
+// fields reported from it don't change otherwise.
+func (r *Reporter) cachedContainerStatus(ctx context.Context, c *client.Container) (*client.ContainerStatus, int) {
+	r.RLock()
+	cached, ok := r.statuses[c.Id]
+	r.RUnlock()
+	if ok && cached.status != nil && cached.state == c.State {
+		return cached.status, cached.pid
+	}
+	return r.containerStatus(ctx, c.Id)
+}
+
+// containerStatus fetches the verbose status of a container, extracting
+// the PID of its init process from the runtime-specific info, if present.
+func (r *Reporter) containerStatus(ctx context.Context, containerID string) (*client.ContainerStatus, int) {
+	resp, err := r.cri.ContainerStatus(ctx, &client.ContainerStatusRequest{ContainerId: containerID, Verbose: true})
+	if err != nil {
+		log.Warnf("CRI: error getting status of container %s: %v", containerID, err)
+		return nil, 0
+	}
+	var info struct {
+		Pid int `json:"pid"`
+	}
+	if raw, ok := resp.Info["info"]; ok {
+		if err := json.Unmarshal([]byte(raw), &info); err != nil {
+			log.Debugf("CRI: error parsing info of container %s: %v", containerID, err)
+		}
+	}
+	return resp.Status, info.Pid
+}
+
+// containerMetrics gathers CPU and memory usage for all containers. CPU
+// usage is reported cumulatively by the runtime, so the percentage is
+// derived from the difference with the previous sample.
+func (r *Reporter) containerMetrics(ctx context.Context) map[string]report.Metrics {
+	resp, err := r.cri.ListContainerStats(ctx, &client.ListContainerStatsRequest{})
+	if err != nil {
+		log.Warnf("CRI: error getting container stats: %v", err)
+		return nil
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	result := map[string]report.Metrics{}
+	cpuUsage := map[string]*client.CpuUsage{}
+	for _, s := range resp.Stats {
+		if s.Attributes == nil {
+			continue
+		}
+		id := s.Attributes.Id
+		metrics := report.Metrics{}
+		if s.Memory != nil && s.Memory.WorkingSetBytes != nil {
+			metrics[docker.MemoryUsage] = report.MakeSingletonMetric(time.Unix(0, s.Memory.Timestamp), float64(s.Memory.WorkingSetBytes.Value))
+		}
+		if s.Cpu != nil && s.Cpu.UsageCoreNanoSeconds != nil {
+			if previous, ok := r.cpuUsage[id]; ok {
+				if percent, ok := cpuPercent(previous, s.Cpu); ok {
+					metrics[docker.CPUTotalUsage] = report.MakeSingletonMetric(time.Unix(0, s.Cpu.Timestamp), percent).WithMax(100.0)
+				}
+			}
+			cpuUsage[id] = s.Cpu
+		}
+		result[id] = metrics
+	}
+	r.cpuUsage = cpuUsage
+	return result
+}
+
+// cpuPercent returns the CPU usage between two samples as a percentage of
+// the total capacity of the host, matching the docker integration.
+func cpuPercent(previous, current *client.CpuUsage) (float64, bool) {
+	timeDelta := float64(current.Timestamp - previous.Timestamp)
+	if timeDelta <= 0 || current.UsageCoreNanoSeconds.Value < previous.UsageCoreNanoSeconds.Value {
+		return 0, false
+	}
+	usageDelta := float64(current.UsageCoreNanoSeconds.Value - previous.UsageCoreNanoSeconds.Value)
+	return usageDelta / timeDelta / float64(runtime.NumCPU()) * 100.0, true
+}
+
+func containerImageTopology(images []*client.Image) report.Topology {
+	result := report.MakeTopology().
+		WithMetadataTemplates(docker.ContainerImageMetadataTemplates).
+		WithTableTemplates(docker.ContainerImageTableTemplates)
+
+	for _, image := range images {
+		imageID := trimImageID(image.Id)
+		latests := map[string]string{
+			docker.ImageID:   imageID,
+			docker.ImageSize: humanize.Bytes(image.Size_),
+		}
+		if len(image.RepoTags) > 0 {
+			imageFullName := image.RepoTags[0]
+			latests[docker.ImageName] = docker.ImageNameWithoutTag(imageFullName)
+			latests[docker.ImageTag] = docker.ImageNameTag(imageFullName)
+		}
+		result.AddNode(report.MakeNodeWith(report.MakeContainerImageNodeID(imageID), latests))
+	}
+
+	return result
+}
+
+func getNode(c *client.Container, image *client.Image) report.Node {
+	imageID := trimImageID(c.ImageRef)
+	if image != nil {
+		imageID = trimImageID(image.Id)
+	}
+	latests := map[string]string{
+		docker.ContainerName:    c.Metadata.Name,
+		docker.ContainerID:      c.Id,
+		docker.ContainerState:   stateString(c.State),
+		docker.ContainerCreated: time.Unix(0, c.CreatedAt).Format(time.RFC3339Nano),
+		docker.ImageID:          imageID,
+	}
+	imageName := c.Image.GetImage()
+	if image != nil && len(image.RepoTags) > 0 {
+		imageName = image.RepoTags[0]
+	}
+	if imageName != "" && !strings.HasPrefix(imageName, "sha256:") {
+		latests[docker.ImageName] = docker.ImageNameWithoutTag(imageName)
+		latests[docker.ImageTag] = docker.ImageNameTag(imageName)
+	}
+
+	result := report.MakeNodeWith(report.MakeContainerNodeID(c.Id), latests).
+		WithParent(report.ContainerImage, report.MakeContainerImageNodeID(imageID)).
+		WithLatestControls(controlsMap(c.State))
 	result = result.AddPrefixPropertyList(docker.LabelPrefix, c.Labels)
 
 	return result
 }
+
+func statusLatests(status *client.ContainerStatus) map[string]string {
+	latests := map[string]string{
+		docker.ContainerStateHuman:   stateHuman(status),
+		docker.ContainerRestartCount: strconv.Itoa(int(status.GetMetadata().GetAttempt())),
+	}
+	if status.State == client.ContainerState_CONTAINER_RUNNING && status.StartedAt > 0 {
+		uptime := mtime.Now().Sub(time.Unix(0, status.StartedAt))
+		latests[docker.ContainerUptime] = strconv.Itoa(int(uptime / time.Second))
+	}
+	return latests
+}
+
+func stateString(state client.ContainerState) string {
+	switch state {
+	case client.ContainerState_CONTAINER_CREATED:
+		return docker.StateCreated
+	case client.ContainerState_CONTAINER_RUNNING:
+		return docker.StateRunning
+	case client.ContainerState_CONTAINER_EXITED:
+		return docker.StateExited
+	default:
+		return "unknown"
+	}
+}
+
+// stateHuman renders the state of a container the same way docker does.
+func stateHuman(status *client.ContainerStatus) string {
+	now := mtime.Now()
+	switch status.State {
+	case client.ContainerState_CONTAINER_CREATED:
+		return "Created"
+	case client.ContainerState_CONTAINER_RUNNING:
+		return fmt.Sprintf("Up %s", units.HumanDuration(now.Sub(time.Unix(0, status.StartedAt))))
+	case client.ContainerState_CONTAINER_EXITED:
+		return fmt.Sprintf("Exited (%d) %s ago", status.ExitCode, units.HumanDuration(now.Sub(time.Unix(0, status.FinishedAt))))
+	default:
+		return "Unknown"
+	}
+}
+
+func controlsMap(state client.ContainerState) map[string]report.NodeControlData {
+	running := state == client.ContainerState_CONTAINER_RUNNING
+	return map[string]report.NodeControlData{
+		AttachContainer: {Dead: !running},
+		ExecContainer:   {Dead: !running},
+		StopContainer:   {Dead: !running},
+		RemoveContainer: {Dead: running},
+	}
+}
+
+// CRI runtimes prefix image ids with the digest algorithm, as docker does;
+// strip it off so both integrations agree on image node IDs.
+func trimImageID(id string) string {
+	return strings.TrimPrefix(id, "sha256:")
+}
@@ -0,0 +1,362 @@
+package cri_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+	client "github.com/weaveworks/scope/cri/runtime"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/cri"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/report"
+)
+
+// fakeRuntime implements the parts of the CRI runtime and image services
+// used by the reporter. Calls to anything else panic via the nil embedded
+// interfaces.
+type fakeRuntime struct {
+	client.RuntimeServiceServer
+	client.ImageServiceServer
+
+	sync.Mutex
+	stats    []*client.ContainerStats
+	stopped  []string
+	removed  []string
+	statuses map[string]int // container ID -> number of status requests
+}
+
+var (
+	now = time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	runningContainer = &client.Container{
+		Id:        "abc123",
+		Metadata:  &client.ContainerMetadata{Name: "nginx", Attempt: 2},
+		Image:     &client.ImageSpec{Image: "nginx:1.17"},
+		ImageRef:  "docker.io/library/nginx@sha256:digest",
+		State:     client.ContainerState_CONTAINER_RUNNING,
+		CreatedAt: now.Add(-time.Hour).UnixNano(),
+		Labels:    map[string]string{"app": "web"},
+	}
+	exitedContainer = &client.Container{
+		Id:        "def456",
+		Metadata:  &client.ContainerMetadata{Name: "job"},
+		Image:     &client.ImageSpec{Image: "sha256:unknown"},
+		ImageRef:  "sha256:unknown",
+		State:     client.ContainerState_CONTAINER_EXITED,
+		CreatedAt: now.Add(-time.Hour).UnixNano(),
+	}
+	nginxImage = &client.Image{
+		Id:          "sha256:nginximage",
+		RepoTags:    []string{"nginx:1.17"},
+		RepoDigests: []string{"docker.io/library/nginx@sha256:digest"},
+		Size_:       1000000,
+	}
+)
+
+func (f *fakeRuntime) ListContainers(context.Context, *client.ListContainersRequest) (*client.ListContainersResponse, error) {
+	return &client.ListContainersResponse{Containers: []*client.Container{runningContainer, exitedContainer}}, nil
+}
+
+func (f *fakeRuntime) ContainerStatus(_ context.Context, req *client.ContainerStatusRequest) (*client.ContainerStatusResponse, error) {
+	f.Lock()
+	f.statuses[req.ContainerId]++
+	f.Unlock()
+	if req.ContainerId == runningContainer.Id {
+		return &client.ContainerStatusResponse{
+			Status: &client.ContainerStatus{
+				Id:        runningContainer.Id,
+				Metadata:  runningContainer.Metadata,
+				State:     runningContainer.State,
+				StartedAt: now.Add(-time.Minute).UnixNano(),
+			},
+			Info: map[string]string{"info": `{"pid": 1234, "sandboxID": "xyz"}`},
+		}, nil
+	}
+	return &client.ContainerStatusResponse{
+		Status: &client.ContainerStatus{
+			Id:         exitedContainer.Id,
+			Metadata:   exitedContainer.Metadata,
+			State:      exitedContainer.State,
+			StartedAt:  now.Add(-time.Hour).UnixNano(),
+			FinishedAt: now.Add(-time.Minute).UnixNano(),
+			ExitCode:   1,
+		},
+	}, nil
+}
+
+func (f *fakeRuntime) ListContainerStats(context.Context, *client.ListContainerStatsRequest) (*client.ListContainerStatsResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	return &client.ListContainerStatsResponse{Stats: f.stats}, nil
+}
+
+func (f *fakeRuntime) StopContainer(_ context.Context, req *client.StopContainerRequest) (*client.StopContainerResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.stopped = append(f.stopped, req.ContainerId)
+	return &client.StopContainerResponse{}, nil
+}
+
+func (f *fakeRuntime) RemoveContainer(_ context.Context, req *client.RemoveContainerRequest) (*client.RemoveContainerResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.removed = append(f.removed, req.ContainerId)
+	return &client.RemoveContainerResponse{}, nil
+}
+
+func (f *fakeRuntime) ListImages(context.Context, *client.ListImagesRequest) (*client.ListImagesResponse, error) {
+	return &client.ListImagesResponse{Images: []*client.Image{nginxImage}}, nil
+}
+
+func (f *fakeRuntime) setStats(timestamp time.Time, cpuNanos, memory uint64) {
+	f.Lock()
+	defer f.Unlock()
+	f.stats = []*client.ContainerStats{{
+		Attributes: &client.ContainerAttributes{Id: runningContainer.Id},
+		Cpu: &client.CpuUsage{
+			Timestamp:            timestamp.UnixNano(),
+			UsageCoreNanoSeconds: &client.UInt64Value{Value: cpuNanos},
+		},
+		Memory: &client.MemoryUsage{
+			Timestamp:       timestamp.UnixNano(),
+			WorkingSetBytes: &client.UInt64Value{Value: memory},
+		},
+	}}
+}
+
+// startFakeRuntime serves a fakeRuntime on a unix socket, and returns a
+// reporter connected to it.
+func startFakeRuntime(t *testing.T, hr *controls.HandlerRegistry) (*fakeRuntime, *cri.Reporter, func()) {
+	dir, err := ioutil.TempDir("", "scope-cri")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "cri.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeRuntime{statuses: map[string]int{}}
+	server := grpc.NewServer()
+	client.RegisterRuntimeServiceServer(server, fake)
+	client.RegisterImageServiceServer(server, fake)
+	go server.Serve(listener)
+
+	runtimeClient, imageClient, err := cri.NewCRIClients("unix://" + socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporter := cri.NewReporter(runtimeClient, imageClient, "probe1", nil, hr)
+	return fake, reporter, func() {
+		reporter.Stop()
+		server.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestReporter(t *testing.T) {
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	fake, reporter, cleanup := startFakeRuntime(t, controls.NewDefaultHandlerRegistry())
+	defer cleanup()
+
+	fake.setStats(now.Add(-time.Second), 1e9, 4096)
+	_, err := reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.setStats(now, 1.5e9, 8192)
+	rpt, err := reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	running, ok := rpt.Container.Nodes[report.MakeContainerNodeID(runningContainer.Id)]
+	if !ok {
+		t.Fatal("not found")
+	}
+	for key, want := range map[string]string{
+		docker.ContainerName:         "nginx",
+		docker.ContainerState:        docker.StateRunning,
+		docker.ContainerStateHuman:   "Up About a minute",
+		docker.ContainerUptime:       "60",
+		docker.ContainerRestartCount: "2",
+		docker.ImageID:               "nginximage",
+		docker.ImageName:             "nginx",
+		docker.ImageTag:              "1.17",
+		docker.LabelPrefix + "app":   "web",
+		report.ControlProbeID:        "probe1",
+	} {
+		have, _ := running.Latest.Lookup(key)
+		assert.Equal(t, want, have, key)
+	}
+	parents, _ := running.Parents.Lookup(report.ContainerImage)
+	assert.Equal(t, report.MakeStringSet(report.MakeContainerImageNodeID("nginximage")), parents)
+
+	memory, ok := running.Metrics[docker.MemoryUsage]
+	if !ok {
+		t.Fatal("not found")
+	}
+	assert.Equal(t, 8192.0, lastValue(memory))
+	cpu, ok := running.Metrics[docker.CPUTotalUsage]
+	if !ok {
+		t.Fatal("not found")
+	}
+	assert.InDelta(t, 50.0/float64(runtime.NumCPU()), lastValue(cpu), 0.0001)
+
+	controls := map[string]bool{}
+	running.LatestControls.ForEach(func(id string, _ time.Time, data report.NodeControlData) {
+		controls[id] = data.Dead
+	})
+	assert.Equal(t, map[string]bool{
+		cri.AttachContainer: false,
+		cri.ExecContainer:   false,
+		cri.StopContainer:   false,
+		cri.RemoveContainer: true,
+	}, controls)
+
+	exited, ok := rpt.Container.Nodes[report.MakeContainerNodeID(exitedContainer.Id)]
+	if !ok {
+		t.Fatal("not found")
+	}
+	state, _ := exited.Latest.Lookup(docker.ContainerStateHuman)
+	assert.Equal(t, "Exited (1) About a minute ago", state)
+	_, ok = exited.Metrics[docker.CPUTotalUsage]
+	assert.False(t, ok)
+
+	image, ok := rpt.ContainerImage.Nodes[report.MakeContainerImageNodeID("nginximage")]
+	if !ok {
+		t.Fatal("not found")
+	}
+	for key, want := range map[string]string{
+		docker.ImageName: "nginx",
+		docker.ImageTag:  "1.17",
+		docker.ImageSize: "1.0 MB",
+	} {
+		have, _ := image.Latest.Lookup(key)
+		assert.Equal(t, want, have, key)
+	}
+}
+
+func TestReporterCachesStatus(t *testing.T) {
+	fake, reporter, cleanup := startFakeRuntime(t, controls.NewDefaultHandlerRegistry())
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		if _, err := reporter.Report(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fake.Lock()
+	defer fake.Unlock()
+	assert.Equal(t, map[string]int{runningContainer.Id: 1, exitedContainer.Id: 1}, fake.statuses)
+}
+
+func lastValue(m report.Metric) float64 {
+	sample, _ := m.LastSample()
+	return sample.Value
+}
+
+type mockWalker []process.Process
+
+func (m mockWalker) Walk(f func(process.Process, process.Process)) error {
+	for _, p := range m {
+		f(p, process.Process{})
+	}
+	return nil
+}
+
+func TestTagger(t *testing.T) {
+	_, reporter, cleanup := startFakeRuntime(t, controls.NewDefaultHandlerRegistry())
+	defer cleanup()
+
+	rpt, err := reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		initNodeID  = report.MakeProcessNodeID("somehost.com", "1234")
+		childNodeID = report.MakeProcessNodeID("somehost.com", "1240")
+		otherNodeID = report.MakeProcessNodeID("somehost.com", "99")
+	)
+	rpt.Process.AddNode(report.MakeNodeWith(initNodeID, map[string]string{process.PID: "1234"}))
+	rpt.Process.AddNode(report.MakeNodeWith(childNodeID, map[string]string{process.PID: "1240"}))
+	rpt.Process.AddNode(report.MakeNodeWith(otherNodeID, map[string]string{process.PID: "99"}))
+
+	walker := mockWalker{
+		{PID: 1, PPID: 0},
+		{PID: 99, PPID: 1},
+		{PID: 1234, PPID: 1},
+		{PID: 1240, PPID: 1234},
+	}
+	have, err := cri.NewTagger(reporter, walker).Tag(rpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, nodeID := range []string{initNodeID, childNodeID} {
+		node := have.Process.Nodes[nodeID]
+		containerID, _ := node.Latest.Lookup(docker.ContainerID)
+		assert.Equal(t, runningContainer.Id, containerID, nodeID)
+		containers, _ := node.Parents.Lookup(report.Container)
+		assert.Equal(t, report.MakeStringSet(report.MakeContainerNodeID(runningContainer.Id)), containers, nodeID)
+		images, _ := node.Parents.Lookup(report.ContainerImage)
+		assert.Equal(t, report.MakeStringSet(report.MakeContainerImageNodeID("nginx")), images, nodeID)
+	}
+
+	_, ok := have.Process.Nodes[otherNodeID].Latest.Lookup(docker.ContainerID)
+	assert.False(t, ok)
+}
+
+func TestControls(t *testing.T) {
+	hr := controls.NewDefaultHandlerRegistry()
+	fake, _, cleanup := startFakeRuntime(t, hr)
+	defer cleanup()
+
+	result := hr.HandleControlRequest(xfer.Request{
+		Control: cri.StopContainer,
+		NodeID:  report.MakeContainerNodeID(runningContainer.Id),
+	})
+	assert.Equal(t, xfer.Response{}, result)
+
+	nodeID := report.MakeContainerNodeID(exitedContainer.Id)
+	result = hr.HandleControlRequest(xfer.Request{
+		Control: cri.RemoveContainer,
+		NodeID:  nodeID,
+	})
+	assert.Equal(t, xfer.Response{RemovedNode: nodeID}, result)
+
+	result = hr.HandleControlRequest(xfer.Request{
+		Control: cri.StopContainer,
+		NodeID:  "not-a-container",
+	})
+	assert.Equal(t, "Invalid ID: not-a-container", result.Error)
+
+	result = hr.HandleControlRequest(xfer.Request{
+		Control:     cri.ResizeExecTTY,
+		ControlArgs: map[string]string{"pipeID": "pipe", "height": "24", "width": "80"},
+	})
+	assert.Equal(t, `Unknown pipeID ("pipe")`, result.Error)
+
+	fake.Lock()
+	defer fake.Unlock()
+	assert.Equal(t, []string{runningContainer.Id}, fake.stopped)
+	assert.Equal(t, []string{exitedContainer.Id}, fake.removed)
+}
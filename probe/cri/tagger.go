@@ -0,0 +1,57 @@
+package cri
+
+import (
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/report"
+)
+
+// PIDLookup finds the ID of the container whose init process has a pid.
+type PIDLookup interface {
+	LockedPIDLookup(f func(func(int) string))
+}
+
+// Tagger is a tagger that tags CRI container information to process
+// nodes that have a PID.
+type Tagger struct {
+	pids       PIDLookup
+	procWalker process.Walker
+}
+
+// NewTagger returns a usable Tagger.
+func NewTagger(pids PIDLookup, procWalker process.Walker) *Tagger {
+	return &Tagger{
+		pids:       pids,
+		procWalker: procWalker,
+	}
+}
+
+// Name of this tagger, for metrics gathering
+func (Tagger) Name() string { return "CRI" }
+
+// Tag implements Tagger.
+func (t *Tagger) Tag(r report.Report) (report.Report, error) {
+	tree, err := process.NewTree(t.procWalker)
+	if err != nil {
+		return report.MakeReport(), err
+	}
+	t.tag(tree, r.Container, &r.Process)
+	return r, nil
+}
+
+func (t *Tagger) tag(tree process.Tree, containers report.Topology, topology *report.Topology) {
+	docker.TagProcesses(tree, topology, func(f func(func(int) (string, string, bool))) {
+		t.pids.LockedPIDLookup(func(lookup func(int) string) {
+			f(func(pid int) (string, string, bool) {
+				containerID := lookup(pid)
+				return containerID, containerID, containerID != ""
+			})
+		})
+	}, func(containerID string) (string, bool) {
+		container, ok := containers.Nodes[report.MakeContainerNodeID(containerID)]
+		if !ok {
+			return "", false
+		}
+		return container.Latest.Lookup(docker.ImageName)
+	})
+}
@@ -3,6 +3,7 @@ package docker
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"strconv"
 	"strings"
@@ -31,6 +32,14 @@ const (
 	ContainerUptime        = report.DockerContainerUptime
 	ContainerRestartCount  = report.DockerContainerRestartCount
 	ContainerNetworkMode   = report.DockerContainerNetworkMode
+	ContainerExitCode      = report.DockerContainerExitCode
+	ContainerOOMKilled     = report.DockerContainerOOMKilled
+	ContainerHealth        = report.DockerContainerHealth
+
+	ContainerEventsPrefix = "docker_container_events_"
+	ContainerEventTime    = "docker_container_event_time"
+	ContainerEventType    = "docker_container_event_type"
+	ContainerEventDetail  = "docker_container_event_detail"
 
 	NetworkRxDropped = "network_rx_dropped"
 	NetworkRxBytes   = "network_rx_bytes"
@@ -52,6 +61,19 @@ const (
 	CPUUsageInKernelmode = "docker_cpu_usage_in_kernelmode"
 	CPUSystemCPUUsage    = "docker_cpu_system_cpu_usage"
 
+	BlkioReadBytes  = "docker_blkio_read_bytes_per_second"
+	BlkioWriteBytes = "docker_blkio_write_bytes_per_second"
+	BlkioReadOps    = "docker_blkio_read_ops_per_second"
+	BlkioWriteOps   = "docker_blkio_write_ops_per_second"
+
+	// Prefixes of the per-network metrics, followed by the name of the
+	// Docker network, or of the interface inside the container, e.g. eth0,
+	// when it can't be matched to one.
+	NetworkRxBytesPrefix = "docker_network_rx_bytes_per_second_"
+	NetworkTxBytesPrefix = "docker_network_tx_bytes_per_second_"
+
+	PidsCurrent = "docker_pids_current"
+
 	LabelPrefix = "docker_label_"
 	EnvPrefix   = report.DockerEnvPrefix
 )
@@ -68,9 +90,20 @@ var (
 	StateDeleted    = "deleted"
 )
 
+// maxContainerEvents is how many recent lifecycle events we keep per container.
+const maxContainerEvents = 10
+
+// ContainerEvent is a lifecycle event of a container, as reported by Docker
+type ContainerEvent struct {
+	Time   time.Time
+	Type   string // e.g. DieEvent, OOMEvent
+	Detail string // e.g. the exit code or health status
+}
+
 // StatsGatherer gathers container stats
 type StatsGatherer interface {
 	Stats(docker.StatsOptions) error
+	PidsLimit(id string) (uint64, error)
 }
 
 // Container represents a Docker container
@@ -90,6 +123,7 @@ type Container interface {
 	StopGatheringStats()
 	NetworkMode() (string, bool)
 	NetworkInfo([]net.IP) report.Sets
+	RecordEvent(ContainerEvent)
 }
 
 type container struct {
@@ -101,8 +135,20 @@ type container struct {
 	numPending             int
 	hostID                 string
 	baseNode               report.Node
+	events                 []ContainerEvent
 	noCommandLineArguments bool
 	noEnvironmentVariables bool
+	// networks are the Docker networks of the interfaces seen in stats.
+	networks map[string]string
+	// pidsLimit is the enforced limit on PIDs, or 0 if unknown or none.
+	pidsLimit uint64
+}
+
+// InterfaceMACStub returns the MAC address of a network interface of a
+// process, from the sysfs of its network namespace. Exposed for testing.
+var InterfaceMACStub = func(pid int, name string) (string, error) {
+	buf, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/root/sys/class/net/%s/address", pid, name))
+	return strings.TrimSpace(string(buf)), err
 }
 
 // NewContainer creates a new Container
@@ -112,6 +158,7 @@ func NewContainer(c *docker.Container, hostID string, noCommandLineArguments boo
 		hostID:                 hostID,
 		noCommandLineArguments: noCommandLineArguments,
 		noEnvironmentVariables: noEnvironmentVariables,
+		networks:               map[string]string{},
 	}
 	result.baseNode = result.getBaseNode()
 	return result
@@ -186,9 +233,26 @@ func (c *container) StartGatheringStats(client StatsGatherer) error {
 		}
 	}()
 
+	// The limit is only changed by updating the container, which restarts
+	// gathering its stats.
+	go func() {
+		limit, err := client.PidsLimit(opts.ID)
+		if err != nil {
+			log.Debugf("docker container: error getting the PIDs limit of %s: %v", opts.ID, err)
+			return
+		}
+		c.Lock()
+		c.pidsLimit = limit
+		c.Unlock()
+	}()
+
 	go func() {
 		for s := range stats {
+			networks := c.interfaceNetworks(s.Networks)
 			c.Lock()
+			for name, network := range networks {
+				c.networks[name] = network
+			}
 			if c.numPending >= len(c.pendingStats) {
 				log.Warnf("docker container: dropping stats for %s", c.container.ID)
 			} else {
@@ -209,6 +273,50 @@ func (c *container) StartGatheringStats(client StatsGatherer) error {
 	return nil
 }
 
+// interfaceNetworks finds the Docker networks of the interfaces in stats
+// which haven't been seen before, by their MAC addresses. Interfaces which
+// can't be matched are named after themselves.
+func (c *container) interfaceNetworks(stats map[string]docker.NetworkStats) map[string]string {
+	c.RLock()
+	var (
+		unknown  []string
+		pid      = c.container.State.Pid
+		networks = map[string]string{}
+	)
+	for name := range stats {
+		if _, ok := c.networks[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if c.container.NetworkSettings != nil {
+		for network, settings := range c.container.NetworkSettings.Networks {
+			networks[strings.ToLower(settings.MacAddress)] = network
+		}
+	}
+	c.RUnlock()
+
+	result := map[string]string{}
+	for _, name := range unknown {
+		result[name] = name
+		if len(stats) == 1 && len(networks) == 1 {
+			// No need to look at the only interface
+			for _, network := range networks {
+				result[name] = network
+			}
+			continue
+		}
+		mac, err := InterfaceMACStub(pid, name)
+		if err != nil {
+			log.Debugf("docker container: can't find the network of %s in %s: %v", name, c.container.ID, err)
+			continue
+		}
+		if network, ok := networks[strings.ToLower(mac)]; ok {
+			result[name] = network
+		}
+	}
+	return result
+}
+
 func (c *container) StopGatheringStats() {
 	c.Lock()
 	defer c.Unlock()
@@ -230,13 +338,15 @@ func (c *container) ports(localAddrs []net.IP) report.StringSet {
 			continue
 		}
 		for _, b := range bindings {
-			if b.HostIP != "0.0.0.0" {
+			if b.HostIP != "0.0.0.0" && b.HostIP != "::" {
 				ports = append(ports, fmt.Sprintf("%s:%s->%s", b.HostIP, b.HostPort, port))
 				continue
 			}
 
+			// Bound to all addresses of the binding's family
+			ipv4 := b.HostIP == "0.0.0.0"
 			for _, ip := range localAddrs {
-				if ip.To4() != nil {
+				if (ip.To4() != nil) == ipv4 {
 					ports = append(ports, fmt.Sprintf("%s:%s->%s", ip, b.HostPort, port))
 				}
 			}
@@ -263,19 +373,25 @@ func addScopeToIPs(hostID string, ips []string) []string {
 	return ipsWithScopes
 }
 
-func isIPv4(addr string) bool {
+// isReportedIP returns whether addr is an address to report; IPv6
+// link-local addresses are left out as they are not unique across links.
+func isReportedIP(addr string) bool {
 	ip := net.ParseIP(addr)
-	return ip != nil && ip.To4() != nil
+	return ip != nil && !ip.IsLinkLocalUnicast()
 }
 
 func (c *container) NetworkInfo(localAddrs []net.IP) report.Sets {
 	c.RLock()
 	defer c.RUnlock()
 
-	ips := c.container.NetworkSettings.SecondaryIPAddresses
+	ips := append([]string{}, c.container.NetworkSettings.SecondaryIPAddresses...)
+	ips = append(ips, c.container.NetworkSettings.SecondaryIPv6Addresses...)
 	if c.container.NetworkSettings.IPAddress != "" {
 		ips = append(ips, c.container.NetworkSettings.IPAddress)
 	}
+	if c.container.NetworkSettings.GlobalIPv6Address != "" {
+		ips = append(ips, c.container.NetworkSettings.GlobalIPv6Address)
+	}
 
 	if c.container.State.Running && c.container.State.Pid != 0 {
 		// Fetch IP addresses from the container's namespace
@@ -303,17 +419,19 @@ func (c *container) NetworkInfo(localAddrs []net.IP) report.Sets {
 		if settings.IPAddress != "" {
 			ips = append(ips, settings.IPAddress)
 		}
+		if settings.GlobalIPv6Address != "" {
+			ips = append(ips, settings.GlobalIPv6Address)
+		}
 	}
 
-	// Filter out IPv6 addresses; nothing works with IPv6 yet
-	ipv4s := []string{}
+	reportedIPs := []string{}
 	for _, ip := range ips {
-		if isIPv4(ip) {
-			ipv4s = append(ipv4s, ip)
+		if isReportedIP(ip) {
+			reportedIPs = append(reportedIPs, ip)
 		}
 	}
 	// Treat all Docker IPs as local scoped.
-	ipsWithScopes := addScopeToIPs(c.hostID, ipv4s)
+	ipsWithScopes := addScopeToIPs(c.hostID, reportedIPs)
 
 	s := report.MakeSets()
 	if len(networks) > 0 {
@@ -322,8 +440,8 @@ func (c *container) NetworkInfo(localAddrs []net.IP) report.Sets {
 	if len(c.container.NetworkSettings.Ports) > 0 {
 		s = s.Add(ContainerPorts, c.ports(localAddrs))
 	}
-	if len(ipv4s) > 0 {
-		s = s.Add(ContainerIPs, report.MakeStringSet(ipv4s...))
+	if len(reportedIPs) > 0 {
+		s = s.Add(ContainerIPs, report.MakeStringSet(reportedIPs...))
 	}
 	if len(ipsWithScopes) > 0 {
 		s = s.Add(ContainerIPsWithScopes, report.MakeStringSet(ipsWithScopes...))
@@ -369,6 +487,104 @@ func (c *container) cpuPercentMetric(stats []docker.Stats) report.Metric {
 	return report.MakeMetric(samples).WithMax(100.0)
 }
 
+// counterRateMetric turns a counter in the stats into a per-second rate.
+// Samples where the counter is missing or went backwards are skipped.
+func counterRateMetric(stats []docker.Stats, counter func(docker.Stats) (uint64, bool)) report.Metric {
+	if len(stats) < 2 {
+		return report.MakeMetric(nil)
+	}
+
+	samples := make([]report.Sample, 0, len(stats)-1)
+	previous := stats[0]
+	for _, s := range stats[1:] {
+		value, ok1 := counter(s)
+		previousValue, ok2 := counter(previous)
+		seconds := s.Read.Sub(previous.Read).Seconds()
+		previous = s
+		if !ok1 || !ok2 || value < previousValue || seconds <= 0 {
+			continue
+		}
+		samples = append(samples, report.Sample{
+			Timestamp: s.Read,
+			Value:     float64(value-previousValue) / seconds,
+		})
+	}
+	return report.MakeMetric(samples)
+}
+
+// blkioTotal sums the entries for an operation over all block devices.
+// cgroups v1 names operations "Read" and "Write", v2 "read" and "write".
+func blkioTotal(entries []docker.BlkioStatsEntry, op string) (uint64, bool) {
+	var total uint64
+	for _, e := range entries {
+		if strings.EqualFold(e.Op, op) {
+			total += e.Value
+		}
+	}
+	return total, len(entries) > 0
+}
+
+func (c *container) blkioMetrics(stats []docker.Stats, result report.Metrics) {
+	if len(stats[len(stats)-1].BlkioStats.IOServiceBytesRecursive) == 0 {
+		return
+	}
+	for key, counter := range map[string]func(docker.Stats) (uint64, bool){
+		BlkioReadBytes: func(s docker.Stats) (uint64, bool) {
+			return blkioTotal(s.BlkioStats.IOServiceBytesRecursive, "read")
+		},
+		BlkioWriteBytes: func(s docker.Stats) (uint64, bool) {
+			return blkioTotal(s.BlkioStats.IOServiceBytesRecursive, "write")
+		},
+		BlkioReadOps: func(s docker.Stats) (uint64, bool) {
+			return blkioTotal(s.BlkioStats.IOServicedRecursive, "read")
+		},
+		BlkioWriteOps: func(s docker.Stats) (uint64, bool) {
+			return blkioTotal(s.BlkioStats.IOServicedRecursive, "write")
+		},
+	} {
+		result[key] = counterRateMetric(stats, counter)
+	}
+}
+
+func (c *container) networkMetrics(stats []docker.Stats, result report.Metrics) {
+	for name := range stats[len(stats)-1].Networks {
+		name := name
+		network, ok := c.networks[name]
+		if !ok {
+			network = name
+		}
+		result[NetworkRxBytesPrefix+network] = counterRateMetric(stats, func(s docker.Stats) (uint64, bool) {
+			n, ok := s.Networks[name]
+			return n.RxBytes, ok
+		})
+		result[NetworkTxBytesPrefix+network] = counterRateMetric(stats, func(s docker.Stats) (uint64, bool) {
+			n, ok := s.Networks[name]
+			return n.TxBytes, ok
+		})
+	}
+}
+
+func (c *container) pidsMetric(stats []docker.Stats, result report.Metrics) {
+	if stats[len(stats)-1].PidsStats.Current == 0 {
+		return
+	}
+	samples := make([]report.Sample, len(stats))
+	for i, s := range stats {
+		samples[i].Timestamp = s.Read
+		samples[i].Value = float64(s.PidsStats.Current)
+	}
+	metric := report.MakeMetric(samples)
+	// The limit the kernel enforces is in the stats of newer Docker
+	// versions. Older ones only have the configured one, where 0 or -1
+	// means unlimited.
+	if c.pidsLimit > 0 {
+		metric = metric.WithMax(float64(c.pidsLimit))
+	} else if c.container.HostConfig != nil && c.container.HostConfig.PidsLimit > 0 {
+		metric = metric.WithMax(float64(c.container.HostConfig.PidsLimit))
+	}
+	result[PidsCurrent] = metric
+}
+
 func (c *container) metrics() report.Metrics {
 	if c.numPending == 0 {
 		return report.Metrics{}
@@ -378,6 +594,9 @@ func (c *container) metrics() report.Metrics {
 		MemoryUsage:   c.memoryUsageMetric(pendingStats),
 		CPUTotalUsage: c.cpuPercentMetric(pendingStats),
 	}
+	c.blkioMetrics(pendingStats, result)
+	c.networkMetrics(pendingStats, result)
+	c.pidsMetric(pendingStats, result)
 
 	// leave one stat to help with relative metrics
 	c.pendingStats[0] = c.pendingStats[c.numPending-1]
@@ -453,16 +672,50 @@ func (c *container) GetNode() report.Node {
 			networkMode = c.container.HostConfig.NetworkMode
 		}
 		latest[ContainerUptime] = strconv.Itoa(uptimeSeconds)
-		latest[ContainerRestartCount] = strconv.Itoa(c.container.RestartCount)
 		latest[ContainerNetworkMode] = networkMode
 	}
+	latest[ContainerRestartCount] = strconv.Itoa(c.container.RestartCount)
+	if !c.container.State.Running && !c.container.State.FinishedAt.IsZero() {
+		latest[ContainerExitCode] = strconv.Itoa(c.container.State.ExitCode)
+		latest[ContainerOOMKilled] = strconv.FormatBool(c.container.State.OOMKilled)
+	}
+	if health := c.container.State.Health.Status; health != "" {
+		latest[ContainerHealth] = health
+	}
 
 	result := c.baseNode.WithLatests(latest)
 	result = result.WithLatestControls(controls)
 	result = result.WithMetrics(c.metrics())
+	result = result.AddPrefixMulticolumnTable(ContainerEventsPrefix, c.eventRows())
 	return result
 }
 
+// RecordEvent remembers a lifecycle event, keeping only the most recent ones.
+func (c *container) RecordEvent(event ContainerEvent) {
+	c.Lock()
+	defer c.Unlock()
+	c.events = append(c.events, event)
+	if len(c.events) > maxContainerEvents {
+		c.events = c.events[len(c.events)-maxContainerEvents:]
+	}
+}
+
+func (c *container) eventRows() []report.Row {
+	rows := make([]report.Row, 0, len(c.events))
+	for _, event := range c.events {
+		rows = append(rows, report.Row{
+			// Rows are sorted by ID, so use the time to keep them in order.
+			ID: strconv.FormatInt(event.Time.UnixNano(), 10),
+			Entries: map[string]string{
+				ContainerEventTime:   event.Time.UTC().Format(time.RFC3339Nano),
+				ContainerEventType:   event.Type,
+				ContainerEventDetail: event.Detail,
+			},
+		})
+	}
+	return rows
+}
+
 // ExtractContainerIPs returns the list of container IPs given a Node from the Container topology.
 func ExtractContainerIPs(nmd report.Node) []string {
 	v, _ := nmd.Sets.Lookup(ContainerIPs)
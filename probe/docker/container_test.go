@@ -1,6 +1,7 @@
 package docker_test
 
 import (
+	"fmt"
 	"net"
 	"strconv"
 	"strings"
@@ -17,8 +18,9 @@ import (
 )
 
 type mockStatsGatherer struct {
-	opts  client.StatsOptions
-	ready chan bool
+	opts      client.StatsOptions
+	ready     chan bool
+	pidsLimit uint64
 }
 
 func newMockStatsGatherer() *mockStatsGatherer {
@@ -31,6 +33,10 @@ func (s *mockStatsGatherer) Stats(opts client.StatsOptions) error {
 	return nil
 }
 
+func (s *mockStatsGatherer) PidsLimit(_ string) (uint64, error) {
+	return s.pidsLimit, nil
+}
+
 func (s *mockStatsGatherer) Send(stats *client.Stats) {
 	<-s.ready
 	s.opts.Stats <- stats
@@ -166,3 +172,136 @@ func TestContainerHidingBoth(t *testing.T) {
 		}
 	})
 }
+
+func TestContainerEvents(t *testing.T) {
+	now := time.Unix(12345, 67890).UTC()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	c := docker.NewContainer(&client.Container{
+		ID:           "ping",
+		Name:         "pong",
+		RestartCount: 2,
+		Config:       &client.Config{},
+		State: client.State{
+			ExitCode:   137,
+			OOMKilled:  true,
+			FinishedAt: now,
+			Health:     client.Health{Status: "unhealthy"},
+		},
+	}, "scope", false, false)
+	for i := 0; i < 12; i++ {
+		c.RecordEvent(docker.ContainerEvent{Time: now.Add(time.Duration(i) * time.Second), Type: docker.DieEvent, Detail: strconv.Itoa(i)})
+	}
+	node := c.GetNode()
+
+	for key, want := range map[string]string{
+		docker.ContainerRestartCount: "2",
+		docker.ContainerExitCode:     "137",
+		docker.ContainerOOMKilled:    "true",
+		docker.ContainerHealth:       "unhealthy",
+	} {
+		if have, _ := node.Latest.Lookup(key); have != want {
+			t.Errorf("Expected %s %q, got %q", key, want, have)
+		}
+	}
+
+	rows := node.ExtractMulticolumnTable(docker.ContainerTableTemplates[docker.ContainerEventsPrefix])
+	if len(rows) != 10 {
+		t.Fatalf("Expected the 10 most recent events, got %d", len(rows))
+	}
+	for i, row := range rows {
+		want := map[string]string{
+			docker.ContainerEventTime:   now.Add(time.Duration(i+2) * time.Second).Format(time.RFC3339Nano),
+			docker.ContainerEventType:   docker.DieEvent,
+			docker.ContainerEventDetail: strconv.Itoa(i + 2),
+		}
+		if !reflect.DeepEqual(want, row.Entries) {
+			t.Errorf("row %d: %v != %v", i, row.Entries, want)
+		}
+	}
+}
+
+func TestContainerStatsMetrics(t *testing.T) {
+	now := time.Unix(12345, 67890).UTC()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	oldInterfaceMAC := docker.InterfaceMACStub
+	defer func() { docker.InterfaceMACStub = oldInterfaceMAC }()
+	docker.InterfaceMACStub = func(pid int, name string) (string, error) {
+		if pid != 1234 || name != "eth0" {
+			return "", fmt.Errorf("no interface %s in %d", name, pid)
+		}
+		return "02:42:AC:11:00:02", nil
+	}
+
+	c := docker.NewContainer(&client.Container{
+		ID:         "ping",
+		Name:       "pong",
+		Config:     &client.Config{},
+		State:      client.State{Pid: 1234},
+		HostConfig: &client.HostConfig{PidsLimit: 100},
+		NetworkSettings: &client.NetworkSettings{Networks: map[string]client.ContainerNetwork{
+			"frontend": {MacAddress: "02:42:ac:11:00:02"},
+			"backend":  {MacAddress: "02:42:ac:12:00:02"},
+		}},
+	}, "scope", false, false)
+	s := newMockStatsGatherer()
+	s.pidsLimit = 50
+	if err := c.StartGatheringStats(s); err != nil {
+		t.Fatal(err)
+	}
+	defer c.StopGatheringStats()
+
+	stats := func(read time.Time, bytes, ops uint64, pids uint64) *client.Stats {
+		stats := &client.Stats{Read: read}
+		stats.BlkioStats.IOServiceBytesRecursive = []client.BlkioStatsEntry{
+			{Major: 8, Op: "Read", Value: bytes},
+			{Major: 8, Op: "Write", Value: 2 * bytes},
+			{Major: 8, Op: "Total", Value: 3 * bytes},
+		}
+		stats.BlkioStats.IOServicedRecursive = []client.BlkioStatsEntry{
+			{Major: 8, Op: "read", Value: ops},
+			{Major: 8, Op: "write", Value: 2 * ops},
+		}
+		stats.Networks = map[string]client.NetworkStats{
+			"eth0": {RxBytes: bytes, TxBytes: 2 * bytes},
+			"eth1": {RxBytes: 3 * bytes, TxBytes: 4 * bytes},
+		}
+		stats.PidsStats.Current = pids
+		return stats
+	}
+	s.Send(stats(now, 1000, 10, 5))
+	s.Send(stats(now.Add(2*time.Second), 3000, 30, 7))
+
+	want := map[string]float64{
+		docker.BlkioReadBytes:  1000,
+		docker.BlkioWriteBytes: 2000,
+		docker.BlkioReadOps:    10,
+		docker.BlkioWriteOps:   20,
+		// Interfaces are named after their networks, when they can be found
+		docker.NetworkRxBytesPrefix + "frontend": 1000,
+		docker.NetworkTxBytesPrefix + "frontend": 2000,
+		docker.NetworkRxBytesPrefix + "eth1":     3000,
+		docker.NetworkTxBytesPrefix + "eth1":     4000,
+		docker.PidsCurrent:                       7,
+	}
+	test.Poll(t, 100*time.Millisecond, want, func() interface{} {
+		have := map[string]float64{}
+		for key, metric := range c.GetNode().Metrics {
+			if _, ok := want[key]; !ok {
+				continue
+			}
+			if sample, ok := metric.LastSample(); ok {
+				have[key] = sample.Value
+			}
+		}
+		return have
+	})
+
+	// The enforced pids limit is the maximum
+	test.Poll(t, 100*time.Millisecond, 50.0, func() interface{} {
+		return c.GetNode().Metrics[docker.PidsCurrent].Max
+	})
+}
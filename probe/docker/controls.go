@@ -22,12 +22,17 @@ const (
 	ExecContainer    = report.DockerExecContainer
 	ResizeExecTTY    = "docker_resize_exec_tty"
 
-	waitTime = 10
+	// StopWaitTime is how many seconds a container is given to stop
+	// before it is killed.
+	StopWaitTime = 10
 )
 
+// ExecShellCmd runs the root user's login shell, falling back to /bin/sh.
+var ExecShellCmd = []string{"/bin/sh", "-c", "TERM=xterm exec $( (type getent > /dev/null 2>&1  && getent passwd root | cut -d: -f7 2>/dev/null) || echo /bin/sh)"}
+
 func (r *registry) stopContainer(containerID string, _ xfer.Request) xfer.Response {
 	log.Infof("Stopping container %s", containerID)
-	return xfer.ResponseError(r.client.StopContainer(containerID, waitTime))
+	return xfer.ResponseError(r.client.StopContainer(containerID, StopWaitTime))
 }
 
 func (r *registry) startContainer(containerID string, _ xfer.Request) xfer.Response {
@@ -37,7 +42,7 @@ func (r *registry) startContainer(containerID string, _ xfer.Request) xfer.Respo
 
 func (r *registry) restartContainer(containerID string, _ xfer.Request) xfer.Response {
 	log.Infof("Restarting container %s", containerID)
-	return xfer.ResponseError(r.client.RestartContainer(containerID, waitTime))
+	return xfer.ResponseError(r.client.RestartContainer(containerID, StopWaitTime))
 }
 
 func (r *registry) pauseContainer(containerID string, _ xfer.Request) xfer.Response {
@@ -113,7 +118,7 @@ func (r *registry) execContainer(containerID string, req xfer.Request) xfer.Resp
 		AttachStdout: true,
 		AttachStderr: true,
 		Tty:          true,
-		Cmd:          []string{"/bin/sh", "-c", "TERM=xterm exec $( (type getent > /dev/null 2>&1  && getent passwd root | cut -d: -f7 2>/dev/null) || echo /bin/sh)"},
+		Cmd:          ExecShellCmd,
 		Container:    containerID,
 	})
 	if err != nil {
@@ -0,0 +1,65 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+
+	docker_client "github.com/fsouza/go-dockerclient"
+)
+
+// pidsLimitClient is a Docker client which can also get the limit on the
+// number of PIDs of a container, which docker_client.Stats leaves out.
+type pidsLimitClient struct {
+	*docker_client.Client
+}
+
+// PidsLimit returns the limit on the number of PIDs of a container the
+// kernel enforces, from a single sample of its stats, or 0 if there is none.
+func (c pidsLimitClient) PidsLimit(id string) (uint64, error) {
+	u, err := url.Parse(c.Endpoint())
+	if err != nil {
+		return 0, err
+	}
+	switch u.Scheme {
+	case "unix":
+		// The client's transport dials the socket, whatever the URL
+		u.Scheme, u.Host = "http", "unix.sock"
+	case "tcp":
+		u.Scheme = "http"
+		if c.TLSConfig != nil {
+			u.Scheme = "https"
+		}
+	}
+	u.Path = "/containers/" + url.PathEscape(id) + "/stats"
+	u.RawQuery = "stream=false"
+	resp, err := c.HTTPClient.Get(u.String())
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("getting stats of %s: %s", id, resp.Status)
+	}
+	return decodePidsLimit(resp.Body)
+}
+
+// decodePidsLimit decodes the PIDs limit from container stats. A limit of
+// 0, or the largest value, means unlimited.
+func decodePidsLimit(r io.Reader) (uint64, error) {
+	var stats struct {
+		PidsStats struct {
+			Limit uint64 `json:"limit"`
+		} `json:"pids_stats"`
+	}
+	if err := json.NewDecoder(r).Decode(&stats); err != nil {
+		return 0, err
+	}
+	if stats.PidsStats.Limit == math.MaxUint64 {
+		return 0, nil
+	}
+	return stats.PidsStats.Limit, nil
+}
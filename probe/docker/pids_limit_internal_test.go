@@ -0,0 +1,26 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodePidsLimit(t *testing.T) {
+	for _, tc := range []struct {
+		stats string
+		want  uint64
+	}{
+		{`{"pids_stats":{"current":3,"limit":50}}`, 50},
+		{`{"pids_stats":{"current":3,"limit":18446744073709551615}}`, 0},
+		{`{"pids_stats":{"current":3}}`, 0},
+		{`{}`, 0},
+	} {
+		have, err := decodePidsLimit(strings.NewReader(tc.stats))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.stats, err)
+		}
+		if have != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.stats, tc.want, have)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"strings"
 	"sync"
 	"time"
 
@@ -8,6 +9,7 @@ import (
 	docker_client "github.com/fsouza/go-dockerclient"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/weaveworks/common/mtime"
 	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/report"
 )
@@ -23,6 +25,9 @@ const (
 	UnpauseEvent           = "unpause"
 	NetworkConnectEvent    = "network:connect"
 	NetworkDisconnectEvent = "network:disconnect"
+	OOMEvent               = "oom"
+	HealthStatusEvent      = "health_status"
+	RestartEvent           = "restart"
 )
 
 // Vars exported for testing.
@@ -86,14 +91,24 @@ type Client interface {
 	CreateExec(docker_client.CreateExecOptions) (*docker_client.Exec, error)
 	StartExecNonBlocking(string, docker_client.StartExecOptions) (docker_client.CloseWaiter, error)
 	Stats(docker_client.StatsOptions) error
+	PidsLimit(id string) (uint64, error)
 	ResizeExecTTY(id string, height, width int) error
 }
 
 func newDockerClient(endpoint string) (Client, error) {
+	var (
+		client *docker_client.Client
+		err    error
+	)
 	if endpoint == "" {
-		return docker_client.NewClientFromEnv()
+		client, err = docker_client.NewClientFromEnv()
+	} else {
+		client, err = docker_client.NewClient(endpoint)
+	}
+	if err != nil {
+		return nil, err
 	}
-	return docker_client.NewClient(endpoint)
+	return pidsLimitClient{client}, nil
 }
 
 // RegistryOptions are used to initialize the Registry
@@ -301,8 +316,23 @@ func (r *registry) updateNetworks() error {
 
 func (r *registry) handleEvent(event *docker_client.APIEvents) {
 	// TODO: Send shortcut reports on networks being created/destroyed?
-	switch event.Status {
-	case CreateEvent, RenameEvent, StartEvent, DieEvent, PauseEvent, UnpauseEvent, NetworkConnectEvent, NetworkDisconnectEvent:
+	// Health events carry the new status, e.g. "health_status: unhealthy"
+	status, detail := event.Status, ""
+	if i := strings.Index(status, ": "); i >= 0 {
+		status, detail = status[:i], status[i+2:]
+	}
+	switch status {
+	case CreateEvent, RenameEvent, StartEvent, PauseEvent, UnpauseEvent, NetworkConnectEvent, NetworkDisconnectEvent:
+		r.updateContainerState(event.ID)
+	case DieEvent:
+		if exitCode, ok := event.Actor.Attributes["exitCode"]; ok {
+			detail = "exit code " + exitCode
+		}
+		fallthrough
+	case OOMEvent, HealthStatusEvent, RestartEvent:
+		// Record the event before updating the state, so the shortcut
+		// report sent by updateContainerState includes it.
+		r.recordEvent(event, status, detail)
 		r.updateContainerState(event.ID)
 	case DestroyEvent:
 		r.Lock()
@@ -312,6 +342,22 @@ func (r *registry) handleEvent(event *docker_client.APIEvents) {
 	}
 }
 
+func (r *registry) recordEvent(event *docker_client.APIEvents, eventType, detail string) {
+	r.RLock()
+	c, ok := r.containers.Get(event.ID)
+	r.RUnlock()
+	if !ok {
+		return
+	}
+	t := mtime.Now()
+	if event.TimeNano != 0 {
+		t = time.Unix(0, event.TimeNano)
+	} else if event.Time != 0 {
+		t = time.Unix(event.Time, 0)
+	}
+	c.(Container).RecordEvent(ContainerEvent{Time: t, Type: eventType, Detail: detail})
+}
+
 func (r *registry) updateContainerState(containerID string) {
 	r.Lock()
 	defer r.Unlock()
@@ -89,6 +89,8 @@ func (c *mockContainer) Container() *client.Container {
 
 func (c *mockContainer) HasTTY() bool { return true }
 
+func (c *mockContainer) RecordEvent(docker.ContainerEvent) {}
+
 type mockDockerClient struct {
 	sync.RWMutex
 	apiContainers []client.APIContainers
@@ -172,6 +174,10 @@ func (m *mockDockerClient) Stats(_ client.StatsOptions) error {
 	return fmt.Errorf("stats")
 }
 
+func (m *mockDockerClient) PidsLimit(_ string) (uint64, error) {
+	return 0, fmt.Errorf("pidsLimit")
+}
+
 func (m *mockDockerClient) ResizeExecTTY(id string, height, width int) error {
 	return fmt.Errorf("resizeExecTTY")
 }
@@ -515,3 +521,30 @@ func TestRegistryDelete(t *testing.T) {
 		}
 	})
 }
+
+func TestRegistryHealthEvent(t *testing.T) {
+	mdc := newMockClient()
+	setupStubs(mdc, func() {
+		registry := testRegistry()
+		defer registry.Stop()
+		time.Sleep(time.Millisecond * 100) // Allow for goroutines to get started
+
+		updates := make(chan report.Node, 1)
+		registry.WatchContainerUpdates(func(n report.Node) {
+			select {
+			case updates <- n:
+			default:
+			}
+		})
+
+		mdc.send(&client.APIEvents{Status: docker.HealthStatusEvent + ": unhealthy", ID: "ping"})
+		select {
+		case n := <-updates:
+			if n.ID != report.MakeContainerNodeID("ping") {
+				t.Errorf("Expected an update for ping, got %s", n.ID)
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected a shortcut update for an unhealthy container")
+		}
+	})
+}
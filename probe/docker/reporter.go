@@ -2,6 +2,7 @@ package docker
 
 import (
 	"net"
+	"sort"
 	"strings"
 
 	humanize "github.com/dustin/go-humanize"
@@ -41,11 +42,19 @@ var (
 		ContainerPorts:        {ID: ContainerPorts, Label: "Ports", From: report.FromSets, Priority: 9},
 		ContainerCreated:      {ID: ContainerCreated, Label: "Created", From: report.FromLatest, Datatype: report.DateTime, Priority: 10},
 		ContainerID:           {ID: ContainerID, Label: "ID", From: report.FromLatest, Truncate: 12, Priority: 11},
+		ContainerHealth:       {ID: ContainerHealth, Label: "Health", From: report.FromLatest, Priority: 12},
+		ContainerExitCode:     {ID: ContainerExitCode, Label: "Exit code", From: report.FromLatest, Datatype: report.Number, Priority: 13},
+		ContainerOOMKilled:    {ID: ContainerOOMKilled, Label: "OOM killed", From: report.FromLatest, Priority: 14},
 	}
 
 	ContainerMetricTemplates = report.MetricTemplates{
-		CPUTotalUsage: {ID: CPUTotalUsage, Label: "CPU", Format: report.PercentFormat, Priority: 1},
-		MemoryUsage:   {ID: MemoryUsage, Label: "Memory", Format: report.FilesizeFormat, Priority: 2},
+		CPUTotalUsage:   {ID: CPUTotalUsage, Label: "CPU", Format: report.PercentFormat, Priority: 1},
+		MemoryUsage:     {ID: MemoryUsage, Label: "Memory", Format: report.FilesizeFormat, Priority: 2},
+		BlkioReadBytes:  {ID: BlkioReadBytes, Label: "Block read/s", Format: report.FilesizeFormat, Group: "blkio", Priority: 3},
+		BlkioWriteBytes: {ID: BlkioWriteBytes, Label: "Block write/s", Format: report.FilesizeFormat, Group: "blkio", Priority: 4},
+		BlkioReadOps:    {ID: BlkioReadOps, Label: "Block reads/s", Format: report.DefaultFormat, Group: "blkio", Priority: 5},
+		BlkioWriteOps:   {ID: BlkioWriteOps, Label: "Block writes/s", Format: report.DefaultFormat, Group: "blkio", Priority: 6},
+		PidsCurrent:     {ID: PidsCurrent, Label: "PIDs", Format: report.IntegerFormat, Priority: 7},
 	}
 
 	ContainerImageMetadataTemplates = report.MetadataTemplates{
@@ -78,6 +87,17 @@ var (
 			Type:   report.PropertyListType,
 			Prefix: EnvPrefix,
 		},
+		ContainerEventsPrefix: {
+			ID:     ContainerEventsPrefix,
+			Label:  "Recent events",
+			Type:   report.MulticolumnTableType,
+			Prefix: ContainerEventsPrefix,
+			Columns: []report.Column{
+				{ID: ContainerEventTime, Label: "Time", DataType: report.DateTime},
+				{ID: ContainerEventType, Label: "Event"},
+				{ID: ContainerEventDetail, Label: "Detail"},
+			},
+		},
 	}
 
 	ContainerImageTableTemplates = report.TableTemplates{
@@ -217,6 +237,7 @@ func (r *Reporter) containerTopology(localAddrs []net.IP) report.Topology {
 	r.registry.WalkContainers(func(c Container) {
 		nodes = append(nodes, c.GetNode().WithLatests(metadata))
 	})
+	result.MetricTemplates = result.MetricTemplates.Merge(networkMetricTemplates(nodes))
 
 	// Copy the IP addresses from other containers where they share network
 	// namespaces & deal with containers in the host net namespace.  This
@@ -269,6 +290,32 @@ func (r *Reporter) containerTopology(localAddrs []net.IP) report.Topology {
 	return result
 }
 
+// networkMetricTemplates makes the templates of the per-network metrics of
+// the containers, as their networks are only known from their stats.
+func networkMetricTemplates(nodes []report.Node) report.MetricTemplates {
+	networks := map[string]struct{}{}
+	for _, node := range nodes {
+		for key := range node.Metrics {
+			if strings.HasPrefix(key, NetworkRxBytesPrefix) {
+				networks[strings.TrimPrefix(key, NetworkRxBytesPrefix)] = struct{}{}
+			}
+		}
+	}
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	templates := report.MetricTemplates{}
+	for i, name := range names {
+		rx, tx := NetworkRxBytesPrefix+name, NetworkTxBytesPrefix+name
+		templates[rx] = report.MetricTemplate{ID: rx, Label: "Network rx/s (" + name + ")", Format: report.FilesizeFormat, Group: "network", Priority: 10 + 2*float64(i)}
+		templates[tx] = report.MetricTemplate{ID: tx, Label: "Network tx/s (" + name + ")", Format: report.FilesizeFormat, Group: "network", Priority: 11 + 2*float64(i)}
+	}
+	return templates
+}
+
 func (r *Reporter) containerImageTopology() report.Topology {
 	result := report.MakeTopology().
 		WithMetadataTemplates(ContainerImageMetadataTemplates).
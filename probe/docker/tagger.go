@@ -81,6 +81,43 @@ func (t *Tagger) Tag(r report.Report) (report.Report, error) {
 }
 
 func (t *Tagger) tag(tree process.Tree, topology *report.Topology) {
+	TagProcesses(tree, topology, func(f func(func(int) (string, string, bool))) {
+		t.registry.LockedPIDLookup(func(lookup func(int) Container) {
+			f(func(pid int) (string, string, bool) {
+				c := lookup(pid)
+				if c == nil {
+					return "", "", false
+				}
+				if ContainerIsStopped(c) || c.PID() == 1 {
+					return "", "", true
+				}
+				return c.ID(), c.Image(), true
+			})
+		})
+	}, func(imageID string) (string, bool) {
+		image, ok := t.registry.GetContainerImage(imageID)
+		if !ok || len(image.RepoTags) == 0 {
+			return "", false
+		}
+		return ImageNameWithoutTag(image.RepoTags[0]), true
+	})
+}
+
+// TagProcesses tags each process node in topology with the container
+// which the process, or its closest ancestor, is the init process of. It
+// is shared by the container runtime integrations.
+//
+// lockedLookup runs its argument under the runtime's lock, passing it a
+// function which returns the ID and image of the container a pid belongs
+// to, and whether there was one. Containers which shouldn't be tagged are
+// returned with an empty ID. imageName is called outside the lock to find
+// the name of an image.
+func TagProcesses(
+	tree process.Tree,
+	topology *report.Topology,
+	lockedLookup func(func(func(int) (containerID, image string, ok bool))),
+	imageName func(image string) (string, bool),
+) {
 	for _, node := range topology.Nodes {
 		pidStr, ok := node.Latest.Lookup(process.PID)
 		if !ok {
@@ -93,14 +130,15 @@ func (t *Tagger) tag(tree process.Tree, topology *report.Topology) {
 		}
 
 		var (
-			c         Container
-			candidate = int(pid)
+			containerID, image string
+			candidate          = int(pid)
 		)
 
-		t.registry.LockedPIDLookup(func(lookup func(int) Container) {
+		lockedLookup(func(lookup func(int) (string, string, bool)) {
 			for {
-				c = lookup(candidate)
-				if c != nil {
+				var found bool
+				containerID, image, found = lookup(candidate)
+				if found {
 					break
 				}
 
@@ -111,18 +149,16 @@ func (t *Tagger) tag(tree process.Tree, topology *report.Topology) {
 			}
 		})
 
-		if c == nil || ContainerIsStopped(c) || c.PID() == 1 {
+		if containerID == "" {
 			continue
 		}
 
-		node = node.WithLatest(ContainerID, mtime.Now(), c.ID())
-		node = node.WithParent(report.Container, report.MakeContainerNodeID(c.ID()))
+		node = node.WithLatest(ContainerID, mtime.Now(), containerID)
+		node = node.WithParent(report.Container, report.MakeContainerNodeID(containerID))
 
 		// If we can work out the image name, add a parent tag for it
-		image, ok := t.registry.GetContainerImage(c.Image())
-		if ok && len(image.RepoTags) > 0 {
-			imageName := ImageNameWithoutTag(image.RepoTags[0])
-			node = node.WithParent(report.ContainerImage, report.MakeContainerImageNodeID(imageName))
+		if name, ok := imageName(image); ok {
+			node = node.WithParent(report.ContainerImage, report.MakeContainerImageNodeID(name))
 		}
 
 		topology.ReplaceNode(node)
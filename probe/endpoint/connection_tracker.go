@@ -7,32 +7,52 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
-	"github.com/typetypetype/conntrack"
+	"github.com/weaveworks/common/mtime"
 
+	"github.com/weaveworks/scope/probe/endpoint/conntrack"
 	"github.com/weaveworks/scope/probe/endpoint/procspy"
 	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/report"
 )
 
 type connectionTracker struct {
-	conf            ReporterConfig
-	flowWalker      flowWalker // Interface
-	ebpfTracker     *EbpfTracker
+	conf        ReporterConfig
+	flowWalker  flowWalker // Interface
+	ebpfTracker *EbpfTracker
+	// UDP flows come from conntrack even when TCP connections come from
+	// eBPF, as the tcptracer-bpf kprobes only instrument TCP.
+	udpFlowWalker   flowWalker
 	reverseResolver *reverseResolver
 
 	// time of the previous ebpf failure, or zero if it didn't fail
 	ebpfLastFailureTime time.Time
+
+	// conntrack accounting of the active flows as of the previous
+	// report, so each report only carries the traffic seen since then
+	flowCounters map[uint32]flowCounters
+}
+
+type flowCounters struct {
+	firstSeen                                        time.Time
+	origPackets, origBytes, replyPackets, replyBytes uint64
 }
 
 func newConnectionTracker(conf ReporterConfig) connectionTracker {
 	ct := connectionTracker{
 		conf:            conf,
 		reverseResolver: newReverseResolver(),
+		flowCounters:    map[uint32]flowCounters{},
 	}
 	if conf.UseEbpfConn {
 		et, err := newEbpfTracker()
 		if err == nil {
 			ct.ebpfTracker = et
+			if conf.UDP != nil {
+				if !conf.UseConntrack {
+					log.Warnf("UDP flows are tracked with conntrack, which is disabled: no UDP flows will be reported")
+				}
+				ct.udpFlowWalker = newConntrackFlowWalker(conf.UseConntrack, conf.ProcRoot, conf.BufferSize, flowFilter{noTCP: true, udp: conf.UDP})
+			}
 			go ct.getInitialState()
 			return ct
 		}
@@ -63,11 +83,15 @@ func flowToTuple(f conntrack.Conn) (ft fourTuple) {
 
 func (t *connectionTracker) useProcfs() {
 	t.ebpfTracker = nil
+	if t.udpFlowWalker != nil {
+		t.udpFlowWalker.stop()
+		t.udpFlowWalker = nil
+	}
 	if t.conf.WalkProc && t.conf.Scanner == nil {
 		t.conf.Scanner = procspy.NewConnectionScanner(t.conf.ProcessCache, t.conf.SpyProcs)
 	}
 	if t.flowWalker == nil {
-		t.flowWalker = newConntrackFlowWalker(t.conf.UseConntrack, t.conf.ProcRoot, t.conf.BufferSize, false /* natOnly */)
+		t.flowWalker = newConntrackFlowWalker(t.conf.UseConntrack, t.conf.ProcRoot, t.conf.BufferSize, flowFilter{udp: t.conf.UDP})
 	}
 }
 
@@ -78,6 +102,7 @@ func (t *connectionTracker) ReportConnections(rpt *report.Report) {
 	if t.ebpfTracker != nil {
 		if !t.ebpfTracker.isDead() {
 			t.performEbpfTrack(rpt, hostNodeID)
+			t.reportFlows(rpt, t.udpFlowWalker)
 			return
 		}
 
@@ -98,6 +123,7 @@ func (t *connectionTracker) ReportConnections(rpt *report.Report) {
 			if err == nil {
 				go t.getInitialState()
 				t.performEbpfTrack(rpt, hostNodeID)
+				t.reportFlows(rpt, t.udpFlowWalker)
 				return
 			}
 			log.Warnf("could not restart ebpf tracker, falling back to proc scanning: %v", err)
@@ -106,18 +132,79 @@ func (t *connectionTracker) ReportConnections(rpt *report.Report) {
 	}
 
 	// consult the flowWalker for short-lived (conntracked) connections
-	seenTuples := map[string]fourTuple{}
-	t.flowWalker.walkFlows(func(f conntrack.Conn, alive bool) {
+	seenTuples := t.reportFlows(rpt, t.flowWalker)
+
+	if t.conf.WalkProc && t.conf.Scanner != nil {
+		t.performWalkProc(rpt, hostNodeID, seenTuples)
+	}
+}
+
+// reportFlows adds the connections of conntracked flows to the report,
+// returning the tuples of the TCP ones.
+func (t *connectionTracker) reportFlows(rpt *report.Report, fw flowWalker) map[string]fourTuple {
+	var (
+		seenTuples      = map[string]fourTuple{}
+		now             = mtime.Now()
+		newFlowCounters = map[uint32]flowCounters{}
+		udpNode         = map[string]string{Protocol: UDP}
+	)
+	if fw == nil {
+		return seenTuples
+	}
+	fw.walkFlows(func(f conntrack.Conn, alive bool) {
 		tuple := flowToTuple(f)
+		md, counters := flowEdgeMetadata(f, t.flowCounters, now)
+		if alive {
+			newFlowCounters[f.CtId] = counters
+		}
+		if f.Orig.Proto == udpProto {
+			t.addConnection(rpt, false, t.conf.UDP.fold(tuple), "", udpNode, udpNode, md)
+			return
+		}
 		seenTuples[tuple.key()] = tuple
-		t.addConnection(rpt, false, tuple, "", nil, nil)
+		t.addConnection(rpt, false, tuple, "", nil, nil, md)
 	})
+	t.flowCounters = newFlowCounters
+	return seenTuples
+}
 
-	if t.conf.WalkProc && t.conf.Scanner != nil {
-		t.performWalkProc(rpt, hostNodeID, seenTuples)
+// flowEdgeMetadata returns the edge metadata of a conntracked flow, with
+// the packets and bytes it carried since the previous report, along with
+// its current counters. Packet and byte counts are only available when
+// conntrack accounting is enabled (net.netfilter.nf_conntrack_acct=1).
+func flowEdgeMetadata(f conntrack.Conn, previous map[uint32]flowCounters, now time.Time) (report.EdgeMetadata, flowCounters) {
+	last, ok := previous[f.CtId]
+	if !ok {
+		last.firstSeen = now
+	}
+	// The flow is seen from its originator, so the original direction
+	// is egress and the reply direction is ingress.
+	md := report.EdgeMetadata{
+		EgressPacketCount:  counterDelta(f.OrigPktCount, last.origPackets),
+		EgressByteCount:    counterDelta(f.OrigPktLen, last.origBytes),
+		IngressPacketCount: counterDelta(f.ReplyPktCount, last.replyPackets),
+		IngressByteCount:   counterDelta(f.ReplyPktLen, last.replyBytes),
+		MaxConnCount:       1,
+		FirstSeen:          last.firstSeen,
+		LastSeen:           now,
+	}
+	return md, flowCounters{
+		firstSeen:    last.firstSeen,
+		origPackets:  f.OrigPktCount,
+		origBytes:    f.OrigPktLen,
+		replyPackets: f.ReplyPktCount,
+		replyBytes:   f.ReplyPktLen,
 	}
 }
 
+func counterDelta(current, last uint64) uint64 {
+	if current < last {
+		// counters were reset, e.g. because the conntrack id was reused
+		return current
+	}
+	return current - last
+}
+
 func (t *connectionTracker) existingFlows() map[string]fourTuple {
 	seenTuples := map[string]fourTuple{}
 	if !t.conf.UseConntrack {
@@ -143,6 +230,7 @@ func (t *connectionTracker) performWalkProc(rpt *report.Report, hostNodeID strin
 	if err != nil {
 		return err
 	}
+	now := mtime.Now()
 	for conn := conns.Next(); conn != nil; conn = conns.Next() {
 		tuple, namespaceID, incoming := connectionTuple(conn, seenTuples)
 		var toNodeInfo, fromNodeInfo map[string]string
@@ -152,7 +240,12 @@ func (t *connectionTracker) performWalkProc(rpt *report.Report, hostNodeID strin
 				report.HostNodeID: hostNodeID,
 			}
 		}
-		t.addConnection(rpt, incoming, tuple, namespaceID, fromNodeInfo, toNodeInfo)
+		// Connections also seen in conntrack have already been counted.
+		var md report.EdgeMetadata
+		if _, ok := seenTuples[tuple.key()]; !ok {
+			md = report.EdgeMetadata{MaxConnCount: 1, LastSeen: now}
+		}
+		t.addConnection(rpt, incoming, tuple, namespaceID, fromNodeInfo, toNodeInfo, md)
 	}
 	return nil
 }
@@ -187,6 +280,7 @@ func (t *connectionTracker) getInitialState() {
 }
 
 func (t *connectionTracker) performEbpfTrack(rpt *report.Report, hostNodeID string) error {
+	now := mtime.Now()
 	t.ebpfTracker.walkConnections(func(e ebpfConnection) {
 		var toNodeInfo, fromNodeInfo map[string]string
 		if e.pid > 0 {
@@ -195,21 +289,26 @@ func (t *connectionTracker) performEbpfTrack(rpt *report.Report, hostNodeID stri
 				report.HostNodeID: hostNodeID,
 			}
 		}
-		t.addConnection(rpt, e.incoming, e.tuple, e.networkNamespace, fromNodeInfo, toNodeInfo)
+		md := report.EdgeMetadata{MaxConnCount: 1, FirstSeen: e.firstSeen, LastSeen: e.lastSeen}
+		if md.LastSeen.IsZero() {
+			md.LastSeen = now
+		}
+		t.addConnection(rpt, e.incoming, e.tuple, e.networkNamespace, fromNodeInfo, toNodeInfo, md)
 	})
 	return nil
 }
 
-func (t *connectionTracker) addConnection(rpt *report.Report, incoming bool, ft fourTuple, namespaceID string, extraFromNode, extraToNode map[string]string) {
+func (t *connectionTracker) addConnection(rpt *report.Report, incoming bool, ft fourTuple, namespaceID string, extraFromNode, extraToNode map[string]string, md report.EdgeMetadata) {
 	if incoming {
 		ft = reverse(ft)
 		extraFromNode, extraToNode = extraToNode, extraFromNode
+		md = md.Reversed()
 	}
 	var (
 		fromNode = t.makeEndpointNode(namespaceID, ft.fromAddr, ft.fromPort, extraFromNode)
 		toNode   = t.makeEndpointNode(namespaceID, ft.toAddr, ft.toPort, extraToNode)
 	)
-	rpt.Endpoint.AddNode(fromNode.WithAdjacent(toNode.ID))
+	rpt.Endpoint.AddNode(fromNode.WithEdge(toNode.ID, md))
 	rpt.Endpoint.AddNode(toNode)
 	t.addDNS(rpt, ft.fromAddr)
 	t.addDNS(rpt, ft.toAddr)
@@ -217,7 +316,11 @@ func (t *connectionTracker) addConnection(rpt *report.Report, incoming bool, ft
 
 func (t *connectionTracker) makeEndpointNode(namespaceID string, addr string, port uint16, extra map[string]string) report.Node {
 	portStr := strconv.Itoa(int(port))
-	node := report.MakeNodeWith(report.MakeEndpointNodeID(t.conf.HostID, namespaceID, addr, portStr), nil)
+	id := report.MakeEndpointNodeID(t.conf.HostID, namespaceID, addr, portStr)
+	if extra[Protocol] == UDP {
+		id = report.MakeUDPEndpointNodeID(t.conf.HostID, namespaceID, addr, portStr)
+	}
+	node := report.MakeNodeWith(id, nil)
 	if extra != nil {
 		node = node.WithLatests(extra)
 	}
@@ -245,6 +348,9 @@ func (t *connectionTracker) Stop() error {
 	if t.flowWalker != nil {
 		t.flowWalker.stop()
 	}
+	if t.udpFlowWalker != nil {
+		t.udpFlowWalker.stop()
+	}
 	t.reverseResolver.stop()
 	return nil
 }
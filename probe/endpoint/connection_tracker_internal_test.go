@@ -0,0 +1,136 @@
+// +build linux
+
+package endpoint
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/test"
+
+	"github.com/weaveworks/scope/probe/endpoint/conntrack"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestFlowEdgeMetadata(t *testing.T) {
+	var (
+		t1   = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+		t2   = t1.Add(3 * time.Second)
+		flow = conntrack.Conn{
+			CtId: 1,
+			Orig: conntrack.Tuple{
+				Proto: tcpProto, Src: net.ParseIP("10.0.0.1"), SrcPort: 41000,
+				Dst: net.ParseIP("10.0.0.2"), DstPort: 80,
+			},
+			OrigPktCount:  2,
+			OrigPktLen:    100,
+			ReplyPktCount: 1,
+			ReplyPktLen:   1000,
+		}
+		counters = map[uint32]flowCounters{}
+	)
+
+	have, counter := flowEdgeMetadata(flow, counters, t1)
+	want := report.EdgeMetadata{
+		EgressPacketCount:  2,
+		EgressByteCount:    100,
+		IngressPacketCount: 1,
+		IngressByteCount:   1000,
+		MaxConnCount:       1,
+		FirstSeen:          t1,
+		LastSeen:           t1,
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Fatal(test.Diff(want, have))
+	}
+
+	// The next report only carries the traffic since the previous one
+	counters[flow.CtId] = counter
+	flow.OrigPktCount, flow.OrigPktLen = 3, 150
+	have, _ = flowEdgeMetadata(flow, counters, t2)
+	want = report.EdgeMetadata{
+		EgressPacketCount: 1,
+		EgressByteCount:   50,
+		MaxConnCount:      1,
+		FirstSeen:         t1,
+		LastSeen:          t2,
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Fatal(test.Diff(want, have))
+	}
+}
+
+func TestReportUDPFlows(t *testing.T) {
+	udp, err := NewUDPConfig("53", "10.96.0.0/12", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		dnsQuery = func(id uint32, port uint16) conntrack.Conn {
+			return conntrack.Conn{
+				CtId: id,
+				Orig: conntrack.Tuple{
+					Proto: udpProto, Src: net.ParseIP("10.32.0.5"), SrcPort: port,
+					Dst: net.ParseIP("10.96.0.10"), DstPort: 53,
+				},
+				Reply: conntrack.Tuple{
+					Proto: udpProto, Src: net.ParseIP("10.96.0.10"), SrcPort: 53,
+					Dst: net.ParseIP("10.32.0.5"), DstPort: port,
+				},
+			}
+		}
+		statsd = conntrack.Conn{
+			CtId: 3,
+			Orig: conntrack.Tuple{
+				Proto: udpProto, Src: net.ParseIP("10.32.0.5"), SrcPort: 40000,
+				Dst: net.ParseIP("10.32.0.6"), DstPort: 8125,
+			},
+		}
+		walker = &conntrackWalker{filter: flowFilter{udp: udp}}
+	)
+	if !walker.relevant(dnsQuery(1, 41000)) {
+		t.Error("Expected DNS query to be tracked")
+	}
+	if walker.relevant(statsd) {
+		t.Error("Expected statsd flow not to be tracked")
+	}
+	if (&conntrackWalker{}).relevant(dnsQuery(1, 41000)) {
+		t.Error("Expected UDP not to be tracked by default")
+	}
+
+	ct := connectionTracker{
+		conf:            ReporterConfig{HostID: "host1", UDP: udp},
+		reverseResolver: newReverseResolver(),
+		flowCounters:    map[uint32]flowCounters{},
+	}
+	defer ct.reverseResolver.stop()
+	tcpQuery := dnsQuery(3, 41002)
+	tcpQuery.Orig.Proto, tcpQuery.Reply.Proto = tcpProto, tcpProto
+	rpt := report.MakeReport()
+	seen := ct.reportFlows(&rpt, &mockFlowWalker{flows: []conntrack.Conn{dnsQuery(1, 41000), dnsQuery(2, 41001), tcpQuery}})
+	if len(seen) != 1 {
+		t.Errorf("Expected only the TCP tuple, got %v", seen)
+	}
+
+	// Both queries are folded into one edge from the client, and the
+	// server's UDP endpoint is apart from its TCP one
+	client := report.MakeUDPEndpointNodeID("host1", "", "10.32.0.5", "0")
+	server := report.MakeUDPEndpointNodeID("host1", "", "10.96.0.10", "53")
+	tcpServer := report.MakeEndpointNodeID("host1", "", "10.96.0.10", "53")
+	if want, have := 4, len(rpt.Endpoint.Nodes); want != have {
+		t.Fatalf("Expected %d endpoints, got %d: %v", want, have, rpt.Endpoint.Nodes)
+	}
+	if protocol, ok := rpt.Endpoint.Nodes[tcpServer].Latest.Lookup(Protocol); ok {
+		t.Errorf("Expected %s not to be tagged, got %q", tcpServer, protocol)
+	}
+	for _, id := range []string{client, server} {
+		if protocol, _ := rpt.Endpoint.Nodes[id].Latest.Lookup(Protocol); protocol != UDP {
+			t.Errorf("Expected %s to be tagged as UDP, got %q", id, protocol)
+		}
+	}
+	if !rpt.Endpoint.Nodes[client].Adjacency.Contains(server) {
+		t.Errorf("Expected an edge from %s to %s", client, server)
+	}
+}
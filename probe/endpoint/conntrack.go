@@ -10,7 +10,8 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
-	"github.com/typetypetype/conntrack"
+
+	"github.com/weaveworks/scope/probe/endpoint/conntrack"
 )
 
 const (
@@ -19,6 +20,7 @@ const (
 	timeWait   = "TIME_WAIT"
 	tcpClose   = "CLOSE"
 	tcpProto   = 6
+	udpProto   = 17
 )
 
 // flowWalker is something that maintains flows, and provides an accessor
@@ -40,12 +42,19 @@ type conntrackWalker struct {
 	activeFlows   map[uint32]conntrack.Conn // active flows in state != TIME_WAIT
 	bufferedFlows []conntrack.Conn          // flows coming out of activeFlows spend 1 walk cycle here
 	bufferSize    int
-	natOnly       bool
+	filter        flowFilter
 	quit          chan struct{}
 }
 
+// flowFilter selects the flows a conntrackWalker keeps track of.
+type flowFilter struct {
+	natOnly bool       // only flows which have been NAT'd
+	noTCP   bool       // no TCP flows, e.g. when eBPF is tracking those
+	udp     *UDPConfig // which UDP flows to track, if any
+}
+
 // newConntracker creates and starts a new conntracker.
-func newConntrackFlowWalker(useConntrack bool, procRoot string, bufferSize int, natOnly bool) flowWalker {
+func newConntrackFlowWalker(useConntrack bool, procRoot string, bufferSize int, filter flowFilter) flowWalker {
 	if !useConntrack {
 		return nilFlowWalker{}
 	} else if err := IsConntrackSupported(procRoot); err != nil {
@@ -55,7 +64,7 @@ func newConntrackFlowWalker(useConntrack bool, procRoot string, bufferSize int,
 	result := &conntrackWalker{
 		activeFlows: map[uint32]conntrack.Conn{},
 		bufferSize:  bufferSize,
-		natOnly:     natOnly,
+		filter:      filter,
 		quit:        make(chan struct{}),
 	}
 	go result.loop()
@@ -106,13 +115,19 @@ func (c *conntrackWalker) clearFlows() {
 }
 
 func (c *conntrackWalker) relevant(f conntrack.Conn) bool {
-	// For now, we're only interested in tcp connections - there is too much udp
-	// traffic going on (every container talking to dns, for example) to
-	// render nicely. TODO: revisit this.
-	if f.Orig.Proto != tcpProto {
+	switch f.Orig.Proto {
+	case tcpProto:
+		if c.filter.noTCP {
+			return false
+		}
+	case udpProto:
+		if !c.filter.udp.tracks(flowToTuple(f)) {
+			return false
+		}
+	default:
 		return false
 	}
-	return !(c.natOnly && (f.Status&conntrack.IPS_NAT_MASK) == 0)
+	return !(c.filter.natOnly && (f.Status&conntrack.IPS_NAT_MASK) == 0)
 }
 
 func (c *conntrackWalker) run() {
@@ -177,6 +192,11 @@ func (c *conntrackWalker) handleFlow(f conntrack.Conn) {
 	case f.MsgType == conntrack.NfctMsgDestroy:
 		if active, ok := c.activeFlows[f.CtId]; ok {
 			delete(c.activeFlows, f.CtId)
+			// the destroy event carries the final accounting of the flow
+			if f.OrigPktCount > active.OrigPktCount || f.ReplyPktCount > active.ReplyPktCount {
+				active.OrigPktCount, active.OrigPktLen = f.OrigPktCount, f.OrigPktLen
+				active.ReplyPktCount, active.ReplyPktLen = f.ReplyPktCount, f.ReplyPktLen
+			}
 			c.bufferedFlows = append(c.bufferedFlows, active)
 		}
 	}
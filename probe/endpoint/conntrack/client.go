@@ -77,7 +77,8 @@ func queryAllConnections(bufferSize int, cb func(Conn)) error {
 			Seq:   0,
 		},
 		Body: unix.Nfgenmsg{
-			Nfgen_family: syscall.AF_INET,
+			// AF_UNSPEC dumps both IPv4 and IPv6 connections
+			Nfgen_family: syscall.AF_UNSPEC,
 			Version:      NFNETLINK_V0,
 			Res_id:       0,
 		},
@@ -389,9 +390,11 @@ func parseIP(b []byte, tuple *Tuple) error {
 			tuple.Dst = make(net.IP, len(attr.Msg))
 			copy(tuple.Dst, attr.Msg)
 		case CtaIpV6Src:
-			// TODO
+			tuple.Src = make(net.IP, len(attr.Msg))
+			copy(tuple.Src, attr.Msg)
 		case CtaIpV6Dst:
-			// TODO
+			tuple.Dst = make(net.IP, len(attr.Msg))
+			copy(tuple.Dst, attr.Msg)
 		}
 	}
 	return nil
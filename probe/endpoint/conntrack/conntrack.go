@@ -1,3 +1,8 @@
+// Package conntrack reads connections from the kernel's connection tracking
+// tables over netlink.
+//
+// It is a fork of github.com/typetypetype/conntrack at revision 9d9dd84,
+// changed to dump and parse IPv6 connections as well as IPv4 ones.
 package conntrack
 
 import (
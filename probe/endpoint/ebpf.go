@@ -12,9 +12,11 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/weaveworks/common/fs"
+	"github.com/weaveworks/common/mtime"
 	"github.com/weaveworks/scope/probe/endpoint/procspy"
 	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/probe/process"
@@ -27,6 +29,8 @@ type ebpfConnection struct {
 	networkNamespace string
 	incoming         bool
 	pid              int
+	firstSeen        time.Time // zero if the connection predates the tracker
+	lastSeen         time.Time // zero while the connection is open
 }
 
 // EbpfTracker contains the sets of open and closed TCP connections.
@@ -38,6 +42,7 @@ type EbpfTracker struct {
 	stopping        bool
 	dead            bool
 	lastTimestampV4 uint64
+	lastTimestampV6 uint64
 
 	// debugBPF specifies if EbpfTracker must be started in debug mode. This
 	// allows to easily debug issues like:
@@ -62,6 +67,7 @@ type EbpfTracker struct {
 //   - 4.1.2-foo
 //   - 4.1.2-33.44+bar
 //   - etc.
+//
 // For example, on a Ubuntu system the vendor specific release part
 // (after the first `-`) could look like:
 // '<ABI number>.<upload number>-<flavour>' or
@@ -141,6 +147,20 @@ func newEbpfTracker() (*EbpfTracker, error) {
 
 // TCPEventV4 handles IPv4 TCP events from the eBPF tracer
 func (t *EbpfTracker) TCPEventV4(e tracer.TcpV4) {
+	tuple := fourTuple{e.SAddr.String(), e.DAddr.String(), e.SPort, e.DPort}
+	t.handleEvent(e.Type, e.Timestamp, &t.lastTimestampV4, int(e.Pid), int(e.Fd), tuple, e.NetNS)
+}
+
+// TCPEventV6 handles IPv6 TCP events from the eBPF tracer
+func (t *EbpfTracker) TCPEventV6(e tracer.TcpV6) {
+	tuple := fourTuple{e.SAddr.String(), e.DAddr.String(), e.SPort, e.DPort}
+	t.handleEvent(e.Type, e.Timestamp, &t.lastTimestampV6, int(e.Pid), int(e.Fd), tuple, e.NetNS)
+}
+
+// handleEvent handles a TCP event of either family. The tracer delivers
+// each family's events in order, but not in order with the other's, so
+// timestamps are checked against the last one of the same family.
+func (t *EbpfTracker) handleEvent(eventType tracer.EventType, timestamp uint64, lastTimestamp *uint64, pid, fd int, tuple fourTuple, netNS uint32) {
 	if t.debugBPF {
 		debugBPFFile := "/var/run/scope/debug-bpf"
 		b, err := ioutil.ReadFile("/var/run/scope/debug-bpf")
@@ -152,42 +172,35 @@ func (t *EbpfTracker) TCPEventV4(e tracer.TcpV4) {
 		}
 	}
 
-	if t.lastTimestampV4 > e.Timestamp {
+	if *lastTimestamp > timestamp {
 		// A kernel bug can cause the timestamps to be wrong (e.g. on Ubuntu with Linux 4.4.0-47.68)
 		// Upgrading the kernel will fix the problem. For further info see:
 		// https://github.com/iovisor/bcc/issues/790#issuecomment-263704235
 		// https://github.com/weaveworks/scope/issues/2334
-		log.Errorf("tcp tracer received event with timestamp %v even though the last timestamp was %v. Stopping the eBPF tracker.", e.Timestamp, t.lastTimestampV4)
+		log.Errorf("tcp tracer received event with timestamp %v even though the last timestamp was %v. Stopping the eBPF tracker.", timestamp, *lastTimestamp)
 		t.stop()
 		return
 	}
 
-	t.lastTimestampV4 = e.Timestamp
+	*lastTimestamp = timestamp
 
-	if e.Type == tracer.EventFdInstall {
-		t.handleFdInstall(e.Type, int(e.Pid), int(e.Fd))
+	if eventType == tracer.EventFdInstall {
+		t.handleFdInstall(eventType, pid, fd)
 	} else {
-		tuple := fourTuple{e.SAddr.String(), e.DAddr.String(), e.SPort, e.DPort}
-		t.handleConnection(e.Type, tuple, int(e.Pid), strconv.Itoa(int(e.NetNS)))
+		t.handleConnection(eventType, tuple, pid, strconv.Itoa(int(netNS)))
 	}
 }
 
-// TCPEventV6 handles IPv6 TCP events from the eBPF tracer. This is
-// currently a no-op.
-func (t *EbpfTracker) TCPEventV6(e tracer.TcpV6) {
-	// TODO: IPv6 not supported in Scope
-}
-
 // LostV4 handles IPv4 TCP event misses from the eBPF tracer.
 func (t *EbpfTracker) LostV4(count uint64) {
 	log.Errorf("tcp tracer lost %d events. Stopping the eBPF tracker", count)
 	t.stop()
 }
 
-// LostV6 handles IPv4 TCP event misses from the eBPF tracer. This is
-// currently a no-op.
+// LostV6 handles IPv6 TCP event misses from the eBPF tracer.
 func (t *EbpfTracker) LostV6(count uint64) {
-	// TODO: IPv6 not supported in Scope
+	log.Errorf("tcp tracer lost %d IPv6 events. Stopping the eBPF tracker", count)
+	t.stop()
 }
 
 func tupleFromPidFd(pid int, fd int) (tuple fourTuple, netns string, ok bool) {
@@ -257,6 +270,7 @@ func (t *EbpfTracker) handleFdInstall(ev tracer.EventType, pid int, fd int) {
 		tuple:            tuple,
 		pid:              pid,
 		networkNamespace: netns,
+		firstSeen:        mtime.Now(),
 	}
 }
 
@@ -274,6 +288,7 @@ func (t *EbpfTracker) handleConnection(ev tracer.EventType, tuple fourTuple, pid
 			tuple:            tuple,
 			pid:              pid,
 			networkNamespace: networkNamespace,
+			firstSeen:        mtime.Now(),
 		}
 	case tracer.EventAccept:
 		t.openConnections[tuple] = ebpfConnection{
@@ -281,6 +296,7 @@ func (t *EbpfTracker) handleConnection(ev tracer.EventType, tuple fourTuple, pid
 			tuple:            tuple,
 			pid:              pid,
 			networkNamespace: networkNamespace,
+			firstSeen:        mtime.Now(),
 		}
 	case tracer.EventClose:
 		if !t.ready {
@@ -288,6 +304,7 @@ func (t *EbpfTracker) handleConnection(ev tracer.EventType, tuple fourTuple, pid
 		}
 		if deadConn, ok := t.openConnections[tuple]; ok {
 			delete(t.openConnections, tuple)
+			deadConn.lastSeen = mtime.Now()
 			t.closedConnections = append(t.closedConnections, deadConn)
 		} else {
 			log.Debugf("EbpfTracker: unmatched close event: %s pid=%d netns=%s", tuple, pid, networkNamespace)
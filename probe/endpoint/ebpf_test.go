@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/weaveworks/common/mtime"
 	"github.com/weaveworks/tcptracer-bpf/pkg/tracer"
 
 	"github.com/weaveworks/scope/probe/host"
@@ -24,6 +25,10 @@ func newMockEbpfTracker() *EbpfTracker {
 }
 
 func TestHandleConnection(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
 	var (
 		ServerPid  uint32 = 42
 		ClientPid  uint32 = 43
@@ -55,6 +60,7 @@ func TestHandleConnection(t *testing.T) {
 			networkNamespace: strconv.Itoa(int(NetNS)),
 			incoming:         false,
 			pid:              int(ClientPid),
+			firstSeen:        now,
 		}
 
 		IPv4ConnectCloseEvent = tracer.TcpV4{
@@ -91,6 +97,7 @@ func TestHandleConnection(t *testing.T) {
 			networkNamespace: strconv.Itoa(int(NetNS)),
 			incoming:         true,
 			pid:              int(ServerPid),
+			firstSeen:        now,
 		}
 
 		IPv4AcceptCloseEvent = tracer.TcpV4{
@@ -238,6 +245,51 @@ func TestInvalidTimeStampDead(t *testing.T) {
 	}
 }
 
+func TestIPv6Events(t *testing.T) {
+	var (
+		ServerIP = net.ParseIP("2001:db8::1")
+		ClientIP = net.ParseIP("2001:db8::2")
+		v4Event  = tracer.TcpV4{
+			Timestamp: 5,
+			Type:      tracer.EventConnect,
+			Pid:       43,
+			SAddr:     net.ParseIP("10.0.0.2").To4(),
+			DAddr:     net.ParseIP("10.0.0.1").To4(),
+			SPort:     6789,
+			DPort:     12345,
+			NetNS:     123456789,
+		}
+		v6Event = tracer.TcpV6{
+			Timestamp: 3,
+			Type:      tracer.EventConnect,
+			Pid:       43,
+			SAddr:     ClientIP,
+			DAddr:     ServerIP,
+			SPort:     6790,
+			DPort:     12345,
+			NetNS:     123456789,
+		}
+	)
+	mockEbpfTracker := newMockEbpfTracker()
+	mockEbpfTracker.TCPEventV4(v4Event)
+	// IPv6 events are ordered separately from IPv4 ones
+	mockEbpfTracker.TCPEventV6(v6Event)
+	if mockEbpfTracker.isDead() {
+		t.Errorf("expected ebpfTracker to be alive after events with valid order")
+	}
+
+	want := fourTuple{fromAddr: "2001:db8::2", toAddr: "2001:db8::1", fromPort: 6790, toPort: 12345}
+	found := false
+	mockEbpfTracker.walkConnections(func(e ebpfConnection) {
+		if e.tuple == want {
+			found = true
+		}
+	})
+	if !found {
+		t.Errorf("walkConnections didn't find IPv6 connection %v", want)
+	}
+}
+
 func TestIsKernelSupported(t *testing.T) {
 	var release, version string
 	oldGetKernelReleaseAndVersion := host.GetKernelReleaseAndVersion
@@ -0,0 +1,313 @@
+// +build linux
+
+package endpoint
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	ipvsServicesPath    = "net/ip_vs"
+	ipvsConnectionsPath = "net/ip_vs_conn"
+	kubeProxyInterval   = 10 * time.Second
+)
+
+type ipPort struct {
+	ip, port string
+}
+
+// serviceConnection is a connection from a client to the virtual IP of
+// a Kubernetes service, which kube-proxy has sent to one of its backends.
+type serviceConnection struct {
+	client, service, backend ipPort
+}
+
+// clientService is a connection from a client to the virtual IP of a
+// Kubernetes service, before it was sent to a backend.
+type clientService struct {
+	client, service ipPort
+}
+
+// kubeProxyTables reads the state kube-proxy programs into the kernel to
+// send connections to Kubernetes service IPs to backend pods: IPVS
+// services and connections, and, if enabled, the KUBE-SERVICES iptables
+// chains.
+type kubeProxyTables struct {
+	procRoot     string
+	iptablesSave func() ([]byte, error) // nil to not read iptables
+
+	sync.Mutex
+	services map[ipPort][]ipPort // service IP:port -> backend IP:ports
+	quit     chan struct{}
+}
+
+func newKubeProxyTables(procRoot string, iptables bool) *kubeProxyTables {
+	k := &kubeProxyTables{
+		procRoot: procRoot,
+		quit:     make(chan struct{}),
+	}
+	if iptables {
+		k.iptablesSave = func() ([]byte, error) {
+			return exec.Command("iptables-save", "-t", "nat").Output()
+		}
+	}
+	go k.loop()
+	return k
+}
+
+func (k *kubeProxyTables) loop() {
+	for {
+		k.readServices()
+		select {
+		case <-time.After(kubeProxyInterval):
+		case <-k.quit:
+			return
+		}
+	}
+}
+
+func (k *kubeProxyTables) stop() {
+	close(k.quit)
+}
+
+// readServices reads the backends of each service, from IPVS if
+// kube-proxy is in IPVS mode and from iptables otherwise, if enabled.
+func (k *kubeProxyTables) readServices() {
+	services, err := readIPVSServices(filepath.Join(k.procRoot, ipvsServicesPath))
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("kube-proxy: reading IPVS services: %v", err)
+	}
+	if len(services) == 0 && k.iptablesSave != nil {
+		var output []byte
+		if output, err = k.iptablesSave(); err != nil {
+			log.Debugf("kube-proxy: reading iptables: %v", err)
+		} else {
+			services = parseKubeServiceChains(output)
+		}
+	}
+	k.Lock()
+	k.services = services
+	k.Unlock()
+}
+
+// applyNAT points connections to service IPs at the backends they were
+// sent to. IPVS tells us the backend of each connection; otherwise, in
+// iptables mode, conntrack's DNAT'd flows do, and connections to services
+// with a single backend can be resolved without them.
+func (k *kubeProxyTables) applyNAT(rpt report.Report, scope string, dnat map[clientService]ipPort) {
+	conns, err := readIPVSConnections(filepath.Join(k.procRoot, ipvsConnectionsPath))
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("kube-proxy: reading IPVS connections: %v", err)
+	}
+
+	k.Lock()
+	services := k.services
+	k.Unlock()
+	for id, node := range rpt.Endpoint.Nodes {
+		for _, adjacentID := range node.Adjacency {
+			_, ip, port, ok := report.ParseEndpointNodeID(adjacentID)
+			if !ok || report.IsUDPEndpointNodeID(adjacentID) {
+				continue
+			}
+			service := ipPort{ip, port}
+			backends := services[service]
+			if len(backends) == 0 {
+				continue
+			}
+			_, clientIP, clientPort, ok := report.ParseEndpointNodeID(id)
+			if !ok {
+				continue
+			}
+			client := ipPort{clientIP, clientPort}
+			backend, ok := dnat[clientService{client, service}]
+			if !ok && len(backends) == 1 {
+				backend, ok = backends[0], true
+			}
+			if ok {
+				conns = append(conns, serviceConnection{client, service, backend})
+			}
+		}
+	}
+
+	for _, c := range conns {
+		var (
+			clientID  = report.MakeEndpointNodeID(scope, "", c.client.ip, c.client.port)
+			serviceID = report.MakeEndpointNodeID(scope, "", c.service.ip, c.service.port)
+			backendID = report.MakeEndpointNodeID(scope, "", c.backend.ip, c.backend.port)
+		)
+		if redirectEdge(rpt, clientID, serviceID, backendID) {
+			continue
+		}
+		if node, ok := rpt.Endpoint.Nodes[backendID]; ok {
+			addCopy(rpt, node, serviceID)
+		}
+	}
+}
+
+// readIPVSServices parses /proc/net/ip_vs, which lists each virtual
+// service followed by its real servers:
+//
+//	TCP  0A60000A:0035 rr
+//	  -> 0A200002:0035      Masq    1      0          0
+func readIPVSServices(path string) (map[ipPort][]ipPort, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	services := map[ipPort][]ipPort{}
+	var service *ipPort
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) >= 2 && (fields[0] == "TCP" || fields[0] == "UDP"):
+			addr, ok := parseIPVSAddr(fields[1])
+			if !ok {
+				service = nil
+				continue
+			}
+			service = &addr
+			services[addr] = nil
+		case len(fields) >= 2 && fields[0] == "->" && service != nil:
+			if addr, ok := parseIPVSAddr(fields[1]); ok {
+				services[*service] = append(services[*service], addr)
+			}
+		}
+	}
+	return services, scanner.Err()
+}
+
+// readIPVSConnections parses /proc/net/ip_vs_conn, which lists the
+// client, service and backend of each connection:
+//
+//	Pro FromIP   FPrt ToIP     TPrt DestIP   DPrt State       Expires PEName PEData
+//	TCP 0A200001 9C40 0A60000A 0035 0A200002 0035 ESTABLISHED    899
+func readIPVSConnections(path string) ([]serviceConnection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var conns []serviceConnection
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || (fields[0] != "TCP" && fields[0] != "UDP") {
+			continue
+		}
+		if state := fields[7]; state == timeWait || state == tcpClose {
+			continue
+		}
+		var addrs [3]ipPort
+		ok := true
+		for i := range addrs {
+			addrs[i], ok = parseIPVSIPPort(fields[1+2*i], fields[2+2*i])
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			conns = append(conns, serviceConnection{client: addrs[0], service: addrs[1], backend: addrs[2]})
+		}
+	}
+	return conns, scanner.Err()
+}
+
+// parseIPVSAddr parses an address as IPVS prints it: hex digits for
+// IPv4, or a bracketed IPv6 address, followed by a hex port.
+func parseIPVSAddr(s string) (ipPort, bool) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return ipPort{}, false
+	}
+	return parseIPVSIPPort(strings.Trim(s[:i], "[]"), s[i+1:])
+}
+
+func parseIPVSIPPort(ip, port string) (ipPort, bool) {
+	var addr net.IP
+	if strings.Contains(ip, ":") {
+		addr = net.ParseIP(ip)
+	} else if b, err := hex.DecodeString(ip); err == nil && len(b) == net.IPv4len {
+		addr = net.IP(b)
+	}
+	p, err := strconv.ParseUint(port, 16, 16)
+	if addr == nil || err != nil {
+		return ipPort{}, false
+	}
+	return ipPort{addr.String(), strconv.FormatUint(p, 10)}, true
+}
+
+// parseKubeServiceChains finds the backends of each service in the
+// output of iptables-save, following kube-proxy's chains from
+// KUBE-SERVICES through KUBE-SVC-* to the DNAT rules in KUBE-SEP-*:
+//
+//	-A KUBE-SERVICES -d 10.96.0.10/32 -p udp -m udp --dport 53 -j KUBE-SVC-TCOU7JCQXEZGVUNU
+//	-A KUBE-SVC-TCOU7JCQXEZGVUNU -m statistic --mode random --probability 0.5 -j KUBE-SEP-Q3HNNZPXUAYYDXW2
+//	-A KUBE-SEP-Q3HNNZPXUAYYDXW2 -p udp -m udp -j DNAT --to-destination 10.32.0.2:53
+func parseKubeServiceChains(output []byte) map[ipPort][]ipPort {
+	var (
+		serviceChains  = map[ipPort]string{}
+		endpointChains = map[string][]string{}
+		destinations   = map[string]ipPort{}
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "-A" {
+			continue
+		}
+		chain, args := fields[1], ruleArgs(fields[2:])
+		switch {
+		case chain == "KUBE-SERVICES" && strings.HasPrefix(args["-j"], "KUBE-SVC-"):
+			ip := strings.TrimSuffix(args["-d"], "/32")
+			if net.ParseIP(ip) != nil && args["--dport"] != "" {
+				serviceChains[ipPort{ip, args["--dport"]}] = args["-j"]
+			}
+		case strings.HasPrefix(chain, "KUBE-SVC-") && strings.HasPrefix(args["-j"], "KUBE-SEP-"):
+			endpointChains[chain] = append(endpointChains[chain], args["-j"])
+		case strings.HasPrefix(chain, "KUBE-SEP-") && args["-j"] == "DNAT":
+			if host, port, err := net.SplitHostPort(args["--to-destination"]); err == nil {
+				destinations[chain] = ipPort{host, port}
+			}
+		}
+	}
+
+	services := map[ipPort][]ipPort{}
+	for service, chain := range serviceChains {
+		for _, endpointChain := range endpointChains[chain] {
+			if backend, ok := destinations[endpointChain]; ok {
+				services[service] = append(services[service], backend)
+			}
+		}
+	}
+	return services
+}
+
+// ruleArgs collects the options of an iptables rule which take a value.
+func ruleArgs(fields []string) map[string]string {
+	args := map[string]string{}
+	for i := 0; i+1 < len(fields); i++ {
+		if strings.HasPrefix(fields[i], "-") && !strings.HasPrefix(fields[i+1], "-") {
+			args[fields[i]] = fields[i+1]
+			i++
+		}
+	}
+	return args
+}
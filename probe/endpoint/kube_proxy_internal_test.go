@@ -0,0 +1,157 @@
+// +build linux
+
+package endpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+const (
+	ipvsServices = `IP Virtual Server version 1.2.1 (size=4096)
+Prot LocalAddress:Port Scheduler Flags
+  -> RemoteAddress:Port Forward Weight ActiveConn InActConn
+TCP  0A60000A:0050 rr
+  -> 0A280002:1F90      Masq    1      1          0
+  -> 0A280003:1F90      Masq    1      0          0
+TCP  [fd00:0000:0000:0000:0000:0000:0000:000a]:0050 rr
+  -> [fd00:0000:0000:0000:0000:0000:0000:0002]:1F90      Masq    1      0          0
+UDP  0A600001:0035 rr
+`
+	ipvsConnections = `Pro FromIP   FPrt ToIP     TPrt DestIP   DPrt State       Expires PEName PEData
+TCP 0A200001 9C40 0A60000A 0050 0A280003 1F90 ESTABLISHED    899
+TCP 0A200001 9C41 0A60000A 0050 0A280002 1F90 TIME_WAIT       59
+`
+	iptablesSave = `# Generated by iptables-save v1.6.1
+*nat
+:KUBE-SERVICES - [0:0]
+-A KUBE-SERVICES ! -s 10.32.0.0/12 -d 10.96.0.20/32 -p tcp -m comment --comment "default/web: cluster IP" -m tcp --dport 80 -j KUBE-MARK-MASQ
+-A KUBE-SERVICES -d 10.96.0.20/32 -p tcp -m comment --comment "default/web: cluster IP" -m tcp --dport 80 -j KUBE-SVC-WEB
+-A KUBE-SERVICES -d 10.96.0.30/32 -p tcp -m comment --comment "default/db: cluster IP" -m tcp --dport 5432 -j KUBE-SVC-DB
+-A KUBE-SVC-WEB -m statistic --mode random --probability 0.50000000000 -j KUBE-SEP-WEB1
+-A KUBE-SVC-WEB -j KUBE-SEP-WEB2
+-A KUBE-SVC-DB -j KUBE-SEP-DB1
+-A KUBE-SEP-WEB1 -s 10.40.0.2/32 -j KUBE-MARK-MASQ
+-A KUBE-SEP-WEB1 -p tcp -m tcp -j DNAT --to-destination 10.40.0.2:8080
+-A KUBE-SEP-WEB2 -p tcp -m tcp -j DNAT --to-destination 10.40.0.3:8080
+-A KUBE-SEP-DB1 -p tcp -m comment --comment "default/db:" -m tcp -j DNAT --to-destination 10.40.0.4:5432
+COMMIT
+`
+)
+
+func writeProcFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "kube-proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReadIPVS(t *testing.T) {
+	procRoot := writeProcFiles(t, map[string]string{
+		ipvsServicesPath:    ipvsServices,
+		ipvsConnectionsPath: ipvsConnections,
+	})
+	defer os.RemoveAll(procRoot)
+
+	services, err := readIPVSServices(filepath.Join(procRoot, ipvsServicesPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantServices := map[ipPort][]ipPort{
+		{"10.96.0.10", "80"}: {{"10.40.0.2", "8080"}, {"10.40.0.3", "8080"}},
+		{"fd00::a", "80"}:    {{"fd00::2", "8080"}},
+		{"10.96.0.1", "53"}:  nil,
+	}
+	if !reflect.DeepEqual(wantServices, services) {
+		t.Error(test.Diff(wantServices, services))
+	}
+
+	conns, err := readIPVSConnections(filepath.Join(procRoot, ipvsConnectionsPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantConns := []serviceConnection{
+		{client: ipPort{"10.32.0.1", "40000"}, service: ipPort{"10.96.0.10", "80"}, backend: ipPort{"10.40.0.3", "8080"}},
+	}
+	if !reflect.DeepEqual(wantConns, conns) {
+		t.Error(test.Diff(wantConns, conns))
+	}
+}
+
+func TestParseKubeServiceChains(t *testing.T) {
+	want := map[ipPort][]ipPort{
+		{"10.96.0.20", "80"}:   {{"10.40.0.2", "8080"}, {"10.40.0.3", "8080"}},
+		{"10.96.0.30", "5432"}: {{"10.40.0.4", "5432"}},
+	}
+	if have := parseKubeServiceChains([]byte(iptablesSave)); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestKubeProxyNAT(t *testing.T) {
+	procRoot := writeProcFiles(t, map[string]string{ipvsConnectionsPath: ipvsConnections})
+	defer os.RemoveAll(procRoot)
+	k := &kubeProxyTables{
+		procRoot:     procRoot,
+		iptablesSave: func() ([]byte, error) { return []byte(iptablesSave), nil },
+	}
+	k.readServices()
+
+	endpointID := func(ip, port string) string { return report.MakeEndpointNodeID("host1", "", ip, port) }
+	md := report.EdgeMetadata{MaxConnCount: 1}
+	have := report.MakeReport()
+	// IPVS knows which backend this connection went to
+	have.Endpoint.AddNode(report.MakeNode(endpointID("10.32.0.1", "40000")).WithEdge(endpointID("10.96.0.10", "80"), md))
+	// This service only has one backend
+	have.Endpoint.AddNode(report.MakeNode(endpointID("10.32.0.1", "40001")).WithEdge(endpointID("10.96.0.30", "5432"), md))
+	// This one has two, so we can't tell without conntrack
+	have.Endpoint.AddNode(report.MakeNode(endpointID("10.32.0.1", "40002")).WithEdge(endpointID("10.96.0.20", "80"), md))
+	// which knows where this connection to it went
+	have.Endpoint.AddNode(report.MakeNode(endpointID("10.32.0.1", "40003")).WithEdge(endpointID("10.96.0.20", "80"), md))
+	k.applyNAT(have, "host1", map[clientService]ipPort{
+		{ipPort{"10.32.0.1", "40003"}, ipPort{"10.96.0.20", "80"}}: {"10.40.0.2", "8080"},
+	})
+
+	for client, backend := range map[string]string{
+		endpointID("10.32.0.1", "40000"): endpointID("10.40.0.3", "8080"),
+		endpointID("10.32.0.1", "40001"): endpointID("10.40.0.4", "5432"),
+		endpointID("10.32.0.1", "40002"): endpointID("10.96.0.20", "80"),
+		endpointID("10.32.0.1", "40003"): endpointID("10.40.0.2", "8080"),
+	} {
+		want := report.MakeIDList(backend)
+		if adjacency := have.Endpoint.Nodes[client].Adjacency; !reflect.DeepEqual(want, adjacency) {
+			t.Errorf("%s: %s", client, test.Diff(want, adjacency))
+		}
+	}
+	for _, backend := range []string{endpointID("10.40.0.3", "8080"), endpointID("10.40.0.4", "5432")} {
+		if _, ok := have.Endpoint.Nodes[backend]; !ok {
+			t.Errorf("Missing backend %s", backend)
+		}
+	}
+}
+
+func TestKubeProxyWithoutIPTables(t *testing.T) {
+	procRoot := writeProcFiles(t, map[string]string{})
+	defer os.RemoveAll(procRoot)
+	k := &kubeProxyTables{procRoot: procRoot}
+	k.readServices()
+	if len(k.services) != 0 {
+		t.Errorf("Expected no services without IPVS or iptables, got %v", k.services)
+	}
+}
@@ -6,8 +6,7 @@ import (
 	"net"
 	"strconv"
 
-	"github.com/typetypetype/conntrack"
-
+	"github.com/weaveworks/scope/probe/endpoint/conntrack"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -24,10 +23,19 @@ type endpointMapping struct {
 // natMapper rewrites a report to deal with NAT'd connections.
 type natMapper struct {
 	flowWalker
+	udp       *UDPConfig
+	kubeProxy *kubeProxyTables // nil to not resolve Kubernetes service IPs
+}
+
+func makeNATMapper(fw flowWalker, udp *UDPConfig) natMapper {
+	return natMapper{flowWalker: fw, udp: udp}
 }
 
-func makeNATMapper(fw flowWalker) natMapper {
-	return natMapper{fw}
+func (n natMapper) stop() {
+	n.flowWalker.stop()
+	if n.kubeProxy != nil {
+		n.kubeProxy.stop()
+	}
 }
 
 func toMapping(f conntrack.Conn) *endpointMapping {
@@ -52,23 +60,77 @@ func toMapping(f conntrack.Conn) *endpointMapping {
 }
 
 // applyNAT duplicates Nodes in the endpoint topology of a report, based on
-// the NAT table.
+// the NAT table. Connections to a destination which was NAT'd to an
+// endpoint on another host, such as a Kubernetes service IP, are pointed
+// at that endpoint instead.
 func (n natMapper) applyNAT(rpt report.Report, scope string) {
+	dnat := map[clientService]ipPort{} // for kube-proxy's services
 	n.flowWalker.walkFlows(func(f conntrack.Conn, _ bool) {
 		mapping := toMapping(f)
+		if n.kubeProxy != nil && f.Orig.Proto != udpProto && f.Orig.Src.Equal(f.Reply.Dst) {
+			dnat[clientService{
+				client:  ipPort{f.Orig.Src.String(), strconv.Itoa(int(f.Orig.SrcPort))},
+				service: ipPort{f.Orig.Dst.String(), strconv.Itoa(int(f.Orig.DstPort))},
+			}] = ipPort{f.Reply.Src.String(), strconv.Itoa(int(f.Reply.SrcPort))}
+		}
+		if f.Orig.Proto == udpProto && n.udp != nil && n.udp.Aggregate && !f.Orig.Src.Equal(f.Reply.Dst) {
+			// The client of a SNAT'd flow was reported without its port
+			mapping.originalPort, mapping.rewrittenPort = 0, 0
+		}
 
 		realEndpointPort := strconv.Itoa(int(mapping.originalPort))
 		copyEndpointPort := strconv.Itoa(int(mapping.rewrittenPort))
-		realEndpointID := report.MakeEndpointNodeID(scope, "", mapping.originalIP.String(), realEndpointPort)
-		copyEndpointID := report.MakeEndpointNodeID(scope, "", mapping.rewrittenIP.String(), copyEndpointPort)
+		makeEndpointNodeID := report.MakeEndpointNodeID
+		if f.Orig.Proto == udpProto {
+			makeEndpointNodeID = report.MakeUDPEndpointNodeID
+		}
+		realEndpointID := makeEndpointNodeID(scope, "", mapping.originalIP.String(), realEndpointPort)
+		copyEndpointID := makeEndpointNodeID(scope, "", mapping.rewrittenIP.String(), copyEndpointPort)
 
 		node, ok := rpt.Endpoint.Nodes[realEndpointID]
 		if !ok {
+			if f.Orig.Src.Equal(f.Reply.Dst) {
+				clientID := makeEndpointNodeID(scope, "", f.Orig.Src.String(), strconv.Itoa(int(f.Orig.SrcPort)))
+				redirectEdge(rpt, clientID, copyEndpointID, realEndpointID)
+			}
 			return
 		}
+		addCopy(rpt, node, copyEndpointID)
+	})
+	if n.kubeProxy != nil {
+		n.kubeProxy.applyNAT(rpt, scope, dnat)
+	}
+}
 
-		rpt.Endpoint.AddNode(node.WithID(copyEndpointID).WithLatests(map[string]string{
-			CopyOf: realEndpointID,
-		}))
+// addCopy adds a copy of an endpoint under the ID it was NAT'd to.
+func addCopy(rpt report.Report, node report.Node, copyEndpointID string) {
+	// The traffic on the copy's edges is already accounted for
+	// on the real endpoint.
+	copyNode := node.WithID(copyEndpointID).WithLatests(map[string]string{
+		CopyOf: node.ID,
 	})
+	copyNode.Edges = report.MakeEdgeMetadatas()
+	rpt.Endpoint.AddNode(copyNode)
+}
+
+// redirectEdge moves the edge from a client endpoint to the destination
+// it connected to over to the endpoint the destination was NAT'd to.
+// It returns false if the client has no such edge.
+func redirectEdge(rpt report.Report, clientID, natID, realID string) bool {
+	node, ok := rpt.Endpoint.Nodes[clientID]
+	if !ok || !node.Adjacency.Contains(natID) {
+		return false
+	}
+	md, _ := node.Edges.Lookup(natID)
+	adjacency := report.MakeIDList()
+	for _, id := range node.Adjacency {
+		if id != natID {
+			adjacency = adjacency.Add(id)
+		}
+	}
+	node.Adjacency = adjacency
+	node.Edges = node.Edges.Delete(natID)
+	rpt.Endpoint.Nodes[clientID] = node.WithEdge(realID, md)
+	rpt.Endpoint.AddNode(report.MakeNode(realID))
+	return true
 }
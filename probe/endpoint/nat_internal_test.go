@@ -7,10 +7,9 @@ import (
 	"syscall"
 	"testing"
 
-	"github.com/typetypetype/conntrack"
-
 	"github.com/weaveworks/common/mtime"
 	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/probe/endpoint/conntrack"
 	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test/reflect"
 )
@@ -81,7 +80,7 @@ func TestNat(t *testing.T) {
 			"foo":  "bar",
 		}))
 
-		makeNATMapper(ct).applyNAT(have, "host1")
+		makeNATMapper(ct, nil).applyNAT(have, "host1")
 		if !reflect.DeepEqual(want, have) {
 			t.Fatal(test.Diff(want, have))
 		}
@@ -123,9 +122,55 @@ func TestNat(t *testing.T) {
 			"foo":  "baz",
 		}))
 
-		makeNATMapper(ct).applyNAT(have, "host1")
+		makeNATMapper(ct, nil).applyNAT(have, "host1")
 		if !reflect.DeepEqual(want, have) {
 			t.Fatal(test.Diff(want, have))
 		}
 	}
 }
+
+func TestNatRemoteBackend(t *testing.T) {
+	mtime.NowForce(mtime.Now())
+	defer mtime.NowReset()
+
+	// pod1 (10.32.0.1:40000) connects to the service IP 10.96.0.10:80,
+	// which is DNAT'd to pod2 (10.40.0.2:8080) on another host.
+	f := conntrack.Conn{
+		MsgType: conntrack.NfctMsgUpdate,
+		Orig: conntrack.Tuple{
+			Src:     net.ParseIP("10.32.0.1"),
+			Dst:     net.ParseIP("10.96.0.10"),
+			SrcPort: 40000,
+			DstPort: 80,
+			Proto:   syscall.IPPROTO_TCP,
+		},
+		Reply: conntrack.Tuple{
+			Src:     net.ParseIP("10.40.0.2"),
+			Dst:     net.ParseIP("10.32.0.1"),
+			SrcPort: 8080,
+			DstPort: 40000,
+			Proto:   syscall.IPPROTO_TCP,
+		},
+		CtId: 3,
+	}
+	var (
+		clientID  = report.MakeEndpointNodeID("host1", "", "10.32.0.1", "40000")
+		serviceID = report.MakeEndpointNodeID("host1", "", "10.96.0.10", "80")
+		backendID = report.MakeEndpointNodeID("host1", "", "10.40.0.2", "8080")
+		md        = report.EdgeMetadata{MaxConnCount: 1}
+	)
+	have := report.MakeReport()
+	have.Endpoint.AddNode(report.MakeNodeWith(clientID, map[string]string{"pid": "42"}).WithEdge(serviceID, md))
+	have.Endpoint.AddNode(report.MakeNode(serviceID))
+
+	want := report.MakeReport()
+	want.ID = have.ID
+	want.Endpoint.AddNode(report.MakeNodeWith(clientID, map[string]string{"pid": "42"}).WithEdge(backendID, md))
+	want.Endpoint.AddNode(report.MakeNode(serviceID))
+	want.Endpoint.AddNode(report.MakeNode(backendID))
+
+	makeNATMapper(&mockFlowWalker{flows: []conntrack.Conn{f}}, nil).applyNAT(have, "host1")
+	if !reflect.DeepEqual(want, have) {
+		t.Fatal(test.Diff(want, have))
+	}
+}
@@ -14,8 +14,12 @@ const (
 	ReverseDNSNames = report.ReverseDNSNames
 	SnoopedDNSNames = report.SnoopedDNSNames
 	CopyOf          = report.CopyOf
+	Protocol        = report.Protocol // only set on UDP endpoints
 )
 
+// UDP is the Protocol of UDP endpoints.
+const UDP = "udp"
+
 // ReporterConfig are the config options for the endpoint reporter.
 type ReporterConfig struct {
 	HostID       string
@@ -26,9 +30,15 @@ type ReporterConfig struct {
 	UseEbpfConn  bool
 	ProcRoot     string
 	BufferSize   int
+	UDP          *UDPConfig // nil to not track UDP
 	ProcessCache *process.CachingWalker
 	Scanner      procspy.ConnectionScanner
 	DNSSnooper   *DNSSnooper
+	KubeProxy    bool // Resolve Kubernetes service IPs from kube-proxy's IPVS or iptables state
+
+	// KubeProxyIPTables is whether to read kube-proxy's iptables state,
+	// which means running iptables-save, when it is not in IPVS mode.
+	KubeProxyIPTables bool
 }
 
 // SpyDuration is an exported prometheus metric
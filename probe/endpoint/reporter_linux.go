@@ -21,10 +21,14 @@ type Reporter struct {
 // is stored in the Endpoint topology. It optionally enriches that topology
 // with process (PID) information.
 func NewReporter(conf ReporterConfig) *Reporter {
+	natMapper := makeNATMapper(newConntrackFlowWalker(conf.UseConntrack, conf.ProcRoot, conf.BufferSize, flowFilter{natOnly: true, udp: conf.UDP}), conf.UDP)
+	if conf.KubeProxy {
+		natMapper.kubeProxy = newKubeProxyTables(conf.ProcRoot, conf.KubeProxyIPTables)
+	}
 	return &Reporter{
 		conf:              conf,
 		connectionTracker: newConnectionTracker(conf),
-		natMapper:         makeNATMapper(newConntrackFlowWalker(conf.UseConntrack, conf.ProcRoot, conf.BufferSize, true /* natOnly */)),
+		natMapper:         natMapper,
 	}
 }
 
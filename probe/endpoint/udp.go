@@ -0,0 +1,102 @@
+package endpoint
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// UDPConfig turns on tracking of UDP flows, which is otherwise left out:
+// there is too much UDP traffic going on (every container talking to DNS,
+// for example) to render nicely unless it is narrowed down. UDP flows are
+// only read from conntrack; the eBPF tracker only instruments TCP.
+type UDPConfig struct {
+	// Ports restricts tracking to flows to one of these ports; empty
+	// means any port.
+	Ports []uint16
+
+	// Peers restricts tracking to flows to or from one of these networks;
+	// empty means anywhere.
+	Peers []*net.IPNet
+
+	// Aggregate folds all of a client's flows to the same server, from
+	// whatever ephemeral ports, into a single edge.
+	Aggregate bool
+}
+
+// NewUDPConfig makes a UDPConfig from comma-separated lists of ports and
+// CIDRs.
+func NewUDPConfig(ports, peers string, aggregate bool) (*UDPConfig, error) {
+	config := &UDPConfig{Aggregate: aggregate}
+	for _, port := range splitList(ports) {
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UDP port %q: %v", port, err)
+		}
+		config.Ports = append(config.Ports, uint16(p))
+	}
+	for _, peer := range splitList(peers) {
+		_, ipNet, err := net.ParseCIDR(peer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UDP peer network %q: %v", peer, err)
+		}
+		config.Peers = append(config.Peers, ipNet)
+	}
+	return config, nil
+}
+
+func splitList(list string) []string {
+	result := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// tracks returns whether the UDP flow is to be tracked.
+func (c *UDPConfig) tracks(t fourTuple) bool {
+	if c == nil {
+		return false
+	}
+	if len(c.Ports) > 0 && !containsPort(c.Ports, t.toPort) {
+		return false
+	}
+	if len(c.Peers) > 0 && !inNetworks(c.Peers, t.fromAddr) && !inNetworks(c.Peers, t.toAddr) {
+		return false
+	}
+	return true
+}
+
+// fold returns the tuple of a UDP flow as reported, which is without the
+// client's port when aggregating.
+func (c *UDPConfig) fold(t fourTuple) fourTuple {
+	if c != nil && c.Aggregate {
+		t.fromPort = 0
+	}
+	return t
+}
+
+func containsPort(ports []uint16, port uint16) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+func inNetworks(networks []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package endpoint
+
+import (
+	"testing"
+)
+
+func TestUDPConfig(t *testing.T) {
+	if _, err := NewUDPConfig("53,dns", "", false); err == nil {
+		t.Error("Expected invalid port to be rejected")
+	}
+	if _, err := NewUDPConfig("", "10.0.0.1", false); err == nil {
+		t.Error("Expected invalid network to be rejected")
+	}
+
+	c, err := NewUDPConfig(" 53, 5353 ", "10.96.0.0/12", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		tuple fourTuple
+		want  bool
+	}{
+		{fourTuple{"10.32.0.5", "10.96.0.10", 41000, 53}, true},
+		{fourTuple{"10.96.0.10", "10.32.0.5", 41000, 5353}, true},
+		{fourTuple{"10.32.0.5", "10.96.0.10", 41000, 8125}, false},
+		{fourTuple{"10.32.0.5", "8.8.8.8", 41000, 53}, false},
+	} {
+		if have := c.tracks(tc.tuple); have != tc.want {
+			t.Errorf("%s: want %v, have %v", tc.tuple, tc.want, have)
+		}
+	}
+
+	var none *UDPConfig
+	if none.tracks(fourTuple{"10.32.0.5", "10.96.0.10", 41000, 53}) {
+		t.Error("Expected no UDP flows to be tracked without configuration")
+	}
+
+	tuple := fourTuple{"10.32.0.5", "10.96.0.10", 41000, 53}
+	if have := c.fold(tuple); have != tuple {
+		t.Errorf("Expected %s unchanged, got %s", tuple, have)
+	}
+	c.Aggregate = true
+	if want, have := (fourTuple{"10.32.0.5", "10.96.0.10", 0, 53}), c.fold(tuple); have != want {
+		t.Errorf("want %s, have %s", want, have)
+	}
+}
@@ -0,0 +1,261 @@
+package host
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node.Metrics, and prefixes of the device tables.
+const (
+	DiskReadBytes   = "host_disk_read_bytes_per_second"
+	DiskWriteBytes  = "host_disk_write_bytes_per_second"
+	FilesystemUsage = "host_filesystem_usage_percent"
+	NetworkRxBytes  = "host_network_rx_bytes_per_second"
+	NetworkTxBytes  = "host_network_tx_bytes_per_second"
+
+	DisksTablePrefix       = "host_disks_table_"
+	FilesystemsTablePrefix = "host_filesystems_table_"
+	InterfacesTablePrefix  = "host_interfaces_table_"
+)
+
+// Columns of the device tables.
+const (
+	DiskDevice      = "host_disk_device"
+	DiskReadRate    = "host_disk_read_rate"
+	DiskWriteRate   = "host_disk_write_rate"
+	DiskReadOps     = "host_disk_read_ops"
+	DiskWriteOps    = "host_disk_write_ops"
+	FilesystemMount = "host_filesystem_mount"
+	FilesystemDev   = "host_filesystem_device"
+	FilesystemType  = "host_filesystem_type"
+	FilesystemSize  = "host_filesystem_size"
+	FilesystemUsed  = "host_filesystem_used"
+	FilesystemUse   = "host_filesystem_use"
+	InterfaceName   = "host_interface_name"
+	InterfaceRx     = "host_interface_rx_rate"
+	InterfaceTx     = "host_interface_tx_rate"
+	InterfaceRxPkts = "host_interface_rx_packets"
+	InterfaceTxPkts = "host_interface_tx_packets"
+	InterfaceRxErrs = "host_interface_rx_errors"
+	InterfaceTxErrs = "host_interface_tx_errors"
+)
+
+// Exposed for testing.
+var (
+	TableTemplates = report.TableTemplates{
+		DisksTablePrefix: {
+			ID:     DisksTablePrefix,
+			Label:  "Disks",
+			Type:   report.MulticolumnTableType,
+			Prefix: DisksTablePrefix,
+			Columns: []report.Column{
+				{ID: DiskDevice, Label: "Device"},
+				{ID: DiskReadRate, Label: "Read bytes/s", DataType: report.Number},
+				{ID: DiskWriteRate, Label: "Write bytes/s", DataType: report.Number},
+				{ID: DiskReadOps, Label: "Reads/s", DataType: report.Number},
+				{ID: DiskWriteOps, Label: "Writes/s", DataType: report.Number},
+			},
+		},
+		FilesystemsTablePrefix: {
+			ID:     FilesystemsTablePrefix,
+			Label:  "Filesystems",
+			Type:   report.MulticolumnTableType,
+			Prefix: FilesystemsTablePrefix,
+			Columns: []report.Column{
+				{ID: FilesystemMount, Label: "Mount"},
+				{ID: FilesystemDev, Label: "Device"},
+				{ID: FilesystemType, Label: "Type"},
+				{ID: FilesystemSize, Label: "Size"},
+				{ID: FilesystemUsed, Label: "Used"},
+				{ID: FilesystemUse, Label: "Use %", DataType: report.Number},
+			},
+		},
+		InterfacesTablePrefix: {
+			ID:     InterfacesTablePrefix,
+			Label:  "Network interfaces",
+			Type:   report.MulticolumnTableType,
+			Prefix: InterfacesTablePrefix,
+			Columns: []report.Column{
+				{ID: InterfaceName, Label: "Interface"},
+				{ID: InterfaceRx, Label: "Rx bytes/s", DataType: report.Number},
+				{ID: InterfaceTx, Label: "Tx bytes/s", DataType: report.Number},
+				{ID: InterfaceRxPkts, Label: "Rx packets/s", DataType: report.Number},
+				{ID: InterfaceTxPkts, Label: "Tx packets/s", DataType: report.Number},
+				{ID: InterfaceRxErrs, Label: "Rx errors/s", DataType: report.Number},
+				{ID: InterfaceTxErrs, Label: "Tx errors/s", DataType: report.Number},
+			},
+		},
+	}
+)
+
+// DiskStats are the cumulative IO counters of a block device.
+type DiskStats struct {
+	ReadBytes, WriteBytes uint64
+	Reads, Writes         uint64
+}
+
+// InterfaceStats are the cumulative counters of a network interface.
+// Physical interfaces are backed by a device; only their traffic counts
+// towards the host's, as the traffic of bridges, veths and tunnels is also
+// seen on them, or stays on the host.
+type InterfaceStats struct {
+	RxBytes, RxPackets, RxErrors uint64
+	TxBytes, TxPackets, TxErrors uint64
+	Physical                     bool
+}
+
+// Filesystem is the capacity and usage of a mounted filesystem, in bytes.
+type Filesystem struct {
+	Mount, Device, Type string
+	Size, Used, Avail   uint64
+}
+
+// UsagePercent is how full the filesystem is, as df counts it: blocks
+// reserved for root are neither used nor available.
+func (f Filesystem) UsagePercent() float64 {
+	if f.Used+f.Avail == 0 {
+		return 0
+	}
+	return float64(f.Used) * 100 / float64(f.Used+f.Avail)
+}
+
+// deviceCounters remembers the counters of the last report, to turn them
+// into rates.
+type deviceCounters struct {
+	sync.Mutex
+	time       time.Time
+	disks      map[string]DiskStats
+	interfaces map[string]InterfaceStats
+}
+
+// rate is the change per second between two samples of a counter, if it
+// hasn't been reset.
+func rate(current, previous uint64, seconds float64) (float64, bool) {
+	if current < previous || seconds <= 0 {
+		return 0, false
+	}
+	return float64(current-previous) / seconds, true
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 1, 64)
+}
+
+// addDeviceMetrics adds the device metrics of the host to metrics, and
+// returns the rows of its device tables.
+func (c *deviceCounters) addDeviceMetrics(procRoot string, now time.Time, metrics report.Metrics) (disks, filesystems, interfaces []report.Row) {
+	diskStats, _ := GetDiskStats(procRoot)
+	interfaceStats, _ := GetInterfaceStats(procRoot)
+	mounted, _ := GetFilesystems(procRoot)
+
+	c.Lock()
+	seconds := now.Sub(c.time).Seconds()
+	previousDisks, previousInterfaces := c.disks, c.interfaces
+	c.time, c.disks, c.interfaces = now, diskStats, interfaceStats
+	c.Unlock()
+
+	if previousDisks != nil {
+		var read, written float64
+		for device, stats := range diskStats {
+			previous, ok := previousDisks[device]
+			if !ok {
+				continue
+			}
+			readRate, ok1 := rate(stats.ReadBytes, previous.ReadBytes, seconds)
+			writeRate, ok2 := rate(stats.WriteBytes, previous.WriteBytes, seconds)
+			reads, ok3 := rate(stats.Reads, previous.Reads, seconds)
+			writes, ok4 := rate(stats.Writes, previous.Writes, seconds)
+			if !ok1 || !ok2 || !ok3 || !ok4 {
+				continue
+			}
+			read += readRate
+			written += writeRate
+			disks = append(disks, report.Row{
+				ID: device,
+				Entries: map[string]string{
+					DiskDevice:    device,
+					DiskReadRate:  formatFloat(readRate),
+					DiskWriteRate: formatFloat(writeRate),
+					DiskReadOps:   formatFloat(reads),
+					DiskWriteOps:  formatFloat(writes),
+				},
+			})
+		}
+		if len(diskStats) > 0 {
+			metrics[DiskReadBytes] = report.MakeSingletonMetric(now, read)
+			metrics[DiskWriteBytes] = report.MakeSingletonMetric(now, written)
+		}
+	}
+
+	if previousInterfaces != nil {
+		var (
+			rx, tx   float64
+			physical bool
+		)
+		for name, stats := range interfaceStats {
+			previous, ok := previousInterfaces[name]
+			if !ok {
+				continue
+			}
+			rxRate, ok1 := rate(stats.RxBytes, previous.RxBytes, seconds)
+			txRate, ok2 := rate(stats.TxBytes, previous.TxBytes, seconds)
+			rxPackets, ok3 := rate(stats.RxPackets, previous.RxPackets, seconds)
+			txPackets, ok4 := rate(stats.TxPackets, previous.TxPackets, seconds)
+			rxErrors, ok5 := rate(stats.RxErrors, previous.RxErrors, seconds)
+			txErrors, ok6 := rate(stats.TxErrors, previous.TxErrors, seconds)
+			if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 || !ok6 {
+				continue
+			}
+			if stats.Physical {
+				rx += rxRate
+				tx += txRate
+				physical = true
+			}
+			interfaces = append(interfaces, report.Row{
+				ID: name,
+				Entries: map[string]string{
+					InterfaceName:   name,
+					InterfaceRx:     formatFloat(rxRate),
+					InterfaceTx:     formatFloat(txRate),
+					InterfaceRxPkts: formatFloat(rxPackets),
+					InterfaceTxPkts: formatFloat(txPackets),
+					InterfaceRxErrs: formatFloat(rxErrors),
+					InterfaceTxErrs: formatFloat(txErrors),
+				},
+			})
+		}
+		if physical {
+			metrics[NetworkRxBytes] = report.MakeSingletonMetric(now, rx)
+			metrics[NetworkTxBytes] = report.MakeSingletonMetric(now, tx)
+		}
+	}
+
+	// The fullest filesystem is the one which matters.
+	fullest := -1.0
+	for _, fs := range mounted {
+		usage := fs.UsagePercent()
+		if usage > fullest {
+			fullest = usage
+		}
+		filesystems = append(filesystems, report.Row{
+			ID: fs.Mount,
+			Entries: map[string]string{
+				FilesystemMount: fs.Mount,
+				FilesystemDev:   fs.Device,
+				FilesystemType:  fs.Type,
+				FilesystemSize:  humanize.Bytes(fs.Size),
+				FilesystemUsed:  humanize.Bytes(fs.Used),
+				FilesystemUse:   formatFloat(usage),
+			},
+		})
+	}
+	if fullest >= 0 {
+		metrics[FilesystemUsage] = report.MakeSingletonMetric(now, fullest).WithMax(100)
+	}
+	return disks, filesystems, interfaces
+}
@@ -0,0 +1,16 @@
+package host
+
+// GetDiskStats returns the IO counters of the host's disks.
+var GetDiskStats = func(procRoot string) (map[string]DiskStats, error) {
+	return nil, nil
+}
+
+// GetInterfaceStats returns the counters of the host's network interfaces.
+var GetInterfaceStats = func(procRoot string) (map[string]InterfaceStats, error) {
+	return nil, nil
+}
+
+// GetFilesystems returns the capacity and usage of the host's filesystems.
+var GetFilesystems = func(procRoot string) ([]Filesystem, error) {
+	return nil, nil
+}
@@ -0,0 +1,217 @@
+package host
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Paths of the files devices are read from, relative to the proc root.
+const (
+	ProcDiskStats = "diskstats"
+	ProcNetDev    = "net/dev"
+	// The mounts of PID 1 are the host's, even when the probe is
+	// containerised; its root is how we get to them.
+	ProcMounts   = "1/mounts"
+	ProcHostRoot = "1/root"
+	// Network interfaces, relative to the host's root. Those with a
+	// device are physical.
+	SysClassNet = "sys/class/net"
+)
+
+const sectorSize = 512
+
+// Block devices which are virtual, or double count IO of other devices.
+var ignoredDiskPrefixes = []string{"loop", "ram", "dm-", "zram", "sr", "fd"}
+
+// GetDiskStats returns the IO counters of the host's disks, from
+// /proc/diskstats. Partitions are left out, as they double count the IO
+// of their disks.
+var GetDiskStats = func(procRoot string) (map[string]DiskStats, error) {
+	f, err := os.Open(filepath.Join(procRoot, ProcDiskStats))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// major minor name reads merged sectors-read ms writes merged sectors-written ...
+	disks := map[string]DiskStats{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || ignoredDisk(fields[2]) {
+			continue
+		}
+		var counters [4]uint64
+		for i, field := range []string{fields[3], fields[5], fields[7], fields[9]} {
+			if counters[i], err = strconv.ParseUint(field, 10, 64); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			continue
+		}
+		disks[fields[2]] = DiskStats{
+			Reads:      counters[0],
+			ReadBytes:  counters[1] * sectorSize,
+			Writes:     counters[2],
+			WriteBytes: counters[3] * sectorSize,
+		}
+	}
+	for name := range disks {
+		if isPartition(name, disks) {
+			delete(disks, name)
+		}
+	}
+	return disks, scanner.Err()
+}
+
+func ignoredDisk(name string) bool {
+	for _, prefix := range ignoredDiskPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPartition says whether a device is a partition of another, by its
+// name, e.g. sda1 of sda and nvme0n1p1 of nvme0n1.
+func isPartition(name string, disks map[string]DiskStats) bool {
+	for disk := range disks {
+		if disk == name || !strings.HasPrefix(name, disk) {
+			continue
+		}
+		number := name[len(disk):]
+		if last := disk[len(disk)-1]; '0' <= last && last <= '9' {
+			if !strings.HasPrefix(number, "p") {
+				continue
+			}
+			number = number[1:]
+		}
+		if _, err := strconv.Atoi(number); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// GetInterfaceStats returns the counters of the host's network interfaces,
+// other than loopback, from /proc/net/dev, and whether they are physical
+// from /sys/class/net.
+var GetInterfaceStats = func(procRoot string) (map[string]InterfaceStats, error) {
+	f, err := os.Open(filepath.Join(procRoot, ProcNetDev))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Inter-|   Receive                                                |  Transmit
+	//  face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs ...
+	//   eth0: 1234 ...
+	interfaces := map[string]InterfaceStats{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		name := strings.TrimSpace(line[:colon])
+		fields := strings.Fields(line[colon+1:])
+		if name == "lo" || len(fields) < 16 {
+			continue
+		}
+		var counters [16]uint64
+		for i := range counters {
+			if counters[i], err = strconv.ParseUint(fields[i], 10, 64); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			continue
+		}
+		interfaces[name] = InterfaceStats{
+			RxBytes:   counters[0],
+			RxPackets: counters[1],
+			RxErrors:  counters[2],
+			TxBytes:   counters[8],
+			TxPackets: counters[9],
+			TxErrors:  counters[10],
+			Physical:  isPhysical(procRoot, name),
+		}
+	}
+	return interfaces, scanner.Err()
+}
+
+func isPhysical(procRoot, name string) bool {
+	_, err := os.Stat(filepath.Join(procRoot, ProcHostRoot, SysClassNet, name, "device"))
+	return err == nil
+}
+
+// GetFilesystems returns the capacity and usage of the host's filesystems
+// on block devices, from the mounts of PID 1. Each device is only counted
+// once, at the first place it is mounted.
+var GetFilesystems = func(procRoot string) ([]Filesystem, error) {
+	f, err := os.Open(filepath.Join(procRoot, ProcMounts))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		filesystems []Filesystem
+		seen        = map[string]struct{}{}
+		scanner     = bufio.NewScanner(f)
+	)
+	for scanner.Scan() {
+		// device mountpoint type options dump pass
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+		device, mount := unescapeMount(fields[0]), unescapeMount(fields[1])
+		if _, ok := seen[device]; ok {
+			continue
+		}
+		var stat unix.Statfs_t
+		if err := unix.Statfs(filepath.Join(procRoot, ProcHostRoot, mount), &stat); err != nil {
+			continue
+		}
+		seen[device] = struct{}{}
+		blockSize := uint64(stat.Bsize)
+		filesystems = append(filesystems, Filesystem{
+			Mount:  mount,
+			Device: device,
+			Type:   fields[2],
+			Size:   stat.Blocks * blockSize,
+			Used:   (stat.Blocks - stat.Bfree) * blockSize,
+			Avail:  stat.Bavail * blockSize,
+		})
+	}
+	return filesystems, scanner.Err()
+}
+
+// unescapeMount undoes the octal escaping of spaces and other characters
+// in /proc/mounts, e.g. "\040" for a space.
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
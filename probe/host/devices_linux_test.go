@@ -0,0 +1,126 @@
+package host_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+const (
+	diskstats = `   7       0 loop0 52 0 2148 12 0 0 0 0 0 16 12 0 0 0 0
+   8       0 sda 1000 10 2000 400 500 20 4000 800 0 900 1200 0 0 0 0
+   8       1 sda1 990 10 1990 390 500 20 4000 800 0 890 1190 0 0 0 0
+ 259       0 nvme0n1 10 0 80 4 20 0 160 8 0 12 12 0 0 0 0
+ 259       1 nvme0n1p1 10 0 80 4 20 0 160 8 0 12 12 0 0 0 0
+ 253       0 dm-0 900 0 1800 380 480 0 3900 790 0 870 1170 0 0 0 0
+`
+	netDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:   12345     100    0    0    0     0          0         0    12345     100    0    0    0     0       0          0
+  eth0: 1000000    2000    3    0    0     0          0         0   500000    1000    1    0    0     0       0          0
+docker0:    4000      40    0    0    0     0          0         0     3000      30    0    0    0     0       0          0
+`
+	mounts = `/dev/sda1 / ext4 rw,relatime 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+/dev/nvme0n1p1 /mnt/my\040disk xfs rw,relatime 0 0
+/dev/sda1 /var/lib/docker/overlay2 ext4 rw,relatime 0 0
+/dev/sdb1 /gone ext4 rw,relatime 0 0
+`
+)
+
+// makeProcRoot writes a fixture proc filesystem, with the root of PID 1
+// holding the mount points.
+func makeProcRoot(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "host-proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, contents := range map[string]string{
+		host.ProcDiskStats: diskstats,
+		host.ProcNetDev:    netDev,
+		host.ProcMounts:    mounts,
+	} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{
+		filepath.Join("mnt", "my disk"),
+		filepath.Join(host.SysClassNet, "eth0", "device"),
+		filepath.Join(host.SysClassNet, "docker0"),
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, host.ProcHostRoot, path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGetDiskStats(t *testing.T) {
+	procRoot := makeProcRoot(t)
+	defer os.RemoveAll(procRoot)
+
+	have, err := host.GetDiskStats(procRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]host.DiskStats{
+		"sda":     {Reads: 1000, ReadBytes: 2000 * 512, Writes: 500, WriteBytes: 4000 * 512},
+		"nvme0n1": {Reads: 10, ReadBytes: 80 * 512, Writes: 20, WriteBytes: 160 * 512},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestGetInterfaceStats(t *testing.T) {
+	procRoot := makeProcRoot(t)
+	defer os.RemoveAll(procRoot)
+
+	have, err := host.GetInterfaceStats(procRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]host.InterfaceStats{
+		"eth0":    {RxBytes: 1000000, RxPackets: 2000, RxErrors: 3, TxBytes: 500000, TxPackets: 1000, TxErrors: 1, Physical: true},
+		"docker0": {RxBytes: 4000, RxPackets: 40, TxBytes: 3000, TxPackets: 30},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestGetFilesystems(t *testing.T) {
+	procRoot := makeProcRoot(t)
+	defer os.RemoveAll(procRoot)
+
+	have, err := host.GetFilesystems(procRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Bind mounts of a device are left out, as are mounts which aren't there.
+	if len(have) != 2 {
+		t.Fatalf("Expected 2 filesystems, got %+v", have)
+	}
+	for i, want := range []host.Filesystem{
+		{Mount: "/", Device: "/dev/sda1", Type: "ext4"},
+		{Mount: "/mnt/my disk", Device: "/dev/nvme0n1p1", Type: "xfs"},
+	} {
+		fs := have[i]
+		if fs.Mount != want.Mount || fs.Device != want.Device || fs.Type != want.Type {
+			t.Errorf("Expected %+v, got %+v", want, fs)
+		}
+		if fs.Size == 0 || fs.Used > fs.Size || fs.Avail > fs.Size {
+			t.Errorf("Expected the capacity of the fixture's filesystem, got %+v", fs)
+		}
+	}
+}
@@ -49,6 +49,12 @@ var (
 		CPUUsage:    {ID: CPUUsage, Label: "CPU", Format: report.PercentFormat, Priority: 1},
 		MemoryUsage: {ID: MemoryUsage, Label: "Memory", Format: report.FilesizeFormat, Priority: 2},
 		Load1:       {ID: Load1, Label: "Load (1m)", Format: report.DefaultFormat, Group: "load", Priority: 11},
+
+		FilesystemUsage: {ID: FilesystemUsage, Label: "Fullest disk", Format: report.PercentFormat, Priority: 3},
+		DiskReadBytes:   {ID: DiskReadBytes, Label: "Disk read/s", Format: report.FilesizeFormat, Group: "disk", Priority: 4},
+		DiskWriteBytes:  {ID: DiskWriteBytes, Label: "Disk write/s", Format: report.FilesizeFormat, Group: "disk", Priority: 5},
+		NetworkRxBytes:  {ID: NetworkRxBytes, Label: "Network rx/s", Format: report.FilesizeFormat, Group: "network", Priority: 6},
+		NetworkTxBytes:  {ID: NetworkTxBytes, Label: "Network tx/s", Format: report.FilesizeFormat, Group: "network", Priority: 7},
 	}
 )
 
@@ -63,17 +69,21 @@ type Reporter struct {
 	hostShellCmd    []string
 	handlerRegistry *controls.HandlerRegistry
 	pipeIDToTTY     map[string]uintptr
+	procRoot        string
+	devices         deviceCounters
 }
 
 // NewReporter returns a Reporter which produces a report containing host
-// topology for this host.
-func NewReporter(hostID, hostName, probeID, version string, pipes controls.PipeClient, handlerRegistry *controls.HandlerRegistry) *Reporter {
+// topology for this host. Disk, filesystem and network interface metrics
+// are read from the proc filesystem at procRoot.
+func NewReporter(hostID, hostName, probeID, version string, pipes controls.PipeClient, handlerRegistry *controls.HandlerRegistry, procRoot string) *Reporter {
 	r := &Reporter{
 		hostID:          hostID,
 		hostName:        hostName,
 		probeID:         probeID,
 		pipes:           pipes,
 		version:         version,
+		procRoot:        procRoot,
 		hostShellCmd:    getHostShellCmd(),
 		handlerRegistry: handlerRegistry,
 		pipeIDToTTY:     map[string]uintptr{},
@@ -116,6 +126,7 @@ func (r *Reporter) Report() (report.Report, error) {
 
 	rep.Host = rep.Host.WithMetadataTemplates(MetadataTemplates)
 	rep.Host = rep.Host.WithMetricTemplates(MetricTemplates)
+	rep.Host = rep.Host.WithTableTemplates(TableTemplates)
 
 	now := mtime.Now()
 	metrics := GetLoad(now)
@@ -123,6 +134,7 @@ func (r *Reporter) Report() (report.Report, error) {
 	metrics[CPUUsage] = report.MakeSingletonMetric(now, cpuUsage).WithMax(max)
 	memoryUsage, max := GetMemoryUsageBytes()
 	metrics[MemoryUsage] = report.MakeSingletonMetric(now, memoryUsage).WithMax(max)
+	disks, filesystems, interfaces := r.devices.addDeviceMetrics(r.procRoot, now, metrics)
 
 	rep.Host.AddNode(
 		report.MakeNodeWith(report.MakeHostNodeID(r.hostID), map[string]string{
@@ -138,7 +150,10 @@ func (r *Reporter) Report() (report.Report, error) {
 				Add(LocalNetworks, report.MakeStringSet(localCIDRs...)),
 			).
 			WithMetrics(metrics).
-			WithLatestActiveControls(ExecHost),
+			WithLatestActiveControls(ExecHost).
+			AddPrefixMulticolumnTable(DisksTablePrefix, disks).
+			AddPrefixMulticolumnTable(FilesystemsTablePrefix, filesystems).
+			AddPrefixMulticolumnTable(InterfacesTablePrefix, interfaces),
 	)
 
 	rep.Host.Controls.AddControl(report.Control{
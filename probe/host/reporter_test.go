@@ -2,6 +2,7 @@ package host_test
 
 import (
 	"net"
+	"reflect"
 	"runtime"
 	"testing"
 	"time"
@@ -57,7 +58,7 @@ func TestReporter(t *testing.T) {
 	host.GetLocalNetworks = func() ([]*net.IPNet, error) { return []*net.IPNet{ipnet}, nil }
 
 	hr := controls.NewDefaultHandlerRegistry()
-	rpt, err := host.NewReporter(hostID, hostname, "probe-id", "", nil, hr).Report()
+	rpt, err := host.NewReporter(hostID, hostname, "probe-id", "", nil, hr, "").Report()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -101,3 +102,123 @@ func TestReporter(t *testing.T) {
 		}
 	}
 }
+
+func TestReporterDevices(t *testing.T) {
+	start := time.Now()
+	mtime.NowForce(start)
+	defer mtime.NowReset()
+
+	var (
+		oldGetDiskStats      = host.GetDiskStats
+		oldGetInterfaceStats = host.GetInterfaceStats
+		oldGetFilesystems    = host.GetFilesystems
+		disks                = map[string]host.DiskStats{"sda": {ReadBytes: 1000, WriteBytes: 2000, Reads: 10, Writes: 20}}
+		interfaces           = map[string]host.InterfaceStats{
+			"eth0":    {RxBytes: 5000, TxBytes: 3000, RxPackets: 50, TxPackets: 30, RxErrors: 1, Physical: true},
+			"docker0": {RxBytes: 1000, TxBytes: 1000, RxPackets: 10, TxPackets: 10},
+		}
+	)
+	defer func() {
+		host.GetDiskStats = oldGetDiskStats
+		host.GetInterfaceStats = oldGetInterfaceStats
+		host.GetFilesystems = oldGetFilesystems
+	}()
+	host.GetDiskStats = func(string) (map[string]host.DiskStats, error) { return disks, nil }
+	host.GetInterfaceStats = func(string) (map[string]host.InterfaceStats, error) { return interfaces, nil }
+	host.GetFilesystems = func(string) ([]host.Filesystem, error) {
+		return []host.Filesystem{
+			{Mount: "/", Device: "/dev/sda1", Type: "ext4", Size: 100, Used: 45, Avail: 45},
+			{Mount: "/data", Device: "/dev/sdb1", Type: "xfs", Size: 100, Used: 90, Avail: 10},
+		}, nil
+	}
+
+	r := host.NewReporter("hostid", "hostname", "probe-id", "", nil, controls.NewDefaultHandlerRegistry(), "/proc")
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := rpt.Host.Nodes[report.MakeHostNodeID("hostid")]
+	// Rates need two reports
+	if _, ok := node.Metrics[host.DiskReadBytes]; ok {
+		t.Errorf("Expected no disk rates from the first report")
+	}
+	if sample, _ := node.Metrics[host.FilesystemUsage].LastSample(); sample.Value != 90 {
+		t.Errorf("Expected the usage of the fullest filesystem, got %v", sample.Value)
+	}
+
+	mtime.NowForce(start.Add(2 * time.Second))
+	disks = map[string]host.DiskStats{"sda": {ReadBytes: 3000, WriteBytes: 2000, Reads: 14, Writes: 20}}
+	// Only the traffic of physical interfaces is the host's
+	interfaces = map[string]host.InterfaceStats{
+		"eth0":    {RxBytes: 9000, TxBytes: 3400, RxPackets: 60, TxPackets: 32, RxErrors: 2, Physical: true},
+		"docker0": {RxBytes: 5000, TxBytes: 5000, RxPackets: 20, TxPackets: 20},
+	}
+	rpt, err = r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node = rpt.Host.Nodes[report.MakeHostNodeID("hostid")]
+	for key, want := range map[string]float64{
+		host.DiskReadBytes:  1000,
+		host.DiskWriteBytes: 0,
+		host.NetworkRxBytes: 2000,
+		host.NetworkTxBytes: 200,
+	} {
+		if sample, ok := node.Metrics[key].LastSample(); !ok || sample.Value != want {
+			t.Errorf("Expected %s %v, got %v", key, want, sample.Value)
+		}
+	}
+
+	for prefix, want := range map[string][]report.Row{
+		host.DisksTablePrefix: {{ID: "sda", Entries: map[string]string{
+			host.DiskDevice:    "sda",
+			host.DiskReadRate:  "1000.0",
+			host.DiskWriteRate: "0.0",
+			host.DiskReadOps:   "2.0",
+			host.DiskWriteOps:  "0.0",
+		}}},
+		host.InterfacesTablePrefix: {
+			{ID: "docker0", Entries: map[string]string{
+				host.InterfaceName:   "docker0",
+				host.InterfaceRx:     "2000.0",
+				host.InterfaceTx:     "2000.0",
+				host.InterfaceRxPkts: "5.0",
+				host.InterfaceTxPkts: "5.0",
+				host.InterfaceRxErrs: "0.0",
+				host.InterfaceTxErrs: "0.0",
+			}},
+			{ID: "eth0", Entries: map[string]string{
+				host.InterfaceName:   "eth0",
+				host.InterfaceRx:     "2000.0",
+				host.InterfaceTx:     "200.0",
+				host.InterfaceRxPkts: "5.0",
+				host.InterfaceTxPkts: "1.0",
+				host.InterfaceRxErrs: "0.5",
+				host.InterfaceTxErrs: "0.0",
+			}},
+		},
+		host.FilesystemsTablePrefix: {
+			{ID: "/", Entries: map[string]string{
+				host.FilesystemMount: "/",
+				host.FilesystemDev:   "/dev/sda1",
+				host.FilesystemType:  "ext4",
+				host.FilesystemSize:  "100 B",
+				host.FilesystemUsed:  "45 B",
+				host.FilesystemUse:   "50.0",
+			}},
+			{ID: "/data", Entries: map[string]string{
+				host.FilesystemMount: "/data",
+				host.FilesystemDev:   "/dev/sdb1",
+				host.FilesystemType:  "xfs",
+				host.FilesystemSize:  "100 B",
+				host.FilesystemUsed:  "90 B",
+				host.FilesystemUse:   "90.0",
+			}},
+		},
+	} {
+		have := node.ExtractMulticolumnTable(host.TableTemplates[prefix])
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: expected %v, got %v", prefix, want, have)
+		}
+	}
+}
@@ -18,11 +18,14 @@ import (
 	log "github.com/sirupsen/logrus"
 	apiappsv1 "k8s.io/api/apps/v1"
 	apiappsv1beta1 "k8s.io/api/apps/v1beta1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	apibatchv1 "k8s.io/api/batch/v1"
 	apibatchv1beta1 "k8s.io/api/batch/v1beta1"
 	apibatchv2alpha1 "k8s.io/api/batch/v2alpha1"
 	apiv1 "k8s.io/api/core/v1"
 	apiextensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	storagev1 "k8s.io/api/storage/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
@@ -56,6 +59,10 @@ type Client interface {
 	WalkVolumeSnapshots(f func(VolumeSnapshot) error) error
 	WalkVolumeSnapshotData(f func(VolumeSnapshotData) error) error
 	WalkJobs(f func(Job) error) error
+	WalkIngresses(f func(Ingress) error) error
+	WalkNetworkPolicies(f func(NetworkPolicy) error) error
+	WalkHorizontalPodAutoscalers(f func(HorizontalPodAutoscaler) error) error
+	WalkNodes(f func(NodeResource) error) error
 
 	WatchPods(f func(Event, Pod))
 
@@ -67,21 +74,26 @@ type Client interface {
 	DeleteVolumeSnapshot(namespaceID, volumeSnapshotID string) error
 	ScaleUp(namespaceID, id string) error
 	ScaleDown(namespaceID, id string) error
+	CordonNode(name string, unschedulable bool) error
+	DrainNode(name string) error
 }
 
 // ResourceMap is the mapping of resource and their GroupKind
 var ResourceMap = map[string]schema.GroupKind{
-	"Pod":                   {Group: apiv1.GroupName, Kind: "Pod"},
-	"Service":               {Group: apiv1.GroupName, Kind: "Service"},
-	"Deployment":            {Group: apiappsv1.GroupName, Kind: "Deployment"},
-	"DaemonSet":             {Group: apiappsv1.GroupName, Kind: "DaemonSet"},
-	"StatefulSet":           {Group: apiappsv1.GroupName, Kind: "StatefulSet"},
-	"Job":                   {Group: apibatchv1.GroupName, Kind: "Job"},
-	"CronJob":               {Group: apibatchv1.GroupName, Kind: "CronJob"},
-	"Node":                  {Group: apiv1.GroupName, Kind: "Node"},
-	"PersistentVolume":      {Group: apiv1.GroupName, Kind: "PersistentVolume"},
-	"PersistentVolumeClaim": {Group: apiv1.GroupName, Kind: "PersistentVolumeClaim"},
-	"StorageClass":          {Group: storagev1.GroupName, Kind: "StorageClass"},
+	"Pod":                     {Group: apiv1.GroupName, Kind: "Pod"},
+	"Service":                 {Group: apiv1.GroupName, Kind: "Service"},
+	"Deployment":              {Group: apiappsv1.GroupName, Kind: "Deployment"},
+	"DaemonSet":               {Group: apiappsv1.GroupName, Kind: "DaemonSet"},
+	"StatefulSet":             {Group: apiappsv1.GroupName, Kind: "StatefulSet"},
+	"Job":                     {Group: apibatchv1.GroupName, Kind: "Job"},
+	"CronJob":                 {Group: apibatchv1.GroupName, Kind: "CronJob"},
+	"Node":                    {Group: apiv1.GroupName, Kind: "Node"},
+	"PersistentVolume":        {Group: apiv1.GroupName, Kind: "PersistentVolume"},
+	"PersistentVolumeClaim":   {Group: apiv1.GroupName, Kind: "PersistentVolumeClaim"},
+	"StorageClass":            {Group: storagev1.GroupName, Kind: "StorageClass"},
+	"Ingress":                 {Group: apiextensionsv1beta1.GroupName, Kind: "Ingress"},
+	"NetworkPolicy":           {Group: networkingv1.GroupName, Kind: "NetworkPolicy"},
+	"HorizontalPodAutoscaler": {Group: autoscalingv1.GroupName, Kind: "HorizontalPodAutoscaler"},
 }
 
 type client struct {
@@ -102,6 +114,9 @@ type client struct {
 	storageClassStore          cache.Store
 	volumeSnapshotStore        cache.Store
 	volumeSnapshotDataStore    cache.Store
+	ingressStore               cache.Store
+	networkPolicyStore         cache.Store
+	hpaStore                   cache.Store
 
 	podWatchesMutex sync.Mutex
 	podWatches      []func(Event, Pod)
@@ -197,6 +212,9 @@ func NewClient(config ClientConfig) (Client, error) {
 	result.storageClassStore = result.setupStore("storageclasses")
 	result.volumeSnapshotStore = result.setupStore("volumesnapshots")
 	result.volumeSnapshotDataStore = result.setupStore("volumesnapshotdatas")
+	result.ingressStore = result.setupStore("ingresses")
+	result.networkPolicyStore = result.setupStore("networkpolicies")
+	result.hpaStore = result.setupStore("horizontalpodautoscalers")
 
 	return result, nil
 }
@@ -249,6 +267,12 @@ func (c *client) clientAndType(resource string) (rest.Interface, interface{}, er
 		return c.client.BatchV1().RESTClient(), &apibatchv1.Job{}, nil
 	case "statefulsets":
 		return c.client.AppsV1beta1().RESTClient(), &apiappsv1beta1.StatefulSet{}, nil
+	case "ingresses":
+		return c.client.ExtensionsV1beta1().RESTClient(), &apiextensionsv1beta1.Ingress{}, nil
+	case "networkpolicies":
+		return c.client.NetworkingV1().RESTClient(), &networkingv1.NetworkPolicy{}, nil
+	case "horizontalpodautoscalers":
+		return c.client.AutoscalingV1().RESTClient(), &autoscalingv1.HorizontalPodAutoscaler{}, nil
 	case "volumesnapshots":
 		return c.snapshotClient.VolumesnapshotV1().RESTClient(), &snapshotv1.VolumeSnapshot{}, nil
 	case "volumesnapshotdatas":
@@ -467,6 +491,50 @@ func (c *client) WalkJobs(f func(Job) error) error {
 	return nil
 }
 
+// WalkIngresses calls f for each ingress
+func (c *client) WalkIngresses(f func(Ingress) error) error {
+	for _, m := range c.ingressStore.List() {
+		i := m.(*apiextensionsv1beta1.Ingress)
+		if err := f(NewIngress(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkNetworkPolicies calls f for each network policy
+func (c *client) WalkNetworkPolicies(f func(NetworkPolicy) error) error {
+	for _, m := range c.networkPolicyStore.List() {
+		p := m.(*networkingv1.NetworkPolicy)
+		if err := f(NewNetworkPolicy(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkHorizontalPodAutoscalers calls f for each horizontal pod autoscaler
+func (c *client) WalkHorizontalPodAutoscalers(f func(HorizontalPodAutoscaler) error) error {
+	for _, m := range c.hpaStore.List() {
+		h := m.(*autoscalingv1.HorizontalPodAutoscaler)
+		if err := f(NewHorizontalPodAutoscaler(h)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkNodes calls f for each node
+func (c *client) WalkNodes(f func(NodeResource) error) error {
+	for _, m := range c.nodeStore.List() {
+		n := m.(*apiv1.Node)
+		if err := f(NewNode(n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *client) CloneVolumeSnapshot(namespaceID, volumeSnapshotID, persistentVolumeClaimID, capacity string) error {
 	var scName string
 	var claimSize string
@@ -604,6 +672,50 @@ func (c *client) DeletePod(namespaceID, podID string) error {
 	return c.client.CoreV1().Pods(namespaceID).Delete(podID, &metav1.DeleteOptions{})
 }
 
+// CordonNode marks a node as (un)schedulable.
+func (c *client) CordonNode(name string, unschedulable bool) error {
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	_, err := c.client.CoreV1().Nodes().Patch(name, types.StrategicMergePatchType, []byte(patch))
+	return err
+}
+
+// DrainNode cordons a node and evicts its pods, like `kubectl drain
+// --ignore-daemonsets`. Mirror pods and pods managed by daemon sets are left
+// alone, as they can't be moved elsewhere.
+func (c *client) DrainNode(name string) error {
+	if err := c.CordonNode(name, true); err != nil {
+		return err
+	}
+	pods, err := c.client.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", name).String(),
+	})
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for _, pod := range pods.Items {
+		if _, ok := pod.Annotations[apiv1.MirrorPodAnnotationKey]; ok {
+			continue
+		}
+		if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "DaemonSet" {
+			continue
+		}
+		if pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed {
+			continue
+		}
+		err := c.client.CoreV1().Pods(pod.Namespace).Evict(&policyv1beta1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Sprintf("%s/%s: %v", pod.Namespace, pod.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error evicting pods: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 func (c *client) DeleteVolumeSnapshot(namespaceID, volumeSnapshotID string) error {
 	return c.snapshotClient.VolumesnapshotV1().VolumeSnapshots(namespaceID).Delete(volumeSnapshotID, &metav1.DeleteOptions{})
 }
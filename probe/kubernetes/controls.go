@@ -21,6 +21,9 @@ const (
 	DeleteVolumeSnapshot = report.KubernetesDeleteVolumeSnapshot
 	ScaleUp              = report.KubernetesScaleUp
 	ScaleDown            = report.KubernetesScaleDown
+	CordonNode           = report.KubernetesCordonNode
+	UncordonNode         = report.KubernetesUncordonNode
+	DrainNode            = report.KubernetesDrainNode
 )
 
 // GroupName and version used by CRDs
@@ -95,6 +98,18 @@ func (r *Reporter) describeJob(req xfer.Request, namespaceID, jobID string) xfer
 	return r.describe(req, namespaceID, jobID, ResourceMap["Job"], apimeta.RESTMapping{})
 }
 
+func (r *Reporter) describeIngress(req xfer.Request, namespaceID, ingressID string) xfer.Response {
+	return r.describe(req, namespaceID, ingressID, ResourceMap["Ingress"], apimeta.RESTMapping{})
+}
+
+func (r *Reporter) describeNetworkPolicy(req xfer.Request, namespaceID, networkPolicyID string) xfer.Response {
+	return r.describe(req, namespaceID, networkPolicyID, ResourceMap["NetworkPolicy"], apimeta.RESTMapping{})
+}
+
+func (r *Reporter) describeHorizontalPodAutoscaler(req xfer.Request, namespaceID, hpaID string) xfer.Response {
+	return r.describe(req, namespaceID, hpaID, ResourceMap["HorizontalPodAutoscaler"], apimeta.RESTMapping{})
+}
+
 func (r *Reporter) describeVolumeSnapshot(req xfer.Request, namespaceID, volumeSnapshotID, _, _ string) xfer.Response {
 	restMapping := apimeta.RESTMapping{
 		Resource: schema.GroupVersionResource{
@@ -168,6 +183,27 @@ func (r *Reporter) deletePod(req xfer.Request, namespaceID, podID string, _ []st
 	}
 }
 
+func (r *Reporter) cordonNode(req xfer.Request, name string) xfer.Response {
+	if err := r.client.CordonNode(name, true); err != nil {
+		return xfer.ResponseError(err)
+	}
+	return xfer.Response{}
+}
+
+func (r *Reporter) uncordonNode(req xfer.Request, name string) xfer.Response {
+	if err := r.client.CordonNode(name, false); err != nil {
+		return xfer.ResponseError(err)
+	}
+	return xfer.Response{}
+}
+
+func (r *Reporter) drainNode(req xfer.Request, name string) xfer.Response {
+	if err := r.client.DrainNode(name); err != nil {
+		return xfer.ResponseError(err)
+	}
+	return xfer.Response{}
+}
+
 func (r *Reporter) deleteVolumeSnapshot(req xfer.Request, namespaceID, volumeSnapshotID, _, _ string) xfer.Response {
 	if err := r.client.DeleteVolumeSnapshot(namespaceID, volumeSnapshotID); err != nil {
 		return xfer.ResponseError(err)
@@ -210,6 +246,12 @@ func (r *Reporter) Describe() func(xfer.Request) xfer.Response {
 			f = r.CaptureVolumeSnapshotData(r.describeVolumeSnapshotData)
 		case "<job>":
 			f = r.CaptureJob(r.describeJob)
+		case "<ingress>":
+			f = r.CaptureIngress(r.describeIngress)
+		case "<network_policy>":
+			f = r.CaptureNetworkPolicy(r.describeNetworkPolicy)
+		case "<horizontal_pod_autoscaler>":
+			f = r.CaptureHorizontalPodAutoscaler(r.describeHorizontalPodAutoscaler)
 		default:
 			return xfer.ResponseErrorf("Node not found: %s", req.NodeID)
 		}
@@ -494,6 +536,9 @@ func (r *Reporter) registerControls() {
 		DeleteVolumeSnapshot: r.CaptureVolumeSnapshot(r.deleteVolumeSnapshot),
 		ScaleUp:              r.CaptureDeployment(r.ScaleUp),
 		ScaleDown:            r.CaptureDeployment(r.ScaleDown),
+		CordonNode:           r.CaptureNode(r.cordonNode),
+		UncordonNode:         r.CaptureNode(r.uncordonNode),
+		DrainNode:            r.CaptureNode(r.drainNode),
 	}
 	r.handlerRegistry.Batch(nil, controls)
 }
@@ -508,6 +553,94 @@ func (r *Reporter) deregisterControls() {
 		DeleteVolumeSnapshot,
 		ScaleUp,
 		ScaleDown,
+		CordonNode,
+		UncordonNode,
+		DrainNode,
 	}
 	r.handlerRegistry.Batch(controls, nil)
 }
+
+// CaptureNode finds the Kubernetes node of a host node, and passes its name
+// to f.
+func (r *Reporter) CaptureNode(f func(xfer.Request, string) xfer.Response) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		hostname, ok := report.ParseHostNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		var node NodeResource
+		r.client.WalkNodes(func(n NodeResource) error {
+			if n.Hostname() == hostname {
+				node = n
+			}
+			return nil
+		})
+		if node == nil {
+			return xfer.ResponseErrorf("Node not found: %s", hostname)
+		}
+		return f(req, node.Name())
+	}
+}
+
+// CaptureIngress is exported for testing
+func (r *Reporter) CaptureIngress(f func(xfer.Request, string, string) xfer.Response) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		uid, ok := report.ParseIngressNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		var ingress Ingress
+		r.client.WalkIngresses(func(i Ingress) error {
+			if i.UID() == uid {
+				ingress = i
+			}
+			return nil
+		})
+		if ingress == nil {
+			return xfer.ResponseErrorf("Ingress not found: %s", uid)
+		}
+		return f(req, ingress.Namespace(), ingress.Name())
+	}
+}
+
+// CaptureNetworkPolicy is exported for testing
+func (r *Reporter) CaptureNetworkPolicy(f func(xfer.Request, string, string) xfer.Response) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		uid, ok := report.ParseNetworkPolicyNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		var networkPolicy NetworkPolicy
+		r.client.WalkNetworkPolicies(func(p NetworkPolicy) error {
+			if p.UID() == uid {
+				networkPolicy = p
+			}
+			return nil
+		})
+		if networkPolicy == nil {
+			return xfer.ResponseErrorf("Network policy not found: %s", uid)
+		}
+		return f(req, networkPolicy.Namespace(), networkPolicy.Name())
+	}
+}
+
+// CaptureHorizontalPodAutoscaler is exported for testing
+func (r *Reporter) CaptureHorizontalPodAutoscaler(f func(xfer.Request, string, string) xfer.Response) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		uid, ok := report.ParseHorizontalPodAutoscalerNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		var horizontalPodAutoscaler HorizontalPodAutoscaler
+		r.client.WalkHorizontalPodAutoscalers(func(h HorizontalPodAutoscaler) error {
+			if h.UID() == uid {
+				horizontalPodAutoscaler = h
+			}
+			return nil
+		})
+		if horizontalPodAutoscaler == nil {
+			return xfer.ResponseErrorf("Horizontal pod autoscaler not found: %s", uid)
+		}
+		return f(req, horizontalPodAutoscaler.Namespace(), horizontalPodAutoscaler.Name())
+	}
+}
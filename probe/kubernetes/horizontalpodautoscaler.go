@@ -0,0 +1,62 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strconv"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// HorizontalPodAutoscaler represents a Kubernetes horizontal pod autoscaler
+type HorizontalPodAutoscaler interface {
+	Meta
+	ScaleTargetKind() string
+	ScaleTargetName() string
+	GetNode(probeID string) report.Node
+}
+
+type horizontalPodAutoscaler struct {
+	*autoscalingv1.HorizontalPodAutoscaler
+	Meta
+}
+
+// NewHorizontalPodAutoscaler creates a new HorizontalPodAutoscaler
+func NewHorizontalPodAutoscaler(h *autoscalingv1.HorizontalPodAutoscaler) HorizontalPodAutoscaler {
+	return &horizontalPodAutoscaler{HorizontalPodAutoscaler: h, Meta: meta{h.ObjectMeta}}
+}
+
+func (h *horizontalPodAutoscaler) ScaleTargetKind() string {
+	return h.Spec.ScaleTargetRef.Kind
+}
+
+func (h *horizontalPodAutoscaler) ScaleTargetName() string {
+	return h.Spec.ScaleTargetRef.Name
+}
+
+func (h *horizontalPodAutoscaler) GetNode(probeID string) report.Node {
+	minReplicas := int32(1)
+	if h.Spec.MinReplicas != nil {
+		minReplicas = *h.Spec.MinReplicas
+	}
+	latests := map[string]string{
+		NodeType:              "Horizontal Pod Autoscaler",
+		ScaleTarget:           fmt.Sprintf("%s/%s", h.ScaleTargetKind(), h.ScaleTargetName()),
+		MinReplicas:           strconv.Itoa(int(minReplicas)),
+		MaxReplicas:           strconv.Itoa(int(h.Spec.MaxReplicas)),
+		report.ControlProbeID: probeID,
+	}
+	if h.Spec.TargetCPUUtilizationPercentage != nil {
+		latests[TargetCPUUtilization] = fmt.Sprintf("%d%%", *h.Spec.TargetCPUUtilizationPercentage)
+	}
+	now := mtime.Now()
+	return h.MetaNode(report.MakeHorizontalPodAutoscalerNodeID(h.UID())).
+		WithLatests(latests).
+		WithMetrics(report.Metrics{
+			CurrentReplicas: report.MakeSingletonMetric(now, float64(h.Status.CurrentReplicas)).WithMax(float64(h.Spec.MaxReplicas)),
+			DesiredReplicas: report.MakeSingletonMetric(now, float64(h.Status.DesiredReplicas)).WithMax(float64(h.Spec.MaxReplicas)),
+		}).
+		WithLatestActiveControls(Describe)
+}
@@ -0,0 +1,96 @@
+package kubernetes
+
+import (
+	"sort"
+	"strings"
+
+	apiextensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Ingress represents a Kubernetes ingress
+type Ingress interface {
+	Meta
+	ServiceNames() []string
+	GetNode(probeID string) report.Node
+}
+
+type ingress struct {
+	*apiextensionsv1beta1.Ingress
+	Meta
+}
+
+// NewIngress creates a new Ingress
+func NewIngress(i *apiextensionsv1beta1.Ingress) Ingress {
+	return &ingress{Ingress: i, Meta: meta{i.ObjectMeta}}
+}
+
+func (i *ingress) backends() []apiextensionsv1beta1.IngressBackend {
+	var backends []apiextensionsv1beta1.IngressBackend
+	if i.Spec.Backend != nil {
+		backends = append(backends, *i.Spec.Backend)
+	}
+	for _, rule := range i.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			backends = append(backends, path.Backend)
+		}
+	}
+	return backends
+}
+
+// ServiceNames returns the names of the services the ingress routes
+// traffic to, which are in the ingress' namespace.
+func (i *ingress) ServiceNames() []string {
+	seen := map[string]struct{}{}
+	names := []string{}
+	for _, backend := range i.backends() {
+		if _, ok := seen[backend.ServiceName]; ok {
+			continue
+		}
+		seen[backend.ServiceName] = struct{}{}
+		names = append(names, backend.ServiceName)
+	}
+	return names
+}
+
+func (i *ingress) GetNode(probeID string) report.Node {
+	var hosts, backends []string
+	for _, rule := range i.Spec.Rules {
+		if rule.Host != "" {
+			hosts = append(hosts, rule.Host)
+		}
+	}
+	seen := map[string]struct{}{}
+	for _, backend := range i.backends() {
+		b := backend.ServiceName + ":" + backend.ServicePort.String()
+		if _, ok := seen[b]; !ok {
+			seen[b] = struct{}{}
+			backends = append(backends, b)
+		}
+	}
+	sort.Strings(hosts)
+	sort.Strings(backends)
+	latests := map[string]string{
+		NodeType:              "Ingress",
+		report.ControlProbeID: probeID,
+	}
+	if len(hosts) > 0 {
+		latests[IngressHosts] = strings.Join(hosts, ", ")
+	}
+	if len(backends) > 0 {
+		latests[IngressBackends] = strings.Join(backends, ", ")
+	}
+	for _, lb := range i.Status.LoadBalancer.Ingress {
+		if lb.IP != "" {
+			latests[PublicIP] = lb.IP
+			break
+		}
+	}
+	return i.MetaNode(report.MakeIngressNodeID(i.UID())).
+		WithLatests(latests).
+		WithLatestActiveControls(Describe)
+}
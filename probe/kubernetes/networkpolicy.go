@@ -0,0 +1,60 @@
+package kubernetes
+
+import (
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// NetworkPolicy represents a Kubernetes network policy
+type NetworkPolicy interface {
+	Meta
+	Selector() (labels.Selector, error)
+	GetNode(probeID string) report.Node
+}
+
+type networkPolicy struct {
+	*networkingv1.NetworkPolicy
+	Meta
+}
+
+// NewNetworkPolicy creates a new NetworkPolicy
+func NewNetworkPolicy(p *networkingv1.NetworkPolicy) NetworkPolicy {
+	return &networkPolicy{NetworkPolicy: p, Meta: meta{p.ObjectMeta}}
+}
+
+func (p *networkPolicy) Selector() (labels.Selector, error) {
+	return metav1.LabelSelectorAsSelector(&p.Spec.PodSelector)
+}
+
+func (p *networkPolicy) GetNode(probeID string) report.Node {
+	policyTypes := make([]string, 0, len(p.Spec.PolicyTypes))
+	for _, t := range p.Spec.PolicyTypes {
+		policyTypes = append(policyTypes, string(t))
+	}
+	if len(policyTypes) == 0 {
+		// Policies without types always affect ingress, and egress only if
+		// they have egress rules.
+		policyTypes = append(policyTypes, string(networkingv1.PolicyTypeIngress))
+		if len(p.Spec.Egress) > 0 {
+			policyTypes = append(policyTypes, string(networkingv1.PolicyTypeEgress))
+		}
+	}
+	podSelector := metav1.FormatLabelSelector(&p.Spec.PodSelector)
+	if podSelector == "<none>" {
+		podSelector = "all pods"
+	}
+	latests := map[string]string{
+		NodeType:              "Network Policy",
+		PolicyTypes:           strings.Join(policyTypes, ", "),
+		PodSelector:           podSelector,
+		report.ControlProbeID: probeID,
+	}
+	return p.MetaNode(report.MakeNetworkPolicyNodeID(p.UID())).
+		WithLatests(latests).
+		WithLatestActiveControls(Describe)
+}
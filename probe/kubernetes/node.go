@@ -0,0 +1,111 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	KubeletVersion    = report.KubernetesKubeletVersion
+	Unschedulable     = report.KubernetesUnschedulable
+	Taints            = report.KubernetesTaints
+	AllocatableCPU    = report.KubernetesAllocatableCPU
+	AllocatableMemory = report.KubernetesAllocatableMemory
+	RequestedCPU      = report.KubernetesRequestedCPU
+	RequestedMemory   = report.KubernetesRequestedMemory
+
+	NodeConditionPrefix = "kubernetes_node_condition_"
+)
+
+// NodeResource represents a Kubernetes node
+// `Node` would be confused with report.Node
+type NodeResource interface {
+	Meta
+	Hostname() string
+	Unschedulable() bool
+	GetNode(probeID string, requests apiv1.ResourceList) report.Node
+}
+
+type node struct {
+	*apiv1.Node
+	Meta
+}
+
+// NewNode creates a new Node
+func NewNode(n *apiv1.Node) NodeResource {
+	return &node{Node: n, Meta: meta{n.ObjectMeta}}
+}
+
+// Hostname is the hostname of the node, which Scope probes use as their
+// host ID.
+func (n *node) Hostname() string {
+	for _, address := range n.Status.Addresses {
+		if address.Type == apiv1.NodeHostName && address.Address != "" {
+			return address.Address
+		}
+	}
+	return n.Name()
+}
+
+func (n *node) Unschedulable() bool {
+	return n.Spec.Unschedulable
+}
+
+func (n *node) taints() string {
+	taints := make([]string, 0, len(n.Spec.Taints))
+	for _, t := range n.Spec.Taints {
+		taint := t.Key
+		if t.Value != "" {
+			taint += "=" + t.Value
+		}
+		taints = append(taints, taint+":"+string(t.Effect))
+	}
+	sort.Strings(taints)
+	return strings.Join(taints, ", ")
+}
+
+// GetNode returns the host node for this Kubernetes node. requests are the
+// total resource requests of the pods scheduled on it.
+func (n *node) GetNode(probeID string, requests apiv1.ResourceList) report.Node {
+	var (
+		allocatableCPU    = n.Status.Allocatable[apiv1.ResourceCPU]
+		allocatableMemory = n.Status.Allocatable[apiv1.ResourceMemory]
+		requestedCPU      = requests[apiv1.ResourceCPU]
+		requestedMemory   = requests[apiv1.ResourceMemory]
+		now               = mtime.Now()
+	)
+	latests := map[string]string{
+		KubeletVersion:    n.Status.NodeInfo.KubeletVersion,
+		Unschedulable:     fmt.Sprint(n.Unschedulable()),
+		AllocatableCPU:    allocatableCPU.String(),
+		AllocatableMemory: allocatableMemory.String(),
+	}
+	if taints := n.taints(); taints != "" {
+		latests[Taints] = taints
+	}
+	conditions := map[string]string{}
+	for _, c := range n.Status.Conditions {
+		conditions[string(c.Type)] = string(c.Status)
+	}
+	return report.MakeNodeWith(report.MakeHostNodeID(n.Hostname()), latests).
+		AddPrefixPropertyList(NodeConditionPrefix, conditions).
+		AddPrefixPropertyList(LabelPrefix, n.Labels()).
+		WithMetrics(report.Metrics{
+			RequestedCPU: report.MakeSingletonMetric(now, float64(requestedCPU.MilliValue())/1000).
+				WithMax(float64(allocatableCPU.MilliValue()) / 1000),
+			RequestedMemory: report.MakeSingletonMetric(now, float64(requestedMemory.Value())).
+				WithMax(float64(allocatableMemory.Value())),
+		}).
+		WithLatestControls(map[string]report.NodeControlData{
+			CordonNode:   {Dead: n.Unschedulable(), ProbeID: probeID},
+			UncordonNode: {Dead: !n.Unschedulable(), ProbeID: probeID},
+			DrainNode:    {ProbeID: probeID},
+		})
+}
@@ -31,6 +31,7 @@ type Pod interface {
 	RestartCount() uint
 	ContainerNames() []string
 	VolumeClaimNames() []string
+	ResourceRequests() apiv1.ResourceList
 }
 
 type pod struct {
@@ -77,6 +78,23 @@ func (p *pod) RestartCount() uint {
 	return count
 }
 
+// ResourceRequests sums the resource requests of the pod's containers.
+// Finished pods don't request anything.
+func (p *pod) ResourceRequests() apiv1.ResourceList {
+	result := apiv1.ResourceList{}
+	if p.Status.Phase == apiv1.PodSucceeded || p.Status.Phase == apiv1.PodFailed {
+		return result
+	}
+	for _, c := range p.Spec.Containers {
+		for name, quantity := range c.Resources.Requests {
+			total := result[name]
+			total.Add(quantity)
+			result[name] = total
+		}
+	}
+	return result
+}
+
 func (p *pod) VolumeClaimNames() []string {
 	var claimNames []string
 	for _, volume := range p.Spec.Volumes {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
 
 	log "github.com/sirupsen/logrus"
@@ -16,25 +17,34 @@ import (
 
 // These constants are keys used in node metadata
 const (
-	IP                 = report.KubernetesIP
-	ObservedGeneration = report.KubernetesObservedGeneration
-	Replicas           = report.KubernetesReplicas
-	DesiredReplicas    = report.KubernetesDesiredReplicas
-	NodeType           = report.KubernetesNodeType
-	Type               = report.KubernetesType
-	Ports              = report.KubernetesPorts
-	VolumeClaim        = report.KubernetesVolumeClaim
-	StorageClassName   = report.KubernetesStorageClassName
-	AccessModes        = report.KubernetesAccessModes
-	ReclaimPolicy      = report.KubernetesReclaimPolicy
-	Status             = report.KubernetesStatus
-	Message            = report.KubernetesMessage
-	VolumeName         = report.KubernetesVolumeName
-	Provisioner        = report.KubernetesProvisioner
-	StorageDriver      = report.KubernetesStorageDriver
-	VolumeSnapshotName = report.KubernetesVolumeSnapshotName
-	SnapshotData       = report.KubernetesSnapshotData
-	VolumeCapacity     = report.KubernetesVolumeCapacity
+	IP                   = report.KubernetesIP
+	ObservedGeneration   = report.KubernetesObservedGeneration
+	Replicas             = report.KubernetesReplicas
+	DesiredReplicas      = report.KubernetesDesiredReplicas
+	NodeType             = report.KubernetesNodeType
+	Type                 = report.KubernetesType
+	Ports                = report.KubernetesPorts
+	VolumeClaim          = report.KubernetesVolumeClaim
+	StorageClassName     = report.KubernetesStorageClassName
+	AccessModes          = report.KubernetesAccessModes
+	ReclaimPolicy        = report.KubernetesReclaimPolicy
+	Status               = report.KubernetesStatus
+	Message              = report.KubernetesMessage
+	VolumeName           = report.KubernetesVolumeName
+	Provisioner          = report.KubernetesProvisioner
+	StorageDriver        = report.KubernetesStorageDriver
+	VolumeSnapshotName   = report.KubernetesVolumeSnapshotName
+	SnapshotData         = report.KubernetesSnapshotData
+	VolumeCapacity       = report.KubernetesVolumeCapacity
+	IngressHosts         = report.KubernetesIngressHosts
+	IngressBackends      = report.KubernetesIngressBackends
+	PolicyTypes          = report.KubernetesPolicyTypes
+	PodSelector          = report.KubernetesPodSelector
+	ScaleTarget          = report.KubernetesScaleTarget
+	MinReplicas          = report.KubernetesMinReplicas
+	MaxReplicas          = report.KubernetesMaxReplicas
+	CurrentReplicas      = report.KubernetesCurrentReplicas
+	TargetCPUUtilization = report.KubernetesTargetCPUUtilization
 )
 
 // Exposed for testing
@@ -155,6 +165,61 @@ var (
 
 	JobMetricTemplates = PodMetricTemplates
 
+	NodeMetadataTemplates = report.MetadataTemplates{
+		KubeletVersion:    {ID: KubeletVersion, Label: "Kubelet version", From: report.FromLatest, Priority: 3},
+		Unschedulable:     {ID: Unschedulable, Label: "Cordoned", From: report.FromLatest, Priority: 4},
+		AllocatableCPU:    {ID: AllocatableCPU, Label: "Allocatable CPU", From: report.FromLatest, Priority: 5},
+		AllocatableMemory: {ID: AllocatableMemory, Label: "Allocatable memory", From: report.FromLatest, Priority: 6},
+		Taints:            {ID: Taints, Label: "Taints", From: report.FromLatest, Priority: 7},
+	}
+
+	NodeMetricTemplates = report.MetricTemplates{
+		RequestedCPU:    {ID: RequestedCPU, Label: "Requested CPU (cores)", Format: report.DefaultFormat, Priority: 3},
+		RequestedMemory: {ID: RequestedMemory, Label: "Requested memory", Format: report.FilesizeFormat, Priority: 4},
+	}
+
+	NodeTableTemplates = report.TableTemplates{
+		NodeConditionPrefix: {
+			ID:     NodeConditionPrefix,
+			Label:  "Kubernetes node conditions",
+			Type:   report.PropertyListType,
+			Prefix: NodeConditionPrefix,
+		},
+	}.Merge(TableTemplates)
+
+	IngressMetadataTemplates = report.MetadataTemplates{
+		NodeType:        {ID: NodeType, Label: "Type", From: report.FromLatest, Priority: 1},
+		Namespace:       {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 2},
+		Created:         {ID: Created, Label: "Created", From: report.FromLatest, Datatype: report.DateTime, Priority: 3},
+		PublicIP:        {ID: PublicIP, Label: "Public IP", From: report.FromLatest, Datatype: report.IP, Priority: 4},
+		IngressHosts:    {ID: IngressHosts, Label: "Hosts", From: report.FromLatest, Priority: 5},
+		IngressBackends: {ID: IngressBackends, Label: "Backends", From: report.FromLatest, Priority: 6},
+	}
+
+	NetworkPolicyMetadataTemplates = report.MetadataTemplates{
+		NodeType:    {ID: NodeType, Label: "Type", From: report.FromLatest, Priority: 1},
+		Namespace:   {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 2},
+		Created:     {ID: Created, Label: "Created", From: report.FromLatest, Datatype: report.DateTime, Priority: 3},
+		PodSelector: {ID: PodSelector, Label: "Pod selector", From: report.FromLatest, Priority: 4},
+		PolicyTypes: {ID: PolicyTypes, Label: "Policy types", From: report.FromLatest, Priority: 5},
+		report.Pod:  {ID: report.Pod, Label: "# Pods", From: report.FromCounters, Datatype: report.Number, Priority: 6},
+	}
+
+	HorizontalPodAutoscalerMetadataTemplates = report.MetadataTemplates{
+		NodeType:             {ID: NodeType, Label: "Type", From: report.FromLatest, Priority: 1},
+		Namespace:            {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 2},
+		Created:              {ID: Created, Label: "Created", From: report.FromLatest, Datatype: report.DateTime, Priority: 3},
+		ScaleTarget:          {ID: ScaleTarget, Label: "Scale target", From: report.FromLatest, Priority: 4},
+		MinReplicas:          {ID: MinReplicas, Label: "Min replicas", From: report.FromLatest, Datatype: report.Number, Priority: 5},
+		MaxReplicas:          {ID: MaxReplicas, Label: "Max replicas", From: report.FromLatest, Datatype: report.Number, Priority: 6},
+		TargetCPUUtilization: {ID: TargetCPUUtilization, Label: "Target CPU", From: report.FromLatest, Priority: 7},
+	}
+
+	HorizontalPodAutoscalerMetricTemplates = report.MetricTemplates{
+		CurrentReplicas: {ID: CurrentReplicas, Label: "Current replicas", Format: report.IntegerFormat, Priority: 1},
+		DesiredReplicas: {ID: DesiredReplicas, Label: "Desired replicas", Format: report.IntegerFormat, Priority: 2},
+	}
+
 	TableTemplates = report.TableTemplates{
 		LabelPrefix: {
 			ID:     LabelPrefix,
@@ -327,7 +392,23 @@ func (r *Reporter) Report() (report.Report, error) {
 	if err != nil {
 		return result, err
 	}
-	podTopology, err := r.podTopology(services, deployments, daemonSets, statefulSets, cronJobs, jobs)
+	ingressTopology, _, err := r.ingressTopology(services)
+	if err != nil {
+		return result, err
+	}
+	networkPolicyTopology, networkPolicies, err := r.networkPolicyTopology()
+	if err != nil {
+		return result, err
+	}
+	horizontalPodAutoscalerTopology, _, err := r.horizontalPodAutoscalerTopology(deployments, statefulSets)
+	if err != nil {
+		return result, err
+	}
+	podTopology, err := r.podTopology(services, deployments, daemonSets, statefulSets, cronJobs, jobs, networkPolicies)
+	if err != nil {
+		return result, err
+	}
+	hostTopology, err := r.hostTopology()
 	if err != nil {
 		return result, err
 	}
@@ -363,12 +444,16 @@ func (r *Reporter) Report() (report.Report, error) {
 	result.CronJob = result.CronJob.Merge(cronJobTopology)
 	result.Deployment = result.Deployment.Merge(deploymentTopology)
 	result.Namespace = result.Namespace.Merge(namespaceTopology)
+	result.Host = result.Host.Merge(hostTopology)
 	result.PersistentVolume = result.PersistentVolume.Merge(persistentVolumeTopology)
 	result.PersistentVolumeClaim = result.PersistentVolumeClaim.Merge(persistentVolumeClaimTopology)
 	result.StorageClass = result.StorageClass.Merge(storageClassTopology)
 	result.VolumeSnapshot = result.VolumeSnapshot.Merge(volumeSnapshotTopology)
 	result.VolumeSnapshotData = result.VolumeSnapshotData.Merge(volumeSnapshotDataTopology)
 	result.Job = result.Job.Merge(jobTopology)
+	result.Ingress = result.Ingress.Merge(ingressTopology)
+	result.NetworkPolicy = result.NetworkPolicy.Merge(networkPolicyTopology)
+	result.HorizontalPodAutoscaler = result.HorizontalPodAutoscaler.Merge(horizontalPodAutoscalerTopology)
 	return result, nil
 }
 
@@ -556,6 +641,77 @@ func (r *Reporter) jobTopology() (report.Topology, []Job, error) {
 	return result, jobs, err
 }
 
+// ingressTopology links each ingress to the services it routes traffic to.
+func (r *Reporter) ingressTopology(services []Service) (report.Topology, []Ingress, error) {
+	ingresses := []Ingress{}
+	result := report.MakeTopology().
+		WithMetadataTemplates(IngressMetadataTemplates).
+		WithTableTemplates(TableTemplates)
+	result.Controls.AddControl(DescribeControl)
+	serviceIDs := map[string]string{}
+	for _, service := range services {
+		serviceIDs[service.Namespace()+"/"+service.Name()] = report.MakeServiceNodeID(service.UID())
+	}
+	err := r.client.WalkIngresses(func(i Ingress) error {
+		node := i.GetNode(r.probeID)
+		for _, name := range i.ServiceNames() {
+			if id, ok := serviceIDs[i.Namespace()+"/"+name]; ok {
+				node = node.WithAdjacent(id)
+			}
+		}
+		result.AddNode(node)
+		ingresses = append(ingresses, i)
+		return nil
+	})
+	return result, ingresses, err
+}
+
+func (r *Reporter) networkPolicyTopology() (report.Topology, []NetworkPolicy, error) {
+	networkPolicies := []NetworkPolicy{}
+	result := report.MakeTopology().
+		WithMetadataTemplates(NetworkPolicyMetadataTemplates).
+		WithTableTemplates(TableTemplates)
+	result.Controls.AddControl(DescribeControl)
+	err := r.client.WalkNetworkPolicies(func(p NetworkPolicy) error {
+		result.AddNode(p.GetNode(r.probeID))
+		networkPolicies = append(networkPolicies, p)
+		return nil
+	})
+	return result, networkPolicies, err
+}
+
+// horizontalPodAutoscalerTopology links each autoscaler to the deployment
+// or stateful set it scales. Those are the only scalable kinds the probe
+// reports: autoscalers of anything else, such as replica sets managed
+// without a deployment, replication controllers or custom resources, have
+// no node to link to, and only show their scale target as a label.
+func (r *Reporter) horizontalPodAutoscalerTopology(deployments []Deployment, statefulSets []StatefulSet) (report.Topology, []HorizontalPodAutoscaler, error) {
+	hpas := []HorizontalPodAutoscaler{}
+	result := report.MakeTopology().
+		WithMetadataTemplates(HorizontalPodAutoscalerMetadataTemplates).
+		WithMetricTemplates(HorizontalPodAutoscalerMetricTemplates).
+		WithTableTemplates(TableTemplates)
+	result.Controls.AddControl(DescribeControl)
+	type scaleTarget struct{ topology, id string }
+	targets := map[string]scaleTarget{}
+	for _, d := range deployments {
+		targets["Deployment/"+d.Namespace()+"/"+d.Name()] = scaleTarget{report.Deployment, report.MakeDeploymentNodeID(d.UID())}
+	}
+	for _, s := range statefulSets {
+		targets["StatefulSet/"+s.Namespace()+"/"+s.Name()] = scaleTarget{report.StatefulSet, report.MakeStatefulSetNodeID(s.UID())}
+	}
+	err := r.client.WalkHorizontalPodAutoscalers(func(h HorizontalPodAutoscaler) error {
+		node := h.GetNode(r.probeID)
+		if target, ok := targets[h.ScaleTargetKind()+"/"+h.Namespace()+"/"+h.ScaleTargetName()]; ok {
+			node = node.WithParent(target.topology, target.id).WithAdjacent(target.id)
+		}
+		result.AddNode(node)
+		hpas = append(hpas, h)
+		return nil
+	})
+	return result, hpas, err
+}
+
 type labelledChild interface {
 	Labels() map[string]string
 	AddParent(string, string)
@@ -571,7 +727,7 @@ func match(namespace string, selector labels.Selector, topology, id string) func
 	}
 }
 
-func (r *Reporter) podTopology(services []Service, deployments []Deployment, daemonSets []DaemonSet, statefulSets []StatefulSet, cronJobs []CronJob, jobs []Job) (report.Topology, error) {
+func (r *Reporter) podTopology(services []Service, deployments []Deployment, daemonSets []DaemonSet, statefulSets []StatefulSet, cronJobs []CronJob, jobs []Job, networkPolicies []NetworkPolicy) (report.Topology, error) {
 	var (
 		pods = report.MakeTopology().
 			WithMetadataTemplates(PodMetadataTemplates).
@@ -663,6 +819,18 @@ func (r *Reporter) podTopology(services []Service, deployments []Deployment, dae
 			))
 		}
 	}
+	for _, networkPolicy := range networkPolicies {
+		selector, err := networkPolicy.Selector()
+		if err != nil {
+			return pods, err
+		}
+		selectors = append(selectors, match(
+			networkPolicy.Namespace(),
+			selector,
+			report.NetworkPolicy,
+			report.MakeNetworkPolicyNodeID(networkPolicy.UID()),
+		))
+	}
 
 	var localPodUIDs map[string]struct{}
 	if r.nodeName == "" && r.kubeletPort != 0 {
@@ -693,6 +861,59 @@ func (r *Reporter) podTopology(services []Service, deployments []Deployment, dae
 	return pods, err
 }
 
+// hostTopology reports the Kubernetes nodes as hosts, so that they are
+// merged with the hosts reported by Scope probes, and hosts without a probe
+// are shown.
+func (r *Reporter) hostTopology() (report.Topology, error) {
+	result := report.MakeTopology().
+		WithMetadataTemplates(NodeMetadataTemplates).
+		WithMetricTemplates(NodeMetricTemplates).
+		WithTableTemplates(NodeTableTemplates)
+	result.Controls.AddControls([]report.Control{
+		{
+			ID:    CordonNode,
+			Human: "Cordon",
+			Icon:  "fa fa-ban",
+			Rank:  3,
+		},
+		{
+			ID:    UncordonNode,
+			Human: "Uncordon",
+			Icon:  "fa fa-check-circle",
+			Rank:  3,
+		},
+		{
+			ID:           DrainNode,
+			Human:        "Drain",
+			Icon:         "fa fa-sign-out",
+			Confirmation: "Are you sure you want to evict all pods from this node?",
+			Rank:         4,
+		},
+	})
+	requests := map[string]apiv1.ResourceList{}
+	err := r.client.WalkPods(func(p Pod) error {
+		nodeRequests, ok := requests[p.NodeName()]
+		if !ok {
+			nodeRequests = apiv1.ResourceList{}
+			requests[p.NodeName()] = nodeRequests
+		}
+		for name, quantity := range p.ResourceRequests() {
+			total := nodeRequests[name]
+			total.Add(quantity)
+			nodeRequests[name] = total
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	err = r.client.WalkNodes(func(n NodeResource) error {
+		result.AddNode(n.GetNode(r.probeID, requests[n.Name()]))
+		return nil
+	})
+	return result, err
+}
+
 func (r *Reporter) namespaceTopology() (report.Topology, error) {
 	result := report.MakeTopology()
 	err := r.client.WalkNamespaces(func(ns NamespaceResource) error {
@@ -7,12 +7,16 @@ import (
 	"strings"
 	"testing"
 
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	apiv1 "k8s.io/api/core/v1"
 	apiv1beta1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
 	k8smeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe/controls"
@@ -114,10 +118,16 @@ func newMockClient() *mockClient {
 }
 
 type mockClient struct {
-	pods        []kubernetes.Pod
-	services    []kubernetes.Service
-	deployments []kubernetes.Deployment
-	logs        map[string]io.ReadCloser
+	pods            []kubernetes.Pod
+	services        []kubernetes.Service
+	deployments     []kubernetes.Deployment
+	ingresses       []kubernetes.Ingress
+	networkPolicies []kubernetes.NetworkPolicy
+	hpas            []kubernetes.HorizontalPodAutoscaler
+	nodes           []kubernetes.NodeResource
+	logs            map[string]io.ReadCloser
+	cordoned        map[string]bool
+	drained         []string
 }
 
 func (c *mockClient) Stop() {}
@@ -176,6 +186,38 @@ func (c *mockClient) WalkJobs(f func(kubernetes.Job) error) error {
 	return nil
 }
 func (*mockClient) WatchPods(func(kubernetes.Event, kubernetes.Pod)) {}
+func (c *mockClient) WalkIngresses(f func(kubernetes.Ingress) error) error {
+	for _, ingress := range c.ingresses {
+		if err := f(ingress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (c *mockClient) WalkNetworkPolicies(f func(kubernetes.NetworkPolicy) error) error {
+	for _, networkPolicy := range c.networkPolicies {
+		if err := f(networkPolicy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (c *mockClient) WalkHorizontalPodAutoscalers(f func(kubernetes.HorizontalPodAutoscaler) error) error {
+	for _, hpa := range c.hpas {
+		if err := f(hpa); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (c *mockClient) WalkNodes(f func(kubernetes.NodeResource) error) error {
+	for _, node := range c.nodes {
+		if err := f(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 func (c *mockClient) GetLogs(namespaceID, podName string, _ []string) (io.ReadCloser, error) {
 	r, ok := c.logs[namespaceID+";"+podName]
 	if !ok {
@@ -192,6 +234,17 @@ func (c *mockClient) ScaleUp(namespaceID, id string) error {
 func (c *mockClient) ScaleDown(namespaceID, id string) error {
 	return nil
 }
+func (c *mockClient) CordonNode(name string, unschedulable bool) error {
+	if c.cordoned == nil {
+		c.cordoned = map[string]bool{}
+	}
+	c.cordoned[name] = unschedulable
+	return nil
+}
+func (c *mockClient) DrainNode(name string) error {
+	c.drained = append(c.drained, name)
+	return nil
+}
 func (c *mockClient) CloneVolumeSnapshot(namespaceID, VolumeSnapshotID, persistentVolumeClaimID, capacity string) error {
 	return nil
 }
@@ -312,6 +365,251 @@ func TestReporter(t *testing.T) {
 
 }
 
+func TestReporterIngressNetworkPolicyAutoscaler(t *testing.T) {
+	oldGetNodeName := kubernetes.GetLocalPodUIDs
+	defer func() { kubernetes.GetLocalPodUIDs = oldGetNodeName }()
+	kubernetes.GetLocalPodUIDs = func(string) (map[string]struct{}, error) {
+		return map[string]struct{}{pod1UID: {}, pod2UID: {}}, nil
+	}
+
+	minReplicas := int32(2)
+	targetCPU := int32(80)
+	client := newMockClient()
+	client.deployments = []kubernetes.Deployment{kubernetes.NewDeployment(&apiv1beta1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "pong", UID: "deployment1234", Namespace: "ping"},
+	})}
+	client.ingresses = []kubernetes.Ingress{kubernetes.NewIngress(&apiv1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "pong-ingress", UID: "ingress1234", Namespace: "ping"},
+		Spec: apiv1beta1.IngressSpec{
+			Rules: []apiv1beta1.IngressRule{{
+				Host: "pong.example.com",
+				IngressRuleValue: apiv1beta1.IngressRuleValue{HTTP: &apiv1beta1.HTTPIngressRuleValue{
+					Paths: []apiv1beta1.HTTPIngressPath{
+						{Path: "/", Backend: apiv1beta1.IngressBackend{ServiceName: "pongservice", ServicePort: intstr.FromInt(6379)}},
+						{Path: "/missing", Backend: apiv1beta1.IngressBackend{ServiceName: "missing", ServicePort: intstr.FromInt(80)}},
+					},
+				}},
+			}},
+		},
+	})}
+	client.networkPolicies = []kubernetes.NetworkPolicy{kubernetes.NewNetworkPolicy(&networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "pong-policy", UID: "policy1234", Namespace: "ping"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"ponger": "true"}},
+		},
+	})}
+	client.hpas = []kubernetes.HorizontalPodAutoscaler{kubernetes.NewHorizontalPodAutoscaler(&autoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "pong-hpa", UID: "hpa1234", Namespace: "ping"},
+		Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef:                 autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "pong"},
+			MinReplicas:                    &minReplicas,
+			MaxReplicas:                    5,
+			TargetCPUUtilizationPercentage: &targetCPU,
+		},
+		Status: autoscalingv1.HorizontalPodAutoscalerStatus{CurrentReplicas: 2, DesiredReplicas: 3},
+	}), kubernetes.NewHorizontalPodAutoscaler(&autoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "ping-hpa", UID: "hpa5678", Namespace: "ping"},
+		Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{Kind: "ReplicaSet", Name: "ping"},
+			MaxReplicas:    3,
+		},
+	})}
+	hr := controls.NewDefaultHandlerRegistry()
+	rpt, err := kubernetes.NewReporter(client, nil, "probe-id", "foo", nil, hr, "", 0).Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serviceID := report.MakeServiceNodeID(serviceUID)
+	deploymentID := report.MakeDeploymentNodeID("deployment1234")
+
+	// Ingresses are adjacent to the services they route to
+	{
+		node, ok := rpt.Ingress.Nodes[report.MakeIngressNodeID("ingress1234")]
+		if !ok {
+			t.Fatalf("Expected report to have ingress, got %v", rpt.Ingress.Nodes)
+		}
+		if want := report.MakeIDList(serviceID); !reflect.DeepEqual(want, node.Adjacency) {
+			t.Errorf("Expected ingress adjacency %v, got %v", want, node.Adjacency)
+		}
+		for k, want := range map[string]string{
+			kubernetes.IngressHosts:    "pong.example.com",
+			kubernetes.IngressBackends: "missing:80, pongservice:6379",
+			report.ControlProbeID:      "probe-id",
+		} {
+			if have, ok := node.Latest.Lookup(k); !ok || have != want {
+				t.Errorf("Expected ingress latest %q: %q, got %q", k, want, have)
+			}
+		}
+	}
+
+	// Network policies are parents of the pods they select
+	{
+		policyID := report.MakeNetworkPolicyNodeID("policy1234")
+		node, ok := rpt.NetworkPolicy.Nodes[policyID]
+		if !ok {
+			t.Fatalf("Expected report to have network policy, got %v", rpt.NetworkPolicy.Nodes)
+		}
+		if have, ok := node.Latest.Lookup(kubernetes.PodSelector); !ok || have != "ponger=true" {
+			t.Errorf("Expected network policy pod selector, got %q", have)
+		}
+		if have, ok := node.Latest.Lookup(kubernetes.PolicyTypes); !ok || have != "Ingress" {
+			t.Errorf("Expected network policy types, got %q", have)
+		}
+		for _, podID := range []string{report.MakePodNodeID(pod1UID), report.MakePodNodeID(pod2UID)} {
+			if parents, ok := rpt.Pod.Nodes[podID].Parents.Lookup(report.NetworkPolicy); !ok || !parents.Contains(policyID) {
+				t.Errorf("Expected pod %s to have parent network policy %q, got %q", podID, policyID, parents)
+			}
+		}
+	}
+
+	// Autoscalers are linked to the deployments they scale
+	{
+		node, ok := rpt.HorizontalPodAutoscaler.Nodes[report.MakeHorizontalPodAutoscalerNodeID("hpa1234")]
+		if !ok {
+			t.Fatalf("Expected report to have autoscaler, got %v", rpt.HorizontalPodAutoscaler.Nodes)
+		}
+		if parents, ok := node.Parents.Lookup(report.Deployment); !ok || !parents.Contains(deploymentID) {
+			t.Errorf("Expected autoscaler to have parent deployment %q, got %q", deploymentID, parents)
+		}
+		if want := report.MakeIDList(deploymentID); !reflect.DeepEqual(want, node.Adjacency) {
+			t.Errorf("Expected autoscaler adjacency %v, got %v", want, node.Adjacency)
+		}
+		for k, want := range map[string]string{
+			kubernetes.ScaleTarget:          "Deployment/pong",
+			kubernetes.MinReplicas:          "2",
+			kubernetes.MaxReplicas:          "5",
+			kubernetes.TargetCPUUtilization: "80%",
+		} {
+			if have, ok := node.Latest.Lookup(k); !ok || have != want {
+				t.Errorf("Expected autoscaler latest %q: %q, got %q", k, want, have)
+			}
+		}
+		for k, want := range map[string]float64{
+			kubernetes.CurrentReplicas: 2,
+			kubernetes.DesiredReplicas: 3,
+		} {
+			if sample, ok := node.Metrics[k].LastSample(); !ok || sample.Value != want {
+				t.Errorf("Expected autoscaler metric %q: %v, got %v", k, want, sample.Value)
+			}
+		}
+	}
+
+	// Autoscalers of kinds the probe doesn't report only get a label
+	{
+		node, ok := rpt.HorizontalPodAutoscaler.Nodes[report.MakeHorizontalPodAutoscalerNodeID("hpa5678")]
+		if !ok {
+			t.Fatalf("Expected report to have autoscaler, got %v", rpt.HorizontalPodAutoscaler.Nodes)
+		}
+		if node.Parents.Size() != 0 || len(node.Adjacency) != 0 {
+			t.Errorf("Expected autoscaler without parents or adjacency, got %v, %v", node.Parents, node.Adjacency)
+		}
+		if have, ok := node.Latest.Lookup(kubernetes.ScaleTarget); !ok || have != "ReplicaSet/ping" {
+			t.Errorf("Expected autoscaler scale target %q, got %q", "ReplicaSet/ping", have)
+		}
+	}
+}
+
+func TestReporterNodes(t *testing.T) {
+	oldGetNodeName := kubernetes.GetLocalPodUIDs
+	defer func() { kubernetes.GetLocalPodUIDs = oldGetNodeName }()
+	kubernetes.GetLocalPodUIDs = func(string) (map[string]struct{}, error) {
+		return map[string]struct{}{}, nil
+	}
+
+	client := newMockClient()
+	pod := apiPod1
+	pod.Spec.Containers = []apiv1.Container{
+		{Resources: apiv1.ResourceRequirements{Requests: apiv1.ResourceList{
+			apiv1.ResourceCPU:    resource.MustParse("250m"),
+			apiv1.ResourceMemory: resource.MustParse("64Mi"),
+		}}},
+		{Resources: apiv1.ResourceRequirements{Requests: apiv1.ResourceList{
+			apiv1.ResourceCPU: resource.MustParse("250m"),
+		}}},
+	}
+	client.pods = []kubernetes.Pod{kubernetes.NewPod(&pod), pod2}
+	client.nodes = []kubernetes.NodeResource{kubernetes.NewNode(&apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName, UID: "node1234"},
+		Spec: apiv1.NodeSpec{
+			Taints: []apiv1.Taint{{Key: "dedicated", Value: "db", Effect: apiv1.TaintEffectNoSchedule}},
+		},
+		Status: apiv1.NodeStatus{
+			Addresses: []apiv1.NodeAddress{{Type: apiv1.NodeHostName, Address: "host1"}},
+			Allocatable: apiv1.ResourceList{
+				apiv1.ResourceCPU:    resource.MustParse("2"),
+				apiv1.ResourceMemory: resource.MustParse("1Gi"),
+			},
+			Conditions: []apiv1.NodeCondition{
+				{Type: apiv1.NodeReady, Status: apiv1.ConditionTrue},
+				{Type: apiv1.NodeMemoryPressure, Status: apiv1.ConditionFalse},
+			},
+			NodeInfo: apiv1.NodeSystemInfo{KubeletVersion: "v1.12.1"},
+		},
+	})}
+	hr := controls.NewDefaultHandlerRegistry()
+	rpt, err := kubernetes.NewReporter(client, nil, "probe-id", "foo", nil, hr, "", 0).Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostID := report.MakeHostNodeID("host1")
+	node, ok := rpt.Host.Nodes[hostID]
+	if !ok {
+		t.Fatalf("Expected report to have host %q, got %v", hostID, rpt.Host.Nodes)
+	}
+	for k, want := range map[string]string{
+		kubernetes.KubeletVersion:                         "v1.12.1",
+		kubernetes.Unschedulable:                          "false",
+		kubernetes.Taints:                                 "dedicated=db:NoSchedule",
+		kubernetes.AllocatableCPU:                         "2",
+		kubernetes.AllocatableMemory:                      "1Gi",
+		kubernetes.NodeConditionPrefix + "Ready":          "True",
+		kubernetes.NodeConditionPrefix + "MemoryPressure": "False",
+	} {
+		if have, ok := node.Latest.Lookup(k); !ok || have != want {
+			t.Errorf("Expected host latest %q: %q, got %q", k, want, have)
+		}
+	}
+	for k, want := range map[string][2]float64{
+		kubernetes.RequestedCPU:    {0.5, 2},
+		kubernetes.RequestedMemory: {64 << 20, 1 << 30},
+	} {
+		metric := node.Metrics[k]
+		if sample, ok := metric.LastSample(); !ok || sample.Value != want[0] || metric.Max != want[1] {
+			t.Errorf("Expected host metric %q: %v, got %v", k, want, metric)
+		}
+	}
+	// The controls are handled by this probe, whichever probe reports the host.
+	if _, ok := node.Latest.Lookup(report.ControlProbeID); ok {
+		t.Errorf("Expected host not to have a control probe ID")
+	}
+	for control, dead := range map[string]bool{
+		kubernetes.CordonNode:   false,
+		kubernetes.UncordonNode: true,
+		kubernetes.DrainNode:    false,
+	} {
+		if data, ok := node.LatestControls.Lookup(control); !ok || data.Dead != dead || data.ProbeID != "probe-id" {
+			t.Errorf("Expected host control %q dead=%v, got %v", control, dead, data)
+		}
+	}
+
+	// Controls act on the Kubernetes node of the host
+	for _, control := range []string{kubernetes.CordonNode, kubernetes.DrainNode} {
+		resp := hr.HandleControlRequest(xfer.Request{NodeID: hostID, Control: control})
+		if resp.Error != "" {
+			t.Errorf("Unexpected %s error: %s", control, resp.Error)
+		}
+	}
+	if !client.cordoned[nodeName] || !reflect.DeepEqual([]string{nodeName}, client.drained) {
+		t.Errorf("Expected node to be cordoned and drained, got %v, %v", client.cordoned, client.drained)
+	}
+	resp := hr.HandleControlRequest(xfer.Request{NodeID: report.MakeHostNodeID("unknown"), Control: kubernetes.DrainNode})
+	if want := "Node not found: unknown"; resp.Error != want {
+		t.Errorf("Expected error %q, got %q", want, resp.Error)
+	}
+}
+
 func BenchmarkReporter(b *testing.B) {
 	hr := controls.NewDefaultHandlerRegistry()
 	mockK8s := newMockClient()
@@ -0,0 +1,138 @@
+package traces
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/uber/jaeger-client-go/thrift"
+	"github.com/uber/jaeger-client-go/thrift-gen/agent"
+	"github.com/uber/jaeger-client-go/thrift-gen/jaeger"
+	"github.com/uber/jaeger-client-go/thrift-gen/zipkincore"
+	"github.com/uber/jaeger-client-go/utils"
+)
+
+var errZipkinThrift = errors.New("Zipkin Thrift spans are not supported, send Zipkin v2 JSON instead")
+
+// serveJaeger accepts batches of spans sent by Jaeger clients, as to the
+// compact Thrift port of a Jaeger agent.
+func (r *Reporter) serveJaeger(conn net.PacketConn) {
+	var (
+		buf       = make([]byte, utils.UDPPacketMaxLength)
+		processor = agent.NewAgentProcessor(jaegerAgent{r})
+		protocols = thrift.NewTCompactProtocolFactory()
+	)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return // closed by Stop
+		}
+		trans := thrift.NewTMemoryBufferLen(n)
+		trans.Write(buf[:n])
+		protocol := protocols.GetProtocol(trans)
+		if _, err := processor.Process(protocol, protocol); err != nil {
+			log.Debugf("traces: bad Jaeger batch: %v", err)
+		}
+	}
+}
+
+// jaegerAgent implements agent.Agent.
+type jaegerAgent struct {
+	r *Reporter
+}
+
+func (jaegerAgent) EmitZipkinBatch(spans []*zipkincore.Span) error {
+	return errZipkinThrift
+}
+
+func (a jaegerAgent) EmitBatch(batch *jaeger.Batch) error {
+	if batch.Process == nil {
+		return nil
+	}
+	process := jaegerTags(batch.Process.Tags)
+	spans := make([]span, 0, len(batch.Spans))
+	for _, js := range batch.Spans {
+		tags := jaegerTags(js.Tags)
+		var kind string
+		switch tags["span.kind"] {
+		case "client":
+			kind = spanClient
+		case "server":
+			kind = spanServer
+		default:
+			continue
+		}
+		s := span{
+			traceID:       jaegerTraceID(js.TraceIdHigh, js.TraceIdLow),
+			id:            jaegerSpanID(js.SpanId),
+			kind:          kind,
+			service:       batch.Process.ServiceName,
+			local:         address{ip: process["ip"]},
+			remoteService: tags["peer.service"],
+			remote:        address{ip: tags["peer.ipv4"], port: tags["peer.port"]},
+			duration:      time.Duration(js.Duration) * time.Microsecond,
+			err:           tags["error"] == "true",
+		}
+		if s.remote.ip == "" {
+			s.remote.ip = tags["peer.ipv6"]
+		}
+		if js.ParentSpanId != 0 {
+			s.parentID = jaegerSpanID(js.ParentSpanId)
+		} else {
+			for _, ref := range js.References {
+				if ref.RefType == jaeger.SpanRefType_CHILD_OF {
+					s.parentID = jaegerSpanID(ref.SpanId)
+					break
+				}
+			}
+		}
+		for _, tag := range pidTags {
+			if pid, ok := process[tag]; ok {
+				s.pid = pid
+				break
+			}
+		}
+		if code, err := strconv.Atoi(tags["http.status_code"]); err == nil && code >= 500 {
+			s.err = true
+		}
+		spans = append(spans, s)
+	}
+	a.r.add(spans)
+	return nil
+}
+
+// jaegerTags flattens tags to strings. Jaeger clients disagree on the
+// types of some tags, e.g. sending IPs as strings or as packed integers.
+func jaegerTags(tags []*jaeger.Tag) map[string]string {
+	result := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		switch {
+		case tag.VStr != nil:
+			result[tag.Key] = *tag.VStr
+		case tag.VBool != nil:
+			result[tag.Key] = strconv.FormatBool(*tag.VBool)
+		case tag.VLong != nil && (tag.Key == "ip" || tag.Key == "peer.ipv4"):
+			ip := uint32(*tag.VLong)
+			result[tag.Key] = net.IPv4(byte(ip>>24), byte(ip>>16), byte(ip>>8), byte(ip)).String()
+		case tag.VLong != nil:
+			result[tag.Key] = strconv.FormatInt(*tag.VLong, 10)
+		case tag.VDouble != nil:
+			result[tag.Key] = strconv.FormatFloat(*tag.VDouble, 'f', -1, 64)
+		}
+	}
+	return result
+}
+
+func jaegerTraceID(high, low int64) string {
+	if high == 0 {
+		return fmt.Sprintf("%016x", uint64(low))
+	}
+	return fmt.Sprintf("%016x%016x", uint64(high), uint64(low))
+}
+
+func jaegerSpanID(id int64) string {
+	return fmt.Sprintf("%016x", uint64(id))
+}
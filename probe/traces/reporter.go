@@ -0,0 +1,344 @@
+package traces
+
+import (
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/report"
+)
+
+// Node metadata keys.
+const (
+	Service = report.TraceService
+)
+
+const (
+	spanClient = "CLIENT"
+	spanServer = "SERVER"
+
+	// tracePortPrefix marks the port of the synthetic endpoints which
+	// traced calls are drawn from, as the client port is not known.
+	tracePortPrefix = "trace:"
+
+	// maxPendingSpans bounds the number of spans buffered between reports.
+	maxPendingSpans = 100000
+
+	// serverTTL is how long a service is remembered serving where it was
+	// last seen, to find the ends of calls whose spans don't say.
+	serverTTL = 10 * time.Minute
+
+	// maxServers bounds the number of services remembered.
+	maxServers = 10000
+
+	// maxZipkinBodyBytes bounds the size of a POST of Zipkin spans, after
+	// decompression.
+	maxZipkinBodyBytes = 16 << 20
+)
+
+// Tags which processes can use to tell us their pid.
+var pidTags = []string{"process.pid", "pid"}
+
+// span is one side of a call between services, as reported by either
+// Zipkin or Jaeger.
+type span struct {
+	traceID, id, parentID string
+	kind                  string // spanClient or spanServer
+	service               string
+	local                 address
+	pid                   string
+	remoteService         string
+	remote                address
+	duration              time.Duration
+	err                   bool
+}
+
+type address struct {
+	ip, port string
+}
+
+type served struct {
+	addr address
+	seen time.Time
+}
+
+// clean returns the address, without its IP or port if they are not
+// valid, as they are taken from applications' spans and end up in node
+// IDs.
+func (a address) clean() address {
+	if ip := net.ParseIP(a.ip); ip != nil {
+		a.ip = ip.String()
+	} else {
+		a.ip = ""
+	}
+	if port, err := strconv.Atoi(a.port); err != nil || port <= 0 || port > 65535 {
+		a.port = ""
+	}
+	return a
+}
+
+// ReporterConfig are the config options for the traces reporter.
+type ReporterConfig struct {
+	HostID     string
+	ZipkinAddr string // TCP address to accept Zipkin v2 JSON spans on, "" to disable
+	JaegerAddr string // UDP address to accept Jaeger Thrift spans on, "" to disable
+}
+
+// Reporter receives spans from applications on this host and turns the
+// calls between services into edges in the endpoint topology, annotated
+// with request rates, error rates and latency percentiles. Edges are
+// drawn from the process which made the call, or from its IP when the
+// process is unknown, to the address of the server which answered it,
+// so they are rendered alongside the connections between processes
+// and containers.
+//
+// Attributing a call to a process needs the endpoints reported by the
+// endpoint reporter, so Reporter is added to the probe as a Tagger.
+type Reporter struct {
+	conf      ReporterConfig
+	listeners []io.Closer
+
+	mtx     sync.Mutex
+	pending []span
+	carried []span            // client spans whose server was not known at the last report
+	servers map[string]served // where and when each service was last seen serving
+	lastTag time.Time
+}
+
+// NewReporter makes a new Reporter, listening on the configured addresses.
+func NewReporter(conf ReporterConfig) (*Reporter, error) {
+	r := &Reporter{
+		conf:    conf,
+		servers: map[string]served{},
+		lastTag: mtime.Now(),
+	}
+	if conf.ZipkinAddr != "" {
+		listener, err := net.Listen("tcp", conf.ZipkinAddr)
+		if err != nil {
+			return nil, err
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/v2/spans", r.serveZipkin)
+		server := &http.Server{Handler: mux}
+		go server.Serve(listener)
+		r.listeners = append(r.listeners, server)
+	}
+	if conf.JaegerAddr != "" {
+		conn, err := net.ListenPacket("udp", conf.JaegerAddr)
+		if err != nil {
+			r.Stop()
+			return nil, err
+		}
+		go r.serveJaeger(conn)
+		r.listeners = append(r.listeners, conn)
+	}
+	return r, nil
+}
+
+// Stop stops accepting spans.
+func (r *Reporter) Stop() {
+	for _, l := range r.listeners {
+		l.Close()
+	}
+}
+
+// Name of this tagger, for metrics gathering
+func (*Reporter) Name() string { return "Traces" }
+
+func (r *Reporter) add(spans []span) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if len(r.pending)+len(spans) > maxPendingSpans {
+		log.Warnf("traces: dropping %d spans, more than %d since the last report", len(spans), maxPendingSpans)
+		return
+	}
+	for _, s := range spans {
+		s.local, s.remote = s.local.clean(), s.remote.clean()
+		r.pending = append(r.pending, s)
+	}
+}
+
+type edgeKey struct {
+	source  string // synthetic endpoint node ID
+	dest    string // endpoint node ID
+	service string
+	pid     string
+}
+
+type edgeStats struct {
+	destService string
+	durations   []time.Duration
+	errors      int
+}
+
+// Tag implements Tagger, adding an edge for each pair of services seen
+// calling each other since the last report.
+func (r *Reporter) Tag(rpt report.Report) (report.Report, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	now := mtime.Now()
+	period := now.Sub(r.lastTag)
+	if period <= 0 {
+		period = time.Second
+	}
+	spans, carried := r.pending, r.carried
+	r.pending, r.carried, r.lastTag = nil, nil, now
+	for service, s := range r.servers {
+		if now.Sub(s.seen) > serverTTL {
+			delete(r.servers, service)
+		}
+	}
+
+	// Server spans are matched to the client span which made the call:
+	// Jaeger gives them the client span as parent, Zipkin may have both
+	// sides share a span ID.
+	servers := map[string]span{}
+	for _, s := range spans {
+		if s.kind != spanServer {
+			continue
+		}
+		if s.parentID != "" {
+			servers[s.traceID+"/"+s.parentID] = s
+		}
+		servers[s.traceID+"/"+s.id] = s
+		if _, ok := r.servers[s.service]; s.local.ip != "" && (ok || len(r.servers) < maxServers) {
+			r.servers[s.service] = served{s.local, now}
+		}
+	}
+	pids := endpointPIDs(rpt)
+
+	edges := map[edgeKey]*edgeStats{}
+	for i, c := range append(carried, spans...) {
+		if c.kind != spanClient {
+			continue
+		}
+		destService, dest := r.destination(c, servers)
+		if dest.ip == "" {
+			if i >= len(carried) {
+				r.carried = append(r.carried, c)
+			}
+			continue
+		}
+		source, pid := r.source(c, pids)
+		if source == "" {
+			continue
+		}
+		// Service names are escaped, so they can't break up the node ID
+		key := edgeKey{
+			source:  report.MakeEndpointNodeID(r.conf.HostID, "", source, tracePortPrefix+url.QueryEscape(c.service)+">"+dest.ip+":"+dest.port),
+			dest:    report.MakeEndpointNodeID(r.conf.HostID, "", dest.ip, dest.port),
+			service: c.service,
+			pid:     pid,
+		}
+		stats, ok := edges[key]
+		if !ok {
+			stats = &edgeStats{destService: destService}
+			edges[key] = stats
+		}
+		stats.durations = append(stats.durations, c.duration)
+		if c.err {
+			stats.errors++
+		}
+	}
+
+	hostNodeID := report.MakeHostNodeID(r.conf.HostID)
+	for key, stats := range edges {
+		latests := map[string]string{
+			report.HostNodeID: hostNodeID,
+			Service:           key.service,
+		}
+		if key.pid != "" {
+			latests[report.PID] = key.pid
+		}
+		rpt.Endpoint.AddNode(report.MakeNodeWith(key.source, latests).WithEdge(key.dest, stats.edgeMetadata(period, now)))
+		dest := report.MakeNode(key.dest)
+		if stats.destService != "" {
+			dest = dest.WithLatest(Service, now, stats.destService)
+		}
+		rpt.Endpoint.AddNode(dest)
+	}
+	return rpt, nil
+}
+
+// destination works out which service a client span called, and the
+// address it answered on, preferring what the server said about itself.
+func (r *Reporter) destination(c span, servers map[string]span) (string, address) {
+	service, addr := c.remoteService, c.remote
+	if s, ok := servers[c.traceID+"/"+c.id]; ok {
+		service = s.service
+		if s.local.ip != "" {
+			if s.local.port == "" && (addr.ip == "" || addr.ip == s.local.ip) {
+				s.local.port = addr.port
+			}
+			addr = s.local
+		}
+	}
+	if addr.ip == "" && service != "" {
+		addr = r.servers[service].addr
+	}
+	return service, addr
+}
+
+// source works out the IP and, if possible, the pid of the process
+// which made the call described by a client span.
+func (r *Reporter) source(c span, pids map[address]string) (string, string) {
+	ip, pid := c.local.ip, c.pid
+	s, ok := r.servers[c.service]
+	if ip == "" && ok {
+		ip = s.addr.ip
+	}
+	if pid == "" && ok && s.addr.ip == ip {
+		pid = pids[s.addr]
+	}
+	return ip, pid
+}
+
+// endpointPIDs indexes the pids of the processes behind the endpoints
+// in the report by address.
+func endpointPIDs(rpt report.Report) map[address]string {
+	pids := map[address]string{}
+	for id, n := range rpt.Endpoint.Nodes {
+		pid, ok := n.Latest.Lookup(report.PID)
+		if !ok {
+			continue
+		}
+		if _, ip, port, ok := report.ParseEndpointNodeID(id); ok {
+			pids[address{ip, port}] = pid
+		}
+	}
+	return pids
+}
+
+func (s *edgeStats) edgeMetadata(period time.Duration, now time.Time) report.EdgeMetadata {
+	sort.Slice(s.durations, func(i, j int) bool { return s.durations[i] < s.durations[j] })
+	return report.EdgeMetadata{
+		RequestRate: float64(len(s.durations)) / period.Seconds(),
+		ErrorRate:   float64(s.errors) / period.Seconds(),
+		LatencyP50:  percentile(s.durations, 0.5),
+		LatencyP95:  percentile(s.durations, 0.95),
+		LatencyP99:  percentile(s.durations, 0.99),
+		LastSeen:    now,
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
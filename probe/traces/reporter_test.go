@@ -0,0 +1,287 @@
+package traces_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/jaeger-client-go/thrift-gen/jaeger"
+	"github.com/uber/jaeger-client-go/utils"
+
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/scope/probe/traces"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+const hostID = "host1"
+
+var (
+	frontendID = report.MakeEndpointNodeID(hostID, "", "10.0.0.1", "trace:frontend>10.0.0.2:8080")
+	backendID  = report.MakeEndpointNodeID(hostID, "", "10.0.0.2", "8080")
+)
+
+// freeAddr finds a local port which is not in use.
+func freeAddr(t *testing.T, network string) string {
+	var addr string
+	if network == "udp" {
+		conn, err := net.ListenPacket(network, "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr = conn.LocalAddr().String()
+		conn.Close()
+	} else {
+		l, err := net.Listen(network, "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr = l.Addr().String()
+		l.Close()
+	}
+	return addr
+}
+
+func postZipkin(t *testing.T, addr string, spans ...map[string]interface{}) {
+	body, err := json.Marshal(spans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.Post("http://"+addr+"/api/v2/spans", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST spans: %s", res.Status)
+	}
+}
+
+func endpoint(service, ip string, port int) map[string]interface{} {
+	return map[string]interface{}{"serviceName": service, "ipv4": ip, "port": port}
+}
+
+func TestZipkin(t *testing.T) {
+	start := time.Now()
+	mtime.NowForce(start)
+	defer mtime.NowReset()
+
+	addr := freeAddr(t, "tcp")
+	r, err := traces.NewReporter(traces.ReporterConfig{HostID: hostID, ZipkinAddr: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	postZipkin(t, addr,
+		map[string]interface{}{
+			"traceId": "t1", "id": "a", "kind": "SERVER", "duration": 30000,
+			"localEndpoint": endpoint("frontend", "10.0.0.1", 80),
+		},
+		map[string]interface{}{
+			"traceId": "t1", "id": "b", "parentId": "a", "kind": "CLIENT", "duration": 20000,
+			"localEndpoint": endpoint("frontend", "10.0.0.1", 0),
+		},
+		map[string]interface{}{
+			"traceId": "t1", "id": "c", "parentId": "b", "kind": "SERVER", "duration": 15000,
+			"localEndpoint": endpoint("backend", "10.0.0.2", 8080),
+		},
+		map[string]interface{}{
+			"traceId": "t2", "id": "d", "kind": "CLIENT", "duration": 10000,
+			"localEndpoint":  endpoint("frontend", "10.0.0.1", 0),
+			"remoteEndpoint": map[string]interface{}{"serviceName": "backend"},
+			"tags":           map[string]string{"http.status_code": "503"},
+		},
+	)
+
+	// The frontend's pid is found from the endpoint it serves on
+	rpt := report.MakeReport()
+	rpt.Endpoint.AddNode(report.MakeNodeWith(report.MakeEndpointNodeID(hostID, "", "10.0.0.1", "80"), map[string]string{report.PID: "42"}))
+	mtime.NowForce(start.Add(2 * time.Second))
+	rpt, err = r.Tag(rpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frontend, ok := rpt.Endpoint.Nodes[frontendID]
+	if !ok {
+		t.Fatalf("Expected an endpoint for the frontend's calls, got %v", rpt.Endpoint.Nodes)
+	}
+	for key, want := range map[string]string{
+		report.PID:        "42",
+		report.HostNodeID: report.MakeHostNodeID(hostID),
+		traces.Service:    "frontend",
+	} {
+		if have, _ := frontend.Latest.Lookup(key); have != want {
+			t.Errorf("Expected %s %q, got %q", key, want, have)
+		}
+	}
+	md, ok := frontend.Edges.Lookup(backendID)
+	if !ok {
+		t.Fatalf("Expected an edge to the backend, got %v", frontend.Edges)
+	}
+	want := report.EdgeMetadata{
+		RequestRate: 1,
+		ErrorRate:   0.5,
+		LatencyP50:  10 * time.Millisecond,
+		LatencyP95:  20 * time.Millisecond,
+		LatencyP99:  20 * time.Millisecond,
+		LastSeen:    start.Add(2 * time.Second),
+	}
+	if md != want {
+		t.Errorf("Expected %+v, got %+v", want, md)
+	}
+	if service, _ := rpt.Endpoint.Nodes[backendID].Latest.Lookup(traces.Service); service != "backend" {
+		t.Errorf("Expected the backend endpoint to be tagged, got %q", service)
+	}
+
+	// A call whose server is not known yet is held over to the next report
+	postZipkin(t, addr, map[string]interface{}{
+		"traceId": "t3", "id": "e", "kind": "CLIENT", "duration": 5000,
+		"localEndpoint": endpoint("frontend", "10.0.0.1", 0),
+	})
+	mtime.NowForce(start.Add(3 * time.Second))
+	rpt, _ = r.Tag(report.MakeReport())
+	if len(rpt.Endpoint.Nodes) != 0 {
+		t.Errorf("Expected no edges, got %v", rpt.Endpoint.Nodes)
+	}
+	postZipkin(t, addr, map[string]interface{}{
+		"traceId": "t3", "id": "f", "parentId": "e", "kind": "SERVER", "duration": 4000,
+		"localEndpoint": endpoint("backend", "10.0.0.2", 8080),
+	})
+	mtime.NowForce(start.Add(4 * time.Second))
+	rpt, _ = r.Tag(report.MakeReport())
+	if md, _ := rpt.Endpoint.Nodes[frontendID].Edges.Lookup(backendID); md.RequestRate != 1 || md.LatencyP50 != 5*time.Millisecond {
+		t.Errorf("Expected the held over call, got %+v", md)
+	}
+
+	// Service names and addresses can't break up node IDs
+	postZipkin(t, addr,
+		map[string]interface{}{
+			"traceId": "t4", "id": "g", "kind": "CLIENT", "duration": 5000,
+			"localEndpoint": endpoint("front;end", "10.0.0.1", 0),
+		},
+		map[string]interface{}{
+			"traceId": "t4", "id": "h", "parentId": "g", "kind": "SERVER", "duration": 4000,
+			"localEndpoint": endpoint("backend", "10.0.0.2;x", 8080),
+		},
+	)
+	mtime.NowForce(start.Add(5 * time.Second))
+	rpt, _ = r.Tag(report.MakeReport())
+	for id := range rpt.Endpoint.Nodes {
+		if _, ip, _, ok := report.ParseEndpointNodeID(id); !ok || (ip != "10.0.0.1" && ip != "10.0.0.2") {
+			t.Errorf("Expected valid endpoint node IDs, got %q", id)
+		}
+	}
+	if _, ok := rpt.Endpoint.Nodes[report.MakeEndpointNodeID(hostID, "", "10.0.0.1", "trace:front%3Bend>10.0.0.2:8080")]; !ok {
+		t.Errorf("Expected the service name to be escaped, got %v", rpt.Endpoint.Nodes)
+	}
+
+	// Where services serve is forgotten once they haven't been seen for a
+	// while
+	postZipkin(t, addr, map[string]interface{}{
+		"traceId": "t5", "id": "i", "kind": "CLIENT", "duration": 5000,
+		"localEndpoint":  endpoint("frontend", "10.0.0.1", 0),
+		"remoteEndpoint": map[string]interface{}{"serviceName": "backend"},
+	})
+	mtime.NowForce(start.Add(time.Hour))
+	rpt, _ = r.Tag(report.MakeReport())
+	if len(rpt.Endpoint.Nodes) != 0 {
+		t.Errorf("Expected no edges, got %v", rpt.Endpoint.Nodes)
+	}
+}
+
+func TestZipkinBodyTooLarge(t *testing.T) {
+	addr := freeAddr(t, "tcp")
+	r, err := traces.NewReporter(traces.ReporterConfig{HostID: hostID, ZipkinAddr: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	// Gzipped, so the limit applies to the decompressed body
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	gz.Write(append([]byte("["), bytes.Repeat([]byte(" "), 17<<20)...))
+	gz.Close()
+	req, err := http.NewRequest("POST", "http://"+addr+"/api/v2/spans", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Encoding", "gzip")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got %s", http.StatusBadRequest, res.Status)
+	}
+}
+
+func TestJaeger(t *testing.T) {
+	mtime.NowForce(time.Now())
+	defer mtime.NowReset()
+
+	addr := freeAddr(t, "udp")
+	r, err := traces.NewReporter(traces.ReporterConfig{HostID: hostID, JaegerAddr: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	client, err := utils.NewAgentClientUDP(addr, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	str := func(key, value string) *jaeger.Tag {
+		return &jaeger.Tag{Key: key, VType: jaeger.TagType_STRING, VStr: &value}
+	}
+	long := func(key string, value int64) *jaeger.Tag {
+		return &jaeger.Tag{Key: key, VType: jaeger.TagType_LONG, VLong: &value}
+	}
+	isError := true
+	err = client.EmitBatch(&jaeger.Batch{
+		Process: &jaeger.Process{
+			ServiceName: "frontend",
+			Tags:        []*jaeger.Tag{str("ip", "10.0.0.1"), long("process.pid", 42)},
+		},
+		Spans: []*jaeger.Span{{
+			TraceIdLow: 1,
+			SpanId:     2,
+			Duration:   7000,
+			Tags: []*jaeger.Tag{
+				str("span.kind", "client"),
+				str("peer.service", "backend"),
+				long("peer.ipv4", 10<<24|2),
+				long("peer.port", 8080),
+				{Key: "error", VType: jaeger.TagType_BOOL, VBool: &isError},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Poll(t, time.Second, report.EdgeMetadata{
+		RequestRate: 1,
+		ErrorRate:   1,
+		LatencyP50:  7 * time.Millisecond,
+		LatencyP95:  7 * time.Millisecond,
+		LatencyP99:  7 * time.Millisecond,
+		LastSeen:    mtime.Now(),
+	}, func() interface{} {
+		rpt, _ := r.Tag(report.MakeReport())
+		frontend := rpt.Endpoint.Nodes[frontendID]
+		if pid, _ := frontend.Latest.Lookup(report.PID); pid != "42" {
+			return nil
+		}
+		md, _ := frontend.Edges.Lookup(backendID)
+		return md
+	})
+}
@@ -0,0 +1,111 @@
+package traces
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// zipkinSpan is a span in the Zipkin v2 JSON format.
+type zipkinSpan struct {
+	TraceID        string            `json:"traceId"`
+	ID             string            `json:"id"`
+	ParentID       string            `json:"parentId"`
+	Kind           string            `json:"kind"`
+	Duration       int64             `json:"duration"` // microseconds
+	LocalEndpoint  *zipkinEndpoint   `json:"localEndpoint"`
+	RemoteEndpoint *zipkinEndpoint   `json:"remoteEndpoint"`
+	Tags           map[string]string `json:"tags"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+	IPv4        string `json:"ipv4"`
+	IPv6        string `json:"ipv6"`
+	Port        int    `json:"port"`
+}
+
+func (e *zipkinEndpoint) address() address {
+	if e == nil {
+		return address{}
+	}
+	addr := address{ip: e.IPv4}
+	if addr.ip == "" {
+		addr.ip = e.IPv6
+	}
+	if e.Port > 0 {
+		addr.port = strconv.Itoa(e.Port)
+	}
+	return addr
+}
+
+func (e *zipkinEndpoint) service() string {
+	if e == nil {
+		return ""
+	}
+	return e.ServiceName
+}
+
+// serveZipkin accepts spans POSTed by Zipkin reporters, as to the
+// /api/v2/spans endpoint of a Zipkin collector.
+func (r *Reporter) serveZipkin(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	var body io.ReadCloser = http.MaxBytesReader(w, req.Body, maxZipkinBodyBytes)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = http.MaxBytesReader(w, gz, maxZipkinBodyBytes)
+	}
+	var zipkinSpans []zipkinSpan
+	if err := json.NewDecoder(body).Decode(&zipkinSpans); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	spans := make([]span, 0, len(zipkinSpans))
+	for _, zs := range zipkinSpans {
+		if s, ok := zs.span(); ok {
+			spans = append(spans, s)
+		}
+	}
+	r.add(spans)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (zs zipkinSpan) span() (span, bool) {
+	if zs.Kind != spanClient && zs.Kind != spanServer {
+		return span{}, false
+	}
+	s := span{
+		traceID:       zs.TraceID,
+		id:            zs.ID,
+		parentID:      zs.ParentID,
+		kind:          zs.Kind,
+		service:       zs.LocalEndpoint.service(),
+		local:         zs.LocalEndpoint.address(),
+		remoteService: zs.RemoteEndpoint.service(),
+		remote:        zs.RemoteEndpoint.address(),
+		duration:      time.Duration(zs.Duration) * time.Microsecond,
+	}
+	for _, tag := range pidTags {
+		if pid, ok := zs.Tags[tag]; ok {
+			s.pid = pid
+			break
+		}
+	}
+	if _, ok := zs.Tags["error"]; ok {
+		s.err = true
+	} else if code, err := strconv.Atoi(zs.Tags["http.status_code"]); err == nil && code >= 500 {
+		s.err = true
+	}
+	return s, true
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"crypto/subtle"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"math/rand"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"net/url"
+	"os"
+	"os/signal"
 	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/goji/httpauth"
@@ -53,17 +60,22 @@ func init() {
 }
 
 // Router creates the mux for all the various app components.
-func router(collector app.Collector, controlRouter app.ControlRouter, pipeRouter app.PipeRouter, externalUI bool, capabilities map[string]bool, metricsGraphURL string) http.Handler {
+func router(collector app.Collector, userIDer app.UserIDer, authorizer *app.ControlAuthorizer, controlRouter app.ControlRouter, pipeRouter app.PipeRouter, externalServices *app.ExternalServices, alerter *app.Alerter, auditor *app.Auditor, recorder *app.Recorder, events app.EventStore, externalUI bool, capabilities map[string]bool, metricsGraphURL string) http.Handler {
 	router := mux.NewRouter().SkipClean(true)
 
 	// We pull in the http.DefaultServeMux to get the pprof routes
 	router.PathPrefix("/debug/pprof").Handler(http.DefaultServeMux)
 	router.Path("/metrics").Handler(prometheus.Handler())
 
-	app.RegisterReportPostHandler(collector, router)
-	app.RegisterControlRoutes(router, controlRouter)
+	app.RegisterReportPostHandler(collector, router, userIDer)
+	app.RegisterControlRoutes(router, controlRouter, collector, authorizer)
 	app.RegisterPipeRoutes(router, pipeRouter)
-	app.RegisterTopologyRoutes(router, app.WebReporter{Reporter: collector, MetricsGraphURL: metricsGraphURL}, capabilities)
+	app.RegisterTopologyRoutes(router, app.WebReporter{Reporter: collector, MetricsGraphURL: metricsGraphURL, Events: events, Authorizer: authorizer}, capabilities)
+	app.RegisterExternalServicesRoutes(router, externalServices, authorizer)
+	app.RegisterAlertRoutes(router, alerter)
+	app.RegisterAuditRoutes(router, auditor, authorizer)
+	app.RegisterRecordingRoutes(router, recorder, collector, authorizer)
+	app.RegisterEventRoutes(router, events)
 
 	uiHandler := http.FileServer(GetFS(externalUI))
 	router.PathPrefix("/ui").Name("static").Handler(
@@ -77,13 +89,15 @@ func router(collector app.Collector, controlRouter app.ControlRouter, pipeRouter
 			Duration:     requestDuration,
 		},
 		middleware.Tracer{},
+		externalServices,
 	)
 
 	return middlewares.Wrap(router)
 }
 
 func collectorFactory(userIDer multitenant.UserIDer, collectorURL, s3URL, natsHostname string,
-	memcacheConfig multitenant.MemcacheConfig, window time.Duration, maxTopNodes int, createTables bool) (app.Collector, error) {
+	memcacheConfig multitenant.MemcacheConfig, window time.Duration, maxTopNodes int, createTables bool,
+	retention time.Duration, maxSize int64) (app.Collector, error) {
 	if collectorURL == "local" {
 		return app.NewCollector(window), nil
 	}
@@ -96,6 +110,13 @@ func collectorFactory(userIDer multitenant.UserIDer, collectorURL, s3URL, natsHo
 	switch parsed.Scheme {
 	case "file":
 		return app.NewFileCollector(parsed.Path, window)
+	case "leveldb":
+		return app.NewLevelDBCollector(app.LevelDBCollectorConfig{
+			Path:      parsed.Path,
+			Window:    window,
+			Retention: retention,
+			MaxSize:   maxSize,
+		})
 	case "dynamodb":
 		s3, err := url.Parse(s3URL)
 		if err != nil {
@@ -177,6 +198,59 @@ func controlRouterFactory(userIDer multitenant.UserIDer, controlRouterURL string
 	return nil, fmt.Errorf("Invalid control router '%s'", controlRouterURL)
 }
 
+// controlAuthorizerFactory makes the authorizer of controls, identifying
+// users as flags say.
+func controlAuthorizerFactory(flags appFlags) (*app.ControlAuthorizer, error) {
+	authorizer := &app.ControlAuthorizer{
+		UserIDHeader: flags.userIDHeader,
+		BasicAuth:    flags.basicAuth,
+	}
+	if flags.userIDTrustedProxies != "" {
+		for _, cidr := range strings.Split(flags.userIDTrustedProxies, ",") {
+			_, proxy, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				return nil, err
+			}
+			authorizer.TrustedProxies = append(authorizer.TrustedProxies, proxy)
+		}
+	}
+	if flags.controlPolicyFile != "" {
+		policy, err := app.LoadControlPolicy(flags.controlPolicyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading control policy from %s: %v", flags.controlPolicyFile, err)
+		}
+		authorizer.Policy = policy
+		log.Infof("Authorizing controls with %d rules from %s", len(policy.Rules), flags.controlPolicyFile)
+		if flags.userIDHeader != "" && len(authorizer.TrustedProxies) == 0 {
+			log.Warnf("No proxies are trusted to set %s; all users are anonymous to the control policy", flags.userIDHeader)
+		}
+	}
+	return authorizer, nil
+}
+
+// auditorFactory makes the auditor writing to the sinks in flags.
+func auditorFactory(flags appFlags, authorizer *app.ControlAuthorizer) (*app.Auditor, error) {
+	sinks := []app.AuditSink{}
+	if flags.auditFile != "" {
+		sink, err := app.NewFileAuditSink(flags.auditFile)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if flags.auditSyslog != "" {
+		sink, err := app.NewSyslogAuditSink(flags.auditSyslog)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if flags.auditWebhook != "" {
+		sinks = append(sinks, app.NewWebhookAuditSink(flags.auditWebhook))
+	}
+	return app.NewAuditor(sinks, flags.auditRecords, flags.auditTranscripts, authorizer), nil
+}
+
 func pipeRouterFactory(userIDer multitenant.UserIDer, pipeRouterURL, consulInf string) (app.PipeRouter, error) {
 	if pipeRouterURL == "local" {
 		return app.NewLocalPipeRouter(), nil
@@ -234,11 +308,23 @@ func appMain(flags appFlags) {
 			Service:          flags.memcachedService,
 			CompressionLevel: flags.memcachedCompressionLevel,
 		},
-		flags.window, flags.maxTopNodes, flags.awsCreateTables)
+		flags.window, flags.maxTopNodes, flags.awsCreateTables,
+		flags.collectorRetention, flags.collectorMaxSize)
 	if err != nil {
 		log.Fatalf("Error creating collector: %v", err)
 		return
 	}
+	if closer, ok := collector.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	var events app.EventStore
+	if flags.events {
+		events = collector
+		detector := app.NewEventDetector(collector, collector)
+		detector.Start()
+		defer detector.Stop()
+	}
 
 	if flags.BillingEmitterConfig.Enabled {
 		billingEmitter, err := emitterFactory(collector, flags.BillingClientConfig, userIDer, flags.BillingEmitterConfig)
@@ -262,6 +348,33 @@ func appMain(flags appFlags) {
 		return
 	}
 
+	authorizer, err := controlAuthorizerFactory(flags)
+	if err != nil {
+		log.Fatalf("Error creating control authorizer: %v", err)
+		return
+	}
+
+	auditor, err := auditorFactory(flags, authorizer)
+	if err != nil {
+		log.Fatalf("Error creating auditor: %v", err)
+		return
+	}
+	defer auditor.Stop()
+	controlRouter = app.NewAuditingControlRouter(controlRouter, auditor)
+	pipeRouter = app.NewAuditingPipeRouter(pipeRouter, auditor)
+
+	var recorder *app.Recorder
+	if flags.recordingsDir != "" {
+		recorder, err = app.NewRecorder(flags.recordingsDir, strings.Split(flags.recordingsControls, ","), authorizer)
+		if err != nil {
+			log.Fatalf("Error creating recorder: %v", err)
+			return
+		}
+		controlRouter = app.NewRecordingControlRouter(controlRouter, recorder)
+		pipeRouter = app.NewRecordingPipeRouter(pipeRouter, recorder)
+		log.Infof("Recording terminal sessions to %s", flags.recordingsDir)
+	}
+
 	// Start background version checking
 	checkpoint.CheckInterval(&checkpoint.CheckParams{
 		Product: "scope-app",
@@ -289,11 +402,40 @@ func appMain(flags appFlags) {
 		}
 	}
 
+	externalServices, err := app.NewExternalServices(flags.externalServicesFile)
+	if err != nil {
+		log.Fatalf("Error loading external services: %v", err)
+		return
+	}
+	if flags.externalServicesFile != "" {
+		go reloadOnHangup(externalServices)
+	}
+
+	var alerter *app.Alerter
+	if flags.alertsFile != "" {
+		if _, ok := collector.(multitenant.AWSCollector); ok {
+			log.Fatalf("Alerts are not supported with the multitenant collector")
+			return
+		}
+		alertConfig, err := app.LoadAlertConfig(flags.alertsFile)
+		if err != nil {
+			log.Fatalf("Error loading alerts from %s: %v", flags.alertsFile, err)
+			return
+		}
+		notifiers := []app.AlertNotifier{app.NewWebhookNotifier(alertConfig.Webhooks)}
+		alerter = app.NewAlerter(collector, alertConfig.Rules, notifiers, flags.alertsInterval)
+		alerter.RenderWith(externalServices)
+		alerter.Start()
+		defer alerter.Stop()
+		log.Infof("Evaluating %d alerting rules from %s", len(alertConfig.Rules), flags.alertsFile)
+	}
+
 	capabilities := map[string]bool{
 		xfer.HistoricReportsCapability: collector.HasHistoricReports(),
+		xfer.StreamCapability:          flags.probeStream,
 	}
 	logger := logging.Logrus(log.StandardLogger())
-	handler := router(collector, controlRouter, pipeRouter, flags.externalUI, capabilities, flags.metricsGraphURL)
+	handler := router(collector, app.UserIDer(userIDer), authorizer, controlRouter, pipeRouter, externalServices, alerter, auditor, recorder, events, flags.externalUI, capabilities, flags.metricsGraphURL)
 	if flags.logHTTP {
 		handler = middleware.Log{
 			Log:               logger,
@@ -319,9 +461,30 @@ func appMain(flags appFlags) {
 			MaxHeaderBytes: 1 << 20,
 		},
 	}
+	listener, err := net.Listen("tcp", flags.listen)
+	if err != nil {
+		log.Fatalf("Error listening on %s: %v", flags.listen, err)
+		return
+	}
+	httpListener := listener
+	if flags.probeStream {
+		var streamListener net.Listener
+		httpListener, streamListener = app.SplitListener(listener)
+		var authorize func(http.Header) bool
+		if flags.basicAuth {
+			authorize = basicAuthorizer(flags.username, flags.password)
+		}
+		streamServer := app.NewStreamServer(collector, controlRouter, pipeRouter, authorize, app.UserIDer(userIDer))
+		defer streamServer.Stop()
+		go func() {
+			if err := streamServer.Serve(streamListener); err != nil {
+				log.Debugf("Probe stream server exiting: %v", err)
+			}
+		}()
+	}
 	go func() {
 		log.Infof("listening on %s", flags.listen)
-		if err := server.ListenAndServe(); err != nil {
+		if err := server.Serve(httpListener); err != nil {
 			log.Error(err)
 		}
 	}()
@@ -336,6 +499,26 @@ func appMain(flags appFlags) {
 	)
 }
 
+// basicAuthorizer checks probes' streams carry the credentials the HTTP
+// API requires.
+func basicAuthorizer(username, password string) func(http.Header) bool {
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	return func(headers http.Header) bool {
+		return subtle.ConstantTimeCompare([]byte(headers.Get("Authorization")), []byte(want)) == 1
+	}
+}
+
+// reloadOnHangup reloads the external service catalogue on every SIGHUP.
+func reloadOnHangup(externalServices *app.ExternalServices) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	for range hangups {
+		if err := externalServices.Reload(); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
 // stopper adapts graceful.Server's interface to signals.SignalReceiver's interface.
 type stopper struct {
 	Server      *graceful.Server
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/weaveworks/scope/probe/appclient"
+)
+
+// Main runner for exporting a topology, rendered by a running app, as a
+// graph. Writes it to stdout, or the output file if given. Authenticates
+// with the app as the probe would, given the same flags.
+func exportMain(flags exportFlags, probe probeFlags) {
+	if flags.topology == "" {
+		log.Fatal("--export.topology is required")
+	}
+	u, err := url.Parse(flags.appURL)
+	if err != nil {
+		log.Fatalf("Invalid app URL %q: %v", flags.appURL, err)
+	}
+	query, err := url.ParseQuery(flags.options)
+	if err != nil {
+		log.Fatalf("Invalid topology options %q: %v", flags.options, err)
+	}
+	query.Set("format", flags.format)
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/topology/" + flags.topology + "/export"
+	u.RawQuery = query.Encode()
+
+	probeConfig := appclient.ProbeConfig{
+		BasicAuth:    probe.basicAuth,
+		Token:        probeToken(probe, u),
+		ProbeVersion: version,
+		Insecure:     probe.insecure,
+	}
+	client, req, err := probeConfig.AuthorizedClient("GET", u, nil)
+	if err != nil {
+		log.Fatalf("Error exporting topology: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Fatalf("Error exporting topology: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Fatalf("Error exporting topology: %s: %s", resp.Status, body)
+	}
+
+	out := os.Stdout
+	if flags.output != "" {
+		if out, err = os.Create(flags.output); err != nil {
+			log.Fatalf("Error creating %s: %v", flags.output, err)
+		}
+		defer out.Close()
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		log.Fatalf("Error writing topology: %v", err)
+	}
+}
@@ -78,8 +78,10 @@ func setLogLevel(levelname string) {
 }
 
 type flags struct {
-	probe probeFlags
-	app   appFlags
+	probe         probeFlags
+	app           appFlags
+	networkPolicy networkPolicyFlags
+	export        exportFlags
 
 	mode                             string
 	debug                            bool
@@ -100,6 +102,8 @@ type probeFlags struct {
 	token                  string
 	httpListen             string
 	publishInterval        time.Duration
+	fullReportInterval     time.Duration
+	stream                 bool
 	spyInterval            time.Duration
 	pluginsRoot            string
 	insecure               bool
@@ -114,6 +118,14 @@ type probeFlags struct {
 	useConntrack        bool // Use conntrack for endpoint topo
 	conntrackBufferSize int  // Sie of kernel buffer for conntrack
 
+	udpEnabled   bool   // Track UDP flows in conntrack
+	udpPorts     string // Only UDP flows to these ports
+	udpPeers     string // Only UDP flows to/from these networks
+	udpAggregate bool   // Fold UDP clients' ephemeral ports
+
+	tracesZipkinAddr string // Accept Zipkin v2 JSON spans on this address
+	tracesJaegerAddr string // Accept Jaeger Thrift spans on this UDP address
+
 	spyProcs    bool // Associate endpoints with processes (must be root)
 	procEnabled bool // Produce process topology & process nodes in endpoint
 	useEbpfConn bool // Enable connection tracking with eBPF
@@ -131,6 +143,8 @@ type probeFlags struct {
 	kubernetesNodeName     string
 	kubernetesClientConfig kubernetes.ClientConfig
 	kubernetesKubeletPort  uint
+	kubernetesKubeProxy    bool
+	kubernetesIPTables     bool
 
 	ecsEnabled       bool
 	ecsCacheSize     int
@@ -151,6 +165,7 @@ type appFlags struct {
 	logPrefix      string
 	logHTTP        bool
 	logHTTPHeaders bool
+	probeStream    bool
 
 	basicAuth bool
 	username  string
@@ -163,6 +178,8 @@ type appFlags struct {
 	dockerEndpoint string
 
 	collectorURL              string
+	collectorRetention        time.Duration
+	collectorMaxSize          int64
 	s3URL                     string
 	controlRouterURL          string
 	controlRPCTimeout         time.Duration
@@ -174,9 +191,22 @@ type appFlags struct {
 	memcachedExpiration       time.Duration
 	memcachedCompressionLevel int
 	userIDHeader              string
+	userIDTrustedProxies      string
 	externalUI                bool
 	metricsGraphURL           string
 	serviceName               string
+	externalServicesFile      string
+	alertsFile                string
+	controlPolicyFile         string
+	auditRecords              int
+	auditFile                 string
+	auditSyslog               string
+	auditWebhook              string
+	auditTranscripts          bool
+	recordingsDir             string
+	recordingsControls        string
+	alertsInterval            time.Duration
+	events                    bool
 
 	blockProfileRate int
 
@@ -187,6 +217,21 @@ type appFlags struct {
 	BillingClientConfig billing.Config
 }
 
+type networkPolicyFlags struct {
+	appURL    string
+	namespace string
+	from      string
+	to        string
+}
+
+type exportFlags struct {
+	appURL   string
+	topology string
+	format   string
+	options  string
+	output   string
+}
+
 type containerLabelFiltersFlag struct {
 	apiTopologyOptions []app.APITopologyOption
 	filterNumber       int
@@ -296,6 +341,8 @@ func setupFlags(flags *flags) {
 	flag.StringVar(&flags.probe.token, probeTokenFlag, "", "Token to authenticate with cloud.weave.works")
 	flag.StringVar(&flags.probe.httpListen, "probe.http.listen", "", "listen address for HTTP profiling and instrumentation server")
 	flag.DurationVar(&flags.probe.publishInterval, "probe.publish.interval", 3*time.Second, "publish (output) interval")
+	flag.DurationVar(&flags.probe.fullReportInterval, "probe.publish.full-report-interval", 0, "publish a full report at this interval, and deltas against the last one the app acknowledged otherwise (0 to always publish full reports)")
+	flag.BoolVar(&flags.probe.stream, "probe.publish.stream", false, "connect to apps which support it over a single gRPC stream, rather than HTTP and websockets")
 	flag.DurationVar(&flags.probe.spyInterval, "probe.spy.interval", time.Second, "spy (scan) interval")
 	flag.StringVar(&flags.probe.pluginsRoot, "probe.plugins.root", "/var/run/scope/plugins", "Root directory to search for plugins")
 	flag.BoolVar(&flags.probe.noControls, "probe.no-controls", false, "Disable controls (e.g. start/stop containers, terminals, logs ...)")
@@ -310,6 +357,12 @@ func setupFlags(flags *flags) {
 	// Proc & endpoint
 	flag.BoolVar(&flags.probe.useConntrack, "probe.conntrack", true, "also use conntrack to track connections")
 	flag.IntVar(&flags.probe.conntrackBufferSize, "probe.conntrack.buffersize", 4096*1024, "conntrack buffer size")
+	flag.BoolVar(&flags.probe.udpEnabled, "probe.udp", false, "also track UDP flows; these only come from conntrack, as eBPF only tracks TCP connections, so this needs probe.conntrack")
+	flag.StringVar(&flags.probe.udpPorts, "probe.udp.ports", "", "only track UDP flows to these comma-separated ports (default all)")
+	flag.StringVar(&flags.probe.udpPeers, "probe.udp.peers", "", "only track UDP flows to or from these comma-separated CIDRs (default all)")
+	flag.BoolVar(&flags.probe.udpAggregate, "probe.udp.aggregate", false, "fold UDP flows from a client's ephemeral ports to the same server into a single edge")
+	flag.StringVar(&flags.probe.tracesZipkinAddr, "probe.traces.zipkin", "", "accept Zipkin v2 JSON spans on this address (e.g. :9411), and draw edges for the calls they describe")
+	flag.StringVar(&flags.probe.tracesJaegerAddr, "probe.traces.jaeger", "", "accept Jaeger Thrift spans on this UDP address (e.g. :6831), and draw edges for the calls they describe")
 	flag.BoolVar(&flags.probe.spyProcs, "probe.proc.spy", true, "associate endpoints with processes (needs root)")
 	flag.StringVar(&flags.probe.procRoot, "probe.proc.root", "/proc", "location of the proc filesystem")
 	flag.BoolVar(&flags.probe.procEnabled, "probe.processes", true, "produce process topology & include procspied connections")
@@ -342,6 +395,8 @@ func setupFlags(flags *flags) {
 	flag.StringVar(&flags.probe.kubernetesClientConfig.Username, "probe.kubernetes.username", "", "Username for basic authentication to the API server")
 	flag.StringVar(&flags.probe.kubernetesNodeName, "probe.kubernetes.node-name", "", "Name of this node, for filtering pods")
 	flag.UintVar(&flags.probe.kubernetesKubeletPort, "probe.kubernetes.kubelet-port", 10255, "Node-local TCP port for contacting kubelet (zero to disable)")
+	flag.BoolVar(&flags.probe.kubernetesKubeProxy, "probe.kubernetes.kube-proxy", false, "resolve connections to service IPs to their backend pods, from kube-proxy's IPVS state")
+	flag.BoolVar(&flags.probe.kubernetesIPTables, "probe.kubernetes.kube-proxy.iptables", false, "also resolve service IPs from kube-proxy's iptables state, running iptables-save every 10s, when it is not in IPVS mode (needs probe.kubernetes.kube-proxy)")
 
 	// AWS ECS
 	flag.BoolVar(&flags.probe.ecsEnabled, "probe.ecs", false, "Collect ecs-related attributes for containers on this node")
@@ -362,6 +417,7 @@ func setupFlags(flags *flags) {
 	flag.StringVar(&flags.app.logPrefix, "app.log.prefix", "<app>", "prefix for each log line")
 	flag.BoolVar(&flags.app.logHTTP, "app.log.http", false, "Log individual HTTP requests")
 	flag.BoolVar(&flags.app.logHTTPHeaders, "app.log.httpHeaders", false, "Log HTTP headers. Needs app.log.http to be enabled.")
+	flag.BoolVar(&flags.app.probeStream, "app.probe-stream", false, "Accept probes connecting over a gRPC stream on the webserver listen address")
 
 	flag.BoolVar(&flags.app.basicAuth, "app.basicAuth", false, "Enable basic authentication for app")
 	flag.StringVar(&flags.app.username, "app.basicAuth.username", "admin", "Username for basic authentication")
@@ -374,7 +430,9 @@ func setupFlags(flags *flags) {
 	flag.Var(&flags.containerLabelFilterFlags, "app.container-label-filter", "Add container label-based view filter, specified as title:label. Multiple flags are accepted. Example: --app.container-label-filter='Database Containers:role=db'")
 	flag.Var(&flags.containerLabelFilterFlagsExclude, "app.container-label-filter-exclude", "Add container label-based view filter that excludes containers with the given label, specified as title:label. Multiple flags are accepted. Example: --app.container-label-filter-exclude='Database Containers:role=db'")
 
-	flag.StringVar(&flags.app.collectorURL, "app.collector", "local", "Collector to use (local, dynamodb, or file/directory)")
+	flag.StringVar(&flags.app.collectorURL, "app.collector", "local", "Collector to use (local, dynamodb, leveldb:///path/to/db, or file/directory)")
+	flag.DurationVar(&flags.app.collectorRetention, "app.collector.retention", 7*24*time.Hour, "How long to keep reports (when collector is leveldb, 0 to disable)")
+	flag.Int64Var(&flags.app.collectorMaxSize, "app.collector.max-size", 0, "Maximum size in bytes of the stored reports (when collector is leveldb, 0 to disable)")
 	flag.StringVar(&flags.app.s3URL, "app.collector.s3", "local", "S3 URL to use (when collector is dynamodb)")
 	flag.StringVar(&flags.app.controlRouterURL, "app.control.router", "local", "Control router to use (local or sqs)")
 	flag.DurationVar(&flags.app.controlRPCTimeout, "app.control.rpctimeout", time.Minute, "Timeout for control RPC")
@@ -386,14 +444,40 @@ func setupFlags(flags *flags) {
 	flag.StringVar(&flags.app.memcachedService, "app.memcached.service", "memcached", "SRV service used to discover memcache servers.")
 	flag.IntVar(&flags.app.memcachedCompressionLevel, "app.memcached.compression", gzip.DefaultCompression, "How much to compress reports stored in memcached.")
 	flag.StringVar(&flags.app.userIDHeader, "app.userid.header", "", "HTTP header to use as userid")
+	flag.StringVar(&flags.app.userIDTrustedProxies, "app.userid.trusted-proxies", "", "Comma-separated CIDRs of the authenticating proxies trusted to set app.userid.header, to identify users to app.control-policy, audit records and recordings; requests from anywhere else are anonymous")
 	flag.BoolVar(&flags.app.externalUI, "app.externalUI", false, "Point to externally hosted static UI assets")
 	flag.StringVar(&flags.app.metricsGraphURL, "app.metrics-graph", "", "Enable extended metrics graph by providing a templated URL (supports :instanceID and :query). Example: --app.metrics-graph=/prom/:instanceID/notebook/new")
 	flag.StringVar(&flags.app.serviceName, "app.service-name", "app", "The name for this service which should be reported in instrumentation")
+	flag.StringVar(&flags.app.externalServicesFile, "app.external-services", "", "YAML or JSON file defining external services to render as their own nodes rather than as the Internet; reloaded on SIGHUP")
+	flag.StringVar(&flags.app.controlPolicyFile, "app.control-policy", "", "YAML or JSON file defining which users may run which controls; users are identified by app.userid.header from app.userid.trusted-proxies if set, else by their basic authentication username")
+	flag.IntVar(&flags.app.auditRecords, "app.audit.records", 1000, "How many of the latest control and terminal session audit records to keep, to serve on /api/audit, without transcripts, to users app.control-policy allows the read_audit control")
+	flag.StringVar(&flags.app.auditFile, "app.audit.file", "", "File to append audit records to, as JSON lines")
+	flag.StringVar(&flags.app.auditSyslog, "app.audit.syslog", "", "Syslog to write audit records to: local, or a URL such as udp://host:514")
+	flag.StringVar(&flags.app.auditWebhook, "app.audit.webhook", "", "URL to POST audit records to, as JSON")
+	flag.BoolVar(&flags.app.auditTranscripts, "app.audit.transcripts", false, "Record the transcripts of terminal sessions in the audit records of their end, as written to the audit file, syslog and webhook")
+	flag.StringVar(&flags.app.recordingsDir, "app.recordings.dir", "", "Directory to record terminal sessions to, in asciicast format; sessions aren't recorded if empty")
+	flag.StringVar(&flags.app.recordingsControls, "app.recordings.controls", "docker_exec_container,docker_attach_container,cri_exec_container,cri_attach_container,host_exec", "Comma-separated controls whose terminal sessions are recorded")
+	flag.StringVar(&flags.app.alertsFile, "app.alerts", "", "YAML or JSON file defining alerting rules, and the webhooks notified of their alerts (not supported with the multitenant collector)")
+	flag.DurationVar(&flags.app.alertsInterval, "app.alerts.interval", 15*time.Second, "How often to evaluate alerting rules, besides on every new report")
+	flag.BoolVar(&flags.app.events, "app.events", false, "Detect lifecycle events of nodes between reports, served on /api/events (not supported with the multitenant collector)")
 
 	flag.IntVar(&flags.app.blockProfileRate, "app.block.profile.rate", 0, "If more than 0, enable block profiling. The profiler aims to sample an average of one blocking event per rate nanoseconds spent blocked.")
 
 	flag.BoolVar(&flags.app.awsCreateTables, "app.aws.create.tables", false, "Create the tables in DynamoDB")
 	flag.StringVar(&flags.app.consulInf, "app.consul.inf", "", "The interface who's address I should advertise myself under in consul")
+
+	// NetworkPolicy generation flags
+	flag.StringVar(&flags.networkPolicy.appURL, "networkpolicy.app", "http://localhost:"+strconv.Itoa(xfer.AppPort), "URL of the app to get the observed connections from")
+	flag.StringVar(&flags.networkPolicy.namespace, "networkpolicy.namespace", "", "Kubernetes namespace to generate NetworkPolicies for")
+	flag.StringVar(&flags.networkPolicy.from, "networkpolicy.from", "", "Start of the time window of observed connections, in RFC3339 format (default: same as networkpolicy.to)")
+	flag.StringVar(&flags.networkPolicy.to, "networkpolicy.to", "", "End of the time window of observed connections, in RFC3339 format (default: now)")
+
+	// Export flags
+	flag.StringVar(&flags.export.appURL, "export.app", "http://localhost:"+strconv.Itoa(xfer.AppPort), "URL of the app to export the topology from")
+	flag.StringVar(&flags.export.topology, "export.topology", "", "Topology to export, e.g. containers or hosts")
+	flag.StringVar(&flags.export.format, "export.format", "dot", "Export format: dot|graphml|cytoscape")
+	flag.StringVar(&flags.export.options, "export.options", "", "Topology options, as in the UI's URL, e.g. system=application&stopped=running")
+	flag.StringVar(&flags.export.output, "export.output", "", "File to write the export to (default: stdout)")
 }
 
 func main() {
@@ -491,6 +575,10 @@ func main() {
 		appMain(flags.app)
 	case "probe":
 		probeMain(flags.probe, targets)
+	case "networkpolicy":
+		networkPolicyMain(flags.networkPolicy)
+	case "export":
+		exportMain(flags.export, flags.probe)
 	case "version":
 		fmt.Println("Weave Scope version", version)
 	case "help":
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Main runner for generating NetworkPolicies from the connections observed
+// by a running app. Prints them to stdout as YAML.
+func networkPolicyMain(flags networkPolicyFlags) {
+	if flags.namespace == "" {
+		log.Fatal("--networkpolicy.namespace is required")
+	}
+	u, err := url.Parse(flags.appURL)
+	if err != nil {
+		log.Fatalf("Invalid app URL %q: %v", flags.appURL, err)
+	}
+	u.Path = "/api/networkpolicies"
+	query := url.Values{"namespace": {flags.namespace}}
+	if flags.from != "" {
+		query.Set("from", flags.from)
+	}
+	if flags.to != "" {
+		query.Set("to", flags.to)
+	}
+	u.RawQuery = query.Encode()
+
+	resp, err := http.Get(u.String())
+	if err != nil {
+		log.Fatalf("Error getting NetworkPolicies: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Fatalf("Error getting NetworkPolicies: %s: %s", resp.Status, body)
+	}
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		log.Fatalf("Error writing NetworkPolicies: %v", err)
+	}
+}
@@ -37,6 +37,7 @@ import (
 	"github.com/weaveworks/scope/probe/overlay"
 	"github.com/weaveworks/scope/probe/plugins"
 	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/probe/traces"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -94,6 +95,21 @@ func maybeExportProfileData(flags probeFlags) {
 	}
 }
 
+// probeToken returns the token to authenticate with the app at url, erasing
+// any credentials in url, as we use a special header.
+func probeToken(flags probeFlags, url *url.URL) string {
+	token := flags.token
+	if url.User != nil {
+		token = url.User.Username()
+		url.User = nil
+	}
+
+	if flags.basicAuth {
+		token = base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", flags.username, flags.password)))
+	}
+	return token
+}
+
 // Main runs the probe
 func probeMain(flags probeFlags, targets []appclient.Target) {
 	setLogLevel(flags.logLevel)
@@ -146,22 +162,15 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 
 	handlerRegistry := controls.NewDefaultHandlerRegistry()
 	clientFactory := func(hostname string, url url.URL) (appclient.AppClient, error) {
-		token := flags.token
-		if url.User != nil {
-			token = url.User.Username()
-			url.User = nil // erase credentials, as we use a special header
-		}
-
-		if flags.basicAuth {
-			token = base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", flags.username, flags.password)))
-		}
-
 		probeConfig := appclient.ProbeConfig{
 			BasicAuth:    flags.basicAuth,
-			Token:        token,
+			Token:        probeToken(flags, &url),
 			ProbeVersion: version,
 			ProbeID:      probeID,
 			Insecure:     flags.insecure,
+
+			FullReportInterval: flags.fullReportInterval,
+			Stream:             flags.stream,
 		}
 		return appclient.NewAppClient(
 			probeConfig, hostname, url,
@@ -231,7 +240,7 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 	var processCache *process.CachingWalker
 
 	if flags.kubernetesRole != kubernetesRoleCluster {
-		hostReporter := host.NewReporter(hostID, hostName, probeID, version, clients, handlerRegistry)
+		hostReporter := host.NewReporter(hostID, hostName, probeID, version, clients, handlerRegistry, flags.procRoot)
 		defer hostReporter.Stop()
 		p.AddReporter(hostReporter)
 		p.AddTagger(host.NewTagger(hostID))
@@ -249,6 +258,13 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 			defer dnsSnooper.Stop()
 		}
 
+		var udpConfig *endpoint.UDPConfig
+		if flags.udpEnabled {
+			if udpConfig, err = endpoint.NewUDPConfig(flags.udpPorts, flags.udpPeers, flags.udpAggregate); err != nil {
+				log.Fatalf("Invalid UDP tracking configuration: %v", err)
+			}
+		}
+
 		endpointReporter := endpoint.NewReporter(endpoint.ReporterConfig{
 			HostID:       hostID,
 			HostName:     hostName,
@@ -258,11 +274,29 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 			UseEbpfConn:  flags.useEbpfConn,
 			ProcRoot:     flags.procRoot,
 			BufferSize:   flags.conntrackBufferSize,
+			UDP:          udpConfig,
 			ProcessCache: processCache,
 			DNSSnooper:   dnsSnooper,
+			KubeProxy:    flags.kubernetesEnabled && flags.kubernetesKubeProxy,
+
+			KubeProxyIPTables: flags.kubernetesIPTables,
 		})
 		defer endpointReporter.Stop()
 		p.AddReporter(endpointReporter)
+
+		if flags.tracesZipkinAddr != "" || flags.tracesJaegerAddr != "" {
+			tracesReporter, err := traces.NewReporter(traces.ReporterConfig{
+				HostID:     hostID,
+				ZipkinAddr: flags.tracesZipkinAddr,
+				JaegerAddr: flags.tracesJaegerAddr,
+			})
+			if err != nil {
+				log.Errorf("Traces: failed to start: %v", err)
+			} else {
+				defer tracesReporter.Stop()
+				p.AddTagger(tracesReporter)
+			}
+		}
 	}
 
 	if flags.dockerEnabled {
@@ -294,11 +328,16 @@ func probeMain(flags probeFlags, targets []appclient.Target) {
 	}
 
 	if flags.criEnabled {
-		client, err := cri.NewCRIClient(flags.criEndpoint)
+		runtimeClient, imageClient, err := cri.NewCRIClients(flags.criEndpoint)
 		if err != nil {
 			log.Errorf("CRI: failed to start registry: %v", err)
 		} else {
-			p.AddReporter(cri.NewReporter(client))
+			reporter := cri.NewReporter(runtimeClient, imageClient, probeID, clients, handlerRegistry)
+			defer reporter.Stop()
+			if flags.procEnabled {
+				p.AddTagger(cri.NewTagger(reporter, processCache))
+			}
+			p.AddReporter(reporter)
 		}
 	}
 
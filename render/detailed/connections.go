@@ -17,6 +17,8 @@ const (
 	countLabel  = "Count"
 	remoteKey   = "remote"
 	remoteLabel = "Remote"
+	protoKey    = "protocol"
+	protoLabel  = "Protocol"
 	number      = "number"
 )
 
@@ -62,11 +64,13 @@ type connection struct {
 	remoteNodeID          string
 	remoteAddr, localAddr string // for internet nodes only
 	port                  string // destination port
+	protocol              string // empty for TCP
 }
 
 type connectionCounters struct {
 	counted map[string]struct{}
 	counts  map[connection]int
+	udp     bool // whether any of the connections are UDP
 }
 
 func newConnectionCounters() *connectionCounters {
@@ -101,10 +105,30 @@ func (c *connectionCounters) add(dns report.DNSRecords, outgoing bool, localNode
 		return
 	}
 
+	conn.protocol, _ = dstEndpoint.Latest.Lookup(endpoint.Protocol)
+	if conn.protocol != "" {
+		c.udp = true
+	}
+
 	c.counted[connectionID] = struct{}{}
 	c.counts[conn]++
 }
 
+// columns returns the columns of the table, which only has a protocol
+// column if some of the connections are UDP, as TCP is the norm.
+func (c *connectionCounters) columns(internet bool) []Column {
+	columns := NormalColumns
+	if internet {
+		columns = InternetColumns
+	}
+	if !c.udp {
+		return columns
+	}
+	last := len(columns) - 1
+	result := append([]Column{}, columns[:last]...)
+	return append(result, Column{ID: protoKey, Label: protoLabel}, columns[last])
+}
+
 func internetAddr(dns report.DNSRecords, node report.Node, ep report.Node) (string, bool) {
 	if !render.IsInternetNode(node) {
 		return "", true
@@ -132,6 +156,9 @@ func (c *connectionCounters) rows(r report.Report, ns report.Nodes, includeLocal
 			Label:      summary.Label,
 			LabelMinor: summary.LabelMinor,
 		}
+		if row.protocol != "" {
+			connection.ID += "-" + row.protocol
+		}
 		if row.remoteAddr != "" {
 			connection.Label = row.remoteAddr
 			connection.LabelMinor = ""
@@ -148,6 +175,19 @@ func (c *connectionCounters) rows(r report.Report, ns report.Nodes, includeLocal
 				ID:    portKey,
 				Value: row.port,
 			},
+		)
+		if c.udp {
+			protocol := row.protocol
+			if protocol == "" {
+				protocol = "tcp"
+			}
+			connection.Metadata = append(connection.Metadata,
+				report.MetadataRow{
+					ID:    protoKey,
+					Value: protocol,
+				})
+		}
+		connection.Metadata = append(connection.Metadata,
 			report.MetadataRow{
 				ID:    countKey,
 				Value: strconv.Itoa(count),
@@ -176,15 +216,11 @@ func incomingConnectionsSummary(topologyID string, r report.Report, n report.Nod
 		}
 	}
 
-	columnHeaders := NormalColumns
-	if render.IsInternetNode(n) {
-		columnHeaders = InternetColumns
-	}
 	return ConnectionsSummary{
 		ID:          "incoming-connections",
 		TopologyID:  topologyID,
 		Label:       "Inbound",
-		Columns:     columnHeaders,
+		Columns:     counts.columns(render.IsInternetNode(n)),
 		Connections: counts.rows(r, ns, render.IsInternetNode(n)),
 	}
 }
@@ -208,15 +244,11 @@ func outgoingConnectionsSummary(topologyID string, r report.Report, n report.Nod
 		}
 	}
 
-	columnHeaders := NormalColumns
-	if render.IsInternetNode(n) {
-		columnHeaders = InternetColumns
-	}
 	return ConnectionsSummary{
 		ID:          "outgoing-connections",
 		TopologyID:  topologyID,
 		Label:       "Outbound",
-		Columns:     columnHeaders,
+		Columns:     counts.columns(render.IsInternetNode(n)),
 		Connections: counts.rows(r, ns, render.IsInternetNode(n)),
 	}
 }
@@ -0,0 +1,292 @@
+package detailed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Export formats of topologies.
+const (
+	ExportDOT       = "dot"
+	ExportGraphML   = "graphml"
+	ExportCytoscape = "cytoscape"
+)
+
+// ExportContentTypes are the content types of the export formats.
+var ExportContentTypes = map[string]string{
+	ExportDOT:       "text/vnd.graphviz",
+	ExportGraphML:   "application/graphml+xml",
+	ExportCytoscape: "application/json",
+}
+
+// Export writes the graph of a rendered topology in one of the export
+// formats. Nodes carry their label, minor label, rank, shape and whether they
+// are pseudo nodes, as well as their metadata, keyed by ID; edges come from
+// their adjacency.
+func Export(w io.Writer, format, name string, nodes NodeSummaries) error {
+	g := makeExportGraph(nodes)
+	switch format {
+	case ExportDOT:
+		return g.writeDOT(w, name)
+	case ExportGraphML:
+		return g.writeGraphML(w, name)
+	case ExportCytoscape:
+		return g.writeCytoscape(w, name)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// The attributes every node has, which metadata doesn't override.
+var exportNodeAttributes = []string{"label", "labelMinor", "rank", "shape", "pseudo"}
+
+type exportAttribute struct {
+	key, value string
+}
+
+type exportNode struct {
+	id         string
+	attributes []exportAttribute
+}
+
+type exportEdge struct {
+	source, target string
+}
+
+// exportGraph is a topology reduced to what the export formats carry, in a
+// stable order.
+type exportGraph struct {
+	nodes []exportNode
+	edges []exportEdge
+	// metadata keys in the order first seen, after exportNodeAttributes
+	keys []string
+}
+
+func makeExportGraph(nodes NodeSummaries) exportGraph {
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	g := exportGraph{keys: append([]string{}, exportNodeAttributes...)}
+	seen := map[string]struct{}{}
+	for _, key := range exportNodeAttributes {
+		seen[key] = struct{}{}
+	}
+	for _, id := range ids {
+		n := nodes[id]
+		node := exportNode{
+			id: id,
+			attributes: []exportAttribute{
+				{"label", n.Label},
+				{"labelMinor", n.LabelMinor},
+				{"rank", n.Rank},
+				{"shape", n.Shape},
+				{"pseudo", strconv.FormatBool(n.Pseudo)},
+			},
+		}
+		for _, row := range n.Metadata {
+			if row.ID == "id" || isExportNodeAttribute(row.ID) {
+				continue
+			}
+			node.attributes = append(node.attributes, exportAttribute{row.ID, row.Value})
+			if _, ok := seen[row.ID]; !ok {
+				seen[row.ID] = struct{}{}
+				g.keys = append(g.keys, row.ID)
+			}
+		}
+		g.nodes = append(g.nodes, node)
+
+		targets := append([]string{}, n.Adjacency...)
+		sort.Strings(targets)
+		for _, target := range targets {
+			if _, ok := nodes[target]; ok {
+				g.edges = append(g.edges, exportEdge{id, target})
+			}
+		}
+	}
+	return g
+}
+
+func isExportNodeAttribute(key string) bool {
+	for _, attribute := range exportNodeAttributes {
+		if key == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+// Graphviz shapes for the node shapes known to the UI; the rest are drawn
+// as ellipses.
+var dotShapes = map[string]string{
+	report.Circle:         "ellipse",
+	report.Triangle:       "triangle",
+	report.DottedTriangle: "triangle",
+	report.Square:         "box",
+	report.Pentagon:       "pentagon",
+	report.Hexagon:        "hexagon",
+	report.Heptagon:       "septagon",
+	report.Octagon:        "octagon",
+	report.Cylinder:       "cylinder",
+	report.DottedCylinder: "cylinder",
+	report.StorageSheet:   "note",
+}
+
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
+
+func (g exportGraph) writeDOT(w io.Writer, name string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(name))
+	for _, n := range g.nodes {
+		attributes := []string{}
+		for _, a := range n.attributes {
+			switch a.key {
+			case "shape":
+				// keep Scope's shape, and draw the closest Graphviz one
+				shape, ok := dotShapes[a.value]
+				if !ok {
+					shape = "ellipse"
+				}
+				attributes = append(attributes, "shape="+dotQuote(shape), "scope_shape="+dotQuote(a.value))
+			default:
+				attributes = append(attributes, dotQuote(a.key)+"="+dotQuote(a.value))
+			}
+		}
+		fmt.Fprintf(&b, "\t%s [%s];\n", dotQuote(n.id), strings.Join(attributes, ", "))
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(&b, "\t%s -> %s;\n", dotQuote(e.source), dotQuote(e.target))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (g exportGraph) writeGraphML(w io.Writer, name string) error {
+	// Metadata IDs needn't be valid XML IDs, so keys are numbered.
+	keyIDs := map[string]string{}
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Graph: graphMLGraph{ID: name, EdgeDefault: "directed"},
+	}
+	for i, key := range g.keys {
+		keyIDs[key] = "d" + strconv.Itoa(i)
+		keyType := "string"
+		if key == "pseudo" {
+			keyType = "boolean"
+		}
+		doc.Keys = append(doc.Keys, graphMLKey{ID: keyIDs[key], For: "node", Name: key, Type: keyType})
+	}
+	for _, n := range g.nodes {
+		node := graphMLNode{ID: n.id}
+		for _, a := range n.attributes {
+			node.Data = append(node.Data, graphMLData{Key: keyIDs[a.key], Value: a.value})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for _, e := range g.edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{Source: e.source, Target: e.target})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type cytoscapeElement struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+type cytoscapeElements struct {
+	Nodes []cytoscapeElement `json:"nodes"`
+	Edges []cytoscapeElement `json:"edges"`
+}
+
+type cytoscapeGraph struct {
+	Data     map[string]interface{} `json:"data"`
+	Elements cytoscapeElements      `json:"elements"`
+}
+
+func (g exportGraph) writeCytoscape(w io.Writer, name string) error {
+	doc := cytoscapeGraph{Data: map[string]interface{}{"name": name}}
+	doc.Elements.Nodes = []cytoscapeElement{}
+	doc.Elements.Edges = []cytoscapeElement{}
+	for _, n := range g.nodes {
+		data := map[string]interface{}{"id": n.id}
+		for _, a := range n.attributes {
+			if a.key == "pseudo" {
+				data[a.key] = a.value == "true"
+			} else {
+				data[a.key] = a.value
+			}
+		}
+		doc.Elements.Nodes = append(doc.Elements.Nodes, cytoscapeElement{Data: data})
+	}
+	for _, e := range g.edges {
+		doc.Elements.Edges = append(doc.Elements.Edges, cytoscapeElement{Data: map[string]interface{}{
+			"id":     e.source + "->" + e.target,
+			"source": e.source,
+			"target": e.target,
+		}})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
@@ -0,0 +1,115 @@
+package detailed_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+var exportNodes = detailed.NodeSummaries{
+	"a": {
+		BasicNodeSummary: detailed.BasicNodeSummary{ID: "a", Label: `web "frontend"`, LabelMinor: "host1", Rank: "web", Shape: report.Hexagon},
+		Metadata:         []report.MetadataRow{{ID: "docker_image_name", Label: "Image", Value: "nginx"}},
+		Adjacency:        report.MakeIDList("b", "gone"),
+	},
+	"b": {
+		BasicNodeSummary: detailed.BasicNodeSummary{ID: "b", Label: "The Internet", Shape: report.Cloud, Pseudo: true},
+	},
+}
+
+func TestExportDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := detailed.Export(&buf, detailed.ExportDOT, "containers", exportNodes); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph "containers" {
+	"a" ["label"="web \"frontend\"", "labelMinor"="host1", "rank"="web", shape="hexagon", scope_shape="hexagon", "pseudo"="false", "docker_image_name"="nginx"];
+	"b" ["label"="The Internet", "labelMinor"="", "rank"="", shape="ellipse", scope_shape="cloud", "pseudo"="true"];
+	"a" -> "b";
+}
+`
+	if have := buf.String(); have != want {
+		t.Errorf("want:\n%s\nhave:\n%s", want, have)
+	}
+}
+
+func TestExportGraphML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := detailed.Export(&buf, detailed.ExportGraphML, "containers", exportNodes); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Keys []struct {
+			ID   string `xml:"id,attr"`
+			Name string `xml:"attr.name,attr"`
+		} `xml:"key"`
+		Nodes []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"graph>node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+		} `xml:"graph>edge"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Keys) != 6 || doc.Keys[5].Name != "docker_image_name" {
+		t.Errorf("unexpected keys: %v", doc.Keys)
+	}
+	if len(doc.Nodes) != 2 || doc.Nodes[0].ID != "a" || doc.Nodes[1].ID != "b" {
+		t.Errorf("unexpected nodes: %v", doc.Nodes)
+	}
+	if len(doc.Edges) != 1 || doc.Edges[0].Source != "a" || doc.Edges[0].Target != "b" {
+		t.Errorf("unexpected edges: %v", doc.Edges)
+	}
+}
+
+func TestExportCytoscape(t *testing.T) {
+	var buf bytes.Buffer
+	if err := detailed.Export(&buf, detailed.ExportCytoscape, "containers", exportNodes); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Data     map[string]interface{} `json:"data"`
+		Elements struct {
+			Nodes []struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"nodes"`
+			Edges []struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"edges"`
+		} `json:"elements"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Data["name"] != "containers" {
+		t.Errorf("unexpected graph data: %v", doc.Data)
+	}
+	if len(doc.Elements.Nodes) != 2 {
+		t.Fatalf("unexpected nodes: %v", doc.Elements.Nodes)
+	}
+	if a := doc.Elements.Nodes[0].Data; a["id"] != "a" || a["docker_image_name"] != "nginx" || a["pseudo"] != false {
+		t.Errorf("unexpected node: %v", a)
+	}
+	if b := doc.Elements.Nodes[1].Data; b["id"] != "b" || b["pseudo"] != true {
+		t.Errorf("unexpected node: %v", b)
+	}
+	if len(doc.Elements.Edges) != 1 || doc.Elements.Edges[0].Data["source"] != "a" || doc.Elements.Edges[0].Data["target"] != "b" {
+		t.Errorf("unexpected edges: %v", doc.Elements.Edges)
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	err := detailed.Export(&buf, "svg", "containers", exportNodes)
+	if err == nil || !strings.Contains(err.Error(), "svg") {
+		t.Errorf("expected error for unknown format, got %v", err)
+	}
+}
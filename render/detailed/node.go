@@ -81,24 +81,60 @@ func (c *ControlInstance) CodecDecodeSelf(decoder *codec.Decoder) {
 	}
 }
 
+// Columns of the table of a node's lifecycle events.
+const (
+	EventsTableID     = "lifecycle_events"
+	EventTimeColumn   = "event_time"
+	EventTypeColumn   = "event_type"
+	EventDetailColumn = "event_detail"
+)
+
 // RenderContext carries contextual data that is needed when rendering parts of the report.
 type RenderContext struct {
 	report.Report
 	MetricsGraphURL string
+	// NodeEvents returns the rows of the lifecycle events table of a
+	// node, if there is an event store.
+	NodeEvents func(topologyID, nodeID string) []report.Row
 }
 
 // MakeNode transforms a renderable node to a detailed node. It uses
 // aggregate metadata, plus the set of origin node IDs, to produce tables.
 func MakeNode(topologyID string, rc RenderContext, ns report.Nodes, n report.Node) Node {
 	summary, _ := MakeNodeSummary(rc, n)
+	if rc.NodeEvents != nil {
+		if rows := rc.NodeEvents(topologyID, n.ID); len(rows) > 0 {
+			summary.Tables = append(summary.Tables, eventsTable(rows))
+		}
+	}
+	connections := []ConnectionsSummary{
+		incomingConnectionsSummary(topologyID, rc.Report, n, ns),
+		outgoingConnectionsSummary(topologyID, rc.Report, n, ns),
+	}
+	for _, outgoing := range []bool{false, true} {
+		if requests := requestsSummary(topologyID, rc.Report, n, ns, outgoing); len(requests.Connections) > 0 {
+			connections = append(connections, requests)
+		}
+	}
 	return Node{
 		NodeSummary: summary,
 		Controls:    controls(rc.Report, n),
 		Children:    children(rc, n),
-		Connections: []ConnectionsSummary{
-			incomingConnectionsSummary(topologyID, rc.Report, n, ns),
-			outgoingConnectionsSummary(topologyID, rc.Report, n, ns),
+		Connections: connections,
+	}
+}
+
+func eventsTable(rows []report.Row) report.Table {
+	return report.Table{
+		ID:    EventsTableID,
+		Label: "Lifecycle events",
+		Type:  report.MulticolumnTableType,
+		Columns: []report.Column{
+			{ID: EventTimeColumn, Label: "Time", DataType: report.DateTime},
+			{ID: EventTypeColumn, Label: "Event"},
+			{ID: EventDetailColumn, Label: "Detail"},
 		},
+		Rows: rows,
 	}
 }
 
@@ -108,14 +144,18 @@ func controlsFor(topology report.Topology, nodeID string) []ControlInstance {
 	if !ok {
 		return result
 	}
-	probeID, ok := node.Latest.Lookup(report.ControlProbeID)
-	if !ok {
-		return result
-	}
+	nodeProbeID, _ := node.Latest.Lookup(report.ControlProbeID)
 	node.LatestControls.ForEach(func(controlID string, _ time.Time, data report.NodeControlData) {
 		if data.Dead {
 			return
 		}
+		probeID := data.ProbeID
+		if probeID == "" {
+			probeID = nodeProbeID
+		}
+		if probeID == "" {
+			return
+		}
 		if control, ok := topology.Controls[controlID]; ok {
 			result = append(result, ControlInstance{
 				ProbeID: probeID,
@@ -21,6 +21,7 @@ var parentTopologies = []string{
 	report.StatefulSet,
 	report.CronJob,
 	report.Service,
+	report.NetworkPolicy,
 	report.ECSTask,
 	report.ECSService,
 	report.SwarmService,
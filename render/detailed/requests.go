@@ -0,0 +1,90 @@
+package detailed
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	requestRateKey = "request_rate"
+	errorRateKey   = "error_rate"
+	latencyP50Key  = "latency_p50"
+	latencyP95Key  = "latency_p95"
+	latencyP99Key  = "latency_p99"
+)
+
+// RequestColumns are the columns of the tables of requests to/from a node,
+// as traced by applications. Exported for testing.
+var RequestColumns = []Column{
+	{ID: requestRateKey, Label: "Req/s", Datatype: report.Number, DefaultSort: true},
+	{ID: errorRateKey, Label: "Errors/s", Datatype: report.Number},
+	{ID: latencyP50Key, Label: "P50 (ms)", Datatype: report.Number},
+	{ID: latencyP95Key, Label: "P95 (ms)", Datatype: report.Number},
+	{ID: latencyP99Key, Label: "P99 (ms)", Datatype: report.Number},
+}
+
+// requestsSummary returns the table of the requests made over the edges
+// to/from a node, one row per node at the other end of the edge.
+func requestsSummary(topologyID string, r report.Report, n report.Node, ns report.Nodes, outgoing bool) ConnectionsSummary {
+	rows := []Connection{}
+	addRow := func(remote report.Node, md report.EdgeMetadata) {
+		if !md.HasRequests() {
+			return
+		}
+		summary, _ := MakeBasicNodeSummary(r, remote)
+		rows = append(rows, Connection{
+			ID:         remote.ID,
+			NodeID:     summary.ID,
+			Label:      summary.Label,
+			LabelMinor: summary.LabelMinor,
+			Metadata: []report.MetadataRow{
+				{ID: requestRateKey, Value: formatRate(md.RequestRate)},
+				{ID: errorRateKey, Value: formatRate(md.ErrorRate)},
+				{ID: latencyP50Key, Value: formatLatency(md.LatencyP50)},
+				{ID: latencyP95Key, Value: formatLatency(md.LatencyP95)},
+				{ID: latencyP99Key, Value: formatLatency(md.LatencyP99)},
+			},
+		})
+	}
+
+	summary := ConnectionsSummary{
+		TopologyID: topologyID,
+		Columns:    RequestColumns,
+	}
+	if outgoing {
+		summary.ID, summary.Label = "outgoing-requests", "Outbound requests"
+		for _, id := range n.Adjacency {
+			remote, ok := ns[id]
+			if !ok {
+				continue
+			}
+			if md, ok := n.Edges.Lookup(id); ok {
+				addRow(remote, md)
+			}
+		}
+	} else {
+		summary.ID, summary.Label = "incoming-requests", "Inbound requests"
+		for _, remote := range ns {
+			if !remote.Adjacency.Contains(n.ID) {
+				continue
+			}
+			if md, ok := remote.Edges.Lookup(n.ID); ok {
+				addRow(remote, md)
+			}
+		}
+	}
+	sort.Sort(connectionsByID(rows))
+	summary.Connections = rows
+	return summary
+}
+
+func formatRate(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', 2, 64)
+}
+
+func formatLatency(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 1, 64)
+}
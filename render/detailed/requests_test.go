@@ -0,0 +1,69 @@
+package detailed_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestMakeDetailedNodeRequests(t *testing.T) {
+	rpt := fixture.Report.Copy()
+	client := rpt.Endpoint.Nodes[fixture.Client54001NodeID]
+	rpt.Endpoint.Nodes[fixture.Client54001NodeID] = client.WithEdge(fixture.Server80NodeID, report.EdgeMetadata{
+		RequestRate: 2,
+		ErrorRate:   0.5,
+		LatencyP50:  10 * time.Millisecond,
+		LatencyP95:  25 * time.Millisecond,
+		LatencyP99:  125 * time.Millisecond,
+	})
+
+	nodes := render.HostRenderer.Render(context.Background(), rpt).Nodes
+	rc := detailed.RenderContext{Report: rpt}
+	row := func(nodeID, label, labelMinor string) detailed.Connection {
+		return detailed.Connection{
+			ID:         nodeID,
+			NodeID:     nodeID,
+			Label:      label,
+			LabelMinor: labelMinor,
+			Metadata: []report.MetadataRow{
+				{ID: "request_rate", Value: "2.00"},
+				{ID: "error_rate", Value: "0.50"},
+				{ID: "latency_p50", Value: "10.0"},
+				{ID: "latency_p95", Value: "25.0"},
+				{ID: "latency_p99", Value: "125.0"},
+			},
+		}
+	}
+
+	client = nodes[fixture.ClientHostNodeID]
+	have := detailed.MakeNode("hosts", rc, nodes, client).Connections
+	want := detailed.ConnectionsSummary{
+		ID:          "outgoing-requests",
+		TopologyID:  "hosts",
+		Label:       "Outbound requests",
+		Columns:     detailed.RequestColumns,
+		Connections: []detailed.Connection{row(fixture.ServerHostNodeID, "server", "hostname.com")},
+	}
+	if len(have) != 3 || !reflect.DeepEqual(want, have[2]) {
+		t.Errorf("outgoing requests: want %v, have %v", want, have)
+	}
+
+	server := nodes[fixture.ServerHostNodeID]
+	have = detailed.MakeNode("hosts", rc, nodes, server).Connections
+	want = detailed.ConnectionsSummary{
+		ID:          "incoming-requests",
+		TopologyID:  "hosts",
+		Label:       "Inbound requests",
+		Columns:     detailed.RequestColumns,
+		Connections: []detailed.Connection{row(fixture.ClientHostNodeID, "client", "hostname.com")},
+	}
+	if len(have) != 3 || !reflect.DeepEqual(want, have[2]) {
+		t.Errorf("incoming requests: want %v, have %v", want, have)
+	}
+}
@@ -68,51 +68,57 @@ type NodeSummary struct {
 }
 
 var renderers = map[string]func(BasicNodeSummary, report.Node) BasicNodeSummary{
-	render.Pseudo:                pseudoNodeSummary,
-	report.Process:               processNodeSummary,
-	report.Container:             containerNodeSummary,
-	report.ContainerImage:        containerImageNodeSummary,
-	report.Pod:                   podNodeSummary,
-	report.Service:               podGroupNodeSummary,
-	report.Deployment:            podGroupNodeSummary,
-	report.DaemonSet:             podGroupNodeSummary,
-	report.StatefulSet:           podGroupNodeSummary,
-	report.CronJob:               podGroupNodeSummary,
-	report.Job:                   podGroupNodeSummary,
-	report.ECSTask:               ecsTaskNodeSummary,
-	report.ECSService:            ecsServiceNodeSummary,
-	report.SwarmService:          swarmServiceNodeSummary,
-	report.Host:                  hostNodeSummary,
-	report.Overlay:               weaveNodeSummary,
-	report.Endpoint:              nil, // Do not render
-	report.PersistentVolume:      persistentVolumeNodeSummary,
-	report.PersistentVolumeClaim: persistentVolumeClaimNodeSummary,
-	report.StorageClass:          storageClassNodeSummary,
-	report.VolumeSnapshot:        volumeSnapshotNodeSummary,
-	report.VolumeSnapshotData:    volumeSnapshotDataNodeSummary,
+	render.Pseudo:                  pseudoNodeSummary,
+	report.Process:                 processNodeSummary,
+	report.Container:               containerNodeSummary,
+	report.ContainerImage:          containerImageNodeSummary,
+	report.Pod:                     podNodeSummary,
+	report.Service:                 podGroupNodeSummary,
+	report.Deployment:              podGroupNodeSummary,
+	report.DaemonSet:               podGroupNodeSummary,
+	report.StatefulSet:             podGroupNodeSummary,
+	report.CronJob:                 podGroupNodeSummary,
+	report.Job:                     podGroupNodeSummary,
+	report.ECSTask:                 ecsTaskNodeSummary,
+	report.ECSService:              ecsServiceNodeSummary,
+	report.SwarmService:            swarmServiceNodeSummary,
+	report.Host:                    hostNodeSummary,
+	report.Overlay:                 weaveNodeSummary,
+	report.Endpoint:                nil, // Do not render
+	report.PersistentVolume:        persistentVolumeNodeSummary,
+	report.PersistentVolumeClaim:   persistentVolumeClaimNodeSummary,
+	report.StorageClass:            storageClassNodeSummary,
+	report.VolumeSnapshot:          volumeSnapshotNodeSummary,
+	report.VolumeSnapshotData:      volumeSnapshotDataNodeSummary,
+	report.Ingress:                 ingressNodeSummary,
+	report.NetworkPolicy:           networkPolicyNodeSummary,
+	report.HorizontalPodAutoscaler: horizontalPodAutoscalerNodeSummary,
 }
 
 // For each report.Topology, map to a 'primary' API topology. This can then be used in a variety of places.
 var primaryAPITopology = map[string]string{
-	report.Process:               "processes",
-	report.Container:             "containers",
-	report.ContainerImage:        "containers-by-image",
-	report.Pod:                   "pods",
-	report.Deployment:            "kube-controllers",
-	report.DaemonSet:             "kube-controllers",
-	report.StatefulSet:           "kube-controllers",
-	report.CronJob:               "kube-controllers",
-	report.Job:                   "kube-controllers",
-	report.Service:               "services",
-	report.ECSTask:               "ecs-tasks",
-	report.ECSService:            "ecs-services",
-	report.SwarmService:          "swarm-services",
-	report.Host:                  "hosts",
-	report.PersistentVolume:      "pods",
-	report.PersistentVolumeClaim: "pods",
-	report.StorageClass:          "pods",
-	report.VolumeSnapshot:        "pods",
-	report.VolumeSnapshotData:    "pods",
+	report.Process:                 "processes",
+	report.Container:               "containers",
+	report.ContainerImage:          "containers-by-image",
+	report.Pod:                     "pods",
+	report.Deployment:              "kube-controllers",
+	report.DaemonSet:               "kube-controllers",
+	report.StatefulSet:             "kube-controllers",
+	report.CronJob:                 "kube-controllers",
+	report.Job:                     "kube-controllers",
+	report.Service:                 "services",
+	report.ECSTask:                 "ecs-tasks",
+	report.ECSService:              "ecs-services",
+	report.SwarmService:            "swarm-services",
+	report.Host:                    "hosts",
+	report.PersistentVolume:        "pods",
+	report.PersistentVolumeClaim:   "pods",
+	report.StorageClass:            "pods",
+	report.VolumeSnapshot:          "pods",
+	report.VolumeSnapshotData:      "pods",
+	report.Ingress:                 "ingresses",
+	report.NetworkPolicy:           "network-policies",
+	report.HorizontalPodAutoscaler: "autoscalers",
 }
 
 // MakeBasicNodeSummary returns a basic summary of a node, if
@@ -372,6 +378,12 @@ func hostNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
 	} else {
 		base.Label = hostname
 	}
+	if render.IsUnprobedHost(n) {
+		if base.LabelMinor != "" {
+			base.LabelMinor += " "
+		}
+		base.LabelMinor += "(unprobed)"
+	}
 	return base
 }
 
@@ -414,6 +426,25 @@ func volumeSnapshotDataNodeSummary(base BasicNodeSummary, n report.Node) BasicNo
 	return base
 }
 
+func ingressNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
+	base = addKubernetesLabelAndRank(base, n)
+	base.LabelMinor, _ = n.Latest.Lookup(kubernetes.IngressHosts)
+	return base
+}
+
+func networkPolicyNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
+	base = addKubernetesLabelAndRank(base, n)
+	base.Stack = true
+	base.LabelMinor = pluralize(n.Counters, report.Pod, "pod", "pods")
+	return base
+}
+
+func horizontalPodAutoscalerNodeSummary(base BasicNodeSummary, n report.Node) BasicNodeSummary {
+	base = addKubernetesLabelAndRank(base, n)
+	base.LabelMinor, _ = n.Latest.Lookup(kubernetes.ScaleTarget)
+	return base
+}
+
 // groupNodeSummary renders the summary for a group node. n.Topology is
 // expected to be of the form: group:container:hostname
 func groupNodeSummary(base BasicNodeSummary, r report.Report, n report.Node) BasicNodeSummary {
@@ -10,6 +10,7 @@ import (
 	"github.com/weaveworks/common/test"
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/render/detailed"
@@ -240,6 +241,27 @@ func TestMakeNodeSummaryNoMetadata(t *testing.T) {
 	}
 }
 
+func TestMakeNodeSummaryUnprobedHost(t *testing.T) {
+	kubernetesNode := report.MakeNodeWith(report.MakeHostNodeID("node1.example.com"), map[string]string{
+		kubernetes.KubeletVersion: "v1.12.1",
+	}).WithTopology(report.Host)
+	for _, c := range []struct {
+		node report.Node
+		want string
+	}{
+		{kubernetesNode, "example.com (unprobed)"},
+		{kubernetesNode.WithLatests(map[string]string{host.HostName: "node1.example.com"}), "example.com"},
+	} {
+		summary, ok := detailed.MakeNodeSummary(detailed.RenderContext{}, c.node)
+		if !ok {
+			t.Fatalf("Node Summary missing for %v", c.node)
+		}
+		if summary.LabelMinor != c.want {
+			t.Errorf("Expected minor label %q, got %q", c.want, summary.LabelMinor)
+		}
+	}
+}
+
 func TestNodeMetadata(t *testing.T) {
 	inputs := []struct {
 		name string
@@ -430,6 +452,13 @@ func TestNodeTables(t *testing.T) {
 				Add(docker.ContainerIPs, report.MakeStringSet("10.10.10.0/24", "10.10.10.1/24")),
 			),
 			want: []report.Table{
+				{
+					ID:      docker.ContainerEventsPrefix,
+					Type:    report.MulticolumnTableType,
+					Label:   "Recent events",
+					Columns: docker.ContainerTableTemplates[docker.ContainerEventsPrefix].Columns,
+					Rows:    []report.Row{},
+				},
 				{
 					ID:    docker.EnvPrefix,
 					Type:  report.PropertyListType,
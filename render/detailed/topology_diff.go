@@ -2,6 +2,7 @@ package detailed
 
 import (
 	"reflect"
+	"sort"
 )
 
 // Diff is returned by TopoDiff. It represents the changes between two
@@ -38,3 +39,58 @@ func TopoDiff(a, b NodeSummaries) Diff {
 
 	return diff
 }
+
+// Edge is a directed edge between two nodes of a rendered topology.
+type Edge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// EdgeDiff is returned by TopoEdgeDiff. It represents the edges which
+// appeared and disappeared between two NodeSummary maps.
+type EdgeDiff struct {
+	Add    []Edge `json:"add"`
+	Remove []Edge `json:"remove"`
+}
+
+// TopoEdgeDiff gives you the edges added and removed to get from A to B,
+// sorted by source and target.
+func TopoEdgeDiff(a, b NodeSummaries) EdgeDiff {
+	var (
+		edgesA = edges(a)
+		edgesB = edges(b)
+		diff   EdgeDiff
+	)
+	for e := range edgesB {
+		if _, ok := edgesA[e]; !ok {
+			diff.Add = append(diff.Add, e)
+		}
+	}
+	for e := range edgesA {
+		if _, ok := edgesB[e]; !ok {
+			diff.Remove = append(diff.Remove, e)
+		}
+	}
+	sortEdges(diff.Add)
+	sortEdges(diff.Remove)
+	return diff
+}
+
+func edges(ns NodeSummaries) map[Edge]struct{} {
+	result := map[Edge]struct{}{}
+	for id, n := range ns {
+		for _, target := range n.Adjacency {
+			result[Edge{Source: id, Target: target}] = struct{}{}
+		}
+	}
+	return result
+}
+
+func sortEdges(es []Edge) {
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].Source != es[j].Source {
+			return es[i].Source < es[j].Source
+		}
+		return es[i].Target < es[j].Target
+	})
+}
@@ -108,3 +108,56 @@ func TestTopoDiff(t *testing.T) {
 		}
 	}
 }
+
+func TestTopoEdgeDiff(t *testing.T) {
+	node := func(id string, adjacency ...string) detailed.NodeSummary {
+		return detailed.NodeSummary{
+			BasicNodeSummary: detailed.BasicNodeSummary{ID: id},
+			Adjacency:        report.MakeIDList(adjacency...),
+		}
+	}
+	nodes := func(ns ...detailed.NodeSummary) detailed.NodeSummaries {
+		r := detailed.NodeSummaries{}
+		for _, n := range ns {
+			r[n.ID] = n
+		}
+		return r
+	}
+
+	for _, c := range []struct {
+		label      string
+		have, want detailed.EdgeDiff
+	}{
+		{
+			label: "no change",
+			have:  detailed.TopoEdgeDiff(nodes(node("a", "b"), node("b")), nodes(node("a", "b"), node("b"))),
+			want:  detailed.EdgeDiff{},
+		},
+		{
+			label: "nil -> something",
+			have:  detailed.TopoEdgeDiff(nil, nodes(node("a", "c", "b"), node("b", "a"))),
+			want: detailed.EdgeDiff{
+				Add: []detailed.Edge{{Source: "a", Target: "b"}, {Source: "a", Target: "c"}, {Source: "b", Target: "a"}},
+			},
+		},
+		{
+			label: "edges appear and disappear",
+			have:  detailed.TopoEdgeDiff(nodes(node("a", "b"), node("b")), nodes(node("a", "c"), node("b", "a"))),
+			want: detailed.EdgeDiff{
+				Add:    []detailed.Edge{{Source: "a", Target: "c"}, {Source: "b", Target: "a"}},
+				Remove: []detailed.Edge{{Source: "a", Target: "b"}},
+			},
+		},
+		{
+			label: "node removed",
+			have:  detailed.TopoEdgeDiff(nodes(node("a", "b"), node("b")), nodes(node("b"))),
+			want: detailed.EdgeDiff{
+				Remove: []detailed.Edge{{Source: "a", Target: "b"}},
+			},
+		},
+	} {
+		if !reflect.DeepEqual(c.want, c.have) {
+			t.Errorf("%s - %s", c.label, test.Diff(c.want, c.have))
+		}
+	}
+}
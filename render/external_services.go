@@ -0,0 +1,222 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/camlistore/camlistore/pkg/lru"
+	"github.com/ghodss/yaml"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// ExternalServiceCatalogue defines services outside of our infrastructure,
+// traffic to and from which is rendered as a pseudo node of its own rather
+// than as the Internet.
+type ExternalServiceCatalogue struct {
+	Services []ExternalService `json:"services"`
+
+	// DisableBuiltins turns off recognising the cloud provider services
+	// known to Scope (AWS, GCP, Azure) by their DNS names.
+	DisableBuiltins bool `json:"disableBuiltins,omitempty"`
+
+	// id tells renderings with different catalogues apart when memoising.
+	id string
+	// matches memoises match, like knownServiceCache does isKnownService.
+	matches *lru.Cache
+}
+
+// ExternalService is a named external service. Traffic belongs to it if it
+// matches any of the Include rules and none of the Exclude ones.
+type ExternalService struct {
+	Name    string                `json:"name"`
+	Include []ExternalServiceRule `json:"include"`
+	Exclude []ExternalServiceRule `json:"exclude,omitempty"`
+}
+
+// ExternalServiceRule matches the remote end of connections. All the fields
+// set have to match.
+type ExternalServiceRule struct {
+	// DNSSuffix matches any name of the remote address in the domain.
+	DNSSuffix string `json:"dnsSuffix,omitempty"`
+	// DNSRegexp matches any name of the remote address matching it in full.
+	DNSRegexp string `json:"dnsRegexp,omitempty"`
+	// CIDR matches remote addresses in the network.
+	CIDR string `json:"cidr,omitempty"`
+	// Port matches the remote port.
+	Port uint16 `json:"port,omitempty"`
+
+	dnsRegexp *regexp.Regexp
+	network   *net.IPNet
+	port      string
+}
+
+type externalServicesKey struct{}
+
+var noExternalServices = &ExternalServiceCatalogue{}
+
+// WithExternalServices returns a context rendering with the external service
+// catalogue c, which has to have been loaded or parsed.
+func WithExternalServices(ctx context.Context, c *ExternalServiceCatalogue) context.Context {
+	return context.WithValue(ctx, externalServicesKey{}, c)
+}
+
+// externalServices returns the external service catalogue to render with.
+func externalServices(ctx context.Context) *ExternalServiceCatalogue {
+	if c, ok := ctx.Value(externalServicesKey{}).(*ExternalServiceCatalogue); ok && c != nil {
+		return c
+	}
+	return noExternalServices
+}
+
+// LoadExternalServices reads an external service catalogue from a YAML or
+// JSON file.
+func LoadExternalServices(path string) (*ExternalServiceCatalogue, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseExternalServices(buf)
+}
+
+// ParseExternalServices parses a YAML or JSON external service catalogue,
+// checking its rules.
+func ParseExternalServices(buf []byte) (*ExternalServiceCatalogue, error) {
+	var c ExternalServiceCatalogue
+	if err := yaml.Unmarshal(buf, &c); err != nil {
+		return nil, err
+	}
+	names := map[string]struct{}{}
+	for i := range c.Services {
+		s := &c.Services[i]
+		if s.Name == "" {
+			return nil, fmt.Errorf("external service %d has no name", i)
+		}
+		if _, ok := names[s.Name]; ok {
+			return nil, fmt.Errorf("external service %q defined more than once", s.Name)
+		}
+		names[s.Name] = struct{}{}
+		if len(s.Include) == 0 {
+			return nil, fmt.Errorf("external service %q has no include rules", s.Name)
+		}
+		for _, rules := range [][]ExternalServiceRule{s.Include, s.Exclude} {
+			for j := range rules {
+				if err := rules[j].compile(); err != nil {
+					return nil, fmt.Errorf("external service %q: %v", s.Name, err)
+				}
+			}
+		}
+	}
+	c.id = fmt.Sprintf("%x", rand.Int63())
+	c.matches = lru.New(10000)
+	return &c, nil
+}
+
+func (r *ExternalServiceRule) compile() error {
+	if r.DNSSuffix == "" && r.DNSRegexp == "" && r.CIDR == "" && r.Port == 0 {
+		return fmt.Errorf("empty rule")
+	}
+	if r.DNSRegexp != "" {
+		re, err := regexp.Compile("^(?:" + r.DNSRegexp + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid dnsRegexp %q: %v", r.DNSRegexp, err)
+		}
+		r.dnsRegexp = re
+	}
+	if r.CIDR != "" {
+		_, network, err := net.ParseCIDR(r.CIDR)
+		if err != nil {
+			return fmt.Errorf("invalid cidr %q: %v", r.CIDR, err)
+		}
+		r.network = network
+	}
+	if r.Port != 0 {
+		r.port = strconv.Itoa(int(r.Port))
+	}
+	return nil
+}
+
+func (r *ExternalServiceRule) matchesName(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if suffix := strings.Trim(r.DNSSuffix, "."); suffix != "" && name != suffix && !strings.HasSuffix(name, "."+suffix) {
+		return false
+	}
+	return r.dnsRegexp == nil || r.dnsRegexp.MatchString(name)
+}
+
+func (r *ExternalServiceRule) matches(names report.DNSRecord, ip net.IP, port string) bool {
+	if r.port != "" && r.port != port {
+		return false
+	}
+	if r.network != nil && (ip == nil || !r.network.Contains(ip)) {
+		return false
+	}
+	if r.DNSSuffix != "" || r.dnsRegexp != nil {
+		return r.matchesAnyName(names.Forward) || r.matchesAnyName(names.Reverse)
+	}
+	return true
+}
+
+func (r *ExternalServiceRule) matchesAnyName(names report.StringSet) bool {
+	for _, name := range names {
+		if r.matchesName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ExternalService) matches(names report.DNSRecord, ip net.IP, port string) bool {
+	included := false
+	for i := range s.Include {
+		if s.Include[i].matches(names, ip, port) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for i := range s.Exclude {
+		if s.Exclude[i].matches(names, ip, port) {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns the name of the first external service the endpoint at addr
+// and port belongs to, given the names of addr in rpt. This is a hotspot in
+// rendering, so it is memoised on all of those.
+func (c *ExternalServiceCatalogue) match(rpt report.Report, addr, port string) (string, bool) {
+	if len(c.Services) == 0 {
+		return "", false
+	}
+	names := rpt.DNS[addr]
+	key := strings.Join([]string{addr, port, strings.Join(names.Forward, ","), strings.Join(names.Reverse, ",")}, ";")
+	if c.matches != nil {
+		if v, ok := c.matches.Get(key); ok {
+			name := v.(string)
+			return name, name != ""
+		}
+	}
+
+	name := ""
+	ip := net.ParseIP(addr)
+	for i := range c.Services {
+		if c.Services[i].matches(names, ip, port) {
+			name = c.Services[i].Name
+			break
+		}
+	}
+	if c.matches != nil {
+		c.matches.Add(key, name)
+	}
+	return name, name != ""
+}
@@ -0,0 +1,139 @@
+package render_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/utils"
+)
+
+func TestParseExternalServices(t *testing.T) {
+	for _, bad := range []string{
+		`services: [{include: [{cidr: 10.0.0.0/8}]}]`,
+		`services: [{name: foo}]`,
+		`services: [{name: foo, include: [{}]}]`,
+		`services: [{name: foo, include: [{cidr: 10.0.0.0/33}]}]`,
+		`services: [{name: foo, include: [{dnsRegexp: "("}]}]`,
+		`services: [{name: foo, include: [{port: 80}]}, {name: foo, include: [{port: 81}]}]`,
+	} {
+		if _, err := render.ParseExternalServices([]byte(bad)); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+
+	catalogue, err := render.ParseExternalServices([]byte(`{"services": [{"name": "Stripe API", "include": [{"dnsSuffix": "stripe.com"}]}], "disableBuiltins": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Stripe API", catalogue.Services[0].Name)
+	assert.True(t, catalogue.DisableBuiltins)
+}
+
+func withExternalServices(t *testing.T, catalogue string) context.Context {
+	c, err := render.ParseExternalServices([]byte(catalogue))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return render.WithExternalServices(context.Background(), c)
+}
+
+func nodeIDs(nodes report.Nodes) []string {
+	ids := []string{}
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestExternalServiceNodes(t *testing.T) {
+	dnsRpt := rpt.Copy()
+	dnsRpt.DNS = report.DNSRecords{
+		randomIP: report.DNSRecord{Forward: report.MakeStringSet("api.stripe.com")},
+	}
+
+	for _, tc := range []struct {
+		name      string
+		catalogue string
+		rpt       report.Report
+		want      string
+	}{
+		{
+			name:      "cidr",
+			catalogue: `services: [{name: Corporate VPN 3.4.0.0/16, include: [{cidr: 3.4.0.0/16}]}]`,
+			rpt:       rpt,
+			want:      render.ServiceNodeIDPrefix + "Corporate VPN 3.4.0.0/16",
+		},
+		{
+			name:      "cidr and port",
+			catalogue: `services: [{name: Partner, include: [{cidr: 3.4.0.0/16, port: ` + randomPort + `}]}]`,
+			rpt:       rpt,
+			want:      render.ServiceNodeIDPrefix + "Partner",
+		},
+		{
+			name:      "wrong port",
+			catalogue: `services: [{name: Partner, include: [{cidr: 3.4.0.0/16, port: 443}]}]`,
+			rpt:       rpt,
+			want:      render.IncomingInternetID,
+		},
+		{
+			name:      "excluded",
+			catalogue: `services: [{name: Partner, include: [{cidr: 3.0.0.0/8}], exclude: [{cidr: 3.4.5.0/24}]}]`,
+			rpt:       rpt,
+			want:      render.IncomingInternetID,
+		},
+		{
+			name:      "dns suffix",
+			catalogue: `services: [{name: Stripe API, include: [{dnsSuffix: stripe.com}]}]`,
+			rpt:       dnsRpt,
+			want:      render.ServiceNodeIDPrefix + "Stripe API",
+		},
+		{
+			name:      "dns suffix of another domain",
+			catalogue: `services: [{name: Stripe API, include: [{dnsSuffix: tripe.com}]}]`,
+			rpt:       dnsRpt,
+			want:      render.IncomingInternetID,
+		},
+		{
+			name:      "dns regexp",
+			catalogue: `services: [{name: Stripe API, include: [{dnsRegexp: 'api\.[a-z]+\.com'}]}]`,
+			rpt:       dnsRpt,
+			want:      render.ServiceNodeIDPrefix + "Stripe API",
+		},
+	} {
+		ctx := withExternalServices(t, tc.catalogue)
+		have := utils.Prune(render.ContainerWithImageNameRenderer.Render(ctx, tc.rpt).Nodes)
+
+		node, ok := have[tc.want]
+		if !ok {
+			t.Errorf("%s: expected output to have node %s, but had %v", tc.name, tc.want, nodeIDs(have))
+			continue
+		}
+		if !node.Adjacency.Contains(container1NodeID) {
+			t.Errorf("%s: expected %s to have adjacency to %s, but only had %v", tc.name, tc.want, container1NodeID, node.Adjacency)
+		}
+	}
+}
+
+func TestExternalServiceBuiltins(t *testing.T) {
+	dnsRpt := rpt.Copy()
+	dnsRpt.DNS = report.DNSRecords{
+		randomIP: report.DNSRecord{Forward: report.MakeStringSet("s3.amazonaws.com")},
+	}
+
+	have := render.ContainerWithImageNameRenderer.Render(context.Background(), dnsRpt).Nodes
+	if _, ok := have[render.ServiceNodeIDPrefix+"s3.amazonaws.com"]; !ok {
+		t.Errorf("expected builtin service node, but had %v", nodeIDs(have))
+	}
+
+	// The same report rendered with another catalogue isn't served from the
+	// memoised renderings
+	ctx := withExternalServices(t, `{services: [], disableBuiltins: true}`)
+	have = render.ContainerWithImageNameRenderer.Render(ctx, dnsRpt).Nodes
+	if _, ok := have[render.IncomingInternetID]; !ok {
+		t.Errorf("expected internet node with builtins disabled, but had %v", nodeIDs(have))
+	}
+}
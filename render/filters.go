@@ -76,12 +76,17 @@ func (f FilterFunc) Transform(nodes Nodes) Nodes {
 	// Deleted nodes also need to be cut as destinations in adjacency lists.
 	for id, node := range output {
 		newAdjacency := report.MakeIDList()
+		newEdges := report.MakeEdgeMetadatas()
 		for _, dstID := range node.Adjacency {
 			if _, ok := output[dstID]; ok {
 				newAdjacency = newAdjacency.Add(dstID)
+				if md, ok := node.Edges.Lookup(dstID); ok {
+					newEdges = newEdges.Add(dstID, md)
+				}
 			}
 		}
 		node.Adjacency = newAdjacency
+		node.Edges = newEdges
 		output[id] = node
 	}
 
@@ -179,6 +184,7 @@ func filterInternetAdjacencies(nodes report.Nodes) {
 		}
 	}
 	incomingInternet.Adjacency = newAdjacency
+	incomingInternet.Edges = incomingInternet.Edges.Delete(OutgoingInternetID)
 	nodes[IncomingInternetID] = incomingInternet
 }
 
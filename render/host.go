@@ -1,6 +1,8 @@
 package render
 
 import (
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -50,6 +52,17 @@ func nodes2Hosts(nodes Nodes) Nodes {
 	return ret.result(nodes)
 }
 
+// IsUnprobedHost checks if the node is a host only known from the
+// Kubernetes API, as no Scope probe is running on it.
+func IsUnprobedHost(n report.Node) bool {
+	if n.Topology != report.Host {
+		return false
+	}
+	_, probed := n.Latest.Lookup(host.HostName)
+	_, kubernetesNode := n.Latest.Lookup(kubernetes.KubeletVersion)
+	return kubernetesNode && !probed
+}
+
 func endpoint2Host(n report.Node) string {
 	if hostNodeID, ok := n.Latest.Lookup(report.HostNodeID); ok {
 		return hostNodeID
@@ -1,6 +1,7 @@
 package render
 
 import (
+	"context"
 	"strings"
 
 	"github.com/weaveworks/scope/report"
@@ -61,13 +62,13 @@ func NewDerivedPseudoNode(id string, node report.Node) report.Node {
 	return output
 }
 
-func pseudoNodeID(rpt report.Report, n report.Node, local report.Networks) (string, bool) {
-	_, addr, _, ok := report.ParseEndpointNodeID(n.ID)
+func pseudoNodeID(ctx context.Context, rpt report.Report, n report.Node, local report.Networks) (string, bool) {
+	_, addr, port, ok := report.ParseEndpointNodeID(n.ID)
 	if !ok {
 		return "", false
 	}
 
-	if id, ok := externalNodeID(rpt, n, addr, local); ok {
+	if id, ok := externalNodeID(ctx, rpt, n, addr, port, local); ok {
 		return id, ok
 	}
 
@@ -77,12 +78,18 @@ func pseudoNodeID(rpt report.Report, n report.Node, local report.Networks) (stri
 }
 
 // figure out if a node should be considered external and returns an ID which can be used to create a pseudo node
-func externalNodeID(rpt report.Report, n report.Node, addr string, local report.Networks) (string, bool) {
+func externalNodeID(ctx context.Context, rpt report.Report, n report.Node, addr, port string, local report.Networks) (string, bool) {
 	// First, check if it's a known service and emit a a specific node if it
 	// is. This needs to be done before checking IPs since known services can
 	// live in the same network, see https://github.com/weaveworks/scope/issues/2163
-	if hostname, found := rpt.DNS.FirstMatch(n.ID, isKnownService); found {
-		return ServiceNodeIDPrefix + hostname, true
+	services := externalServices(ctx)
+	if name, found := services.match(rpt, addr, port); found {
+		return ServiceNodeIDPrefix + name, true
+	}
+	if !services.DisableBuiltins {
+		if hostname, found := rpt.DNS.FirstMatch(n.ID, isKnownService); found {
+			return ServiceNodeIDPrefix + hostname, true
+		}
 	}
 
 	// If the dstNodeAddr is not in a network local to this report, we emit an
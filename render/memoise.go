@@ -13,7 +13,8 @@ import (
 
 // renderCache is keyed on the combination of Memoiser and report
 // id. It contains promises of report.Nodes, which result from
-// rendering the report with the Memoiser's renderer.
+// rendering the report with the Memoiser's renderer. The external
+// service catalogue rendered with is part of the key too.
 //
 // The use of promises ensures that in the absence of cache evictions
 // a memoiser will only ever render a report once, even when Render()
@@ -42,7 +43,7 @@ func Memoise(r Renderer) Renderer {
 // it stores a new promise and fulfils it by calling through to
 // m.Renderer.
 func (m *memoise) Render(ctx context.Context, rpt report.Report) Nodes {
-	key := fmt.Sprintf("%s-%s", rpt.ID, m.id)
+	key := fmt.Sprintf("%s-%s-%s", rpt.ID, m.id, externalServices(ctx).id)
 
 	m.Lock()
 	v, err := renderCache.Get(key)
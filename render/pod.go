@@ -31,6 +31,9 @@ func renderKubernetesTopologies(rpt report.Report) bool {
 		&rpt.PersistentVolumeClaim,
 		&rpt.StorageClass,
 		&rpt.Job,
+		&rpt.Ingress,
+		&rpt.NetworkPolicy,
+		&rpt.HorizontalPodAutoscaler,
 	}
 	for _, t := range topologies {
 		if len(t.Nodes) > 0 {
@@ -118,6 +121,40 @@ var KubeControllerRenderer = ConditionalRenderer(renderKubernetesTopologies,
 	),
 )
 
+// IngressRenderer is a Renderer which produces a renderable kubernetes
+// services graph, with the ingresses routing traffic to the services.
+//
+// not memoised
+var IngressRenderer = ConditionalRenderer(renderKubernetesTopologies,
+	MakeReduce(
+		SelectIngress,
+		PodServiceRenderer,
+	),
+)
+
+// NetworkPolicyRenderer is a Renderer which produces a renderable kubernetes
+// network policies graph by merging the pods graph and the network policies
+// topology. Pods not selected by any policy are dropped.
+//
+// not memoised
+var NetworkPolicyRenderer = ConditionalRenderer(renderKubernetesTopologies,
+	renderParents(
+		report.Pod, []string{report.NetworkPolicy}, "",
+		PodRenderer,
+	),
+)
+
+// HorizontalPodAutoscalerRenderer is a Renderer which produces a renderable
+// kubernetes controllers graph, with the autoscalers scaling the controllers.
+//
+// not memoised
+var HorizontalPodAutoscalerRenderer = ConditionalRenderer(renderKubernetesTopologies,
+	MakeReduce(
+		SelectHorizontalPodAutoscaler,
+		KubeControllerRenderer,
+	),
+)
+
 // renderParents produces a 'standard' renderer for mapping from some child topology to some parent topologies,
 // by taking a child renderer, mapping to parents, propagating single metrics, and joining with full parent topology.
 // Other options are as per Map2Parent.
@@ -0,0 +1,324 @@
+package render
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// ParseQuery parses a node query into a FilterFunc keeping the nodes it
+// matches. Queries compare node fields with values, combined with AND, OR,
+// NOT and parentheses, e.g.
+//
+//	topology=container AND docker_label_team=payments AND docker_cpu_total_usage > 80
+//
+// Fields are looked up, in order, as
+//   - id and topology, the node's ID and topology;
+//   - parents.<topology>, the IDs of the node's parents in the topology,
+//     with or without their ";<topology>" suffix;
+//   - Latest keys, which include Docker and Kubernetes labels;
+//   - Sets keys;
+//   - metrics, whose value is that of their last sample.
+//
+// The comparison operators are =, !=, <, <=, >, >=, =~ and !~; the last two
+// match regular expressions, in full. Values compare as numbers if both
+// sides are numbers. A field with several values, e.g. a set, matches if any
+// of them does; != and !~ are the negation of = and =~. A field on its own
+// matches nodes which have it. Values with spaces or operator characters
+// are quoted with ' or ".
+func ParseQuery(query string) (FilterFunc, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+	}
+	return FilterFunc(expr), nil
+}
+
+type queryTokenKind int
+
+const (
+	tokenEOF queryTokenKind = iota
+	tokenWord
+	tokenString
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+	pos  int
+}
+
+func (t queryToken) String() string {
+	if t.kind == tokenEOF {
+		return "end of query"
+	}
+	return strconv.Quote(t.text)
+}
+
+// keyword returns whether the token is the (case insensitive) keyword.
+func (t queryToken) keyword(k string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, k)
+}
+
+var queryOps = []string{"!=", "=~", "!~", "<=", ">=", "=", "<", ">"}
+
+func isQueryOpChar(r rune) bool {
+	return strings.ContainsRune("=!<>~", r)
+}
+
+func lexQuery(query string) ([]queryToken, error) {
+	tokens := []queryToken{}
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{tokenLParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{tokenRParen, ")", i})
+			i++
+		case r == '"' || r == '\'':
+			start := i
+			var text []rune
+			for i++; ; i++ {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated string at position %d", start)
+				}
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				} else if runes[i] == r {
+					i++
+					break
+				}
+				text = append(text, runes[i])
+			}
+			tokens = append(tokens, queryToken{tokenString, string(text), start})
+		case isQueryOpChar(r):
+			op := ""
+			for _, candidate := range queryOps {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("invalid operator at position %d", i)
+			}
+			tokens = append(tokens, queryToken{tokenOp, op, i})
+			i += len(op)
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !isQueryOpChar(runes[i]) &&
+				runes[i] != '(' && runes[i] != ')' && runes[i] != '"' && runes[i] != '\'' {
+				i++
+			}
+			tokens = append(tokens, queryToken{tokenWord, string(runes[start:i]), start})
+		}
+	}
+	return append(tokens, queryToken{tokenEOF, "", len(runes)}), nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) parseOr() (func(report.Node) bool, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(n report.Node) bool { return l(n) || right(n) }
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (func(report.Node) bool, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(n report.Node) bool { return l(n) && right(n) }
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (func(report.Node) bool, error) {
+	if p.peek().keyword("not") {
+		p.next()
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(n report.Node) bool { return !expr(n) }, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (func(report.Node) bool, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokenLParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, fmt.Errorf("expected \")\" at position %d, got %s", closing.pos, closing)
+		}
+		return expr, nil
+	case t.kind == tokenWord || t.kind == tokenString:
+		field := t.text
+		if p.peek().kind != tokenOp {
+			return func(n report.Node) bool {
+				_, ok := queryFieldValues(n, field)
+				return ok
+			}, nil
+		}
+		op := p.next()
+		value := p.next()
+		if value.kind != tokenWord && value.kind != tokenString {
+			return nil, fmt.Errorf("expected value at position %d, got %s", value.pos, value)
+		}
+		return makeQueryComparison(field, op.text, value.text)
+	default:
+		return nil, fmt.Errorf("expected field at position %d, got %s", t.pos, t)
+	}
+}
+
+func makeQueryComparison(field, op, value string) (func(report.Node) bool, error) {
+	var match func(string) bool
+	switch op {
+	case "=", "!=":
+		match = func(v string) bool { return queryEqual(v, value) }
+	case "=~", "!~":
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", value, err)
+		}
+		match = re.MatchString
+	default:
+		want, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s needs a number, got %q", op, value)
+		}
+		match = func(v string) bool {
+			have, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return false
+			}
+			switch op {
+			case "<":
+				return have < want
+			case "<=":
+				return have <= want
+			case ">":
+				return have > want
+			default:
+				return have >= want
+			}
+		}
+	}
+	negate := strings.HasPrefix(op, "!")
+	return func(n report.Node) bool {
+		values, _ := queryFieldValues(n, field)
+		for _, v := range values {
+			if match(v) {
+				return !negate
+			}
+		}
+		return negate
+	}, nil
+}
+
+func queryEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+	return errX == nil && errY == nil && x == y
+}
+
+const queryParentsPrefix = "parents."
+
+// queryFieldValues returns the values of a field of n, and whether n has
+// the field at all.
+func queryFieldValues(n report.Node, field string) ([]string, bool) {
+	switch field {
+	case "id":
+		return []string{n.ID}, true
+	case "topology":
+		return []string{n.Topology}, true
+	}
+	if strings.HasPrefix(field, queryParentsPrefix) {
+		parents, ok := n.Parents.Lookup(strings.TrimPrefix(field, queryParentsPrefix))
+		if !ok {
+			return nil, false
+		}
+		values := make([]string, 0, 2*len(parents))
+		for _, id := range parents {
+			values = append(values, id)
+			if i := strings.LastIndex(id, report.ScopeDelim); i >= 0 && strings.HasPrefix(id[i+1:], "<") {
+				values = append(values, id[:i])
+			}
+		}
+		return values, true
+	}
+	if v, ok := n.Latest.Lookup(field); ok {
+		return []string{v}, true
+	}
+	if set, ok := n.Sets.Lookup(field); ok {
+		return set, true
+	}
+	if metric, ok := n.Metrics[field]; ok {
+		if sample, ok := metric.LastSample(); ok {
+			return []string{strconv.FormatFloat(sample.Value, 'f', -1, 64)}, true
+		}
+	}
+	return nil, false
+}
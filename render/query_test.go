@@ -0,0 +1,83 @@
+package render_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestParseQuery(t *testing.T) {
+	now := time.Now()
+	payments := report.MakeNodeWith("a1;<container>", map[string]string{
+		"docker_label_team":     "payments",
+		"docker_container_name": "payments api",
+	}).
+		WithTopology(report.Container).
+		WithMetric("docker_cpu_total_usage", report.MakeSingletonMetric(now, 85.5)).
+		WithSets(report.MakeSets().Add("docker_container_ips", report.MakeStringSet("10.0.0.1", "10.0.0.2"))).
+		WithParent(report.Host, report.MakeHostNodeID("host1"))
+	search := report.MakeNodeWith("b2;<container>", map[string]string{
+		"docker_label_team":     "search",
+		"docker_container_name": "search",
+	}).
+		WithTopology(report.Container).
+		WithMetric("docker_cpu_total_usage", report.MakeSingletonMetric(now, 12)).
+		WithParent(report.Host, report.MakeHostNodeID("host2"))
+	host := report.MakeNode(report.MakeHostNodeID("host1")).WithTopology(report.Host)
+
+	for _, tc := range []struct {
+		query string
+		want  []bool // payments, search, host
+	}{
+		{`topology=container`, []bool{true, true, false}},
+		{`topology=container AND docker_label_team=payments AND docker_cpu_total_usage > 80`, []bool{true, false, false}},
+		{`docker_cpu_total_usage>80`, []bool{true, false, false}},
+		{`docker_cpu_total_usage <= 12`, []bool{false, true, false}},
+		{`docker_cpu_total_usage = 12.0`, []bool{false, true, false}},
+		{`docker_label_team != payments`, []bool{false, true, true}},
+		{`docker_label_team`, []bool{true, true, false}},
+		{`NOT docker_label_team`, []bool{false, false, true}},
+		{`docker_label_team=search or topology=host`, []bool{false, true, true}},
+		{`docker_label_team=payments OR docker_label_team=search AND docker_cpu_total_usage > 80`, []bool{true, false, false}},
+		{`(docker_label_team=payments OR docker_label_team=search) AND docker_cpu_total_usage > 10`, []bool{true, true, false}},
+		{`docker_container_name = "payments api"`, []bool{true, false, false}},
+		{`docker_container_name = 'payments api'`, []bool{true, false, false}},
+		{`docker_container_name =~ pay.*`, []bool{true, false, false}},
+		{`docker_container_name =~ pay`, []bool{false, false, false}},
+		{`docker_container_name !~ pay.*`, []bool{false, true, true}},
+		{`docker_container_ips = 10.0.0.2`, []bool{true, false, false}},
+		{`parents.host = host1`, []bool{true, false, false}},
+		{`parents.host = "host2;<host>"`, []bool{false, true, false}},
+		{`id = "host1;<host>"`, []bool{false, false, true}},
+	} {
+		filter, err := render.ParseQuery(tc.query)
+		if err != nil {
+			t.Errorf("%s: %v", tc.query, err)
+			continue
+		}
+		for i, n := range []report.Node{payments, search, host} {
+			if have := filter(n); have != tc.want[i] {
+				t.Errorf("%s: %s: want %v, have %v", tc.query, n.ID, tc.want[i], have)
+			}
+		}
+	}
+
+	for _, bad := range []string{
+		``,
+		`topology=`,
+		`=container`,
+		`topology==container`,
+		`(topology=container`,
+		`topology=container)`,
+		`topology=container AND`,
+		`docker_cpu_total_usage > high`,
+		`docker_container_name =~ "("`,
+		`docker_container_name = "payments`,
+	} {
+		if _, err := render.ParseQuery(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
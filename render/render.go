@@ -161,8 +161,9 @@ type joinResults struct {
 func newJoinResults(inputNodes report.Nodes) joinResults {
 	nodes := make(report.Nodes, len(inputNodes))
 	for id, n := range inputNodes {
-		n.Adjacency = nil              // result() assumes all nodes start with no adjacencies
-		n.Children = n.Children.Copy() // so we can do unsafe adds
+		n.Adjacency = nil                    // result() assumes all nodes start with no adjacencies
+		n.Edges = report.MakeEdgeMetadatas() // or edge metadata
+		n.Children = n.Children.Copy()       // so we can do unsafe adds
 		nodes[id] = n
 	}
 	return joinResults{nodes: nodes, mapped: map[string]string{}, multi: map[string][]string{}}
@@ -179,6 +180,7 @@ func (ret *joinResults) mapChild(from, to string) {
 // Add m into the results as a top-level node, mapped from original ID
 // Note it is not safe to mix calls to add() with addChild(), addChildAndChildren() or addUnmappedChild()
 func (ret *joinResults) add(from string, m report.Node) {
+	m.Edges = report.MakeEdgeMetadatas() // result() rebuilds all edge metadata from the input nodes
 	if existing, ok := ret.nodes[m.ID]; ok {
 		m = m.Merge(existing)
 	}
@@ -219,36 +221,44 @@ func (ret *joinResults) addChildAndChildren(m report.Node, id string, topology s
 
 // Add a copy of n straight into the results
 func (ret *joinResults) passThrough(n report.Node) {
-	n.Adjacency = nil // result() assumes all nodes start with no adjacencies
+	n.Adjacency = nil                    // result() assumes all nodes start with no adjacencies
+	n.Edges = report.MakeEdgeMetadatas() // or edge metadata
 	ret.nodes[n.ID] = n
 	n.Children = n.Children.Copy() // so we can do unsafe adds
 	ret.mapChild(n.ID, n.ID)
 }
 
-// Rewrite Adjacency of nodes in ret mapped from original nodes in
-// input, and return the result.
+// Rewrite Adjacency and Edges of nodes in ret mapped from original
+// nodes in input, and return the result.
 func (ret *joinResults) result(input Nodes) Nodes {
 	for _, n := range input.Nodes {
 		outID, ok := ret.mapped[n.ID]
 		if !ok {
 			continue
 		}
-		ret.rewriteAdjacency(outID, n.Adjacency)
+		ret.rewriteAdjacency(outID, n.Adjacency, n.Edges)
 		for _, outID := range ret.multi[n.ID] {
-			ret.rewriteAdjacency(outID, n.Adjacency)
+			ret.rewriteAdjacency(outID, n.Adjacency, n.Edges)
 		}
 	}
 	return Nodes{Nodes: ret.nodes}
 }
 
-func (ret *joinResults) rewriteAdjacency(outID string, adjacency report.IDList) {
+func (ret *joinResults) rewriteAdjacency(outID string, adjacency report.IDList, edges report.EdgeMetadatas) {
 	out := ret.nodes[outID]
 	// for each adjacency in the original node, find out what it maps
-	// to (if any), and add that to the new node
+	// to (if any), and add that to the new node, summing the metadata
+	// of all the edges which end up being aggregated into one
 	for _, a := range adjacency {
 		if mappedDest, found := ret.mapped[a]; found {
 			out.Adjacency = out.Adjacency.Add(mappedDest)
 			out.Adjacency = out.Adjacency.Add(ret.multi[a]...)
+			if md, ok := edges.Lookup(a); ok {
+				out.Edges = out.Edges.Flatten(mappedDest, md)
+				for _, dest := range ret.multi[a] {
+					out.Edges = out.Edges.Flatten(dest, md)
+				}
+			}
 		}
 	}
 	ret.nodes[outID] = out
@@ -93,4 +93,27 @@ func TestMapRender3(t *testing.T) {
 	}
 }
 
+func TestMapRenderEdges(t *testing.T) {
+	// 4. Check edge metadata is summed when edges are aggregated
+	mapper := render.Map{
+		MapFunc: func(nodes report.Node) report.Node {
+			return report.MakeNode(nodes.ID[:1])
+		},
+		Renderer: mockRenderer{Nodes: report.Nodes{
+			"a1": report.MakeNode("a1").WithEdge("b1", report.EdgeMetadata{EgressByteCount: 10, MaxConnCount: 1}),
+			"a2": report.MakeNode("a2").WithEdge("b2", report.EdgeMetadata{EgressByteCount: 5, MaxConnCount: 2}),
+			"b1": report.MakeNode("b1"),
+			"b2": report.MakeNode("b2"),
+		}},
+	}
+	want := report.Nodes{
+		"a": report.MakeNode("a").WithEdge("b", report.EdgeMetadata{EgressByteCount: 15, MaxConnCount: 3}),
+		"b": report.MakeNode("b"),
+	}
+	have := mapper.Render(context.Background(), report.MakeReport()).Nodes
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
 func newu64(value uint64) *uint64 { return &value }
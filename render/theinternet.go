@@ -55,7 +55,8 @@ func purgeKnownServiceCache() {
 	knownServiceCache = lru.New(10000)
 }
 
-// TODO: Make it user-customizable https://github.com/weaveworks/scope/issues/1876
+// isKnownService recognises the cloud provider services built into Scope;
+// others can be defined in an ExternalServiceCatalogue.
 // NB: this is a hotspot in rendering performance.
 func isKnownService(hostname string) bool {
 	if v, ok := knownServiceCache.Get(hostname); ok {
@@ -83,7 +84,7 @@ func LocalNetworks(r report.Report) report.Networks {
 			}
 		}
 	}
-	if extra := kubeServiceNetwork(r.Service); extra != nil {
+	for _, extra := range kubeServiceNetworks(r.Service) {
 		networks.Add(extra)
 	}
 	return networks
@@ -94,20 +95,22 @@ func LocalNetworks(r report.Report) report.Networks {
 // service-cluster-ip-range is not exposed by the API server (see
 // https://github.com/kubernetes/kubernetes/issues/25533), so instead
 // we synthesise it by computing the smallest network that contains
-// all service IPs. That network may be smaller than the actual range
-// but that is ok, since in the end all we care about is that it
-// contains all the service IPs.
+// all service IPs, one per address family. That network may be smaller
+// than the actual range but that is ok, since in the end all we care
+// about is that it contains all the service IPs.
 //
-// The right way of fixing this is performing DNAT mapping on
-// persistent connections for which we don't have a robust solution
-// (see https://github.com/weaveworks/scope/issues/1491).
-func kubeServiceNetwork(services report.Topology) *net.IPNet {
+// Probes running with Kubernetes now point connections to service IPs
+// at their backends, using conntrack's DNAT entries and kube-proxy's
+// IPVS and iptables state (see https://github.com/weaveworks/scope/issues/1491),
+// so this only catches the connections they could not resolve, e.g.
+// to services with several backends when conntrack is disabled.
+func kubeServiceNetworks(services report.Topology) []*net.IPNet {
 	serviceIPs := make([]net.IP, 0, len(services.Nodes))
 	for _, md := range services.Nodes {
 		serviceIP, _ := md.Latest.Lookup(report.KubernetesIP)
-		if ip := net.ParseIP(serviceIP).To4(); ip != nil {
+		if ip := net.ParseIP(serviceIP); ip != nil {
 			serviceIPs = append(serviceIPs, ip)
 		}
 	}
-	return report.ContainingIPv4Network(serviceIPs)
+	return report.ContainingNetworks(serviceIPs)
 }
@@ -1,8 +1,10 @@
 package render_test
 
 import (
+	"net"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/weaveworks/common/test"
 	"github.com/weaveworks/scope/probe/host"
@@ -40,3 +42,33 @@ func TestReportLocalNetworks(t *testing.T) {
 		t.Errorf("%s", test.Diff(want, have))
 	}
 }
+
+func TestReportLocalNetworksDualStack(t *testing.T) {
+	r := report.MakeReport().Merge(report.Report{
+		Host: report.Topology{
+			Nodes: report.Nodes{
+				"foo": report.MakeNode("foo").WithSets(report.MakeSets().
+					Add(host.LocalNetworks, report.MakeStringSet("10.0.0.1/8", "fd00::1/64")),
+				),
+			},
+		},
+		Service: report.Topology{
+			Nodes: report.Nodes{
+				"svc1": report.MakeNode("svc1").WithLatest(report.KubernetesIP, time.Now(), "10.96.0.1"),
+				"svc2": report.MakeNode("svc2").WithLatest(report.KubernetesIP, time.Now(), "fd00:10:96::1"),
+				"svc3": report.MakeNode("svc3").WithLatest(report.KubernetesIP, time.Now(), "fd00:10:96::a"),
+			},
+		},
+	})
+	have := render.LocalNetworks(r)
+	for _, ip := range []string{"10.0.0.1", "fd00::42", "10.96.0.1", "fd00:10:96::5"} {
+		if !have.Contains(net.ParseIP(ip)) {
+			t.Errorf("%s not in local networks", ip)
+		}
+	}
+	for _, ip := range []string{"8.8.8.8", "2001:4860:4860::8888", "fd00:10:97::1"} {
+		if have.Contains(net.ParseIP(ip)) {
+			t.Errorf("%s in local networks", ip)
+		}
+	}
+}
@@ -129,6 +129,11 @@ func (*NodeControls) UnmarshalJSON(b []byte) error {
 
 // NodeControlData contains specific information about the control. It
 // is used as a Value field of LatestEntry in NodeControlDataLatestMap.
+//
+// ProbeID, when set, is the probe handling the control, overriding the
+// node's ControlProbeID. This allows probes other than the one owning a
+// node to provide controls for it.
 type NodeControlData struct {
-	Dead bool `json:"dead"`
+	Dead    bool   `json:"dead"`
+	ProbeID string `json:"probeId,omitempty"`
 }
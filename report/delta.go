@@ -0,0 +1,199 @@
+package report
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+// Delta is a Report encoded as the difference from an earlier report of
+// the same probe, which the receiver is expected to still have. It is used
+// to cut the size of what probes publish, since most of a report doesn't
+// change from one publish to the next.
+//
+// Nodes which are unchanged since the base report are omitted. Nodes which
+// changed carry only the Latest entries whose values differ from the base,
+// plus all their other fields. Latest timestamps are ignored when
+// comparing, so entries which are left out keep their base timestamps.
+type Delta struct {
+	// Base is the ID of the report this delta applies to.
+	Base string `json:"base"`
+
+	// Report holds the new and changed nodes, along with everything else
+	// in the report (DNS, templates, plugins, ...) in full.
+	Report Report `json:"report"`
+
+	// Replaced lists, per topology, the nodes in Report which replace their
+	// base counterparts outright rather than being merged into them,
+	// because some of their Latest entries went away.
+	Replaced map[string][]string `json:"replaced,omitempty"`
+
+	// Removed lists, per topology, the IDs of nodes which are gone.
+	Removed map[string][]string `json:"removed,omitempty"`
+}
+
+// MakeDelta computes the delta which turns base into current.
+func MakeDelta(base, current Report) Delta {
+	delta := Delta{
+		Base: base.ID,
+		Report: Report{
+			DNS:      current.DNS,
+			Sampling: current.Sampling,
+			Window:   current.Window,
+			Shortcut: current.Shortcut,
+			Plugins:  current.Plugins,
+			ID:       current.ID,
+		},
+		Replaced: map[string][]string{},
+		Removed:  map[string][]string{},
+	}
+	for _, name := range topologyNames {
+		baseTopology, currentTopology := base.topology(name), current.topology(name)
+		topology := *currentTopology
+		topology.Nodes = Nodes{}
+		for id, node := range currentTopology.Nodes {
+			baseNode, ok := baseTopology.Nodes[id]
+			if !ok {
+				topology.Nodes[id] = node
+				continue
+			}
+			nodeDelta, changed, replaced := diffNode(baseNode, node)
+			if !changed {
+				continue
+			}
+			topology.Nodes[id] = nodeDelta
+			if replaced {
+				delta.Replaced[name] = append(delta.Replaced[name], id)
+			}
+		}
+		for id := range baseTopology.Nodes {
+			if _, ok := currentTopology.Nodes[id]; !ok {
+				delta.Removed[name] = append(delta.Removed[name], id)
+			}
+		}
+		*delta.Report.topology(name) = topology
+	}
+	return delta
+}
+
+// diffNode returns what needs sending for base to become current, whether
+// anything changed at all, and whether the result must replace base
+// rather than be merged into it.
+func diffNode(base, current Node) (Node, bool, bool) {
+	latest, added := MakeStringLatestMap(), 0
+	for _, entry := range current.Latest {
+		value, ok := base.Latest.Lookup(entry.key)
+		if !ok {
+			added++
+		}
+		if !ok || value != entry.Value {
+			latest = append(latest, entry)
+		}
+	}
+	if len(current.Latest)-added < len(base.Latest) {
+		// Some keys have been removed, which can't be merged in.
+		return current, true, true
+	}
+
+	rest, baseRest := current, base
+	rest.Latest, baseRest.Latest = nil, nil
+	if len(latest) == 0 && reflect.DeepEqual(rest, baseRest) {
+		return Node{}, false, false
+	}
+	rest.Latest = latest
+	return rest, true, false
+}
+
+// Apply reconstructs the full report from the base report this delta was
+// computed against.
+func (d Delta) Apply(base Report) (Report, error) {
+	if d.Base != base.ID {
+		return Report{}, fmt.Errorf("delta is against report %q, not %q", d.Base, base.ID)
+	}
+	result := Report{
+		DNS:      d.Report.DNS,
+		Sampling: d.Report.Sampling,
+		Window:   d.Report.Window,
+		Shortcut: d.Report.Shortcut,
+		Plugins:  d.Report.Plugins,
+		ID:       d.Report.ID,
+	}
+	for _, name := range topologyNames {
+		baseTopology, deltaTopology := base.topology(name), d.Report.topology(name)
+		topology := *deltaTopology
+		topology.Nodes = baseTopology.Nodes.Copy()
+		if topology.Nodes == nil {
+			topology.Nodes = Nodes{}
+		}
+		for _, id := range d.Removed[name] {
+			delete(topology.Nodes, id)
+		}
+		replaced := map[string]struct{}{}
+		for _, id := range d.Replaced[name] {
+			replaced[id] = struct{}{}
+		}
+		for id, node := range deltaTopology.Nodes {
+			baseNode, ok := topology.Nodes[id]
+			if _, replace := replaced[id]; ok && !replace {
+				node.Latest = overlayLatest(baseNode.Latest, node.Latest)
+			}
+			topology.Nodes[id] = node
+		}
+		*result.topology(name) = topology
+	}
+	return result, nil
+}
+
+// overlayLatest returns the entries of both maps, preferring those in over
+// those in base regardless of their timestamps.
+func overlayLatest(base, over StringLatestMap) StringLatestMap {
+	result := make(StringLatestMap, 0, len(base)+len(over))
+	i, j := 0, 0
+	for i < len(base) && j < len(over) {
+		switch {
+		case base[i].key < over[j].key:
+			result = append(result, base[i])
+			i++
+		case base[i].key > over[j].key:
+			result = append(result, over[j])
+			j++
+		default:
+			result = append(result, over[j])
+			i++
+			j++
+		}
+	}
+	result = append(result, base[i:]...)
+	return append(result, over[j:]...)
+}
+
+// WriteBinary writes a Delta as a gzipped msgpack into a bytes.Buffer
+func (d Delta) WriteBinary() (*bytes.Buffer, error) {
+	w := &bytes.Buffer{}
+	gzwriter := gzipWriterPool.Get().(*gzip.Writer)
+	gzwriter.Reset(w)
+	defer gzipWriterPool.Put(gzwriter)
+	if err := codec.NewEncoder(gzwriter, &codec.MsgpackHandle{}).Encode(&d); err != nil {
+		return nil, err
+	}
+	gzwriter.Close() // otherwise the content won't get flushed to the output stream
+	return w, nil
+}
+
+// ReadBinary reads bytes into a Delta, decompressing them first if gzipped
+// is true.
+func (d *Delta) ReadBinary(r io.Reader, gzipped bool, codecHandle codec.Handle) error {
+	var err error
+	if gzipped {
+		r, err = gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+	}
+	return codec.NewDecoder(r, codecHandle).Decode(d)
+}
@@ -0,0 +1,88 @@
+package report_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+	"github.com/weaveworks/common/test"
+
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestDelta(t *testing.T) {
+	var (
+		t1 = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+		t2 = t1.Add(3 * time.Second)
+	)
+	base := report.MakeReport()
+	base.Container.AddNode(report.MakeNode("unchanged").WithLatests(map[string]string{"a": "1", "b": "2"}).WithLatest("c", t1, "3"))
+	base.Container.AddNode(report.MakeNode("changed").WithLatest("a", t1, "1").WithLatest("b", t1, "2"))
+	base.Container.AddNode(report.MakeNode("shrunk").WithLatest("a", t1, "1").WithLatest("b", t1, "2"))
+	base.Container.AddNode(report.MakeNode("removed").WithLatest("a", t1, "1"))
+	base.Process.AddNode(report.MakeNode("parented").WithLatest("a", t1, "1"))
+
+	current := report.MakeReport()
+	current.Container.AddNode(base.Container.Nodes["unchanged"])
+	// Timestamps move on even if values don't
+	current.Container.AddNode(report.MakeNode("changed").WithLatest("a", t2, "1").WithLatest("b", t2, "two"))
+	current.Container.AddNode(report.MakeNode("shrunk").WithLatest("a", t2, "1"))
+	current.Container.AddNode(report.MakeNode("added").WithLatest("a", t2, "1"))
+	current.Process.AddNode(base.Process.Nodes["parented"].WithParent(report.Container, "added"))
+
+	delta := report.MakeDelta(base, current)
+	if delta.Base != base.ID {
+		t.Errorf("Expected delta against %q, got %q", base.ID, delta.Base)
+	}
+	wantNodes := report.Nodes{
+		"changed": report.MakeNode("changed").WithLatest("b", t2, "two"),
+		"shrunk":  current.Container.Nodes["shrunk"],
+		"added":   current.Container.Nodes["added"],
+	}
+	if !reflect.DeepEqual(wantNodes, delta.Report.Container.Nodes) {
+		t.Error(test.Diff(wantNodes, delta.Report.Container.Nodes))
+	}
+	if want, have := []string{"shrunk"}, delta.Replaced[report.Container]; !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+	if want, have := []string{"removed"}, delta.Removed[report.Container]; !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+	parented := current.Process.Nodes["parented"]
+	parented.Latest = report.MakeStringLatestMap()
+	if want, have := (report.Nodes{"parented": parented}), delta.Report.Process.Nodes; !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	// Round-trip through the wire format, as the app would see it
+	buf, err := delta.WriteBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded report.Delta
+	if err := decoded.ReadBinary(buf, true, &codec.MsgpackHandle{}); err != nil {
+		t.Fatal(err)
+	}
+
+	have, err := decoded.Apply(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Values left out of the delta keep their base timestamps
+	want := current.Copy()
+	want.Container.Nodes["changed"] = want.Container.Nodes["changed"].WithLatest("a", t1, "1")
+	if have.ID != current.ID {
+		t.Errorf("Expected report %q, got %q", current.ID, have.ID)
+	}
+	if !reflect.DeepEqual(want.Container.Nodes, have.Container.Nodes) {
+		t.Error(test.Diff(want.Container.Nodes, have.Container.Nodes))
+	}
+	if !reflect.DeepEqual(want.Process.Nodes, have.Process.Nodes) {
+		t.Error(test.Diff(want.Process.Nodes, have.Process.Nodes))
+	}
+
+	if _, err := delta.Apply(current); err == nil {
+		t.Error("Expected applying a delta to the wrong base to fail")
+	}
+}
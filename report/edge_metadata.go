@@ -0,0 +1,253 @@
+package report
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/ugorji/go/codec"
+	"github.com/weaveworks/ps"
+)
+
+// EdgeMetadata describes a superset of the metadata that probes can
+// collect about a directed edge between two nodes in any topology.
+//
+// Byte and packet counts cover the period of the report they are in,
+// so they are summed when reports are merged. MaxConnCount is the
+// largest number of concurrent connections seen on the edge, so
+// merging reports covering the same edge keeps the maximum, whereas
+// aggregating distinct edges into one (see Flatten) sums them.
+//
+// Request and error rates and latency percentiles are derived from
+// trace spans, and describe application-layer calls over the edge.
+// Being rates rather than counts, merging keeps the most recently seen
+// values, whereas aggregating distinct edges sums the rates and keeps
+// the highest latencies.
+type EdgeMetadata struct {
+	EgressPacketCount  uint64    `json:"egress_packet_count,omitempty"`
+	IngressPacketCount uint64    `json:"ingress_packet_count,omitempty"`
+	EgressByteCount    uint64    `json:"egress_byte_count,omitempty"`  // Transport layer
+	IngressByteCount   uint64    `json:"ingress_byte_count,omitempty"` // Transport layer
+	MaxConnCount       uint64    `json:"max_conn_count,omitempty"`
+	FirstSeen          time.Time `json:"first_seen,omitempty"`
+	LastSeen           time.Time `json:"last_seen,omitempty"`
+
+	RequestRate float64       `json:"request_rate,omitempty"` // Requests per second
+	ErrorRate   float64       `json:"error_rate,omitempty"`   // Failed requests per second
+	LatencyP50  time.Duration `json:"latency_p50,omitempty"`
+	LatencyP95  time.Duration `json:"latency_p95,omitempty"`
+	LatencyP99  time.Duration `json:"latency_p99,omitempty"`
+}
+
+// Merge merges another EdgeMetadata describing the same edge into the
+// receiver, and returns the result. The original is not modified.
+func (e EdgeMetadata) Merge(other EdgeMetadata) EdgeMetadata {
+	if other.HasRequests() && (!e.HasRequests() || other.LastSeen.After(e.LastSeen)) {
+		e.RequestRate, e.ErrorRate = other.RequestRate, other.ErrorRate
+		e.LatencyP50, e.LatencyP95, e.LatencyP99 = other.LatencyP50, other.LatencyP95, other.LatencyP99
+	}
+	e = e.mergeCountsAndTimes(other)
+	if other.MaxConnCount > e.MaxConnCount {
+		e.MaxConnCount = other.MaxConnCount
+	}
+	return e
+}
+
+// Flatten sums two EdgeMetadatas of distinct edges, which are being
+// aggregated into a single edge, and returns the result. The original is
+// not modified.
+func (e EdgeMetadata) Flatten(other EdgeMetadata) EdgeMetadata {
+	e = e.mergeCountsAndTimes(other)
+	e.MaxConnCount += other.MaxConnCount
+	e.RequestRate += other.RequestRate
+	e.ErrorRate += other.ErrorRate
+	e.LatencyP50 = maxDuration(e.LatencyP50, other.LatencyP50)
+	e.LatencyP95 = maxDuration(e.LatencyP95, other.LatencyP95)
+	e.LatencyP99 = maxDuration(e.LatencyP99, other.LatencyP99)
+	return e
+}
+
+// HasRequests returns whether the edge has request rates or latencies.
+func (e EdgeMetadata) HasRequests() bool {
+	return e.RequestRate > 0 || e.LatencyP99 > 0
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if b > a {
+		return b
+	}
+	return a
+}
+
+func (e EdgeMetadata) mergeCountsAndTimes(other EdgeMetadata) EdgeMetadata {
+	e.EgressPacketCount += other.EgressPacketCount
+	e.IngressPacketCount += other.IngressPacketCount
+	e.EgressByteCount += other.EgressByteCount
+	e.IngressByteCount += other.IngressByteCount
+	if !other.FirstSeen.IsZero() && (e.FirstSeen.IsZero() || other.FirstSeen.Before(e.FirstSeen)) {
+		e.FirstSeen = other.FirstSeen
+	}
+	if other.LastSeen.After(e.LastSeen) {
+		e.LastSeen = other.LastSeen
+	}
+	return e
+}
+
+// Reversed returns the EdgeMetadata as seen from the other end of the
+// edge, i.e. with egress and ingress swapped.
+func (e EdgeMetadata) Reversed() EdgeMetadata {
+	e.EgressPacketCount, e.IngressPacketCount = e.IngressPacketCount, e.EgressPacketCount
+	e.EgressByteCount, e.IngressByteCount = e.IngressByteCount, e.EgressByteCount
+	return e
+}
+
+func (e EdgeMetadata) String() string {
+	return fmt.Sprintf("{egress: %d packets, %d bytes; ingress: %d packets, %d bytes; conns: %d; %s - %s}",
+		e.EgressPacketCount, e.EgressByteCount, e.IngressPacketCount, e.IngressByteCount,
+		e.MaxConnCount, e.FirstSeen.Format(time.RFC3339), e.LastSeen.Format(time.RFC3339))
+}
+
+// EdgeMetadatas collect metadata about each edge of a node. Keys are the
+// remote node IDs, as in Adjacency.
+// It is immutable.
+type EdgeMetadatas struct {
+	psMap ps.Map
+}
+
+var emptyEdgeMetadatas = EdgeMetadatas{ps.NewMap()}
+
+// MakeEdgeMetadatas returns EmptyEdgeMetadatas
+func MakeEdgeMetadatas() EdgeMetadatas {
+	return emptyEdgeMetadatas
+}
+
+// Add value to the edge metadata for 'key', merging with any existing
+// value.
+func (c EdgeMetadatas) Add(key string, value EdgeMetadata) EdgeMetadatas {
+	return c.add(key, value, EdgeMetadata.Merge)
+}
+
+// Flatten adds value to the edge metadata for 'key', summing it with any
+// existing value. Use it when aggregating distinct edges into one.
+func (c EdgeMetadatas) Flatten(key string, value EdgeMetadata) EdgeMetadatas {
+	return c.add(key, value, EdgeMetadata.Flatten)
+}
+
+func (c EdgeMetadatas) add(key string, value EdgeMetadata, merge func(EdgeMetadata, EdgeMetadata) EdgeMetadata) EdgeMetadatas {
+	if c.psMap == nil {
+		c = emptyEdgeMetadatas
+	}
+	if existingValue, ok := c.psMap.Lookup(key); ok {
+		value = merge(existingValue.(EdgeMetadata), value)
+	}
+	return EdgeMetadatas{
+		c.psMap.Set(key, value),
+	}
+}
+
+// Delete the edge metadata for 'key'.
+func (c EdgeMetadatas) Delete(key string) EdgeMetadatas {
+	if c.psMap == nil {
+		return emptyEdgeMetadatas
+	}
+	psMap := c.psMap.Delete(key)
+	if psMap.IsNil() {
+		return emptyEdgeMetadatas
+	}
+	return EdgeMetadatas{psMap}
+}
+
+// Lookup the edge metadata for 'key'
+func (c EdgeMetadatas) Lookup(key string) (EdgeMetadata, bool) {
+	if c.psMap != nil {
+		existingValue, ok := c.psMap.Lookup(key)
+		if ok {
+			return existingValue.(EdgeMetadata), true
+		}
+	}
+	return EdgeMetadata{}, false
+}
+
+// Size returns the number of elements
+func (c EdgeMetadatas) Size() int {
+	if c.psMap == nil {
+		return 0
+	}
+	return c.psMap.Size()
+}
+
+// Merge produces a fresh EdgeMetadatas, containing the keys from both
+// inputs. When both inputs contain the same key, the values are merged
+// with EdgeMetadata.Merge.
+func (c EdgeMetadatas) Merge(other EdgeMetadatas) EdgeMetadatas {
+	var (
+		cSize     = c.Size()
+		otherSize = other.Size()
+		output    = c.psMap
+		iter      = other.psMap
+	)
+	switch {
+	case cSize == 0:
+		return other
+	case otherSize == 0:
+		return c
+	case cSize < otherSize:
+		output, iter = iter, output
+	}
+	iter.ForEach(func(key string, otherVal interface{}) {
+		if val, ok := output.Lookup(key); ok {
+			output = output.Set(key, otherVal.(EdgeMetadata).Merge(val.(EdgeMetadata)))
+		} else {
+			output = output.Set(key, otherVal)
+		}
+	})
+	return EdgeMetadatas{output}
+}
+
+// ForEach executes f on each key value pair in the map
+func (c EdgeMetadatas) ForEach(fn func(k string, _ EdgeMetadata)) {
+	if c.psMap != nil {
+		c.psMap.ForEach(func(key string, value interface{}) {
+			fn(key, value.(EdgeMetadata))
+		})
+	}
+}
+
+func (c EdgeMetadatas) String() string {
+	return mapToString(c.psMap)
+}
+
+// DeepEqual tests equality with other EdgeMetadatas
+func (c EdgeMetadatas) DeepEqual(d EdgeMetadatas) bool {
+	return mapEqual(c.psMap, d.psMap, reflect.DeepEqual)
+}
+
+// CodecEncodeSelf implements codec.Selfer
+func (c *EdgeMetadatas) CodecEncodeSelf(encoder *codec.Encoder) {
+	mapWrite(c.psMap, encoder, func(encoder *codec.Encoder, val interface{}) {
+		e := val.(EdgeMetadata)
+		encoder.Encode(&e)
+	})
+}
+
+// CodecDecodeSelf implements codec.Selfer
+func (c *EdgeMetadatas) CodecDecodeSelf(decoder *codec.Decoder) {
+	out := mapRead(decoder, func(isNil bool) interface{} {
+		var value EdgeMetadata
+		if !isNil {
+			decoder.Decode(&value)
+		}
+		return value
+	})
+	*c = EdgeMetadatas{out}
+}
+
+// MarshalJSON shouldn't be used, use CodecEncodeSelf instead
+func (EdgeMetadatas) MarshalJSON() ([]byte, error) {
+	panic("MarshalJSON shouldn't be used, use CodecEncodeSelf instead")
+}
+
+// UnmarshalJSON shouldn't be used, use CodecDecodeSelf instead
+func (*EdgeMetadatas) UnmarshalJSON(b []byte) error {
+	panic("UnmarshalJSON shouldn't be used, use CodecDecodeSelf instead")
+}
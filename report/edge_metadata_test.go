@@ -0,0 +1,95 @@
+package report_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/common/test"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestEdgeMetadataMerge(t *testing.T) {
+	var (
+		t1 = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+		t2 = t1.Add(time.Minute)
+		t3 = t2.Add(time.Minute)
+	)
+	for name, c := range map[string]struct {
+		a, b, merged, flattened report.EdgeMetadata
+	}{
+		"Empty": {
+			a:         report.EdgeMetadata{},
+			b:         report.EdgeMetadata{},
+			merged:    report.EdgeMetadata{},
+			flattened: report.EdgeMetadata{},
+		},
+		"Counts": {
+			a:         report.EdgeMetadata{EgressPacketCount: 1, EgressByteCount: 10, MaxConnCount: 2},
+			b:         report.EdgeMetadata{EgressPacketCount: 2, IngressByteCount: 20, MaxConnCount: 1},
+			merged:    report.EdgeMetadata{EgressPacketCount: 3, EgressByteCount: 10, IngressByteCount: 20, MaxConnCount: 2},
+			flattened: report.EdgeMetadata{EgressPacketCount: 3, EgressByteCount: 10, IngressByteCount: 20, MaxConnCount: 3},
+		},
+		"Times": {
+			a:         report.EdgeMetadata{FirstSeen: t2, LastSeen: t2},
+			b:         report.EdgeMetadata{FirstSeen: t1, LastSeen: t3},
+			merged:    report.EdgeMetadata{FirstSeen: t1, LastSeen: t3},
+			flattened: report.EdgeMetadata{FirstSeen: t1, LastSeen: t3},
+		},
+		"Unknown first seen": {
+			a:         report.EdgeMetadata{LastSeen: t3},
+			b:         report.EdgeMetadata{FirstSeen: t2, LastSeen: t2},
+			merged:    report.EdgeMetadata{FirstSeen: t2, LastSeen: t3},
+			flattened: report.EdgeMetadata{FirstSeen: t2, LastSeen: t3},
+		},
+		"Requests": {
+			a:         report.EdgeMetadata{RequestRate: 2, ErrorRate: 1, LatencyP50: 10 * time.Millisecond, LatencyP99: 30 * time.Millisecond, LastSeen: t2},
+			b:         report.EdgeMetadata{RequestRate: 4, LatencyP50: 5 * time.Millisecond, LatencyP99: 50 * time.Millisecond, LastSeen: t3},
+			merged:    report.EdgeMetadata{RequestRate: 4, LatencyP50: 5 * time.Millisecond, LatencyP99: 50 * time.Millisecond, LastSeen: t3},
+			flattened: report.EdgeMetadata{RequestRate: 6, ErrorRate: 1, LatencyP50: 10 * time.Millisecond, LatencyP99: 50 * time.Millisecond, LastSeen: t3},
+		},
+	} {
+		if have := c.a.Merge(c.b); !reflect.DeepEqual(c.merged, have) {
+			t.Errorf("%s: merge: %s", name, test.Diff(c.merged, have))
+		}
+		if have := c.b.Merge(c.a); !reflect.DeepEqual(c.merged, have) {
+			t.Errorf("%s: reverse merge: %s", name, test.Diff(c.merged, have))
+		}
+		if have := c.a.Flatten(c.b); !reflect.DeepEqual(c.flattened, have) {
+			t.Errorf("%s: flatten: %s", name, test.Diff(c.flattened, have))
+		}
+	}
+}
+
+func TestEdgeMetadatasMerge(t *testing.T) {
+	var (
+		a = report.MakeEdgeMetadatas().
+			Add("foo", report.EdgeMetadata{EgressByteCount: 1, MaxConnCount: 1})
+		b = report.MakeEdgeMetadatas().
+			Add("foo", report.EdgeMetadata{EgressByteCount: 2, MaxConnCount: 1}).
+			Add("bar", report.EdgeMetadata{IngressByteCount: 3})
+		want = report.MakeEdgeMetadatas().
+			Add("foo", report.EdgeMetadata{EgressByteCount: 3, MaxConnCount: 1}).
+			Add("bar", report.EdgeMetadata{IngressByteCount: 3})
+	)
+	if have := a.Merge(b); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+	if have := (report.EdgeMetadatas{}).Merge(a); !reflect.DeepEqual(a, have) {
+		t.Error(test.Diff(a, have))
+	}
+	if have := a.Delete("foo"); have.Size() != 0 {
+		t.Errorf("expected no edges after delete, got %v", have)
+	}
+}
+
+func TestWithEdge(t *testing.T) {
+	md := report.EdgeMetadata{EgressPacketCount: 1}
+	node := report.MakeNode("foo").WithEdge("bar", md).WithEdge("bar", md)
+	if !node.Adjacency.Contains("bar") {
+		t.Errorf("expected bar in adjacency, got %v", node.Adjacency)
+	}
+	if have, ok := node.Edges.Lookup("bar"); !ok || have.EgressPacketCount != 2 {
+		t.Errorf("expected 2 egress packets, got %v", have)
+	}
+}
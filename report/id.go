@@ -25,6 +25,10 @@ const (
 
 	// DockerOverlayPeerPrefix is the prefix for docker peers in the overlay network
 	DockerOverlayPeerPrefix = "docker_peer_"
+
+	// UDPPortSuffix follows the port in the IDs of UDP endpoints, so they
+	// don't merge with the TCP endpoints of the same address and port.
+	UDPPortSuffix = "/udp"
 )
 
 // MakeEndpointNodeID produces an endpoint node ID from its composite parts.
@@ -32,6 +36,11 @@ func MakeEndpointNodeID(hostID, namespaceID, address, port string) string {
 	return makeAddressID(hostID, namespaceID, address) + ScopeDelim + port
 }
 
+// MakeUDPEndpointNodeID is like MakeEndpointNodeID, for UDP endpoints.
+func MakeUDPEndpointNodeID(hostID, namespaceID, address, port string) string {
+	return MakeEndpointNodeID(hostID, namespaceID, address, port+UDPPortSuffix)
+}
+
 // MakeAddressNodeID produces an address node ID from its composite parts.
 func MakeAddressNodeID(hostID, address string) string {
 	return makeAddressID(hostID, "", address)
@@ -146,6 +155,24 @@ var (
 	// ParseJobNodeID parses a job node ID
 	ParseJobNodeID = parseSingleComponentID("job")
 
+	// MakeIngressNodeID produces an ingress node ID from its composite parts.
+	MakeIngressNodeID = makeSingleComponentID("ingress")
+
+	// ParseIngressNodeID parses an ingress node ID
+	ParseIngressNodeID = parseSingleComponentID("ingress")
+
+	// MakeNetworkPolicyNodeID produces a network policy node ID from its composite parts.
+	MakeNetworkPolicyNodeID = makeSingleComponentID("network_policy")
+
+	// ParseNetworkPolicyNodeID parses a network policy node ID
+	ParseNetworkPolicyNodeID = parseSingleComponentID("network_policy")
+
+	// MakeHorizontalPodAutoscalerNodeID produces a horizontal pod autoscaler node ID from its composite parts.
+	MakeHorizontalPodAutoscalerNodeID = makeSingleComponentID("horizontal_pod_autoscaler")
+
+	// ParseHorizontalPodAutoscalerNodeID parses a horizontal pod autoscaler node ID
+	ParseHorizontalPodAutoscalerNodeID = parseSingleComponentID("horizontal_pod_autoscaler")
+
 	// MakeNamespaceNodeID produces a namespace node ID from its composite parts.
 	MakeNamespaceNodeID = makeSingleComponentID("namespace")
 
@@ -252,7 +279,8 @@ func ParseNodeID(nodeID string) (id string, tag string, ok bool) {
 }
 
 // ParseEndpointNodeID produces the scope, address, and port and remainder.
-// Note that scope may be blank.
+// Note that scope may be blank. The port of UDP endpoints is returned
+// without UDPPortSuffix.
 func ParseEndpointNodeID(endpointNodeID string) (scope, address, port string, ok bool) {
 	// Not using strings.SplitN() to avoid a heap allocation
 	first := strings.Index(endpointNodeID, ScopeDelim)
@@ -263,7 +291,14 @@ func ParseEndpointNodeID(endpointNodeID string) (scope, address, port string, ok
 	if second == -1 {
 		return "", "", "", false
 	}
-	return endpointNodeID[:first], endpointNodeID[first+1 : first+1+second], endpointNodeID[first+1+second+1:], true
+	port = strings.TrimSuffix(endpointNodeID[first+1+second+1:], UDPPortSuffix)
+	return endpointNodeID[:first], endpointNodeID[first+1 : first+1+second], port, true
+}
+
+// IsUDPEndpointNodeID says whether an endpoint node ID is of a UDP
+// endpoint.
+func IsUDPEndpointNodeID(endpointNodeID string) bool {
+	return strings.HasSuffix(endpointNodeID, UDPPortSuffix)
 }
 
 // ParseAddressNodeID produces the host ID, address from an address node ID.
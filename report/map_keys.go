@@ -6,6 +6,9 @@ const (
 	ReverseDNSNames = "reverse_dns_names"
 	SnoopedDNSNames = "snooped_dns_names"
 	CopyOf          = "copy_of"
+	Protocol        = "protocol"
+	// probe/traces
+	TraceService = "trace_service"
 	// probe/process
 	PID     = "pid"
 	Name    = "name" // also used by probe/docker
@@ -43,7 +46,15 @@ const (
 	DockerContainerUptime        = "docker_container_uptime"
 	DockerContainerRestartCount  = "docker_container_restart_count"
 	DockerContainerNetworkMode   = "docker_container_network_mode"
+	DockerContainerExitCode      = "docker_container_exit_code"
+	DockerContainerOOMKilled     = "docker_container_oom_killed"
+	DockerContainerHealth        = "docker_container_health"
 	DockerEnvPrefix              = "docker_env_"
+	// probe/cri
+	CRIStopContainer   = "cri_stop_container"
+	CRIRemoveContainer = "cri_remove_container"
+	CRIAttachContainer = "cri_attach_container"
+	CRIExecContainer   = "cri_exec_container"
 	// probe/kubernetes
 	KubernetesName                 = "kubernetes_name"
 	KubernetesNamespace            = "kubernetes_namespace"
@@ -89,6 +100,25 @@ const (
 	KubernetesCloneVolumeSnapshot  = "kubernetes_clone_volume_snapshot"
 	KubernetesDeleteVolumeSnapshot = "kubernetes_delete_volume_snapshot"
 	KubernetesDescribe             = "kubernetes_describe"
+	KubernetesIngressHosts         = "kubernetes_ingress_hosts"
+	KubernetesIngressBackends      = "kubernetes_ingress_backends"
+	KubernetesPolicyTypes          = "kubernetes_policy_types"
+	KubernetesPodSelector          = "kubernetes_pod_selector"
+	KubernetesScaleTarget          = "kubernetes_scale_target"
+	KubernetesMinReplicas          = "kubernetes_min_replicas"
+	KubernetesMaxReplicas          = "kubernetes_max_replicas"
+	KubernetesCurrentReplicas      = "kubernetes_current_replicas"
+	KubernetesTargetCPUUtilization = "kubernetes_target_cpu_utilization"
+	KubernetesKubeletVersion       = "kubernetes_kubelet_version"
+	KubernetesUnschedulable        = "kubernetes_unschedulable"
+	KubernetesTaints               = "kubernetes_taints"
+	KubernetesAllocatableCPU       = "kubernetes_allocatable_cpu"
+	KubernetesAllocatableMemory    = "kubernetes_allocatable_memory"
+	KubernetesRequestedCPU         = "kubernetes_requested_cpu"
+	KubernetesRequestedMemory      = "kubernetes_requested_memory"
+	KubernetesCordonNode           = "kubernetes_cordon_node"
+	KubernetesUncordonNode         = "kubernetes_uncordon_node"
+	KubernetesDrainNode            = "kubernetes_drain_node"
 	// probe/awsecs
 	ECSCluster             = "ecs_cluster"
 	ECSCreatedAt           = "ecs_created_at"
@@ -105,27 +135,30 @@ const (
    getting clogged with values that are only used once.
 */
 var commonKeys = map[string]string{
-	Endpoint:              Endpoint,
-	Process:               Process,
-	Container:             Container,
-	Pod:                   Pod,
-	Service:               Service,
-	Deployment:            Deployment,
-	ReplicaSet:            ReplicaSet,
-	DaemonSet:             DaemonSet,
-	StatefulSet:           StatefulSet,
-	CronJob:               CronJob,
-	ContainerImage:        ContainerImage,
-	Host:                  Host,
-	Overlay:               Overlay,
-	ECSService:            ECSService,
-	ECSTask:               ECSTask,
-	SwarmService:          SwarmService,
-	PersistentVolume:      PersistentVolume,
-	PersistentVolumeClaim: PersistentVolumeClaim,
-	StorageClass:          StorageClass,
-	VolumeSnapshot:        VolumeSnapshot,
-	VolumeSnapshotData:    VolumeSnapshotData,
+	Endpoint:                Endpoint,
+	Process:                 Process,
+	Container:               Container,
+	Pod:                     Pod,
+	Service:                 Service,
+	Deployment:              Deployment,
+	ReplicaSet:              ReplicaSet,
+	DaemonSet:               DaemonSet,
+	StatefulSet:             StatefulSet,
+	CronJob:                 CronJob,
+	ContainerImage:          ContainerImage,
+	Host:                    Host,
+	Overlay:                 Overlay,
+	ECSService:              ECSService,
+	ECSTask:                 ECSTask,
+	SwarmService:            SwarmService,
+	PersistentVolume:        PersistentVolume,
+	PersistentVolumeClaim:   PersistentVolumeClaim,
+	StorageClass:            StorageClass,
+	VolumeSnapshot:          VolumeSnapshot,
+	VolumeSnapshotData:      VolumeSnapshotData,
+	Ingress:                 Ingress,
+	NetworkPolicy:           NetworkPolicy,
+	HorizontalPodAutoscaler: HorizontalPodAutoscaler,
 
 	HostNodeID:             HostNodeID,
 	ControlProbeID:         ControlProbeID,
@@ -134,6 +167,9 @@ var commonKeys = map[string]string{
 	ReverseDNSNames: ReverseDNSNames,
 	SnoopedDNSNames: SnoopedDNSNames,
 	CopyOf:          CopyOf,
+	Protocol:        Protocol,
+
+	TraceService: TraceService,
 
 	PID:     PID,
 	Name:    Name,
@@ -171,6 +207,14 @@ var commonKeys = map[string]string{
 	DockerContainerUptime:        DockerContainerUptime,
 	DockerContainerRestartCount:  DockerContainerRestartCount,
 	DockerContainerNetworkMode:   DockerContainerNetworkMode,
+	DockerContainerExitCode:      DockerContainerExitCode,
+	DockerContainerOOMKilled:     DockerContainerOOMKilled,
+	DockerContainerHealth:        DockerContainerHealth,
+
+	CRIStopContainer:   CRIStopContainer,
+	CRIRemoveContainer: CRIRemoveContainer,
+	CRIAttachContainer: CRIAttachContainer,
+	CRIExecContainer:   CRIExecContainer,
 
 	KubernetesName:                 KubernetesName,
 	KubernetesNamespace:            KubernetesNamespace,
@@ -1,7 +1,7 @@
 package report
 
 import (
-	"encoding/binary"
+	"math/bits"
 	"net"
 	"strings"
 
@@ -59,7 +59,7 @@ func LocalAddresses() ([]net.IP, error) {
 			return []net.IP{}, err
 		}
 
-		for _, ipnet := range ipv4Nets(addrs) {
+		for _, ipnet := range ipNets(addrs) {
 			result = append(result, ipnet.IP)
 		}
 	}
@@ -81,7 +81,7 @@ func AddLocalBridge(name string) error {
 		return err
 	}
 
-	for _, ipnet := range ipv4Nets(addrs) {
+	for _, ipnet := range ipNets(addrs) {
 		LocalNetworks.Add(ipnet)
 	}
 
@@ -94,13 +94,15 @@ func GetLocalNetworks() ([]*net.IPNet, error) {
 	if err != nil {
 		return nil, err
 	}
-	return ipv4Nets(addrs), nil
+	return ipNets(addrs), nil
 }
 
-func ipv4Nets(addrs []net.Addr) []*net.IPNet {
+func ipNets(addrs []net.Addr) []*net.IPNet {
 	nets := []*net.IPNet{}
 	for _, addr := range addrs {
-		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+		// IPv6 link-local addresses are on every interface, and not
+		// unique across hosts.
+		if ipnet, ok := addr.(*net.IPNet); ok && (ipnet.IP.To4() != nil || !ipnet.IP.IsLinkLocalUnicast()) {
 			nets = append(nets, ipnet)
 		}
 	}
@@ -111,32 +113,59 @@ func ipv4Nets(addrs []net.Addr) []*net.IPNet {
 // the given IPv4 addresses. When no addresses are specified, nil is
 // returned.
 func ContainingIPv4Network(ips []net.IP) *net.IPNet {
+	return containingNetwork(ips, net.IPv4len)
+}
+
+// ContainingNetworks determines the smallest networks containing the
+// given addresses, one per address family present: at most an IPv4
+// network followed by an IPv6 one.
+func ContainingNetworks(ips []net.IP) []*net.IPNet {
+	var ipv4s, ipv6s []net.IP
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			ipv4s = append(ipv4s, ip4)
+		} else if ip6 := ip.To16(); ip6 != nil {
+			ipv6s = append(ipv6s, ip6)
+		}
+	}
+	networks := []*net.IPNet{}
+	for _, network := range []*net.IPNet{containingNetwork(ipv4s, net.IPv4len), containingNetwork(ipv6s, net.IPv6len)} {
+		if network != nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+// containingNetwork determines the smallest network containing the given
+// addresses, all of which are size bytes long.
+func containingNetwork(ips []net.IP, size int) *net.IPNet {
 	if len(ips) == 0 {
 		return nil
 	}
-	cpl := net.IPv4len * 8
-	network := networkFromPrefix(ips[0], cpl)
+	cpl := size * 8
+	network := networkFromPrefix(ips[0], cpl, size)
 	for _, ip := range ips[1:] {
-		if ncpl := commonIPv4PrefixLen(network.IP, ip); ncpl < cpl {
+		if ncpl := commonPrefixLen(network.IP, ip); ncpl < cpl {
 			cpl = ncpl
-			network = networkFromPrefix(network.IP, cpl)
+			network = networkFromPrefix(network.IP, cpl, size)
 		}
 	}
 	return network
 }
 
-func networkFromPrefix(ip net.IP, prefixLen int) *net.IPNet {
-	mask := net.CIDRMask(prefixLen, net.IPv4len*8)
+func networkFromPrefix(ip net.IP, prefixLen, size int) *net.IPNet {
+	mask := net.CIDRMask(prefixLen, size*8)
 	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
 }
 
-func commonIPv4PrefixLen(a, b net.IP) int {
-	x := binary.BigEndian.Uint32(a)
-	y := binary.BigEndian.Uint32(b)
-	cpl := 32
-	for ; x != y; cpl-- {
-		x >>= 1
-		y >>= 1
+func commonPrefixLen(a, b net.IP) int {
+	cpl := 0
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if x := a[i] ^ b[i]; x != 0 {
+			return cpl + bits.LeadingZeros8(x)
+		}
+		cpl += 8
 	}
 	return cpl
 }
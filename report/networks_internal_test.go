@@ -0,0 +1,28 @@
+package report
+
+import (
+	"net"
+	"testing"
+
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+func TestIPNets(t *testing.T) {
+	var addrs []net.Addr
+	for _, cidr := range []string{"10.0.0.1/8", "169.254.0.1/16", "fd00::1/64", "fe80::1/64"} {
+		ip, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipnet.IP = ip
+		addrs = append(addrs, ipnet)
+	}
+	have := []string{}
+	for _, ipnet := range ipNets(addrs) {
+		have = append(have, ipnet.String())
+	}
+	want := []string{"10.0.0.1/8", "169.254.0.1/16", "fd00::1/64"}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
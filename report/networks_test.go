@@ -33,6 +33,40 @@ func TestContainingIPv4Network(t *testing.T) {
 	assert.Equal(t, "0.0.0.0/0", containingIPv4Networks([]string{"10.0.0.1", "192.168.0.1"}).String())
 }
 
+func TestContainingNetworks(t *testing.T) {
+	assert.Empty(t, containingNetworks([]string{}))
+	assert.Equal(t, []string{"10.0.0.0/16"}, containingNetworks([]string{"10.0.128.1", "10.0.0.1"}))
+	assert.Equal(t, []string{"fd00:10:96::1/128"}, containingNetworks([]string{"fd00:10:96::1"}))
+	assert.Equal(t, []string{"fd00:10:96::/112"}, containingNetworks([]string{"fd00:10:96::1", "fd00:10:96::ff01"}))
+	assert.Equal(t, []string{"10.96.0.0/24", "fd00:10:96::/120"}, containingNetworks([]string{"fd00:10:96::1", "10.96.0.1", "10.96.0.200", "fd00:10:96::a0"}))
+	// IPv4-mapped IPv6 addresses count as IPv4
+	assert.Equal(t, []string{"10.96.0.0/30"}, containingNetworks([]string{"::ffff:10.96.0.1", "10.96.0.2"}))
+}
+
+func TestContainsIPv6(t *testing.T) {
+	networks := report.MakeNetworks()
+	for _, cidr := range []string{"10.0.0.1/8", "fd00::1/64"} {
+		if err := networks.AddCIDR(cidr); err != nil {
+			panic(err)
+		}
+	}
+	assert.True(t, networks.Contains(net.ParseIP("fd00::42")))
+	assert.False(t, networks.Contains(net.ParseIP("2001:db8::1")))
+	assert.True(t, networks.Contains(net.ParseIP("::ffff:10.1.2.3")))
+}
+
+func containingNetworks(ipstrings []string) []string {
+	ips := make([]net.IP, len(ipstrings))
+	for i, ip := range ipstrings {
+		ips[i] = net.ParseIP(ip)
+	}
+	result := []string{}
+	for _, network := range report.ContainingNetworks(ips) {
+		result = append(result, network.String())
+	}
+	return result
+}
+
 func containingIPv4Networks(ipstrings []string) *net.IPNet {
 	ips := make([]net.IP, len(ipstrings))
 	for i, ip := range ipstrings {
@@ -15,6 +15,7 @@ type Node struct {
 	Counters       Counters                 `json:"counters,omitempty"`
 	Sets           Sets                     `json:"sets,omitempty"`
 	Adjacency      IDList                   `json:"adjacency,omitempty"`
+	Edges          EdgeMetadatas            `json:"edges,omitempty"`
 	LatestControls NodeControlDataLatestMap `json:"latestControls,omitempty"`
 	Latest         StringLatestMap          `json:"latest,omitempty"`
 	Metrics        Metrics                  `json:"metrics,omitempty" deepequal:"nil==empty"`
@@ -29,6 +30,7 @@ func MakeNode(id string) Node {
 		Counters:       MakeCounters(),
 		Sets:           MakeSets(),
 		Adjacency:      MakeIDList(),
+		Edges:          MakeEdgeMetadatas(),
 		LatestControls: MakeNodeControlDataLatestMap(),
 		Latest:         MakeStringLatestMap(),
 		Metrics:        Metrics{},
@@ -118,6 +120,14 @@ func (n Node) WithAdjacent(a ...string) Node {
 	return n
 }
 
+// WithEdge returns a fresh copy of n, with 'dst' added to Adjacency and md
+// merged into the metadata of that edge.
+func (n Node) WithEdge(dst string, md EdgeMetadata) Node {
+	n.Adjacency = n.Adjacency.Add(dst)
+	n.Edges = n.Edges.Add(dst, md)
+	return n
+}
+
 // WithLatestActiveControls returns a fresh copy of n, with active controls cs added to LatestControls.
 func (n Node) WithLatestActiveControls(cs ...string) Node {
 	lcs := map[string]NodeControlData{}
@@ -191,6 +201,7 @@ func (n Node) Merge(other Node) Node {
 		Counters:       n.Counters.Merge(other.Counters),
 		Sets:           n.Sets.Merge(other.Sets),
 		Adjacency:      n.Adjacency.Merge(other.Adjacency),
+		Edges:          n.Edges.Merge(other.Edges),
 		LatestControls: n.LatestControls.Merge(other.LatestControls),
 		Latest:         n.Latest.Merge(other.Latest),
 		Metrics:        n.Metrics.Merge(other.Metrics),
@@ -11,29 +11,32 @@ import (
 
 // Names of the various topologies.
 const (
-	Endpoint              = "endpoint"
-	Process               = "process"
-	Container             = "container"
-	Pod                   = "pod"
-	Service               = "service"
-	Deployment            = "deployment"
-	ReplicaSet            = "replica_set"
-	DaemonSet             = "daemon_set"
-	StatefulSet           = "stateful_set"
-	CronJob               = "cron_job"
-	Namespace             = "namespace"
-	ContainerImage        = "container_image"
-	Host                  = "host"
-	Overlay               = "overlay"
-	ECSService            = "ecs_service"
-	ECSTask               = "ecs_task"
-	SwarmService          = "swarm_service"
-	PersistentVolume      = "persistent_volume"
-	PersistentVolumeClaim = "persistent_volume_claim"
-	StorageClass          = "storage_class"
-	VolumeSnapshot        = "volume_snapshot"
-	VolumeSnapshotData    = "volume_snapshot_data"
-	Job                   = "job"
+	Endpoint                = "endpoint"
+	Process                 = "process"
+	Container               = "container"
+	Pod                     = "pod"
+	Service                 = "service"
+	Deployment              = "deployment"
+	ReplicaSet              = "replica_set"
+	DaemonSet               = "daemon_set"
+	StatefulSet             = "stateful_set"
+	CronJob                 = "cron_job"
+	Namespace               = "namespace"
+	ContainerImage          = "container_image"
+	Host                    = "host"
+	Overlay                 = "overlay"
+	ECSService              = "ecs_service"
+	ECSTask                 = "ecs_task"
+	SwarmService            = "swarm_service"
+	PersistentVolume        = "persistent_volume"
+	PersistentVolumeClaim   = "persistent_volume_claim"
+	StorageClass            = "storage_class"
+	VolumeSnapshot          = "volume_snapshot"
+	VolumeSnapshotData      = "volume_snapshot_data"
+	Job                     = "job"
+	Ingress                 = "ingress"
+	NetworkPolicy           = "network_policy"
+	HorizontalPodAutoscaler = "horizontal_pod_autoscaler"
 
 	// Shapes used for different nodes
 	Circle         = "circle"
@@ -79,6 +82,9 @@ var topologyNames = []string{
 	VolumeSnapshot,
 	VolumeSnapshotData,
 	Job,
+	Ingress,
+	NetworkPolicy,
+	HorizontalPodAutoscaler,
 }
 
 // Report is the core data type. It's produced by probes, and consumed and
@@ -188,6 +194,18 @@ type Report struct {
 	// Job represent all Kubernetes Job on hosts running probes.
 	Job Topology
 
+	// Ingress nodes represent all Kubernetes Ingresses. Edges to the
+	// Services they route to are present.
+	Ingress Topology
+
+	// NetworkPolicy nodes represent all Kubernetes NetworkPolicies. They
+	// are parents of the Pods their selector matches. Edges are not present.
+	NetworkPolicy Topology
+
+	// HorizontalPodAutoscaler nodes represent all Kubernetes
+	// HorizontalPodAutoscalers. Edges to their scale target are present.
+	HorizontalPodAutoscaler Topology
+
 	DNS DNSRecords
 
 	// Sampling data for this report.
@@ -307,6 +325,18 @@ func MakeReport() Report {
 			WithShape(DottedTriangle).
 			WithLabel("job", "jobs"),
 
+		Ingress: MakeTopology().
+			WithShape(Pentagon).
+			WithLabel("ingress", "ingresses"),
+
+		NetworkPolicy: MakeTopology().
+			WithShape(Square).
+			WithLabel("network policy", "network policies"),
+
+		HorizontalPodAutoscaler: MakeTopology().
+			WithShape(Triangle).
+			WithLabel("autoscaler", "autoscalers"),
+
 		DNS: DNSRecords{},
 
 		Sampling: Sampling{},
@@ -425,6 +455,12 @@ func (r *Report) topology(name string) *Topology {
 		return &r.VolumeSnapshotData
 	case Job:
 		return &r.Job
+	case Ingress:
+		return &r.Ingress
+	case NetworkPolicy:
+		return &r.NetworkPolicy
+	case HorizontalPodAutoscaler:
+		return &r.HorizontalPodAutoscaler
 	}
 	return nil
 }
@@ -266,6 +266,13 @@ func (t Topology) Validate() error {
 				errs = append(errs, fmt.Sprintf("node missing from adjacency %q -> %q", nodeID, dstNodeID))
 			}
 		}
+
+		// Check all edge metadata keys are in the adjacency list.
+		nmd.Edges.ForEach(func(dstNodeID string, _ EdgeMetadata) {
+			if !nmd.Adjacency.Contains(dstNodeID) {
+				errs = append(errs, fmt.Sprintf("edge metadata without adjacency %q -> %q", nodeID, dstNodeID))
+			}
+		})
 	}
 
 	if len(errs) > 0 {